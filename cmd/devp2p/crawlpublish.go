@@ -0,0 +1,380 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	crawlPublishCommand = cli.Command{
+		Name:      "crawl-and-publish",
+		Usage:     "Crawls the network and publishes per-network DNS discovery trees",
+		ArgsUsage: "<nodes.json> <key-file>",
+		Action:    crawlPublish,
+		Flags: []cli.Flag{
+			bootnodesFlag,
+			crawlTimeoutFlag,
+			noCrawlFlag,
+			publishDomainFlag,
+			publishNetworksFlag,
+			publishClientsFlag,
+			publishMinAgeFlag,
+			publishMinScoreFlag,
+			publishSeenWithinFlag,
+			publishTreeDirFlag,
+			publishProviderFlag,
+			cloudflareTokenFlag,
+			cloudflareZoneIDFlag,
+		},
+	}
+)
+
+var (
+	noCrawlFlag = cli.BoolFlag{
+		Name:  "no-crawl",
+		Usage: "Publish the node set without crawling first",
+	}
+	publishDomainFlag = cli.StringFlag{
+		Name:  "domain",
+		Usage: "Domain under which the trees are published",
+	}
+	publishNetworksFlag = cli.StringFlag{
+		Name:  "networks",
+		Usage: "Comma separated networks to publish trees for (mainnet, rinkeby, goerli, ropsten)",
+		Value: "mainnet",
+	}
+	publishClientsFlag = cli.StringFlag{
+		Name:  "clients",
+		Usage: "Comma separated client types to publish trees for (all, les)",
+		Value: "all",
+	}
+	publishMinAgeFlag = cli.DurationFlag{
+		Name:  "min-age",
+		Usage: "Minimum time between first and last response of published nodes",
+	}
+	publishMinScoreFlag = cli.IntFlag{
+		Name:  "min-score",
+		Usage: "Minimum liveness score of published nodes",
+	}
+	publishSeenWithinFlag = cli.DurationFlag{
+		Name:  "seen-within",
+		Usage: "Only publish nodes which responded within this time",
+	}
+	publishTreeDirFlag = cli.StringFlag{
+		Name:  "tree-dir",
+		Usage: "Directory holding the tree definitions",
+		Value: ".",
+	}
+	publishProviderFlag = cli.StringFlag{
+		Name:  "provider",
+		Usage: "DNS provider to deploy the trees to (cloudflare), if not set trees are only written to disk",
+	}
+)
+
+// errEmptyTree is returned by treePublisher.publish when no nodes match the tree filter.
+var errEmptyTree = errors.New("no nodes match the filters")
+
+// Client types which can be selected using --clients.
+var publishClientFilters = map[string][]string{
+	"all": nil,
+	"les": {"-les-server"},
+}
+
+func crawlPublish(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return fmt.Errorf("need nodes file and key file as arguments")
+	}
+	var (
+		nodesFile = ctx.Args().Get(0)
+		keyfile   = ctx.Args().Get(1)
+		domain    = ctx.String(publishDomainFlag.Name)
+	)
+	if domain == "" {
+		return fmt.Errorf("need --%s to publish", publishDomainFlag.Name)
+	}
+	trees, err := publishTreeSpecs(ctx, domain)
+	if err != nil {
+		return err
+	}
+	var provider dnsProvider
+	switch p := ctx.String(publishProviderFlag.Name); p {
+	case "":
+	case "cloudflare":
+		client := newCloudflareClient(ctx)
+		if err := client.checkZone(domain); err != nil {
+			return err
+		}
+		provider = client
+	default:
+		return fmt.Errorf("unknown DNS provider %q", p)
+	}
+
+	// Update the node set.
+	var nodes nodeSet
+	if common.FileExist(nodesFile) {
+		nodes = loadNodesJSON(nodesFile)
+	}
+	if !ctx.Bool(noCrawlFlag.Name) {
+		nodes = crawlNodes(ctx, nodes, ctx.Duration(crawlTimeoutFlag.Name))
+		writeNodesJSON(nodesFile, nodes)
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("no nodes to publish")
+	}
+
+	// Publish the trees.
+	p := &treePublisher{
+		key:      loadSigningKey(keyfile),
+		dir:      ctx.String(publishTreeDirFlag.Name),
+		provider: provider,
+	}
+	for _, spec := range trees {
+		update, err := p.publish(spec, nodes)
+		if err == errEmptyTree {
+			log.Warn("Skipping empty DNS tree", "name", spec.name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("can't publish %s: %v", spec.name, err)
+		}
+		fmt.Println(update)
+	}
+	return nil
+}
+
+// crawlNodes crawls the discv4 network, starting from the given node set.
+func crawlNodes(ctx *cli.Context, input nodeSet, timeout time.Duration) nodeSet {
+	disc := startV4(ctx)
+	defer disc.Close()
+	c := newCrawler(input, disc, disc.RandomNodes())
+	c.revalidateInterval = 10 * time.Minute
+	return c.run(timeout)
+}
+
+// treeSpec describes a DNS tree.
+type treeSpec struct {
+	name   string // DNS name of the tree root
+	filter nodeFilter
+}
+
+// publishTreeSpecs creates the tree specs configured by command line flags. Trees are
+// published at <client>.<network>.<domain>.
+func publishTreeSpecs(ctx *cli.Context, domain string) ([]treeSpec, error) {
+	var history []string
+	if ctx.IsSet(publishMinAgeFlag.Name) {
+		history = append(history, "-min-age", ctx.Duration(publishMinAgeFlag.Name).String())
+	}
+	if ctx.IsSet(publishMinScoreFlag.Name) {
+		history = append(history, "-min-score", fmt.Sprint(ctx.Int(publishMinScoreFlag.Name)))
+	}
+	if ctx.IsSet(publishSeenWithinFlag.Name) {
+		history = append(history, "-seen-within", ctx.Duration(publishSeenWithinFlag.Name).String())
+	}
+	networks := strings.Split(ctx.String(publishNetworksFlag.Name), ",")
+	clients := strings.Split(ctx.String(publishClientsFlag.Name), ",")
+	return makeTreeSpecs(domain, networks, clients, history)
+}
+
+func makeTreeSpecs(domain string, networks, clients, history []string) ([]treeSpec, error) {
+	var specs []treeSpec
+	for _, network := range networks {
+		for _, client := range clients {
+			cf, ok := publishClientFilters[client]
+			if !ok {
+				return nil, fmt.Errorf("unknown client type %q", client)
+			}
+			args := append([]string{"-eth-network", network}, cf...)
+			filter, err := andFilter(append(args, history...))
+			if err != nil {
+				return nil, err
+			}
+			name := strings.Join([]string{client, network, domain}, ".")
+			specs = append(specs, treeSpec{name, filter})
+		}
+	}
+	return specs, nil
+}
+
+// treePublisher maintains DNS trees on disk and deploys them to a DNS provider.
+// The definition of each tree is stored in a subdirectory of dir named after
+// the tree.
+type treePublisher struct {
+	key      *ecdsa.PrivateKey
+	dir      string
+	provider dnsProvider // may be nil
+}
+
+// treeUpdate is the outcome of publishing a single tree.
+type treeUpdate struct {
+	name           string
+	seq            uint
+	nodes          int
+	changed        bool
+	added, removed int
+	deployed       *dnsChanges
+}
+
+func (u *treeUpdate) String() string {
+	s := fmt.Sprintf("%s: %d nodes, seq %d", u.name, u.nodes, u.seq)
+	if u.changed {
+		s += fmt.Sprintf(" (updated, %d added, %d removed)", u.added, u.removed)
+	} else {
+		s += " (unchanged)"
+	}
+	if u.deployed != nil {
+		s += fmt.Sprintf(", DNS: %v", u.deployed)
+	}
+	return s
+}
+
+// publish updates the tree described by spec with the matching nodes of ns. The
+// existing tree is only re-signed with a new sequence number if its content changes.
+// Empty trees are never published because they would remove all nodes from DNS.
+func (p *treePublisher) publish(spec treeSpec, ns nodeSet) (*treeUpdate, error) {
+	var nodes []*enode.Node
+	for _, n := range ns.nodes() {
+		if spec.filter(ns[n.ID()]) {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errEmptyTree
+	}
+	dir := filepath.Join(p.dir, spec.name)
+	old, err := loadExistingTreeDefinition(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &treeUpdate{name: spec.name, nodes: len(nodes)}
+	t, err := p.updateTree(spec.name, old, nodes, update)
+	if err != nil {
+		return nil, err
+	}
+	update.seq = t.Seq()
+	if p.provider != nil {
+		changes, err := deployRecords(p.provider, spec.name, t.ToTXT(spec.name))
+		if err != nil {
+			return nil, err
+		}
+		update.deployed = &changes
+	}
+	return update, nil
+}
+
+// updateTree creates the tree containing nodes. If old has the same content and a valid
+// signature, it is reused as is. Otherwise the tree is signed with the next sequence
+// number and its definition is written to disk.
+func (p *treePublisher) updateTree(name string, old *dnsDefinition, nodes []*enode.Node, update *treeUpdate) (*dnsdisc.Tree, error) {
+	var (
+		seq   uint
+		links = []string{}
+	)
+	if old != nil {
+		seq, links = old.Meta.Seq, old.Meta.Links
+		if t, err := dnsdisc.MakeTree(seq, nodes, links); err == nil && p.validSignature(name, t, old) {
+			return t, nil
+		}
+		seq++
+		update.added, update.removed = diffNodes(old.Nodes, nodes)
+	} else {
+		update.added = len(nodes)
+	}
+	update.changed = true
+
+	t, err := dnsdisc.MakeTree(seq, nodes, links)
+	if err != nil {
+		return nil, err
+	}
+	url, err := t.Sign(p.key, name)
+	if err != nil {
+		return nil, err
+	}
+	def := treeToDefinition(url, t)
+	def.Meta.LastModified = time.Now()
+	dir := filepath.Join(p.dir, name)
+	writeTreeMetadata(dir, def)
+	writeTreeNodes(dir, def)
+	log.Info("Updated DNS tree", "name", name, "seq", seq, "nodes", len(nodes))
+	return t, nil
+}
+
+// validSignature reports whether the signature of the existing tree definition is
+// valid for t and was made by the publisher's key for the given domain.
+func (p *treePublisher) validSignature(domain string, t *dnsdisc.Tree, old *dnsDefinition) bool {
+	d, pubkey, err := dnsdisc.ParseURL(old.Meta.URL)
+	if err != nil || d != domain || !bytes.Equal(crypto.CompressPubkey(pubkey), crypto.CompressPubkey(&p.key.PublicKey)) {
+		return false
+	}
+	return t.SetSignature(pubkey, old.Meta.Sig) == nil
+}
+
+// loadExistingTreeDefinition loads the tree definition in directory. It returns nil if
+// the directory does not contain a tree.
+func loadExistingTreeDefinition(directory string) (*dnsDefinition, error) {
+	metaFile, nodesFile := treeDefinitionFiles(directory)
+	if !common.FileExist(metaFile) || !common.FileExist(nodesFile) {
+		return nil, nil
+	}
+	var (
+		def   dnsDefinition
+		nodes nodeSet
+	)
+	if err := common.LoadJSON(metaFile, &def.Meta); err != nil {
+		return nil, err
+	}
+	if err := common.LoadJSON(nodesFile, &nodes); err != nil {
+		return nil, err
+	}
+	if err := nodes.verify(); err != nil {
+		return nil, err
+	}
+	if def.Meta.Links == nil {
+		def.Meta.Links = []string{}
+	}
+	def.Nodes = nodes.nodes()
+	return &def, nil
+}
+
+// diffNodes counts the nodes added and removed from old to new. Nodes which changed
+// their record count as removed and added.
+func diffNodes(old, new []*enode.Node) (added, removed int) {
+	oldset := make(nodeSet, len(old))
+	oldset.add(old...)
+	for _, n := range new {
+		if o, ok := oldset[n.ID()]; ok && o.Seq == n.Seq() {
+			delete(oldset, n.ID())
+			continue
+		}
+		added++
+	}
+	return added, len(oldset)
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// memoryProvider is a DNS provider which keeps records in memory.
+type memoryProvider map[string]string
+
+func (p memoryProvider) txtRecords(name string) (map[string]string, error) {
+	records := make(map[string]string)
+	for path, val := range p {
+		if path == name || strings.HasSuffix(path, "."+name) {
+			records[path] = val
+		}
+	}
+	return records, nil
+}
+
+func (p memoryProvider) setTXT(path, value string, root bool) error {
+	p[path] = value
+	return nil
+}
+
+func (p memoryProvider) deleteTXT(path string) error {
+	if _, ok := p[path]; !ok {
+		return fmt.Errorf("no record at %s", path)
+	}
+	delete(p, path)
+	return nil
+}
+
+// LookupTXT implements dnsdisc.Resolver. Like real DNS, lookups are case-insensitive.
+func (p memoryProvider) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if val, ok := p[strings.ToLower(name)]; ok {
+		return []string{val}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+type testNode struct {
+	ip     string
+	forkid *forkid.ID
+	les    bool
+	score  int
+}
+
+func makeTestNodeSet(t *testing.T, nodes []testNode) nodeSet {
+	ns := make(nodeSet)
+	for _, tn := range nodes {
+		key, _ := crypto.GenerateKey()
+		var r enr.Record
+		r.Set(enr.IP(net.ParseIP(tn.ip)))
+		if tn.forkid != nil {
+			r.Set(enr.WithEntry("eth", struct{ ForkID forkid.ID }{*tn.forkid}))
+		}
+		if tn.les {
+			r.Set(enr.WithEntry("les", struct{}{}))
+		}
+		if err := enode.SignV4(&r, key); err != nil {
+			t.Fatal(err)
+		}
+		n, err := enode.New(enode.ValidSchemes, &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		ns[n.ID()] = nodeJSON{
+			Seq:           n.Seq(),
+			N:             n,
+			Score:         tn.score,
+			FirstResponse: now.Add(-time.Hour),
+			LastResponse:  now,
+			LastCheck:     now,
+		}
+	}
+	return ns
+}
+
+func TestCrawlPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devp2p-publish-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mainnet = forkid.NewIDWithHead(params.MainnetChainConfig, params.MainnetGenesisHash, params.MainnetChainConfig.IstanbulBlock.Uint64())
+		goerli  = forkid.NewIDWithHead(params.GoerliChainConfig, params.GoerliGenesisHash, 0)
+		key, _  = crypto.GenerateKey()
+		dns     = make(memoryProvider)
+		p       = &treePublisher{key: key, dir: dir, provider: dns}
+	)
+	ns := makeTestNodeSet(t, []testNode{
+		{ip: "10.0.0.1", forkid: &mainnet, score: 5},
+		{ip: "10.0.0.2", forkid: &mainnet, les: true, score: 5},
+		{ip: "10.0.0.3", forkid: &mainnet, score: 0},
+		{ip: "10.0.0.4", forkid: &goerli, score: 5},
+		{ip: "10.0.0.5", score: 5},
+	})
+	specs, err := makeTreeSpecs("nodes.example.org", []string{"mainnet", "goerli"}, []string{"all", "les"}, []string{"-min-score", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish := func() map[string]*treeUpdate {
+		updates := make(map[string]*treeUpdate)
+		for _, spec := range specs {
+			u, err := p.publish(spec, ns)
+			if err == errEmptyTree {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("can't publish %s: %v", spec.name, err)
+			}
+			updates[spec.name] = u
+		}
+		return updates
+	}
+	checkTree := func(name string, wantIPs ...string) {
+		t.Helper()
+		def, err := loadExistingTreeDefinition(filepath.Join(dir, name))
+		if err != nil || def == nil {
+			t.Fatalf("can't load tree %s: %v", name, err)
+		}
+		client, _ := dnsdisc.NewClient(dnsdisc.Config{Resolver: dns})
+		tree, err := client.SyncTree(def.Meta.URL)
+		if err != nil {
+			t.Fatalf("can't sync tree %s: %v", name, err)
+		}
+		var ips []string
+		for _, n := range tree.Nodes() {
+			ips = append(ips, n.IP().String())
+		}
+		if len(ips) != len(wantIPs) {
+			t.Fatalf("tree %s has wrong nodes %v, want %v", name, ips, wantIPs)
+		}
+		for _, ip := range wantIPs {
+			if !strings.Contains(strings.Join(ips, " "), ip) {
+				t.Fatalf("tree %s has wrong nodes %v, want %v", name, ips, wantIPs)
+			}
+		}
+	}
+
+	// Initial publish. The goerli LES tree is empty and must not be created.
+	updates := publish()
+	if len(updates) != 3 {
+		t.Fatalf("wrong number of trees published: %d", len(updates))
+	}
+	if _, ok := updates["les.goerli.nodes.example.org"]; ok {
+		t.Fatal("empty tree published")
+	}
+	for name, u := range updates {
+		if !u.changed || u.seq != 0 || u.added != u.nodes {
+			t.Errorf("wrong initial update for %s: %v", name, u)
+		}
+	}
+	checkTree("all.mainnet.nodes.example.org", "10.0.0.1", "10.0.0.2")
+	checkTree("les.mainnet.nodes.example.org", "10.0.0.2")
+	checkTree("all.goerli.nodes.example.org", "10.0.0.4")
+	initial := make(memoryProvider)
+	for k, v := range dns {
+		initial[k] = v
+	}
+
+	// Publishing again must not change anything.
+	for name, u := range publish() {
+		if u.changed || u.seq != 0 || *u.deployed != (dnsChanges{}) {
+			t.Errorf("wrong update for unchanged tree %s: %v", name, u)
+		}
+	}
+	if !reflect.DeepEqual(dns, initial) {
+		t.Fatal("DNS records changed")
+	}
+
+	// Remove a node. Only the tree containing it is updated.
+	for id, n := range ns {
+		if n.N.IP().Equal(net.ParseIP("10.0.0.1")) {
+			delete(ns, id)
+		}
+	}
+	updates = publish()
+	if u := updates["all.mainnet.nodes.example.org"]; !u.changed || u.seq != 1 || u.removed != 1 || u.added != 0 || u.deployed.deleted == 0 {
+		t.Errorf("wrong update for changed tree: %v", u)
+	}
+	for _, name := range []string{"les.mainnet.nodes.example.org", "all.goerli.nodes.example.org"} {
+		if updates[name].changed {
+			t.Errorf("tree %s changed", name)
+		}
+	}
+	checkTree("all.mainnet.nodes.example.org", "10.0.0.2")
+
+	// Stale records of the old tree are gone.
+	if len(dns) >= len(initial) {
+		t.Fatalf("stale records not deleted: have %d, had %d", len(dns), len(initial))
+	}
+}
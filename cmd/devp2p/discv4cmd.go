@@ -163,11 +163,7 @@ func discv4Crawl(ctx *cli.Context) error {
 		inputSet = loadNodesJSON(nodesFile)
 	}
 
-	disc := startV4(ctx)
-	defer disc.Close()
-	c := newCrawler(inputSet, disc, disc.RandomNodes())
-	c.revalidateInterval = 10 * time.Minute
-	output := c.run(ctx.Duration(crawlTimeoutFlag.Name))
+	output := crawlNodes(ctx, inputSet, ctx.Duration(crawlTimeoutFlag.Name))
 	writeNodesJSON(nodesFile, output)
 	return nil
 }
@@ -40,7 +40,8 @@ var (
 
 type cloudflareClient struct {
 	*cloudflare.API
-	zoneID string
+	zoneID  string
+	entries map[string]cloudflare.DNSRecord // existing records, set by txtRecords
 }
 
 // newCloudflareClient sets up a CloudFlare API client from command line flags.
@@ -64,8 +65,8 @@ func (c *cloudflareClient) deploy(name string, t *dnsdisc.Tree) error {
 	if err := c.checkZone(name); err != nil {
 		return err
 	}
-	records := t.ToTXT(name)
-	return c.uploadRecords(name, records)
+	_, err := deployRecords(c, name, t.ToTXT(name))
+	return err
 }
 
 // checkZone verifies permissions on the CloudFlare DNS Zone for name.
@@ -100,64 +101,45 @@ func (c *cloudflareClient) checkZone(name string) error {
 	return nil
 }
 
-// uploadRecords updates the TXT records at a particular subdomain. All non-root records
-// will have a TTL of "infinity" and all existing records not in the new map will be
-// nuked!
-func (c *cloudflareClient) uploadRecords(name string, records map[string]string) error {
-	// Convert all names to lowercase.
-	lrecords := make(map[string]string, len(records))
-	for name, r := range records {
-		lrecords[strings.ToLower(name)] = r
-	}
-	records = lrecords
-
-	log.Info(fmt.Sprintf("Retrieving existing TXT records on %s", name))
+// txtRecords implements dnsProvider.
+func (c *cloudflareClient) txtRecords(name string) (map[string]string, error) {
 	entries, err := c.DNSRecords(c.zoneID, cloudflare.DNSRecord{Type: "TXT"})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	existing := make(map[string]cloudflare.DNSRecord)
+	c.entries = make(map[string]cloudflare.DNSRecord)
+	records := make(map[string]string)
 	for _, entry := range entries {
 		if !strings.HasSuffix(entry.Name, name) {
 			continue
 		}
-		existing[strings.ToLower(entry.Name)] = entry
+		path := strings.ToLower(entry.Name)
+		c.entries[path] = entry
+		records[path] = entry.Content
 	}
+	return records, nil
+}
 
-	// Iterate over the new records and inject anything missing.
-	for path, val := range records {
-		old, exists := existing[path]
-		if !exists {
-			// Entry is unknown, push a new one to Cloudflare.
-			log.Info(fmt.Sprintf("Creating %s = %q", path, val))
-			ttl := 1
-			if path != name {
-				ttl = 2147483647 // Max TTL permitted by Cloudflare
-			}
-			_, err = c.CreateDNSRecord(c.zoneID, cloudflare.DNSRecord{Type: "TXT", Name: path, Content: val, TTL: ttl})
-		} else if old.Content != val {
-			// Entry already exists, only change its content.
-			log.Info(fmt.Sprintf("Updating %s from %q to %q", path, old.Content, val))
-			old.Content = val
-			err = c.UpdateDNSRecord(c.zoneID, old.ID, old)
-		} else {
-			log.Info(fmt.Sprintf("Skipping %s = %q", path, val))
-		}
-		if err != nil {
-			return fmt.Errorf("failed to publish %s: %v", path, err)
-		}
-	}
+// setTXT implements dnsProvider.
+func (c *cloudflareClient) setTXT(path, value string, root bool) error {
+	if old, exists := c.entries[path]; exists {
+		// Entry already exists, only change its content.
+		old.Content = value
+		return c.UpdateDNSRecord(c.zoneID, old.ID, old)
+	}
+	ttl := 1
+	if !root {
+		ttl = 2147483647 // Max TTL permitted by Cloudflare
+	}
+	_, err := c.CreateDNSRecord(c.zoneID, cloudflare.DNSRecord{Type: "TXT", Name: path, Content: value, TTL: ttl})
+	return err
+}
 
-	// Iterate over the old records and delete anything stale.
-	for path, entry := range existing {
-		if _, ok := records[path]; ok {
-			continue
-		}
-		// Stale entry, nuke it.
-		log.Info(fmt.Sprintf("Deleting %s = %q", path, entry.Content))
-		if err := c.DeleteDNSRecord(c.zoneID, entry.ID); err != nil {
-			return fmt.Errorf("failed to delete %s: %v", path, err)
-		}
+// deleteTXT implements dnsProvider.
+func (c *cloudflareClient) deleteTXT(path string) error {
+	entry, exists := c.entries[path]
+	if !exists {
+		return fmt.Errorf("unknown record %s", path)
 	}
-	return nil
+	return c.DeleteDNSRecord(c.zoneID, entry.ID)
 }
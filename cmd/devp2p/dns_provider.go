@@ -0,0 +1,119 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// dnsProvider is a DNS hosting service which stores the TXT records of node trees.
+type dnsProvider interface {
+	// txtRecords returns the TXT records at name and all of its subdomains.
+	txtRecords(name string) (map[string]string, error)
+	// setTXT creates or updates the TXT record at path. The root record of a tree
+	// changes with every update, all other records are immutable and may be cached
+	// forever.
+	setTXT(path, value string, root bool) error
+	// deleteTXT deletes the TXT record at path.
+	deleteTXT(path string) error
+}
+
+// dnsChanges counts the record changes made by deployRecords.
+type dnsChanges struct {
+	created, updated, deleted int
+}
+
+func (c dnsChanges) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d deleted", c.created, c.updated, c.deleted)
+}
+
+// deployRecords updates the TXT records at name and its subdomains to match the given
+// records. Records which are already present are left alone and all existing records
+// not in the new map are deleted.
+//
+// The root record is written after all other new records and stale records are deleted
+// last, so clients never see a root which refers to missing entries.
+func deployRecords(p dnsProvider, name string, records map[string]string) (dnsChanges, error) {
+	var changes dnsChanges
+
+	// Convert all names to lowercase.
+	name = strings.ToLower(name)
+	lrecords := make(map[string]string, len(records))
+	for path, r := range records {
+		lrecords[strings.ToLower(path)] = r
+	}
+	records = lrecords
+
+	log.Info(fmt.Sprintf("Retrieving existing TXT records on %s", name))
+	existing, err := p.txtRecords(name)
+	if err != nil {
+		return changes, err
+	}
+	lexisting := make(map[string]string, len(existing))
+	for path, r := range existing {
+		lexisting[strings.ToLower(path)] = r
+	}
+	existing = lexisting
+
+	set := func(path, val string) error {
+		old, exists := existing[path]
+		switch {
+		case !exists:
+			log.Info(fmt.Sprintf("Creating %s = %q", path, val))
+			changes.created++
+		case old != val:
+			log.Info(fmt.Sprintf("Updating %s from %q to %q", path, old, val))
+			changes.updated++
+		default:
+			log.Debug(fmt.Sprintf("Skipping %s = %q", path, val))
+			return nil
+		}
+		if err := p.setTXT(path, val, path == name); err != nil {
+			return fmt.Errorf("failed to publish %s: %v", path, err)
+		}
+		return nil
+	}
+	for path, val := range records {
+		if path == name {
+			continue
+		}
+		if err := set(path, val); err != nil {
+			return changes, err
+		}
+	}
+	if val, ok := records[name]; ok {
+		if err := set(name, val); err != nil {
+			return changes, err
+		}
+	}
+
+	// Iterate over the old records and delete anything stale.
+	for path, val := range existing {
+		if _, ok := records[path]; ok {
+			continue
+		}
+		log.Info(fmt.Sprintf("Deleting %s = %q", path, val))
+		if err := p.deleteTXT(path); err != nil {
+			return changes, fmt.Errorf("failed to delete %s: %v", path, err)
+		}
+		changes.deleted++
+	}
+	return changes, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Chain is a sequence of blocks starting at genesis, as known to the test suite.
+type Chain struct {
+	blocks      []*types.Block
+	chainConfig *params.ChainConfig
+}
+
+// Len returns the number of blocks in the chain, including genesis.
+func (c *Chain) Len() int {
+	return len(c.blocks)
+}
+
+// Head returns the last block of the chain.
+func (c *Chain) Head() *types.Block {
+	return c.blocks[len(c.blocks)-1]
+}
+
+// TD returns the total difficulty of the chain up to and including the block
+// at the given height.
+func (c *Chain) TD(height int) *big.Int {
+	sum := new(big.Int)
+	for _, block := range c.blocks[:height+1] {
+		sum.Add(sum, block.Difficulty())
+	}
+	return sum
+}
+
+// ForkID returns the EIP-2124 fork ID at the head of the chain.
+func (c *Chain) ForkID() forkid.ID {
+	return forkid.NewIDWithHead(c.chainConfig, c.blocks[0].Hash(), c.Head().NumberU64())
+}
+
+// Shorten returns a copy of the chain containing the first height blocks.
+func (c *Chain) Shorten(height int) *Chain {
+	blocks := make([]*types.Block, height)
+	copy(blocks, c.blocks[:height])
+	return &Chain{blocks: blocks, chainConfig: c.chainConfig}
+}
+
+// blockByHash returns the block with the given hash, or nil if the chain doesn't
+// contain it.
+func (c *Chain) blockByHash(hash common.Hash) *types.Block {
+	for _, block := range c.blocks {
+		if block.Hash() == hash {
+			return block
+		}
+	}
+	return nil
+}
+
+// GetHeaders answers a header request from the chain, following the semantics
+// of the eth protocol.
+func (c *Chain) GetHeaders(req GetBlockHeaders) (BlockHeaders, error) {
+	if req.Amount < 1 {
+		return nil, fmt.Errorf("no block headers requested")
+	}
+	var start uint64
+	if req.Origin.Hash != (common.Hash{}) {
+		block := c.blockByHash(req.Origin.Hash)
+		if block == nil {
+			return nil, nil
+		}
+		start = block.NumberU64()
+	} else {
+		start = req.Origin.Number
+	}
+	var (
+		headers BlockHeaders
+		step    = req.Skip + 1
+	)
+	for n := start; n < uint64(len(c.blocks)) && uint64(len(headers)) < req.Amount; {
+		headers = append(headers, c.blocks[n].Header())
+		if req.Reverse {
+			if n < step {
+				break
+			}
+			n -= step
+		} else {
+			n += step
+		}
+	}
+	return headers, nil
+}
+
+// loadChain takes the given chain.rlp file, and decodes and returns
+// the blocks from the file.
+func loadChain(chainfile string, genesis string) (*Chain, error) {
+	gen, err := loadGenesis(genesis)
+	if err != nil {
+		return nil, err
+	}
+	gblock := gen.ToBlock(nil)
+
+	fh, err := os.Open(chainfile)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	var reader io.Reader = fh
+	if strings.HasSuffix(chainfile, ".gz") {
+		if reader, err = gzip.NewReader(reader); err != nil {
+			return nil, err
+		}
+	}
+	stream := rlp.NewStream(reader, 0)
+	blocks := []*types.Block{gblock}
+	for i := 0; ; i++ {
+		var b types.Block
+		if err := stream.Decode(&b); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("at block %d: %v", i, err)
+		}
+		// Chain exports usually start at block one, but skip genesis if present.
+		if b.NumberU64() == 0 {
+			if b.Hash() != gblock.Hash() {
+				return nil, fmt.Errorf("genesis mismatch: chain file has %x, genesis.json has %x", b.Hash(), gblock.Hash())
+			}
+			continue
+		}
+		if want := uint64(len(blocks)); b.NumberU64() != want {
+			return nil, fmt.Errorf("at block %d: unexpected block number %d", want, b.NumberU64())
+		}
+		blocks = append(blocks, &b)
+	}
+	return &Chain{blocks: blocks, chainConfig: gen.Config}, nil
+}
+
+func loadGenesis(genesisFile string) (core.Genesis, error) {
+	chainConfig, err := ioutil.ReadFile(genesisFile)
+	if err != nil {
+		return core.Genesis{}, err
+	}
+	var gen core.Genesis
+	if err := json.Unmarshal(chainConfig, &gen); err != nil {
+		return core.Genesis{}, err
+	}
+	if gen.Config == nil {
+		return core.Genesis{}, fmt.Errorf("genesis %s has no chain config", genesisFile)
+	}
+	return gen, nil
+}
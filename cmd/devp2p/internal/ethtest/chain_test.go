@@ -0,0 +1,142 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// writeTestChain generates a chain of n blocks and stores it as chain.rlp and
+// genesis.json in dir.
+func writeTestChain(t *testing.T, dir string, n int) []*types.Block {
+	gspec := &core.Genesis{
+		Config:     params.TestChainConfig,
+		Difficulty: big.NewInt(131072),
+		GasLimit:   5000000,
+		Alloc:      core.GenesisAlloc{},
+	}
+	db := rawdb.NewMemoryDatabase()
+	genesis := gspec.MustCommit(db)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n, nil)
+
+	genesisJSON, err := json.Marshal(gspec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "genesis.json"), genesisJSON, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fh, err := os.Create(filepath.Join(dir, "chain.rlp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	for _, block := range blocks {
+		if err := rlp.Encode(fh, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return append([]*types.Block{genesis}, blocks...)
+}
+
+func TestLoadChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blocks := writeTestChain(t, dir, 10)
+
+	chain, err := loadChain(filepath.Join(dir, "chain.rlp"), filepath.Join(dir, "genesis.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Len() != len(blocks) {
+		t.Fatalf("wrong chain length %d, want %d", chain.Len(), len(blocks))
+	}
+	for i, block := range blocks {
+		if chain.blocks[i].Hash() != block.Hash() {
+			t.Fatalf("block %d mismatch", i)
+		}
+	}
+	td := new(big.Int)
+	for _, block := range blocks {
+		td.Add(td, block.Difficulty())
+	}
+	if chain.TD(chain.Len()-1).Cmp(td) != 0 {
+		t.Errorf("wrong total difficulty %v, want %v", chain.TD(chain.Len()-1), td)
+	}
+	if short := chain.Shorten(5); short.Len() != 5 || short.Head().Hash() != blocks[4].Hash() {
+		t.Errorf("Shorten returned wrong chain")
+	}
+}
+
+func TestChainGetHeaders(t *testing.T) {
+	var (
+		dir, _ = ioutil.TempDir("", "ethtest")
+		blocks = writeTestChain(t, dir, 10)
+	)
+	defer os.RemoveAll(dir)
+	chain, err := loadChain(filepath.Join(dir, "chain.rlp"), filepath.Join(dir, "genesis.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		req  GetBlockHeaders
+		want []uint64
+	}{
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 1}, Amount: 3}, []uint64{1, 2, 3}},
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 1}, Amount: 3, Skip: 2}, []uint64{1, 4, 7}},
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 8}, Amount: 5}, []uint64{8, 9, 10}},
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 5}, Amount: 3, Reverse: true}, []uint64{5, 4, 3}},
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 5}, Amount: 4, Skip: 1, Reverse: true}, []uint64{5, 3, 1}},
+		{GetBlockHeaders{Origin: hashOrNumber{Hash: blocks[6].Hash()}, Amount: 2, Skip: 3}, []uint64{6, 10}},
+		{GetBlockHeaders{Origin: hashOrNumber{Number: 11}, Amount: 1}, []uint64{}},
+		{GetBlockHeaders{Origin: hashOrNumber{Hash: common.Hash{1}}, Amount: 1}, []uint64{}},
+	}
+	for i, test := range tests {
+		headers, err := chain.GetHeaders(test.req)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		have := headerNumbers(headers)
+		if len(have) != len(test.want) {
+			t.Errorf("test %d: wrong headers %v, want %v", i, have, test.want)
+			continue
+		}
+		for j := range have {
+			if have[j] != test.want[j] {
+				t.Errorf("test %d: wrong headers %v, want %v", i, have, test.want)
+				break
+			}
+		}
+	}
+}
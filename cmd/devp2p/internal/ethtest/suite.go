@@ -0,0 +1,439 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ethtest implements a conformance test suite for the eth wire protocol.
+package ethtest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Suite represents a structure used to test the eth protocol of a node.
+//
+// The node under test must be initialized with the same genesis block as the
+// test chain and should have imported all blocks of the chain except the last
+// two. The broadcast test announces the block after the node's head, which
+// also completes the initial sync of most clients. The transaction test then
+// sends a transaction taken from the following block.
+type Suite struct {
+	Dest      *enode.Node
+	fullChain *Chain
+}
+
+// NewSuite creates and returns a new eth-test suite that can
+// be used to test the given node against the given blockchain
+// data.
+func NewSuite(dest *enode.Node, chainfile string, genesisfile string) (*Suite, error) {
+	chain, err := loadChain(chainfile, genesisfile)
+	if err != nil {
+		return nil, err
+	}
+	return &Suite{Dest: dest, fullChain: chain}, nil
+}
+
+// AllTests returns all tests of the suite. The tests run against the same node
+// and must be executed in order.
+func (s *Suite) AllTests() []utesting.Test {
+	return []utesting.Test{
+		{Name: "Status", Fn: s.TestStatus},
+		{Name: "GetBlockHeaders", Fn: s.TestGetBlockHeaders},
+		{Name: "GetBlockBodies", Fn: s.TestGetBlockBodies},
+		{Name: "MaliciousHandshake", Fn: s.TestMaliciousHandshake},
+		{Name: "MaliciousStatus", Fn: s.TestMaliciousStatus},
+		{Name: "MalformedMessages", Fn: s.TestMalformedMessages},
+		{Name: "LargeAnnounce", Fn: s.TestLargeAnnounce},
+		{Name: "Broadcast", Fn: s.TestBroadcast},
+		{Name: "Transaction", Fn: s.TestTransaction},
+	}
+}
+
+// TestStatus attempts to connect to the given node and exchange
+// a status message with it, and then check to make sure
+// the chain head is correct.
+func (s *Suite) TestStatus(t *utesting.T) {
+	conn := s.dial(t)
+	defer conn.Close()
+
+	conn.handshake(t)
+	view := conn.statusExchange(t, s.fullChain, nil)
+	t.Logf("remote node is at block %d, eth/%d", view.Head().NumberU64(), conn.ethProtocolVersion)
+}
+
+// TestGetBlockHeaders tests whether the given node can respond to
+// GetBlockHeaders requests, including requests with skips and reverse
+// traversal.
+func (s *Suite) TestGetBlockHeaders(t *utesting.T) {
+	conn, view := s.setupConnection(t)
+	defer conn.Close()
+
+	head := view.Head().NumberU64()
+	requests := []*GetBlockHeaders{
+		{Origin: hashOrNumber{Number: 0}, Amount: 4},
+		{Origin: hashOrNumber{Hash: view.blocks[0].Hash()}, Amount: 3, Skip: 1},
+		{Origin: hashOrNumber{Number: 1}, Amount: 5, Skip: 2},
+		{Origin: hashOrNumber{Number: head}, Amount: 4, Reverse: true},
+		{Origin: hashOrNumber{Hash: view.Head().Hash()}, Amount: 3, Skip: 1, Reverse: true},
+		{Origin: hashOrNumber{Number: head}, Amount: 4},
+		{Origin: hashOrNumber{Number: head + 10}, Amount: 1},
+	}
+	for i, req := range requests {
+		want, err := view.GetHeaders(*req)
+		if err != nil {
+			t.Fatalf("request %d: can't compute expected headers: %v", i, err)
+		}
+		if err := conn.Write(req); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+		switch msg := conn.ReadAndServe(view, timeout).(type) {
+		case *BlockHeaders:
+			if !headersEqual(*msg, want) {
+				t.Fatalf("request %d (%+v): wrong headers\nhave %v\nwant %v", i, *req, headerNumbers(*msg), headerNumbers(want))
+			}
+		default:
+			t.Fatalf("request %d: unexpected response %T: %v", i, msg, msg)
+		}
+	}
+}
+
+// TestGetBlockBodies tests whether the given node can respond to
+// a GetBlockBodies request and that the response is accurate.
+func (s *Suite) TestGetBlockBodies(t *utesting.T) {
+	conn, view := s.setupConnection(t)
+	defer conn.Close()
+
+	var req GetBlockBodies
+	for i := view.Len() - 1; i > 0 && len(req) < 16; i-- {
+		req = append(req, view.blocks[i].Hash())
+	}
+	if len(req) == 0 {
+		t.Fatalf("remote node has no blocks beyond genesis")
+	}
+	if err := conn.Write(req); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := conn.ReadAndServe(view, timeout).(type) {
+	case *BlockBodies:
+		if len(*msg) != len(req) {
+			t.Fatalf("wrong number of block bodies: have %d, want %d", len(*msg), len(req))
+		}
+		for i, body := range *msg {
+			block := view.blockByHash(req[i])
+			if err := checkBody(block, body); err != nil {
+				t.Errorf("block %d: %v", block.NumberU64(), err)
+			}
+		}
+	default:
+		t.Fatalf("unexpected response %T: %v", msg, msg)
+	}
+}
+
+// TestMaliciousHandshake tries to send malicious data during the handshake.
+func (s *Suite) TestMaliciousHandshake(t *utesting.T) {
+	key, _ := crypto.GenerateKey()
+	pub := crypto.FromECDSAPub(&key.PublicKey)[1:]
+	caps := []p2p.Cap{{Name: "eth", Version: 64}, {Name: "eth", Version: 65}}
+
+	handshakes := []*Hello{
+		{Version: 5, Caps: caps, ID: append(pub, pub...)},
+		{Version: 5, Caps: caps, ID: make([]byte, 64)},
+		{Version: 5, Caps: caps, ID: pub[:32]},
+		{Version: 5, Caps: caps, ID: pub, Name: strings.Repeat("a", 4096)},
+		{Version: 5, Caps: manyCaps(500), ID: pub},
+	}
+	for i, handshake := range handshakes {
+		conn := s.dial(t)
+		if err := conn.Write(handshake); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+		// The remote node may send its own hello before disconnecting.
+		msg := conn.Read()
+		if _, ok := msg.(*Hello); ok {
+			msg = conn.Read()
+		}
+		if err := checkDisconnect(msg); err != nil {
+			t.Errorf("handshake %d: %v", i, err)
+		}
+		conn.Close()
+	}
+}
+
+// TestMaliciousStatus sends status messages which must be rejected by the
+// remote node.
+func (s *Suite) TestMaliciousStatus(t *utesting.T) {
+	statuses := []func(*Status){
+		func(st *Status) { st.Genesis = common.Hash{1} },
+		func(st *Status) { st.NetworkID++ },
+		func(st *Status) { st.ProtocolVersion = 1000 },
+		func(st *Status) { st.ForkID = forkid.ID{Hash: [4]byte{0xde, 0xad, 0xbe, 0xef}} },
+	}
+	for i, modify := range statuses {
+		conn := s.dial(t)
+		conn.handshake(t)
+		conn.statusExchange(t, s.fullChain, modify)
+		if err := checkDisconnect(conn.Read()); err != nil {
+			t.Errorf("status %d: %v", i, err)
+		}
+		conn.Close()
+	}
+}
+
+// TestMalformedMessages sends messages with undecodable payloads, which must
+// cause the remote node to drop the connection.
+func (s *Suite) TestMalformedMessages(t *utesting.T) {
+	garbage, _ := rlp.EncodeToBytes("not a valid request")
+	codes := []int{getBlockHeadersMsg, getBlockBodiesMsg, newBlockMsg, newBlockHashesMsg}
+	for _, code := range codes {
+		conn, view := s.setupConnection(t)
+		msg := p2p.Msg{Code: uint64(code), Size: uint32(len(garbage)), Payload: strings.NewReader(string(garbage))}
+		if err := conn.WriteMsg(msg); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+		if err := checkDisconnect(conn.ReadAndServe(view, timeout)); err != nil {
+			t.Errorf("message code %#x: %v", code, err)
+		}
+		conn.Close()
+	}
+}
+
+// TestLargeAnnounce tests the announcement mechanism with blocks or total
+// difficulties too large to be valid.
+func (s *Suite) TestLargeAnnounce(t *utesting.T) {
+	announcements := []*NewBlock{
+		{Block: largeBlock(), TD: big.NewInt(1)},
+		{Block: s.fullChain.Head(), TD: largeNumber(2)},
+		{Block: largeBlock(), TD: largeNumber(2)},
+	}
+	for i, announcement := range announcements {
+		conn, view := s.setupConnection(t)
+		if err := conn.Write(announcement); err != nil {
+			t.Fatalf("could not write to connection: %v", err)
+		}
+		if err := checkDisconnect(conn.ReadAndServe(view, timeout)); err != nil {
+			t.Errorf("announcement %d: %v", i, err)
+		}
+		conn.Close()
+	}
+}
+
+// TestTransaction sends a valid transaction to the node and checks that it is
+// propagated to another peer. The transaction is taken from the block after
+// the node's head.
+func (s *Suite) TestTransaction(t *utesting.T) {
+	sendConn, view := s.setupConnection(t)
+	defer sendConn.Close()
+	recvConn, _ := s.setupConnection(t)
+	defer recvConn.Close()
+
+	next := s.nextBlock(t, view)
+	if len(next.Transactions()) == 0 {
+		t.Fatalf("block %d of the test chain contains no transactions", next.NumberU64())
+	}
+	tx := next.Transactions()[0]
+	if err := sendConn.Write(Transactions{tx}); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	for {
+		switch msg := recvConn.ReadAndServe(view, timeout).(type) {
+		case *Transactions:
+			for _, have := range *msg {
+				if have.Hash() == tx.Hash() {
+					return
+				}
+			}
+		case *NewPooledTransactionHashes:
+			for _, have := range *msg {
+				if have == tx.Hash() {
+					return
+				}
+			}
+		case *Error:
+			t.Fatalf("transaction %x not propagated: %v", tx.Hash(), msg)
+		case *Disconnect:
+			t.Fatalf("disconnect received: %v", msg.Reason)
+		}
+	}
+}
+
+// TestBroadcast tests whether a block announcement is correctly
+// propagated to the given node's peer(s). The announced block is imported by
+// the node.
+func (s *Suite) TestBroadcast(t *utesting.T) {
+	sendConn, view := s.setupConnection(t)
+	defer sendConn.Close()
+	recvConn, _ := s.setupConnection(t)
+	defer recvConn.Close()
+
+	next := s.nextBlock(t, view)
+	announcement := &NewBlock{Block: next, TD: s.fullChain.TD(int(next.NumberU64()))}
+	if err := sendConn.Write(announcement); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	recvView := s.fullChain.Shorten(int(next.NumberU64()) + 1)
+	for announced := false; !announced; {
+		switch msg := recvConn.ReadAndServe(recvView, timeout).(type) {
+		case *NewBlock:
+			if msg.Block.Hash() == next.Hash() {
+				if msg.TD.Cmp(announcement.TD) != 0 {
+					t.Fatalf("wrong TD in announcement: have %v, want %v", msg.TD, announcement.TD)
+				}
+				announced = true
+			}
+		case *NewBlockHashes:
+			for _, ann := range *msg {
+				if ann.Hash == next.Hash() && ann.Number == next.NumberU64() {
+					announced = true
+				}
+			}
+		case *Error:
+			t.Fatalf("block %d not propagated: %v", next.NumberU64(), msg)
+		case *Disconnect:
+			t.Fatalf("disconnect received: %v", msg.Reason)
+		}
+	}
+	if err := sendConn.waitForBlock(recvView, next); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dial attempts to dial the given node and perform the RLPx encryption
+// handshake.
+func (s *Suite) dial(t *utesting.T) *Conn {
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", s.Dest.IP(), s.Dest.TCP()))
+	if err != nil {
+		t.Fatalf("could not dial node: %v", err)
+	}
+	conn := &Conn{RLPxConn: p2p.NewRLPxConn(fd)}
+	conn.ourKey, _ = crypto.GenerateKey()
+	if _, err := conn.Handshake(conn.ourKey, s.Dest.Pubkey()); err != nil {
+		conn.Close()
+		t.Fatalf("RLPx handshake failed: %v", err)
+	}
+	return conn
+}
+
+// setupConnection dials the node and performs the protocol handshake and status
+// exchange. It returns the connection and the part of the chain known to the node.
+func (s *Suite) setupConnection(t *utesting.T) (*Conn, *Chain) {
+	conn := s.dial(t)
+	conn.handshake(t)
+	return conn, conn.statusExchange(t, s.fullChain, nil)
+}
+
+// nextBlock returns the block after the head of the given view of the chain.
+func (s *Suite) nextBlock(t *utesting.T, view *Chain) *types.Block {
+	if view.Len() >= s.fullChain.Len() {
+		t.Fatalf("remote node has imported all %d blocks of the test chain, no block left to announce", s.fullChain.Len()-1)
+	}
+	return s.fullChain.blocks[view.Len()]
+}
+
+// checkDisconnect returns nil if msg indicates that the remote node dropped
+// the connection.
+func checkDisconnect(msg Message) error {
+	switch msg := msg.(type) {
+	case *Disconnect:
+		return nil
+	case *Error:
+		if nerr, ok := msg.err.(net.Error); ok && nerr.Timeout() {
+			return fmt.Errorf("remote node did not disconnect: %v", msg)
+		}
+		return nil
+	default:
+		return fmt.Errorf("expected disconnect, got %T: %v", msg, msg)
+	}
+}
+
+func headersEqual(a, b []*types.Header) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Hash() != b[i].Hash() {
+			return false
+		}
+	}
+	return true
+}
+
+func headerNumbers(headers []*types.Header) []uint64 {
+	numbers := make([]uint64, len(headers))
+	for i, h := range headers {
+		numbers[i] = h.Number.Uint64()
+	}
+	return numbers
+}
+
+func checkBody(block *types.Block, body *types.Body) error {
+	if have, want := len(body.Transactions), len(block.Transactions()); have != want {
+		return fmt.Errorf("wrong number of transactions: have %d, want %d", have, want)
+	}
+	for i, tx := range body.Transactions {
+		if tx.Hash() != block.Transactions()[i].Hash() {
+			return fmt.Errorf("transaction %d mismatch: have %x, want %x", i, tx.Hash(), block.Transactions()[i].Hash())
+		}
+	}
+	if have, want := types.CalcUncleHash(body.Uncles), block.UncleHash(); have != want {
+		return fmt.Errorf("uncle hash mismatch: have %x, want %x", have, want)
+	}
+	return nil
+}
+
+// largeNumber returns a very large big.Int.
+func largeNumber(megabytes int) *big.Int {
+	buf := make([]byte, megabytes*1024*1024)
+	rand.Read(buf)
+	return new(big.Int).SetBytes(buf)
+}
+
+// largeBlock returns a block with a block number too large to be valid.
+func largeBlock() *types.Block {
+	return types.NewBlockWithHeader(&types.Header{
+		ParentHash: randHash(),
+		UncleHash:  types.EmptyUncleHash,
+		Root:       randHash(),
+		TxHash:     types.EmptyRootHash,
+		Number:     largeNumber(2),
+		Difficulty: largeNumber(2),
+		Time:       1337,
+	})
+}
+
+func randHash() common.Hash {
+	var h common.Hash
+	rand.Read(h[:])
+	return h
+}
+
+func manyCaps(n int) []p2p.Cap {
+	caps := make([]p2p.Cap, n)
+	for i := range caps {
+		caps[i] = p2p.Cap{Name: fmt.Sprintf("cap%d", i), Version: uint(i)}
+	}
+	return caps
+}
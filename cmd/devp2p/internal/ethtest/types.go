@@ -0,0 +1,415 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package ethtest
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Message codes of the base protocol and the eth protocol. Codes of the eth
+// protocol are offset by the length of the base protocol.
+const (
+	helloMsg      = 0x00
+	disconnectMsg = 0x01
+	pingMsg       = 0x02
+	pongMsg       = 0x03
+
+	baseProtocolLength = 16
+
+	statusMsg                     = baseProtocolLength + 0x00
+	newBlockHashesMsg             = baseProtocolLength + 0x01
+	transactionsMsg               = baseProtocolLength + 0x02
+	getBlockHeadersMsg            = baseProtocolLength + 0x03
+	blockHeadersMsg               = baseProtocolLength + 0x04
+	getBlockBodiesMsg             = baseProtocolLength + 0x05
+	blockBodiesMsg                = baseProtocolLength + 0x06
+	newBlockMsg                   = baseProtocolLength + 0x07
+	newPooledTransactionHashesMsg = baseProtocolLength + 0x08
+)
+
+// timeout is the default time to wait for a message from the remote node.
+const timeout = 20 * time.Second
+
+// Message is a decoded devp2p message.
+type Message interface {
+	Code() int
+}
+
+// Error is returned in place of a message when reading fails.
+type Error struct {
+	err error
+}
+
+func errorf(format string, args ...interface{}) *Error {
+	return &Error{fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Unwrap() error  { return e.err }
+func (e *Error) Error() string  { return e.err.Error() }
+func (e *Error) Code() int      { return -1 }
+func (e *Error) String() string { return e.Error() }
+
+// Hello is the RLP structure of the protocol handshake.
+type Hello struct {
+	Version    uint64
+	Name       string
+	Caps       []p2p.Cap
+	ListenPort uint64
+	ID         []byte // secp256k1 public key
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+func (h Hello) Code() int { return helloMsg }
+
+// Disconnect is the RLP structure for a disconnect message.
+type Disconnect struct {
+	Reason p2p.DiscReason
+}
+
+func (d Disconnect) Code() int { return disconnectMsg }
+
+// Ping is the base protocol keep-alive request.
+type Ping struct{}
+
+func (p Ping) Code() int { return pingMsg }
+
+// Pong is the response to Ping.
+type Pong struct{}
+
+func (p Pong) Code() int { return pongMsg }
+
+// Status is the network packet for the status message for eth/64 and later.
+type Status struct {
+	ProtocolVersion uint32
+	NetworkID       uint64
+	TD              *big.Int
+	Head            common.Hash
+	Genesis         common.Hash
+	ForkID          forkid.ID
+}
+
+func (s Status) Code() int { return statusMsg }
+
+// NewBlockHashes is the network packet for the block announcements.
+type NewBlockHashes []struct {
+	Hash   common.Hash // Hash of one particular block being announced
+	Number uint64      // Number of one particular block being announced
+}
+
+func (nbh NewBlockHashes) Code() int { return newBlockHashesMsg }
+
+// Transactions is the network packet for transaction propagation.
+type Transactions []*types.Transaction
+
+func (t Transactions) Code() int { return transactionsMsg }
+
+// GetBlockHeaders represents a block header query.
+type GetBlockHeaders struct {
+	Origin  hashOrNumber // Block from which to retrieve headers
+	Amount  uint64       // Maximum number of headers to retrieve
+	Skip    uint64       // Blocks to skip between consecutive headers
+	Reverse bool         // Query direction (false = rising towards latest, true = falling towards genesis)
+}
+
+func (g GetBlockHeaders) Code() int { return getBlockHeadersMsg }
+
+// hashOrNumber is a combined field for specifying an origin block.
+type hashOrNumber struct {
+	Hash   common.Hash // Block hash from which to retrieve headers (excludes Number)
+	Number uint64      // Block hash from which to retrieve headers (excludes Hash)
+}
+
+// EncodeRLP is a specialized encoder for hashOrNumber to encode only one of the
+// two contained union fields.
+func (hn *hashOrNumber) EncodeRLP(w io.Writer) error {
+	if hn.Hash == (common.Hash{}) {
+		return rlp.Encode(w, hn.Number)
+	}
+	if hn.Number != 0 {
+		return fmt.Errorf("both origin hash (%x) and number (%d) provided", hn.Hash, hn.Number)
+	}
+	return rlp.Encode(w, hn.Hash)
+}
+
+// DecodeRLP is a specialized decoder for hashOrNumber to decode the contents
+// into either a block hash or a block number.
+func (hn *hashOrNumber) DecodeRLP(s *rlp.Stream) error {
+	_, size, _ := s.Kind()
+	origin, err := s.Raw()
+	if err == nil {
+		switch {
+		case size == 32:
+			err = rlp.DecodeBytes(origin, &hn.Hash)
+		case size <= 8:
+			err = rlp.DecodeBytes(origin, &hn.Number)
+		default:
+			err = fmt.Errorf("invalid input size %d for origin", size)
+		}
+	}
+	return err
+}
+
+// BlockHeaders is the network packet for block header responses.
+type BlockHeaders []*types.Header
+
+func (bh BlockHeaders) Code() int { return blockHeadersMsg }
+
+// GetBlockBodies represents a GetBlockBodies request.
+type GetBlockBodies []common.Hash
+
+func (gbb GetBlockBodies) Code() int { return getBlockBodiesMsg }
+
+// BlockBodies is the network packet for block content distribution.
+type BlockBodies []*types.Body
+
+func (bb BlockBodies) Code() int { return blockBodiesMsg }
+
+// NewBlock is the network packet for the block propagation message.
+type NewBlock struct {
+	Block *types.Block
+	TD    *big.Int
+}
+
+func (nb NewBlock) Code() int { return newBlockMsg }
+
+// NewPooledTransactionHashes is the network packet for eth/65 transaction
+// announcements.
+type NewPooledTransactionHashes []common.Hash
+
+func (nph NewPooledTransactionHashes) Code() int { return newPooledTransactionHashesMsg }
+
+// Conn represents an individual connection with a peer.
+type Conn struct {
+	*p2p.RLPxConn
+	ourKey             *ecdsa.PrivateKey
+	ethProtocolVersion uint
+}
+
+// Read reads the next message from the connection, waiting at most for the
+// default timeout.
+func (c *Conn) Read() Message {
+	c.SetReadDeadline(time.Now().Add(timeout))
+	return c.read()
+}
+
+func (c *Conn) read() Message {
+	msg, err := c.ReadMsg()
+	if err != nil {
+		return &Error{err}
+	}
+	defer msg.Discard()
+
+	var m Message
+	switch int(msg.Code) {
+	case helloMsg:
+		m = new(Hello)
+	case disconnectMsg:
+		m = new(Disconnect)
+	case pingMsg:
+		m = new(Ping)
+	case pongMsg:
+		m = new(Pong)
+	case statusMsg:
+		m = new(Status)
+	case newBlockHashesMsg:
+		m = new(NewBlockHashes)
+	case transactionsMsg:
+		m = new(Transactions)
+	case getBlockHeadersMsg:
+		m = new(GetBlockHeaders)
+	case blockHeadersMsg:
+		m = new(BlockHeaders)
+	case getBlockBodiesMsg:
+		m = new(GetBlockBodies)
+	case blockBodiesMsg:
+		m = new(BlockBodies)
+	case newBlockMsg:
+		m = new(NewBlock)
+	case newPooledTransactionHashesMsg:
+		m = new(NewPooledTransactionHashes)
+	default:
+		return errorf("invalid message code: %d", msg.Code)
+	}
+	if err := msg.Decode(m); err != nil {
+		return errorf("could not decode message %d: %v", msg.Code, err)
+	}
+	return m
+}
+
+// ReadAndServe serves GetBlockHeaders requests and keep-alive pings while
+// waiting for the next message from the remote node.
+func (c *Conn) ReadAndServe(chain *Chain, timeout time.Duration) Message {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		c.SetReadDeadline(deadline)
+		switch msg := c.read().(type) {
+		case *Ping:
+			c.Write(&Pong{})
+		case *GetBlockHeaders:
+			headers, err := chain.GetHeaders(*msg)
+			if err != nil {
+				return errorf("could not get headers for inbound header request: %v", err)
+			}
+			if err := c.Write(headers); err != nil {
+				return errorf("could not write to connection: %v", err)
+			}
+		default:
+			return msg
+		}
+	}
+	return errorf("no message received within %v", timeout)
+}
+
+// Write encodes and sends a message.
+func (c *Conn) Write(msg Message) error {
+	return p2p.Send(c, uint64(msg.Code()), msg)
+}
+
+// handshake performs the protocol handshake. Snappy compression is enabled
+// and the eth protocol version negotiated according to the remote hello.
+func (c *Conn) handshake(t *utesting.T) *Hello {
+	pub := crypto.FromECDSAPub(&c.ourKey.PublicKey)[1:]
+	ourHandshake := &Hello{
+		Version: 5,
+		Name:    "devp2p-ethtest",
+		Caps:    []p2p.Cap{{Name: "eth", Version: 64}, {Name: "eth", Version: 65}},
+		ID:      pub,
+	}
+	if err := c.Write(ourHandshake); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	switch msg := c.Read().(type) {
+	case *Hello:
+		if msg.Version >= 5 {
+			c.SetSnappy(true)
+		}
+		c.negotiateEthProtocol(ourHandshake.Caps, msg.Caps)
+		if c.ethProtocolVersion == 0 {
+			t.Fatalf("no common eth protocol version, remote caps: %v", msg.Caps)
+		}
+		return msg
+	case *Disconnect:
+		t.Fatalf("disconnect received during handshake: %v", msg.Reason)
+	default:
+		t.Fatalf("bad handshake: %#v", msg)
+	}
+	return nil
+}
+
+// negotiateEthProtocol sets the Conn's eth protocol version to the highest
+// advertised capability supported by both sides.
+func (c *Conn) negotiateEthProtocol(ours, theirs []p2p.Cap) {
+	var highest uint
+	for _, their := range theirs {
+		for _, our := range ours {
+			if their.Name == "eth" && our == their && their.Version > highest {
+				highest = their.Version
+			}
+		}
+	}
+	c.ethProtocolVersion = highest
+}
+
+// statusExchange reads the status message of the remote node and checks it
+// against the given chain. A status matching the remote node's view of the
+// chain is sent in response, after applying modify if it is non-nil. The part
+// of the chain known to the remote node is returned.
+func (c *Conn) statusExchange(t *utesting.T, chain *Chain, modify func(*Status)) *Chain {
+	var their *Status
+loop:
+	for {
+		switch msg := c.Read().(type) {
+		case *Status:
+			their = msg
+			break loop
+		case *Ping:
+			c.Write(&Pong{})
+		case *Disconnect:
+			t.Fatalf("disconnect received: %v", msg.Reason)
+		case *Error:
+			t.Fatalf("could not read status: %v", msg)
+		default:
+			t.Fatalf("bad status message: %#v", msg)
+		}
+	}
+	if their.Genesis != chain.blocks[0].Hash() {
+		t.Fatalf("wrong genesis block in status: have %x, want %x", their.Genesis, chain.blocks[0].Hash())
+	}
+	head := chain.blockByHash(their.Head)
+	if head == nil {
+		t.Fatalf("head block %x in status is not part of the test chain", their.Head)
+	}
+	view := chain.Shorten(int(head.NumberU64()) + 1)
+	if have, want := their.TD, view.TD(view.Len()-1); have.Cmp(want) != 0 {
+		t.Fatalf("wrong TD in status: have %v, want %v", have, want)
+	}
+	if have, want := their.ForkID, view.ForkID(); have != want {
+		t.Fatalf("wrong fork ID in status: have %v, want %v", have, want)
+	}
+	status := &Status{
+		ProtocolVersion: uint32(c.ethProtocolVersion),
+		NetworkID:       their.NetworkID,
+		TD:              view.TD(view.Len() - 1),
+		Head:            view.Head().Hash(),
+		Genesis:         view.blocks[0].Hash(),
+		ForkID:          view.ForkID(),
+	}
+	if modify != nil {
+		modify(status)
+	}
+	if err := c.Write(status); err != nil {
+		t.Fatalf("could not write to connection: %v", err)
+	}
+	return view
+}
+
+// waitForBlock polls the remote node until it has imported the given block.
+func (c *Conn) waitForBlock(chain *Chain, block *types.Block) error {
+	deadline := time.Now().Add(timeout)
+	req := &GetBlockHeaders{Origin: hashOrNumber{Hash: block.Hash()}, Amount: 1}
+	for time.Now().Before(deadline) {
+		if err := c.Write(req); err != nil {
+			return err
+		}
+		switch msg := c.ReadAndServe(chain, timeout).(type) {
+		case *BlockHeaders:
+			if len(*msg) > 0 {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		case *Error:
+			return msg
+		default:
+			// Ignore announcements and other unrelated traffic.
+		}
+	}
+	return fmt.Errorf("block %d (%x) not imported within %v", block.NumberU64(), block.Hash(), timeout)
+}
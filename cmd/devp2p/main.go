@@ -61,6 +61,8 @@ func init() {
 		discv4Command,
 		dnsCommand,
 		nodesetCommand,
+		rlpxCommand,
+		crawlPublishCommand,
 	}
 }
 
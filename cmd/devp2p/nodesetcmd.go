@@ -19,6 +19,7 @@ package main
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/ethereum/go-ethereum/core/forkid"
@@ -93,6 +94,8 @@ type nodeFilterC struct {
 var filterFlags = map[string]nodeFilterC{
 	"-ip":          {1, ipFilter},
 	"-min-age":     {1, minAgeFilter},
+	"-min-score":   {1, minScoreFilter},
+	"-seen-within": {1, seenWithinFilter},
 	"-eth-network": {1, ethFilter},
 	"-les-server":  {0, lesFilter},
 }
@@ -154,6 +157,24 @@ func minAgeFilter(args []string) (nodeFilter, error) {
 	return f, nil
 }
 
+func minScoreFilter(args []string) (nodeFilter, error) {
+	minscore, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, err
+	}
+	f := func(n nodeJSON) bool { return n.Score >= minscore }
+	return f, nil
+}
+
+func seenWithinFilter(args []string) (nodeFilter, error) {
+	within, err := time.ParseDuration(args[0])
+	if err != nil {
+		return nil, err
+	}
+	f := func(n nodeJSON) bool { return time.Since(n.LastResponse) <= within }
+	return f, nil
+}
+
 func ethFilter(args []string) (nodeFilter, error) {
 	var filter forkid.Filter
 	switch args[0] {
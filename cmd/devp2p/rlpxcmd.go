@@ -0,0 +1,119 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/ethereum/go-ethereum/cmd/devp2p/internal/ethtest"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/utesting"
+	"github.com/ethereum/go-ethereum/p2p"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	rlpxCommand = cli.Command{
+		Name:  "rlpx",
+		Usage: "RLPx Commands",
+		Subcommands: []cli.Command{
+			rlpxPingCommand,
+			rlpxEthTestCommand,
+		},
+	}
+	rlpxPingCommand = cli.Command{
+		Name:      "ping",
+		Usage:     "Performs the RLPx handshake and prints the remote hello message",
+		Action:    rlpxPing,
+		ArgsUsage: "<node>",
+	}
+	rlpxEthTestCommand = cli.Command{
+		Name:      "eth-test",
+		Usage:     "Runs tests against a node",
+		ArgsUsage: "<node> <chain.rlp> <genesis.json>",
+		Action:    rlpxEthTest,
+		Flags:     []cli.Flag{testPatternFlag},
+	}
+)
+
+var testPatternFlag = cli.StringFlag{
+	Name:  "run",
+	Usage: "Pattern of test suite(s) to run",
+}
+
+func rlpxPing(ctx *cli.Context) error {
+	n := getNodeArg(ctx)
+	fd, err := net.Dial("tcp", fmt.Sprintf("%v:%d", n.IP(), n.TCP()))
+	if err != nil {
+		return err
+	}
+	conn := p2p.NewRLPxConn(fd)
+	defer conn.Close()
+
+	ourKey, _ := crypto.GenerateKey()
+	if _, err := conn.Handshake(ourKey, n.Pubkey()); err != nil {
+		return err
+	}
+	msg, err := conn.ReadMsg()
+	if err != nil {
+		return err
+	}
+	switch msg.Code {
+	case 0:
+		var h ethtest.Hello
+		if err := msg.Decode(&h); err != nil {
+			return fmt.Errorf("invalid handshake: %v", err)
+		}
+		fmt.Printf("%+v\n", h)
+	case 1:
+		var reason []p2p.DiscReason
+		if msg.Decode(&reason); len(reason) == 0 {
+			return fmt.Errorf("invalid disconnect message")
+		}
+		return fmt.Errorf("received disconnect message: %v", reason[0])
+	default:
+		return fmt.Errorf("invalid message code %d, expected handshake (code zero)", msg.Code)
+	}
+	return nil
+}
+
+func rlpxEthTest(ctx *cli.Context) error {
+	if ctx.NArg() < 3 {
+		exit("missing node, chain.rlp and genesis.json as command-line arguments")
+	}
+	n, err := parseNode(ctx.Args()[0])
+	if err != nil {
+		exit(err)
+	}
+	suite, err := ethtest.NewSuite(n, ctx.Args()[1], ctx.Args()[2])
+	if err != nil {
+		exit(err)
+	}
+	tests := suite.AllTests()
+	if ctx.IsSet(testPatternFlag.Name) {
+		tests = utesting.MatchTests(tests, ctx.String(testPatternFlag.Name))
+	}
+	results := utesting.RunTests(tests, os.Stdout)
+	fails := utesting.CountFailures(results)
+	fmt.Printf("%d/%d tests passed.\n", len(results)-fails, len(results))
+	if fails > 0 {
+		return fmt.Errorf("%d tests failed", fails)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// cliqueExtraVanity is the number of extra-data prefix bytes reserved for the
+// clique signer vanity.
+const cliqueExtraVanity = 32
+
+// header is the JSON representation of a block header to assemble. The roots
+// derivable from the block body are optional; if they are given, they must match
+// the body of the block.
+type header struct {
+	ParentHash  common.Hash           `json:"parentHash"`
+	OmmerHash   *common.Hash          `json:"sha3Uncles"`
+	Coinbase    common.Address        `json:"miner"`
+	Root        common.Hash           `json:"stateRoot"`
+	TxHash      *common.Hash          `json:"transactionsRoot"`
+	ReceiptHash common.Hash           `json:"receiptsRoot"`
+	Bloom       types.Bloom           `json:"logsBloom"`
+	Difficulty  *math.HexOrDecimal256 `json:"difficulty"`
+	Number      *math.HexOrDecimal256 `json:"number"`
+	GasLimit    math.HexOrDecimal64   `json:"gasLimit"`
+	GasUsed     math.HexOrDecimal64   `json:"gasUsed"`
+	Time        math.HexOrDecimal64   `json:"timestamp"`
+	Extra       hexutil.Bytes         `json:"extraData"`
+	MixDigest   common.Hash           `json:"mixHash"`
+	Nonce       types.BlockNonce      `json:"nonce"`
+}
+
+// toHeader converts the JSON header into a consensus header, leaving the roots
+// derivable from the block body empty if they were not specified.
+func (h *header) toHeader() *types.Header {
+	head := &types.Header{
+		ParentHash:  h.ParentHash,
+		Coinbase:    h.Coinbase,
+		Root:        h.Root,
+		ReceiptHash: h.ReceiptHash,
+		Bloom:       h.Bloom,
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int),
+		GasLimit:    uint64(h.GasLimit),
+		GasUsed:     uint64(h.GasUsed),
+		Time:        uint64(h.Time),
+		Extra:       common.CopyBytes(h.Extra),
+		MixDigest:   h.MixDigest,
+		Nonce:       h.Nonce,
+	}
+	if h.OmmerHash != nil {
+		head.UncleHash = *h.OmmerHash
+	}
+	if h.TxHash != nil {
+		head.TxHash = *h.TxHash
+	}
+	if h.Difficulty != nil {
+		head.Difficulty = (*big.Int)(h.Difficulty)
+	}
+	if h.Number != nil {
+		head.Number = (*big.Int)(h.Number)
+	}
+	return head
+}
+
+// bbInput is the combined input of the block builder when read from stdin.
+type bbInput struct {
+	Header *header          `json:"header,omitempty"`
+	Ommers []*header        `json:"ommers,omitempty"`
+	Txs    *json.RawMessage `json:"txs,omitempty"`
+}
+
+// blockInfo is the output of the block builder.
+type blockInfo struct {
+	Rlp  hexutil.Bytes `json:"rlp"`
+	Hash common.Hash   `json:"hash"`
+}
+
+// BuildMain is the entry point of the `evm b11r` command.
+func BuildMain(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Sanity check the sealing configuration before doing any work
+	var (
+		ethashMode = ctx.String(SealEthashModeFlag.Name)
+		cliqueKey  *ecdsa.PrivateKey
+	)
+	if ctx.Bool(SealEthashFlag.Name) && ctx.IsSet(SealCliqueFlag.Name) {
+		return NewError(ErrorConfig, errors.New("both ethash and clique sealing specified, only one may be chosen"))
+	}
+	if ethashMode != "normal" && ethashMode != "test" {
+		return NewError(ErrorConfig, fmt.Errorf("unknown ethash mode %q, want 'normal' or 'test'", ethashMode))
+	}
+	if ctx.IsSet(SealCliqueFlag.Name) {
+		key, err := crypto.LoadECDSA(ctx.String(SealCliqueFlag.Name))
+		if err != nil {
+			return NewError(ErrorConfig, fmt.Errorf("failed to load clique signing key: %v", err))
+		}
+		cliqueKey = key
+	}
+	// Load the header, ommers and transactions, either from stdin or from files
+	var (
+		headerStr = ctx.String(InputHeaderFlag.Name)
+		ommersStr = ctx.String(InputOmmersFlag.Name)
+		txsStr    = ctx.String(InputBlockTxsFlag.Name)
+		inputData = &bbInput{}
+	)
+	if headerStr == stdinSelector || ommersStr == stdinSelector || txsStr == stdinSelector {
+		if err := json.NewDecoder(os.Stdin).Decode(inputData); err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
+		}
+	}
+	if headerStr != stdinSelector {
+		if err := loadFile(headerStr, "header", &inputData.Header); err != nil {
+			return err
+		}
+	}
+	if inputData.Header == nil {
+		return NewError(ErrorJson, errors.New("missing header"))
+	}
+	if ommersStr != stdinSelector && ommersStr != "" {
+		if err := loadFile(ommersStr, "ommers", &inputData.Ommers); err != nil {
+			return err
+		}
+	}
+	if txsStr != stdinSelector && txsStr != "" {
+		if err := loadFile(txsStr, "txs", &inputData.Txs); err != nil {
+			return err
+		}
+	}
+	head := inputData.Header.toHeader()
+
+	// Decode the transactions, signing the ones which come with a secret key
+	var txs types.Transactions
+	if inputData.Txs != nil {
+		baseConfig, _, err := tests.GetChainConfig(ctx.String(ForknameFlag.Name))
+		if err != nil {
+			return NewError(ErrorConfig, fmt.Errorf("failed constructing chain configuration: %v", err))
+		}
+		chainConfig := *baseConfig
+		chainConfig.ChainID = big.NewInt(ctx.Int64(ChainIDFlag.Name))
+
+		if txs, err = decodeTransactions(*inputData.Txs, &chainConfig, head.Number.Uint64()); err != nil {
+			return err
+		}
+	}
+	ommers := make([]*types.Header, len(inputData.Ommers))
+	for i, ommer := range inputData.Ommers {
+		ommers[i] = ommer.toHeader()
+	}
+	// Assemble the block, verifying any body roots given explicitly
+	block, err := buildBlock(inputData.Header, head, txs, ommers)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ctx.Bool(SealEthashFlag.Name):
+		block, err = sealEthash(block, ethashMode, ctx.String(SealEthashDirFlag.Name))
+	case cliqueKey != nil:
+		block, err = sealClique(block, cliqueKey)
+	}
+	if err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return NewError(ErrorRlp, fmt.Errorf("failed to encode block: %v", err))
+	}
+	return dispatchBlock(ctx, &blockInfo{Rlp: enc, Hash: block.Hash()})
+}
+
+// decodeTransactions decodes the transactions to include in the block, which are
+// either given as the hex encoded RLP list of signed transactions, or as a list of
+// JSON transactions in the format accepted by the state transition tool.
+func decodeTransactions(input json.RawMessage, chainConfig *params.ChainConfig, number uint64) (types.Transactions, error) {
+	var blob hexutil.Bytes
+	if err := json.Unmarshal(input, &blob); err == nil {
+		var txs types.Transactions
+		if err := rlp.DecodeBytes(blob, &txs); err != nil {
+			return nil, NewError(ErrorRlp, fmt.Errorf("failed to decode transactions: %v", err))
+		}
+		return txs, nil
+	}
+	var txs []*txWithKey
+	if err := json.Unmarshal(input, &txs); err != nil {
+		return nil, NewError(ErrorJson, fmt.Errorf("failed unmarshaling txs: %v", err))
+	}
+	return signTransactions(txs, chainConfig, number)
+}
+
+// buildBlock assembles the block from its header and body, filling in the roots
+// derivable from the body, or verifying them if they were specified.
+func buildBlock(spec *header, head *types.Header, txs types.Transactions, ommers []*types.Header) (*types.Block, error) {
+	txHash := types.DeriveSha(txs)
+	if spec.TxHash != nil && *spec.TxHash != txHash {
+		return nil, NewError(ErrorConfig, fmt.Errorf("transactions root mismatch: header %x, body %x", *spec.TxHash, txHash))
+	}
+	head.TxHash = txHash
+
+	ommerHash := types.CalcUncleHash(ommers)
+	if spec.OmmerHash != nil && *spec.OmmerHash != ommerHash {
+		return nil, NewError(ErrorConfig, fmt.Errorf("ommers hash mismatch: header %x, body %x", *spec.OmmerHash, ommerHash))
+	}
+	head.UncleHash = ommerHash
+
+	return types.NewBlockWithHeader(head).WithBody(txs, ommers), nil
+}
+
+// sealEthash seals the block with ethash proof-of-work. The test mode uses a
+// small dataset, producing seals only valid for ethash engines in test mode.
+func sealEthash(block *types.Block, mode string, dir string) (*types.Block, error) {
+	if block.Difficulty().Sign() == 0 {
+		return nil, NewError(ErrorConfig, errors.New("cannot seal block with zero difficulty"))
+	}
+	var engine *ethash.Ethash
+	switch mode {
+	case "test":
+		engine = ethash.NewTester(nil, true)
+	default:
+		engine = ethash.New(ethash.Config{
+			PowMode:        ethash.ModeNormal,
+			CacheDir:       dir,
+			CachesInMem:    2,
+			CachesOnDisk:   3,
+			DatasetDir:     dir,
+			DatasetsInMem:  1,
+			DatasetsOnDisk: 2,
+		}, nil, true)
+	}
+	defer engine.Close()
+
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(nil, block, results, nil); err != nil {
+		return nil, NewError(ErrorConfig, fmt.Errorf("failed to seal block: %v", err))
+	}
+	found := <-results
+	if err := engine.VerifySeal(nil, found.Header()); err != nil {
+		return nil, NewError(ErrorConfig, fmt.Errorf("failed to verify ethash seal: %v", err))
+	}
+	return found, nil
+}
+
+// sealClique signs the block with the given clique signer key, reserving the
+// vanity and seal sections of the extra-data if they're missing.
+func sealClique(block *types.Block, key *ecdsa.PrivateKey) (*types.Block, error) {
+	head := block.Header()
+	if head.Coinbase != (common.Address{}) && head.Coinbase != crypto.PubkeyToAddress(key.PublicKey) {
+		log.Warn("Clique coinbase is a vote, not the signer", "coinbase", head.Coinbase)
+	}
+	if len(head.Extra) < cliqueExtraVanity+crypto.SignatureLength {
+		extra := make([]byte, cliqueExtraVanity+crypto.SignatureLength)
+		copy(extra, head.Extra)
+		head.Extra = extra
+	}
+	signature, err := crypto.Sign(clique.SealHash(head).Bytes(), key)
+	if err != nil {
+		return nil, NewError(ErrorConfig, fmt.Errorf("failed to sign block: %v", err))
+	}
+	copy(head.Extra[len(head.Extra)-crypto.SignatureLength:], signature)
+	return block.WithSeal(head), nil
+}
+
+// dispatchBlock writes the block either to stdout or stderr, or to the specified
+// file.
+func dispatchBlock(ctx *cli.Context, block *blockInfo) error {
+	switch dest := ctx.String(OutputBlockFlag.Name); dest {
+	case "stdout", "stderr":
+		out := os.Stdout
+		if dest == "stderr" {
+			out = os.Stderr
+		}
+		b, err := json.MarshalIndent(block, "", " ")
+		if err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+		}
+		out.Write(b)
+		out.Write([]byte("\n"))
+		return nil
+	default:
+		return saveFile(dest, block)
+	}
+}
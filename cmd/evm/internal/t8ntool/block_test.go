@@ -0,0 +1,117 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testBlockHeader returns the JSON header and ommer the test blocks are built from.
+func testBlockHeader(t *testing.T) (*header, *types.Header) {
+	var head header
+	blob := `{"parentHash": "0x0000000000000000000000000000000000000000000000000000000000000001", "difficulty": "0x20", "number": "1", "gasLimit": "0x47e7c4", "timestamp": "0x54c99069"}`
+	if err := json.Unmarshal([]byte(blob), &head); err != nil {
+		t.Fatalf("failed to decode header: %v", err)
+	}
+	ommer := &types.Header{Difficulty: big.NewInt(1), Number: big.NewInt(0), Coinbase: common.HexToAddress("0xdead")}
+	return &head, ommer
+}
+
+// Tests that block assembly fills in the body roots, rejecting mismatching ones.
+func TestBuildBlock(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.HomesteadSigner{}
+	tx, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+	txs := types.Transactions{tx}
+
+	spec, ommer := testBlockHeader(t)
+	block, err := buildBlock(spec, spec.toHeader(), txs, []*types.Header{ommer})
+	if err != nil {
+		t.Fatalf("failed to build block: %v", err)
+	}
+	if block.TxHash() != types.DeriveSha(txs) {
+		t.Errorf("transactions root mismatch: have %x, want %x", block.TxHash(), types.DeriveSha(txs))
+	}
+	if block.UncleHash() != types.CalcUncleHash([]*types.Header{ommer}) {
+		t.Errorf("ommers hash mismatch")
+	}
+	// Decoding the block must yield the identical block
+	enc, _ := rlp.EncodeToBytes(block)
+	var dec types.Block
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("failed to decode block: %v", err)
+	}
+	if dec.Hash() != block.Hash() || len(dec.Transactions()) != 1 || len(dec.Uncles()) != 1 {
+		t.Errorf("decoded block mismatch")
+	}
+	// Explicitly specified roots must match the body
+	spec.TxHash = &types.EmptyRootHash
+	if _, err := buildBlock(spec, spec.toHeader(), txs, nil); err == nil {
+		t.Errorf("mismatching transactions root accepted")
+	}
+}
+
+// Tests that blocks sealed with a clique key are signed by that key.
+func TestSealClique(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	spec, _ := testBlockHeader(t)
+	block, err := buildBlock(spec, spec.toHeader(), nil, nil)
+	if err != nil {
+		t.Fatalf("failed to build block: %v", err)
+	}
+	sealed, err := sealClique(block, key)
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	head := sealed.Header()
+	if len(head.Extra) != cliqueExtraVanity+crypto.SignatureLength {
+		t.Fatalf("extra-data length mismatch: have %d, want %d", len(head.Extra), cliqueExtraVanity+crypto.SignatureLength)
+	}
+	pubkey, err := crypto.SigToPub(clique.SealHash(head).Bytes(), head.Extra[cliqueExtraVanity:])
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Errorf("signer mismatch: have %x, want %x", signer, crypto.PubkeyToAddress(key.PublicKey))
+	}
+}
+
+// Tests that blocks can be sealed with ethash in test mode.
+func TestSealEthash(t *testing.T) {
+	spec, _ := testBlockHeader(t)
+	block, err := buildBlock(spec, spec.toHeader(), nil, nil)
+	if err != nil {
+		t.Fatalf("failed to build block: %v", err)
+	}
+	sealed, err := sealEthash(block, "test", "")
+	if err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	if sealed.MixDigest() == (common.Hash{}) {
+		t.Errorf("sealed block has no mix digest")
+	}
+}
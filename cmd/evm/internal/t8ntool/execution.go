@@ -0,0 +1,239 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/tests"
+	"golang.org/x/crypto/sha3"
+)
+
+// Prestate is the state and environment the transactions are applied on.
+type Prestate struct {
+	Env stEnv             `json:"env"`
+	Pre core.GenesisAlloc `json:"pre"`
+}
+
+// ExecutionResult contains the execution status after running a state transition,
+// excluding the post-state allocation itself.
+type ExecutionResult struct {
+	StateRoot   common.Hash         `json:"stateRoot"`
+	TxRoot      common.Hash         `json:"txRoot"`
+	ReceiptRoot common.Hash         `json:"receiptRoot"`
+	LogsHash    common.Hash         `json:"logsHash"`
+	Bloom       types.Bloom         `json:"logsBloom"`
+	Receipts    types.Receipts      `json:"receipts"`
+	Rejected    []*rejectedTx       `json:"rejected,omitempty"`
+	GasUsed     math.HexOrDecimal64 `json:"gasUsed"`
+}
+
+// rejectedTx is a transaction that couldn't be included in the block.
+type rejectedTx struct {
+	Index int    `json:"index"`
+	Err   string `json:"error"`
+}
+
+// ommer is an uncle of the block being assembled, which needs to be rewarded.
+type ommer struct {
+	Delta   uint64         `json:"delta"`
+	Address common.Address `json:"address"`
+}
+
+//go:generate gencodec -type stEnv -field-override stEnvMarshaling -out gen_stenv.go
+
+type stEnv struct {
+	Coinbase    common.Address                      `json:"currentCoinbase"   gencodec:"required"`
+	Difficulty  *big.Int                            `json:"currentDifficulty" gencodec:"required"`
+	GasLimit    uint64                              `json:"currentGasLimit"   gencodec:"required"`
+	Number      uint64                              `json:"currentNumber"     gencodec:"required"`
+	Timestamp   uint64                              `json:"currentTimestamp"  gencodec:"required"`
+	BlockHashes map[math.HexOrDecimal64]common.Hash `json:"blockHashes,omitempty"`
+	Ommers      []ommer                             `json:"ommers,omitempty"`
+}
+
+type stEnvMarshaling struct {
+	Coinbase   common.UnprefixedAddress
+	Difficulty *math.HexOrDecimal256
+	GasLimit   math.HexOrDecimal64
+	Number     math.HexOrDecimal64
+	Timestamp  math.HexOrDecimal64
+}
+
+// chainContext serves the ancestry of the block being assembled from the block
+// hashes of the environment, so that BLOCKHASH can be resolved by the EVM.
+// Hashes not supplied are treated as zero.
+type chainContext struct {
+	number uint64                              // Number of the block being assembled
+	hashes map[math.HexOrDecimal64]common.Hash // Hashes of the ancestors by number
+}
+
+// Engine implements core.ChainContext. The author of the block is always known,
+// so no consensus engine is needed to derive it.
+func (c *chainContext) Engine() consensus.Engine {
+	return nil
+}
+
+// GetHeader implements core.ChainContext, returning a stub header linking to
+// the hash of its parent.
+func (c *chainContext) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if number == 0 || number >= c.number {
+		return nil
+	}
+	return &types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		ParentHash: c.hashes[math.HexOrDecimal64(number-1)],
+	}
+}
+
+// Apply applies a set of transactions to a pre-state, rejecting the ones which
+// can't be included in a block.
+func (pre *Prestate) Apply(vmConfig vm.Config, chainConfig *params.ChainConfig, txs types.Transactions, miningReward int64, getTracerFn func(txIndex int, txHash common.Hash) (vm.Tracer, error)) (*state.StateDB, *ExecutionResult, error) {
+	var (
+		statedb = tests.MakePreState(rawdb.NewMemoryDatabase(), pre.Pre)
+		chain   = &chainContext{number: pre.Env.Number, hashes: pre.Env.BlockHashes}
+		header  = &types.Header{
+			Coinbase:   pre.Env.Coinbase,
+			Difficulty: pre.Env.Difficulty,
+			GasLimit:   pre.Env.GasLimit,
+			Number:     new(big.Int).SetUint64(pre.Env.Number),
+			Time:       pre.Env.Timestamp,
+		}
+		gaspool     = new(core.GasPool).AddGas(pre.Env.GasLimit)
+		rejectedTxs []*rejectedTx
+		includedTxs types.Transactions
+		gasUsed     = uint64(0)
+		receipts    = make(types.Receipts, 0)
+		txIndex     = 0
+	)
+	if pre.Env.Number > 0 {
+		header.ParentHash = pre.Env.BlockHashes[math.HexOrDecimal64(pre.Env.Number-1)]
+	}
+	// If DAO is supported/enabled, we need to handle it here. In geth 'proper', it's
+	// done in StateProcessor.Process(block, ...), right before transactions are applied.
+	if chainConfig.DAOForkSupport && chainConfig.DAOForkBlock != nil && chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
+		misc.ApplyDAOHardFork(statedb)
+	}
+	for i, tx := range txs {
+		tracer, err := getTracerFn(txIndex, tx.Hash())
+		if err != nil {
+			return nil, nil, err
+		}
+		vmConfig.Tracer = tracer
+		vmConfig.Debug = (tracer != nil)
+		statedb.Prepare(tx.Hash(), common.Hash{}, txIndex)
+
+		var (
+			snapshot = statedb.Snapshot()
+			gas      = *gaspool
+			used     = gasUsed
+		)
+		receipt, err := core.ApplyTransaction(chainConfig, chain, &pre.Env.Coinbase, gaspool, statedb, header, tx, &gasUsed, vmConfig)
+		if err != nil {
+			statedb.RevertToSnapshot(snapshot)
+			*gaspool, gasUsed = gas, used
+
+			log.Info("Rejected transaction", "index", i, "hash", tx.Hash(), "err", err)
+			rejectedTxs = append(rejectedTxs, &rejectedTx{i, err.Error()})
+			continue
+		}
+		includedTxs = append(includedTxs, tx)
+		receipts = append(receipts, receipt)
+		txIndex++
+	}
+	statedb.IntermediateRoot(chainConfig.IsEIP158(header.Number))
+
+	// Add mining reward. The mining reward may be zero, which only makes a difference
+	// if the coinbase has not been touched otherwise (e.g. only invalid transactions,
+	// or the coinbase self-destructed), as it's then created empty.
+	if miningReward >= 0 {
+		var (
+			blockReward = big.NewInt(miningReward)
+			minerReward = new(big.Int).Set(blockReward)
+			perOmmer    = new(big.Int).Div(blockReward, big.NewInt(32))
+		)
+		for _, ommer := range pre.Env.Ommers {
+			// Add 1/32th for each ommer included
+			minerReward.Add(minerReward, perOmmer)
+
+			// Add (8-delta)/8 to the ommer's miner
+			reward := big.NewInt(8)
+			reward.Sub(reward, new(big.Int).SetUint64(ommer.Delta))
+			reward.Mul(reward, blockReward)
+			reward.Div(reward, big.NewInt(8))
+			statedb.AddBalance(ommer.Address, reward)
+		}
+		statedb.AddBalance(pre.Env.Coinbase, minerReward)
+	}
+	// Commit the block and assemble the results
+	root, err := statedb.Commit(chainConfig.IsEIP158(header.Number))
+	if err != nil {
+		return nil, nil, NewError(ErrorEVM, fmt.Errorf("could not commit state: %v", err))
+	}
+	result := &ExecutionResult{
+		StateRoot:   root,
+		TxRoot:      types.DeriveSha(includedTxs),
+		ReceiptRoot: types.DeriveSha(receipts),
+		Bloom:       types.CreateBloom(receipts),
+		LogsHash:    rlpHash(statedb.Logs()),
+		Receipts:    receipts,
+		Rejected:    rejectedTxs,
+		GasUsed:     math.HexOrDecimal64(gasUsed),
+	}
+	return statedb, result, nil
+}
+
+// signTransactions signs the transactions which come with a secret key, using
+// the signer of the given fork.
+func signTransactions(txs []*txWithKey, chainConfig *params.ChainConfig, number uint64) (types.Transactions, error) {
+	signer := types.MakeSigner(chainConfig, new(big.Int).SetUint64(number))
+
+	signed := make(types.Transactions, len(txs))
+	for i, tx := range txs {
+		if tx.key == nil {
+			signed[i] = tx.tx
+			continue
+		}
+		stx, err := types.SignTx(tx.tx, signer, tx.key)
+		if err != nil {
+			return nil, NewError(ErrorJson, fmt.Errorf("tx %d: failed to sign transaction: %v", i, err))
+		}
+		signed[i] = stx
+	}
+	return signed, nil
+}
+
+// rlpHash calculates the keccak hash of the RLP encoding of an object.
+func rlpHash(x interface{}) (h common.Hash) {
+	hw := sha3.NewLegacyKeccak256()
+	rlp.Encode(hw, x)
+	hw.Sum(h[:0])
+	return h
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package t8ntool
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+// Tests that a transition applies the valid transactions of the sample inputs,
+// rejects the replayed one and that its post-state can be fed back as input.
+func TestTransition(t *testing.T) {
+	var in input
+	if err := loadFile("../../testdata/1/alloc.json", "alloc", &in.Alloc); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadFile("../../testdata/1/env.json", "env", &in.Env); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadFile("../../testdata/1/txs.json", "txs", &in.Txs); err != nil {
+		t.Fatal(err)
+	}
+	base, _, err := tests.GetChainConfig("Byzantium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := *base
+	config.ChainID = big.NewInt(1)
+
+	txs, err := signTransactions(in.Txs, &config, in.Env.Number)
+	if err != nil {
+		t.Fatalf("failed to sign transactions: %v", err)
+	}
+	noTracer := func(int, common.Hash) (vm.Tracer, error) { return nil, nil }
+
+	pre := &Prestate{Env: *in.Env, Pre: in.Alloc}
+	statedb, result, err := pre.Apply(vm.Config{}, &config, txs, 2000000000000000000, noTracer)
+	if err != nil {
+		t.Fatalf("transition failed: %v", err)
+	}
+	if len(result.Receipts) != 1 {
+		t.Errorf("receipt count mismatch: have %d, want 1", len(result.Receipts))
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Index != 1 {
+		t.Errorf("rejected transactions mismatch: have %v, want index 1", result.Rejected)
+	}
+	if result.GasUsed != 21000 {
+		t.Errorf("gas used mismatch: have %d, want 21000", result.GasUsed)
+	}
+	recipient := common.HexToAddress("0x8a8eafb1cf62bfbeb1741769dae1a9dd47996192")
+	if balance := statedb.GetBalance(recipient); balance.Cmp(big.NewInt(0xfeedbead+1)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want %v", balance, 0xfeedbead+1)
+	}
+	// Re-running an empty transition on the dumped post-state must not change it
+	pre = &Prestate{Env: *in.Env, Pre: tests.DumpAlloc(statedb)}
+	_, again, err := pre.Apply(vm.Config{}, &config, nil, -1, noTracer)
+	if err != nil {
+		t.Fatalf("re-transition failed: %v", err)
+	}
+	if again.StateRoot != result.StateRoot {
+		t.Errorf("state root mismatch after round trip: have %x, want %x", again.StateRoot, result.StateRoot)
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// Package t8ntool implements the state transition tool of the evm command, which
+// applies a set of transactions to a pre-state and outputs the resulting post-state,
+// as well as the block builder assembling the results into sealed blocks.
+package t8ntool
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/tests"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// Exit codes of the transition tool, to let callers distinguish between failure
+// causes without parsing the error messages.
+const (
+	ErrorEVM      = 2
+	ErrorVMConfig = 3
+	ErrorConfig   = 4
+	ErrorJson     = 10
+	ErrorIO       = 11
+	ErrorRlp      = 12
+
+	stdinSelector = "stdin"
+)
+
+// NumberedError is an error carrying the exit code the tool should terminate with.
+type NumberedError struct {
+	errorCode int
+	err       error
+}
+
+// NewError wraps an error with the given exit code.
+func NewError(errorCode int, err error) *NumberedError {
+	return &NumberedError{errorCode, err}
+}
+
+func (n *NumberedError) Error() string {
+	return fmt.Sprintf("ERROR(%d): %v", n.errorCode, n.err.Error())
+}
+
+// Code returns the exit code the tool should terminate with.
+func (n *NumberedError) Code() int {
+	return n.errorCode
+}
+
+// input is the combined input of the tool when read from stdin.
+type input struct {
+	Alloc core.GenesisAlloc `json:"alloc,omitempty"`
+	Env   *stEnv            `json:"env,omitempty"`
+	Txs   []*txWithKey      `json:"txs,omitempty"`
+}
+
+// txWithKey is a transaction which is either already signed, or comes with the
+// secret key to sign it with.
+type txWithKey struct {
+	key *ecdsa.PrivateKey
+	tx  *types.Transaction
+}
+
+func (t *txWithKey) UnmarshalJSON(input []byte) error {
+	// Read the secret key, if present
+	var key struct {
+		Key *common.Hash `json:"secretKey"`
+	}
+	if err := json.Unmarshal(input, &key); err != nil {
+		return err
+	}
+	if key.Key != nil {
+		ecdsaKey, err := crypto.ToECDSA(key.Key[:])
+		if err != nil {
+			return err
+		}
+		t.key = ecdsaKey
+	}
+	// Read the transaction itself
+	var tx types.Transaction
+	if err := json.Unmarshal(input, &tx); err != nil {
+		return err
+	}
+	t.tx = &tx
+	return nil
+}
+
+// Main is the entry point of the `evm t8n` command.
+func Main(ctx *cli.Context) error {
+	// Configure the go-ethereum logger
+	glogger := log.NewGlogHandler(log.StreamHandler(os.Stderr, log.TerminalFormat(false)))
+	glogger.Verbosity(log.Lvl(ctx.Int(VerbosityFlag.Name)))
+	log.Root().SetHandler(glogger)
+
+	// Configure the tracer creating a trace file per transaction, if requested
+	getTracer := func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+		return nil, nil
+	}
+	if ctx.Bool(TraceFlag.Name) {
+		logConfig := &vm.LogConfig{
+			DisableStack:  ctx.Bool(TraceDisableStackFlag.Name),
+			DisableMemory: ctx.Bool(TraceDisableMemoryFlag.Name),
+			Debug:         true,
+		}
+		var prevFile *os.File
+		defer func() {
+			if prevFile != nil {
+				prevFile.Close()
+			}
+		}()
+		getTracer = func(txIndex int, txHash common.Hash) (vm.Tracer, error) {
+			if prevFile != nil {
+				prevFile.Close()
+			}
+			traceFile, err := os.Create(fmt.Sprintf("trace-%d-%v.jsonl", txIndex, txHash.String()))
+			if err != nil {
+				return nil, NewError(ErrorIO, fmt.Errorf("failed creating trace-file: %v", err))
+			}
+			prevFile = traceFile
+			return vm.NewJSONLogger(logConfig, traceFile), nil
+		}
+	}
+	// Load the alloc, env and transactions, either from stdin or from files
+	var (
+		allocStr  = ctx.String(InputAllocFlag.Name)
+		envStr    = ctx.String(InputEnvFlag.Name)
+		txStr     = ctx.String(InputTxsFlag.Name)
+		inputData = &input{}
+	)
+	if allocStr == stdinSelector || envStr == stdinSelector || txStr == stdinSelector {
+		if err := json.NewDecoder(os.Stdin).Decode(inputData); err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed unmarshaling stdin: %v", err))
+		}
+	}
+	if allocStr != stdinSelector {
+		if err := loadFile(allocStr, "alloc", &inputData.Alloc); err != nil {
+			return err
+		}
+	}
+	if envStr != stdinSelector {
+		if err := loadFile(envStr, "env", &inputData.Env); err != nil {
+			return err
+		}
+	}
+	if txStr != stdinSelector {
+		if err := loadFile(txStr, "txs", &inputData.Txs); err != nil {
+			return err
+		}
+	}
+	if inputData.Env == nil {
+		return NewError(ErrorJson, fmt.Errorf("missing env"))
+	}
+	prestate := &Prestate{Env: *inputData.Env, Pre: inputData.Alloc}
+
+	// Construct the chain configuration of the requested fork
+	baseConfig, extraEips, err := tests.GetChainConfig(ctx.String(ForknameFlag.Name))
+	if err != nil {
+		return NewError(ErrorVMConfig, fmt.Errorf("failed constructing chain configuration: %v", err))
+	}
+	chainConfig := *baseConfig
+	chainConfig.ChainID = big.NewInt(ctx.Int64(ChainIDFlag.Name))
+
+	vmConfig := vm.Config{ExtraEips: extraEips}
+
+	// Sign any transactions coming with keys, apply them and write out the results
+	txs, err := signTransactions(inputData.Txs, &chainConfig, prestate.Env.Number)
+	if err != nil {
+		return err
+	}
+	statedb, result, err := prestate.Apply(vmConfig, &chainConfig, txs, ctx.Int64(RewardFlag.Name), getTracer)
+	if err != nil {
+		return err
+	}
+	return dispatchOutput(ctx, result, tests.DumpAlloc(statedb))
+}
+
+// loadFile decodes the JSON content of a file into the given object.
+func loadFile(path string, name string, obj interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed reading %s file: %v", name, err))
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(obj); err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed unmarshaling %s file: %v", name, err))
+	}
+	return nil
+}
+
+// saveFile marshals the object to the given file.
+func saveFile(filename string, data interface{}) error {
+	b, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+	}
+	if err = ioutil.WriteFile(filename, b, 0644); err != nil {
+		return NewError(ErrorIO, fmt.Errorf("failed writing output: %v", err))
+	}
+	return nil
+}
+
+// dispatchOutput writes the output data to either stderr or stdout, or to the
+// specified files.
+func dispatchOutput(ctx *cli.Context, result *ExecutionResult, alloc core.GenesisAlloc) error {
+	stdOutObject := make(map[string]interface{})
+	stdErrObject := make(map[string]interface{})
+
+	dispatch := func(fName, name string, obj interface{}) error {
+		switch fName {
+		case "stdout":
+			stdOutObject[name] = obj
+		case "stderr":
+			stdErrObject[name] = obj
+		default:
+			return saveFile(fName, obj)
+		}
+		return nil
+	}
+	if err := dispatch(ctx.String(OutputAllocFlag.Name), "alloc", alloc); err != nil {
+		return err
+	}
+	if err := dispatch(ctx.String(OutputResultFlag.Name), "result", result); err != nil {
+		return err
+	}
+	for out, obj := range map[*os.File]map[string]interface{}{os.Stdout: stdOutObject, os.Stderr: stdErrObject} {
+		if len(obj) == 0 {
+			continue
+		}
+		b, err := json.MarshalIndent(obj, "", " ")
+		if err != nil {
+			return NewError(ErrorJson, fmt.Errorf("failed marshalling output: %v", err))
+		}
+		out.Write(b)
+		out.Write([]byte("\n"))
+	}
+	return nil
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
 	"github.com/ethereum/go-ethereum/core/vm/runtime"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
@@ -82,13 +83,26 @@ func runCmd(ctx *cli.Context) error {
 	var (
 		tracer        vm.Tracer
 		debugLogger   *vm.StructLogger
+		profiler      *vm.Profiler
 		statedb       *state.StateDB
 		chainConfig   *params.ChainConfig
 		sender        = common.BytesToAddress([]byte("sender"))
 		receiver      = common.BytesToAddress([]byte("receiver"))
 		genesisConfig *core.Genesis
 	)
-	if ctx.GlobalBool(MachineFlag.Name) {
+	if config := ctx.GlobalString(EVMInterpreterFlag.Name); config != "" {
+		if _, err := vm.LoadEVMC(config, evmc.CapabilityEVM1); err != nil {
+			utils.Fatalf("Failed to load external EVM: %v", err)
+		}
+	}
+	profile := ctx.GlobalBool(ProfileFlag.Name) || ctx.GlobalString(ProfilePprofFlag.Name) != ""
+	if profile && (ctx.GlobalBool(MachineFlag.Name) || ctx.GlobalBool(DebugFlag.Name)) {
+		utils.Fatalf("Profiling can't be combined with --%s or --%s", DebugFlag.Name, MachineFlag.Name)
+	}
+	if profile {
+		profiler = vm.NewProfiler()
+		tracer = profiler
+	} else if ctx.GlobalBool(MachineFlag.Name) {
 		tracer = vm.NewJSONLogger(logconfig, os.Stdout)
 	} else if ctx.GlobalBool(DebugFlag.Name) {
 		debugLogger = vm.NewStructLogger(logconfig)
@@ -180,7 +194,7 @@ func runCmd(ctx *cli.Context) error {
 		BlockNumber: new(big.Int).SetUint64(genesisConfig.Number),
 		EVMConfig: vm.Config{
 			Tracer:         tracer,
-			Debug:          ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(MachineFlag.Name),
+			Debug:          ctx.GlobalBool(DebugFlag.Name) || ctx.GlobalBool(MachineFlag.Name) || profile,
 			EVMInterpreter: ctx.GlobalString(EVMInterpreterFlag.Name),
 		},
 	}
@@ -254,6 +268,23 @@ func runCmd(ctx *cli.Context) error {
 		vm.WriteLogs(os.Stderr, statedb.Logs())
 	}
 
+	if profiler != nil {
+		if ctx.GlobalBool(ProfileFlag.Name) {
+			fmt.Fprintln(os.Stderr, "#### PROFILE ####")
+			vm.WriteProfile(os.Stderr, profiler.Profile())
+		}
+		if path := ctx.GlobalString(ProfilePprofFlag.Name); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				utils.Fatalf("Failed to create pprof profile: %v", err)
+			}
+			if err := profiler.WritePprof(f); err != nil {
+				utils.Fatalf("Failed to write pprof profile: %v", err)
+			}
+			f.Close()
+		}
+	}
+
 	if ctx.GlobalBool(StatDumpFlag.Name) {
 		var mem goruntime.MemStats
 		goruntime.ReadMemStats(&mem)
@@ -266,7 +297,7 @@ Gas used:           %d
 
 `, execTime, mem.HeapObjects, mem.Alloc, mem.TotalAlloc, mem.NumGC, initialGas-leftOverGas)
 	}
-	if tracer == nil {
+	if tracer == nil || profile {
 		fmt.Printf("0x%x\n", ret)
 		if err != nil {
 			fmt.Printf(" error: %v\n", err)
@@ -0,0 +1,63 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/tests"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var testsCommand = cli.Command{
+	Action:    fillTestsCmd,
+	Name:      "tests",
+	Usage:     "regenerates the blockchain test fixtures of the built-in scenarios for every supported fork",
+	ArgsUsage: "<outdir>",
+}
+
+func fillTestsCmd(ctx *cli.Context) error {
+	outdir := ctx.Args().First()
+	if len(outdir) == 0 {
+		return errors.New("output directory argument required")
+	}
+	if err := os.MkdirAll(outdir, 0755); err != nil {
+		return err
+	}
+	for _, scenario := range tests.BlockScenarios {
+		filled, err := scenario.FillAll()
+		if err != nil {
+			return err
+		}
+		out, err := json.MarshalIndent(filled, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(outdir, scenario.Name+".json")
+		if err := ioutil.WriteFile(path, out, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Filled %d tests into %s\n", len(filled), path)
+	}
+	return nil
+}
@@ -182,13 +182,19 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.BootnodesFlag,
 			utils.BootnodesV4Flag,
 			utils.BootnodesV5Flag,
+			utils.BootnodesV5ENRFlag,
 			utils.ListenPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
+			utils.MaxPeersPerIPFlag,
+			utils.MaxPeersPerSubnetFlag,
+			utils.MaxInboundAttemptsFlag,
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
+			utils.DiscoveryV5ENRFlag,
 			utils.NetrestrictFlag,
+			utils.NetCaptureFlag,
 			utils.NodeKeyFileFlag,
 			utils.NodeKeyHexFlag,
 		},
@@ -206,6 +212,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.MinerExtraDataFlag,
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerNoVerfiyFlag,
+			utils.MinerOrderingFlag,
+			utils.MinerAllowlistFlag,
 		},
 	},
 	{
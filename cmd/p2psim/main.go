@@ -34,6 +34,13 @@
 //     $ p2psim node connect node01 node02
 //     Connected node01 to node02
 //
+// Scenarios described in a JSON file are run in a separate network using the
+// server's node adapter:
+//
+//     $ p2psim scenario ring.json
+//     scenario "ring" PASSED after 1.2s
+//     ...
+//
 package main
 
 import (
@@ -56,6 +63,33 @@ import (
 
 var client *simulations.Client
 
+var linkFlags = []cli.Flag{
+	cli.DurationFlag{
+		Name:  "latency",
+		Usage: "one-way latency",
+	},
+	cli.DurationFlag{
+		Name:  "jitter",
+		Usage: "maximum random deviation from the latency",
+	},
+	cli.Int64Flag{
+		Name:  "bandwidth",
+		Usage: "bandwidth per direction in bytes per second (0 = unlimited)",
+	},
+	cli.Float64Flag{
+		Name:  "loss",
+		Usage: "probability of a write being lost and retransmitted",
+	},
+	cli.Float64Flag{
+		Name:  "drop",
+		Usage: "probability of a write dropping the connection",
+	},
+	cli.BoolFlag{
+		Name:  "down",
+		Usage: "take the link down",
+	},
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Usage = "devp2p simulation command-line client"
@@ -103,6 +137,49 @@ func main() {
 			Usage:  "load a network snapshot from stdin",
 			Action: loadSnapshot,
 		},
+		{
+			Name:      "scenario",
+			ArgsUsage: "<file>",
+			Usage:     "run a scenario and report the result",
+			Action:    runScenario,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the result as JSON",
+				},
+			},
+		},
+		{
+			Name:   "link",
+			Usage:  "manage simulated link conditions",
+			Action: showLinks,
+			Subcommands: []cli.Command{
+				{
+					Name:   "show",
+					Usage:  "show link conditions",
+					Action: showLinks,
+				},
+				{
+					Name:   "default",
+					Usage:  "set the conditions of all links which are not configured individually",
+					Action: setDefaultLink,
+					Flags:  linkFlags,
+				},
+				{
+					Name:      "set",
+					ArgsUsage: "<node> <peer>",
+					Usage:     "set the conditions of the link between two nodes",
+					Action:    setLink,
+					Flags:     linkFlags,
+				},
+				{
+					Name:      "reset",
+					ArgsUsage: "<node> <peer>",
+					Usage:     "revert the link between two nodes to the default conditions",
+					Action:    resetLink,
+				},
+			},
+		},
 		{
 			Name:   "node",
 			Usage:  "manage simulation nodes",
@@ -249,6 +326,109 @@ func loadSnapshot(ctx *cli.Context) error {
 	return client.LoadSnapshot(snap)
 }
 
+func runScenario(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	f, err := os.Open(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scenario := &simulations.Scenario{}
+	if err := json.NewDecoder(f).Decode(scenario); err != nil {
+		return fmt.Errorf("invalid scenario: %v", err)
+	}
+	result, err := client.RunScenario(scenario)
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(ctx.App.Writer)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		result.Report(ctx.App.Writer)
+	}
+	if !result.Passed {
+		return fmt.Errorf("scenario %q failed", result.Name)
+	}
+	return nil
+}
+
+func showLinks(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	links, err := client.GetLinks()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(ctx.App.Writer, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "NODE\tPEER\tLATENCY\tJITTER\tBANDWIDTH\tLOSS\tDROP\tDOWN\n")
+	printLink := func(one, other string, c simulations.LinkConditions) {
+		fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%d\t%g\t%g\t%t\n", one, other, c.Latency, c.Jitter, c.Bandwidth, c.Loss, c.Drop, c.Down)
+	}
+	printLink("*", "*", links.Default)
+	for _, l := range links.Links {
+		printLink(l.One.TerminalString(), l.Other.TerminalString(), l.LinkConditions)
+	}
+	return nil
+}
+
+func linkConditions(ctx *cli.Context) simulations.LinkConditions {
+	return simulations.LinkConditions{
+		Latency:   simulations.Duration(ctx.Duration("latency")),
+		Jitter:    simulations.Duration(ctx.Duration("jitter")),
+		Bandwidth: ctx.Int64("bandwidth"),
+		Loss:      ctx.Float64("loss"),
+		Drop:      ctx.Float64("drop"),
+		Down:      ctx.Bool("down"),
+	}
+}
+
+func setDefaultLink(ctx *cli.Context) error {
+	if len(ctx.Args()) != 0 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	if err := client.SetDefaultLink(linkConditions(ctx)); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.App.Writer, "Updated default link conditions")
+	return nil
+}
+
+func setLink(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	nodeName := args[0]
+	peerName := args[1]
+	if err := client.SetLink(nodeName, peerName, linkConditions(ctx)); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.App.Writer, "Updated link between", nodeName, "and", peerName)
+	return nil
+}
+
+func resetLink(ctx *cli.Context) error {
+	args := ctx.Args()
+	if len(args) != 2 {
+		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
+	}
+	nodeName := args[0]
+	peerName := args[1]
+	if err := client.ResetLink(nodeName, peerName); err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.App.Writer, "Reset link between", nodeName, "and", peerName)
+	return nil
+}
+
 func listNodes(ctx *cli.Context) error {
 	if len(ctx.Args()) != 0 {
 		return cli.ShowCommandHelp(ctx, ctx.Command.Name)
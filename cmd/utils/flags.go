@@ -41,6 +41,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/downloader"
@@ -451,6 +452,15 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerOrderingFlag = cli.StringFlag{
+		Name:  "miner.ordering",
+		Usage: `Transaction ordering policy for built blocks ("price", "fifo", "fair" or "allowlist")`,
+		Value: miner.OrderingPrice,
+	}
+	MinerAllowlistFlag = cli.StringFlag{
+		Name:  "miner.allowlist",
+		Usage: "Comma separated accounts to prioritise with the allowlist ordering policy",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -598,6 +608,21 @@ var (
 		Usage: "Maximum number of pending connection attempts (defaults used if set to 0)",
 		Value: node.DefaultConfig.P2P.MaxPendingPeers,
 	}
+	MaxPeersPerIPFlag = cli.IntFlag{
+		Name:  "maxpeers.perip",
+		Usage: "Maximum number of inbound peers from a single IP address (no limit if set to 0)",
+		Value: node.DefaultConfig.P2P.MaxInboundPerIP,
+	}
+	MaxPeersPerSubnetFlag = cli.IntFlag{
+		Name:  "maxpeers.persubnet",
+		Usage: "Maximum number of inbound peers from a single /24 (IPv4) or /64 (IPv6) network (no limit if set to 0)",
+		Value: node.DefaultConfig.P2P.MaxInboundPerSubnet,
+	}
+	MaxInboundAttemptsFlag = cli.IntFlag{
+		Name:  "maxinboundattempts",
+		Usage: "Maximum number of inbound connection attempts per IP address within ten minutes (no limit if set to 0)",
+		Value: node.DefaultConfig.P2P.MaxInboundAttempts,
+	}
 	ListenPortFlag = cli.IntFlag{
 		Name:  "port",
 		Usage: "Network listening port",
@@ -618,6 +643,11 @@ var (
 		Usage: "Comma separated enode URLs for P2P v5 discovery bootstrap (light server, light nodes)",
 		Value: "",
 	}
+	BootnodesV5ENRFlag = cli.StringFlag{
+		Name:  "bootnodesv5.enr",
+		Usage: "Comma separated enode or ENR URLs for the ENR-based P2P v5 discovery bootstrap",
+		Value: "",
+	}
 	NodeKeyFileFlag = cli.StringFlag{
 		Name:  "nodekey",
 		Usage: "P2P node key file",
@@ -639,10 +669,18 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DiscoveryV5ENRFlag = cli.BoolFlag{
+		Name:  "v5disc.enr",
+		Usage: "Enables the experimental ENR-based V5 discovery mechanism",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
 	}
+	NetCaptureFlag = cli.StringFlag{
+		Name:  "netcapture",
+		Usage: "Records all devp2p protocol messages to the given file (for debugging)",
+	}
 
 	// ATM the url is left to the user and deployment to
 	JSpathFlag = cli.StringFlag{
@@ -726,12 +764,12 @@ var (
 
 	EWASMInterpreterFlag = cli.StringFlag{
 		Name:  "vm.ewasm",
-		Usage: "External ewasm configuration (default = built-in interpreter)",
+		Usage: "External ewasm configuration as path[,option=value...] (default = built-in interpreter)",
 		Value: "",
 	}
 	EVMInterpreterFlag = cli.StringFlag{
 		Name:  "vm.evm",
-		Usage: "External EVM configuration (default = built-in interpreter)",
+		Usage: "External EVM configuration as path[,option=value...] (default = built-in interpreter)",
 		Value: "",
 	}
 )
@@ -855,6 +893,32 @@ func setBootstrapNodesV5(ctx *cli.Context, cfg *p2p.Config) {
 	}
 }
 
+// setBootstrapNodesV5ENR creates a list of bootstrap nodes for the ENR-based v5
+// discovery from the command line flags. There are no pre-configured ones.
+func setBootstrapNodesV5ENR(ctx *cli.Context, cfg *p2p.Config) {
+	var urls []string
+	switch {
+	case ctx.GlobalIsSet(BootnodesV5ENRFlag.Name):
+		urls = strings.Split(ctx.GlobalString(BootnodesV5ENRFlag.Name), ",")
+	case ctx.GlobalIsSet(BootnodesFlag.Name):
+		urls = strings.Split(ctx.GlobalString(BootnodesFlag.Name), ",")
+	default:
+		return // keep the configured ones, if any.
+	}
+
+	cfg.BootstrapNodesV5ENR = make([]*enode.Node, 0, len(urls))
+	for _, url := range urls {
+		if url != "" {
+			node, err := enode.Parse(enode.ValidSchemes, url)
+			if err != nil {
+				log.Crit("Bootstrap URL invalid", "enode", url, "err", err)
+				continue
+			}
+			cfg.BootstrapNodesV5ENR = append(cfg.BootstrapNodesV5ENR, node)
+		}
+	}
+}
+
 // setListenAddress creates a TCP listening address string from set command
 // line flags.
 func setListenAddress(ctx *cli.Context, cfg *p2p.Config) {
@@ -1080,6 +1144,7 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	setListenAddress(ctx, cfg)
 	setBootstrapNodes(ctx, cfg)
 	setBootstrapNodesV5(ctx, cfg)
+	setBootstrapNodesV5ENR(ctx, cfg)
 
 	lightClient := ctx.GlobalString(SyncModeFlag.Name) == "light"
 	lightServer := (ctx.GlobalInt(LightLegacyServFlag.Name) != 0 || ctx.GlobalInt(LightServeFlag.Name) != 0)
@@ -1118,6 +1183,15 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	if ctx.GlobalIsSet(MaxPendingPeersFlag.Name) {
 		cfg.MaxPendingPeers = ctx.GlobalInt(MaxPendingPeersFlag.Name)
 	}
+	if ctx.GlobalIsSet(MaxPeersPerIPFlag.Name) {
+		cfg.MaxInboundPerIP = ctx.GlobalInt(MaxPeersPerIPFlag.Name)
+	}
+	if ctx.GlobalIsSet(MaxPeersPerSubnetFlag.Name) {
+		cfg.MaxInboundPerSubnet = ctx.GlobalInt(MaxPeersPerSubnetFlag.Name)
+	}
+	if ctx.GlobalIsSet(MaxInboundAttemptsFlag.Name) {
+		cfg.MaxInboundAttempts = ctx.GlobalInt(MaxInboundAttemptsFlag.Name)
+	}
 	if ctx.GlobalIsSet(NoDiscoverFlag.Name) || lightClient {
 		cfg.NoDiscovery = true
 	}
@@ -1131,6 +1205,9 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	} else if forceV5Discovery {
 		cfg.DiscoveryV5 = true
 	}
+	if ctx.GlobalIsSet(DiscoveryV5ENRFlag.Name) {
+		cfg.DiscoveryV5ENR = ctx.GlobalBool(DiscoveryV5ENRFlag.Name)
+	}
 
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
@@ -1139,6 +1216,9 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		}
 		cfg.NetRestrict = list
 	}
+	if ctx.GlobalIsSet(NetCaptureFlag.Name) {
+		cfg.CaptureFile = ctx.GlobalString(NetCaptureFlag.Name)
+	}
 
 	if ctx.GlobalBool(DeveloperFlag.Name) {
 		// --dev mode can't use p2p networking.
@@ -1317,6 +1397,24 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.Bool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerOrderingFlag.Name) {
+		cfg.Ordering = ctx.GlobalString(MinerOrderingFlag.Name)
+		if _, err := miner.NewTxOrdering(cfg.Ordering, nil); err != nil {
+			Fatalf("Invalid --miner.ordering: %v", err)
+		}
+	}
+	if ctx.GlobalIsSet(MinerAllowlistFlag.Name) {
+		if cfg.Ordering != miner.OrderingAllowlist {
+			Fatalf("--miner.allowlist requires --miner.ordering=%s", miner.OrderingAllowlist)
+		}
+		for _, account := range strings.Split(ctx.GlobalString(MinerAllowlistFlag.Name), ",") {
+			if trimmed := strings.TrimSpace(account); !common.IsHexAddress(trimmed) {
+				Fatalf("Invalid account in --miner.allowlist: %s", trimmed)
+			} else {
+				cfg.OrderingAllowlist = append(cfg.OrderingAllowlist, common.HexToAddress(trimmed))
+			}
+		}
+	}
 }
 
 func setWhitelist(ctx *cli.Context, cfg *eth.Config) {
@@ -1454,10 +1552,20 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 
 	if ctx.GlobalIsSet(EWASMInterpreterFlag.Name) {
 		cfg.EWASMInterpreter = ctx.GlobalString(EWASMInterpreterFlag.Name)
+		if cfg.EWASMInterpreter != "" {
+			if _, err := vm.LoadEVMC(cfg.EWASMInterpreter, evmc.CapabilityEWASM); err != nil {
+				Fatalf("Invalid --%s: %v", EWASMInterpreterFlag.Name, err)
+			}
+		}
 	}
 
 	if ctx.GlobalIsSet(EVMInterpreterFlag.Name) {
 		cfg.EVMInterpreter = ctx.GlobalString(EVMInterpreterFlag.Name)
+		if cfg.EVMInterpreter != "" {
+			if _, err := vm.LoadEVMC(cfg.EVMInterpreter, evmc.CapabilityEVM1); err != nil {
+				Fatalf("Invalid --%s: %v", EVMInterpreterFlag.Name, err)
+			}
+		}
 	}
 	if ctx.GlobalIsSet(RPCGlobalGasCap.Name) {
 		cfg.RPCGasCap = new(big.Int).SetUint64(ctx.GlobalUint64(RPCGlobalGasCap.Name))
@@ -181,6 +181,9 @@ type Clique struct {
 	signFn SignerFn       // Signer function to authorize hashes with
 	lock   sync.RWMutex   // Protects the signer fields
 
+	takeover        uint64           // Block number of the last block sealed by a preceding engine
+	takeoverSigners []common.Address // Initial signers when taking over a chain from another engine
+
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
 }
@@ -206,6 +209,14 @@ func New(config *params.CliqueConfig, db ethdb.Database) *Clique {
 	}
 }
 
+// Takeover configures the engine to seal an existing chain from the given block
+// onward, taking over from a different consensus engine. The signer set before
+// the given block is the one provided, instead of the one in the genesis block.
+func (c *Clique) Takeover(number uint64, signers []common.Address) {
+	c.takeover = number - 1
+	c.takeoverSigners = append([]common.Address(nil), signers...)
+}
+
 // Author implements consensus.Engine, returning the Ethereum address recovered
 // from the signature in the header's extra-data section.
 func (c *Clique) Author(header *types.Header) (common.Address, error) {
@@ -329,8 +340,20 @@ func (c *Clique) verifyCascadingFields(chain consensus.ChainReader, header *type
 	if err != nil {
 		return err
 	}
-	// If the block is a checkpoint block, verify the signer list
-	if number%c.config.Epoch == 0 {
+	// If the block is a checkpoint block, verify the signer list. Contract governed
+	// lists are checked against the parent state when the block is processed, which
+	// is why chains with governed signers can't be followed without processing them.
+	if number%c.config.Epoch == 0 && c.config.SignerContract != nil {
+		signers := extraSigners(header)
+		if len(signers) == 0 {
+			return errInvalidCheckpointSigners
+		}
+		for i := 1; i < len(signers); i++ {
+			if bytes.Compare(signers[i-1][:], signers[i][:]) >= 0 {
+				return errInvalidCheckpointSigners
+			}
+		}
+	} else if number%c.config.Epoch == 0 {
 		signers := make([]byte, len(snap.Signers)*common.AddressLength)
 		for i, signer := range snap.signers() {
 			copy(signers[i*common.AddressLength:], signer[:])
@@ -365,6 +388,12 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 				break
 			}
 		}
+		// If we're at the last block of a preceding engine, snapshot the initial signers
+		if len(c.takeoverSigners) > 0 && number == c.takeover {
+			snap = newSnapshot(c.config, c.signatures, number, hash, c.takeoverSigners)
+			log.Info("Created takeover snapshot", "number", number, "hash", hash)
+			break
+		}
 		// If we're at the genesis, snapshot the initial state. Alternatively if we're
 		// at a checkpoint block without a parent (light client CHT), or we have piled
 		// up more headers than allowed to be reorged (chain reinit from a freezer),
@@ -529,7 +558,13 @@ func (c *Clique) Prepare(chain consensus.ChainReader, header *types.Header) erro
 	header.Extra = header.Extra[:extraVanity]
 
 	if number%c.config.Epoch == 0 {
-		for _, signer := range snap.signers() {
+		signers := snap.signers()
+		if c.config.SignerContract != nil {
+			if signers, err = c.governedSigners(chain, header, snap); err != nil {
+				return err
+			}
+		}
+		for _, signer := range signers {
 			header.Extra = append(header.Extra, signer[:]...)
 		}
 	}
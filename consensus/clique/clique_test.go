@@ -17,7 +17,10 @@
 package clique
 
 import (
+	"crypto/ecdsa"
 	"math/big"
+	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -111,3 +114,303 @@ func TestReimportMirroredState(t *testing.T) {
 		t.Fatalf("chain head mismatch: have %d, want %d", head, 3)
 	}
 }
+
+// governanceTester is a clique chain with the signers governed by a contract,
+// sealing blocks one by one with a set of test keys.
+type governanceTester struct {
+	t      *testing.T
+	engine *Clique
+	chain  *core.BlockChain
+	keys   map[common.Address]*ecdsa.PrivateKey
+}
+
+// newGovernanceTester creates a clique chain with a single initial signer, and
+// a governance contract listing the given signers.
+func newGovernanceTester(t *testing.T, epoch uint64, governed []common.Address, keys ...*ecdsa.PrivateKey) *governanceTester {
+	var (
+		db       = rawdb.NewMemoryDatabase()
+		contract = common.HexToAddress("0x0000000000000000000000000000000000001000")
+		config   = *params.AllCliqueProtocolChanges
+	)
+	config.Clique = &params.CliqueConfig{Period: 0, Epoch: epoch, SignerContract: &contract}
+
+	tester := &governanceTester{t: t, engine: New(config.Clique, db), keys: make(map[common.Address]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		tester.keys[crypto.PubkeyToAddress(key.PublicKey)] = key
+	}
+	// Lay out the governed signers as a solidity address array in slot 0
+	storage := map[common.Hash]common.Hash{
+		{}: common.BigToHash(big.NewInt(int64(len(governed)))),
+	}
+	base := crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+	for i, signer := range governed {
+		storage[common.BigToHash(new(big.Int).Add(base, big.NewInt(int64(i))))] = signer.Hash()
+	}
+	genspec := &core.Genesis{
+		Config:    &config,
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+		Alloc: core.GenesisAlloc{
+			contract: {Balance: new(big.Int), Code: []byte{0x00}, Storage: storage},
+		},
+	}
+	signer := crypto.PubkeyToAddress(keys[0].PublicKey)
+	copy(genspec.ExtraData[extraVanity:], signer[:])
+	genspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, &config, tester.engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	tester.chain = chain
+	return tester
+}
+
+// seal creates the next block on top of the chain signed by the given signer,
+// optionally casting a vote and overriding the signer list of checkpoints.
+func (gt *governanceTester) seal(signer common.Address, vote *Vote, checkpoint []common.Address) *types.Block {
+	parent := gt.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash:  parent.Hash(),
+		Number:      new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:    parent.GasLimit(),
+		Time:        parent.Time() + 1,
+		Root:        parent.Root(),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+		UncleHash:   types.CalcUncleHash(nil),
+	}
+	gt.engine.Authorize(signer, nil)
+	snap, err := gt.engine.snapshot(gt.chain, parent.NumberU64(), parent.Hash(), nil)
+	if err != nil {
+		gt.t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	header.Difficulty = CalcDifficulty(snap, signer)
+	if vote != nil {
+		header.Coinbase = vote.Address
+		if vote.Authorize {
+			copy(header.Nonce[:], nonceAuthVote)
+		}
+	}
+	header.Extra = make([]byte, extraVanity)
+	if header.Number.Uint64()%gt.engine.config.Epoch == 0 {
+		if checkpoint == nil {
+			checkpoint, err = gt.engine.governedSigners(gt.chain, header, snap)
+			if err != nil {
+				gt.t.Fatalf("failed to retrieve governed signers: %v", err)
+			}
+		}
+		for _, signer := range checkpoint {
+			header.Extra = append(header.Extra, signer[:]...)
+		}
+	}
+	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+
+	sig, _ := crypto.Sign(SealHash(header).Bytes(), gt.keys[signer])
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+	return types.NewBlockWithHeader(header)
+}
+
+// signers returns the authorized signers at the chain head.
+func (gt *governanceTester) signers() []common.Address {
+	head := gt.chain.CurrentHeader()
+	snap, err := gt.engine.snapshot(gt.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		gt.t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	return snap.signers()
+}
+
+// sortedAddresses returns the addresses of the given keys in ascending order.
+func sortedAddresses(keys ...*ecdsa.PrivateKey) []common.Address {
+	addrs := make([]common.Address, len(keys))
+	for i, key := range keys {
+		addrs[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	sort.Sort(signersAscending(addrs))
+	return addrs
+}
+
+// Tests that the signer list of checkpoints is read from the governance contract
+// and takes effect right after the checkpoint.
+func TestGovernedSigners(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		keyB, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB   = crypto.PubkeyToAddress(keyB.PublicKey)
+	)
+	tester := newGovernanceTester(t, 3, []common.Address{addrB, addrA}, keyA, keyB)
+	defer tester.chain.Stop()
+
+	// Seal up to the checkpoint with the genesis signer only
+	for i := 0; i < 3; i++ {
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+			t.Fatalf("block #%d: failed to insert: %v", i+1, err)
+		}
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA, keyB); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after checkpoint: have %x, want %x", signers, want)
+	}
+	// The newly governed signer must be able to seal
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrB, nil, nil)}); err != nil {
+		t.Fatalf("failed to insert block of governed signer: %v", err)
+	}
+}
+
+// Tests that checkpoints listing signers different from the governance contract
+// are rejected.
+func TestGovernedSignersMismatch(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		keyB, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB   = crypto.PubkeyToAddress(keyB.PublicKey)
+	)
+	tester := newGovernanceTester(t, 3, []common.Address{addrA, addrB}, keyA, keyB)
+	defer tester.chain.Stop()
+
+	for i := 0; i < 2; i++ {
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+			t.Fatalf("block #%d: failed to insert: %v", i+1, err)
+		}
+	}
+	block := tester.seal(addrA, nil, []common.Address{addrA})
+	if _, err := tester.chain.InsertChain(types.Blocks{block}); err != errMismatchingCheckpointSigners {
+		t.Fatalf("checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+}
+
+// Tests that votes still modify the signers within an epoch, and take precedence
+// over the governance contract at the next checkpoint.
+func TestGovernedSignersVoteOverride(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		keyB, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB   = crypto.PubkeyToAddress(keyB.PublicKey)
+	)
+	tester := newGovernanceTester(t, 3, []common.Address{addrA}, keyA, keyB)
+	defer tester.chain.Stop()
+
+	// Vote in a new signer and let it seal a block
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, &Vote{Address: addrB, Authorize: true}, nil)}); err != nil {
+		t.Fatalf("failed to insert vote: %v", err)
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA, keyB); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after vote: have %x, want %x", signers, want)
+	}
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrB, nil, nil)}); err != nil {
+		t.Fatalf("failed to insert block of voted signer: %v", err)
+	}
+	// Cross the checkpoint, which must not list the contract signers only
+	block := tester.seal(addrA, nil, []common.Address{addrA})
+	if _, err := tester.chain.InsertChain(types.Blocks{block}); err != errMismatchingCheckpointSigners {
+		t.Fatalf("checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA, keyB); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after checkpoint: have %x, want %x", signers, want)
+	}
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrB, nil, nil)}); err != nil {
+		t.Fatalf("failed to insert block of voted signer after checkpoint: %v", err)
+	}
+}
+
+// Tests that votes keep taking precedence over the governance contract at every
+// later checkpoint, not just the first one after they passed.
+func TestGovernedSignersVoteOverridePersists(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		keyB, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB   = crypto.PubkeyToAddress(keyB.PublicKey)
+	)
+	tester := newGovernanceTester(t, 3, []common.Address{addrA}, keyA, keyB)
+	defer tester.chain.Stop()
+
+	// Vote in a new signer, then cross two checkpoints alternating the signers
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, &Vote{Address: addrB, Authorize: true}, nil)}); err != nil {
+		t.Fatalf("failed to insert vote: %v", err)
+	}
+	for i := 2; i <= 6; i++ {
+		signer := addrA
+		if i%2 == 0 {
+			signer = addrB
+		}
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(signer, nil, nil)}); err != nil {
+			t.Fatalf("block #%d: failed to insert: %v", i, err)
+		}
+		if i%3 == 0 {
+			if signers, want := tester.signers(), sortedAddresses(keyA, keyB); !reflect.DeepEqual(signers, want) {
+				t.Fatalf("block #%d: signers mismatch after checkpoint: have %x, want %x", i, signers, want)
+			}
+		}
+	}
+}
+
+// Tests that a signer voted out stays out at the next checkpoint, even though the
+// governance contract still lists it.
+func TestGovernedSignersConflictingVote(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		keyB, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+		addrB   = crypto.PubkeyToAddress(keyB.PublicKey)
+	)
+	tester := newGovernanceTester(t, 3, []common.Address{addrA, addrB}, keyA, keyB)
+	defer tester.chain.Stop()
+
+	// Let the contract authorize the second signer at the first checkpoint
+	for i := 0; i < 3; i++ {
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+			t.Fatalf("block #%d: failed to insert: %v", i+1, err)
+		}
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA, keyB); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after checkpoint: have %x, want %x", signers, want)
+	}
+	// Vote the contract listed signer out, requiring both signers to agree
+	for _, signer := range []common.Address{addrB, addrA} {
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(signer, &Vote{Address: addrB}, nil)}); err != nil {
+			t.Fatalf("failed to insert vote of %x: %v", signer, err)
+		}
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after vote: have %x, want %x", signers, want)
+	}
+	// Cross the checkpoint, which must not reinstate the signer of the contract
+	block := tester.seal(addrA, nil, []common.Address{addrA, addrB})
+	if _, err := tester.chain.InsertChain(types.Blocks{block}); err != errMismatchingCheckpointSigners {
+		t.Fatalf("checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+		t.Fatalf("failed to insert checkpoint: %v", err)
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch after checkpoint: have %x, want %x", signers, want)
+	}
+	if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrB, nil, nil)}); err != errUnauthorizedSigner {
+		t.Fatalf("dropped signer error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+}
+
+// Tests that an empty governance contract retains the voted signers.
+func TestGovernedSignersEmptyContract(t *testing.T) {
+	var (
+		keyA, _ = crypto.GenerateKey()
+		addrA   = crypto.PubkeyToAddress(keyA.PublicKey)
+	)
+	tester := newGovernanceTester(t, 2, nil, keyA)
+	defer tester.chain.Stop()
+
+	for i := 0; i < 3; i++ {
+		if _, err := tester.chain.InsertChain(types.Blocks{tester.seal(addrA, nil, nil)}); err != nil {
+			t.Fatalf("block #%d: failed to insert: %v", i+1, err)
+		}
+	}
+	if signers, want := tester.signers(), sortedAddresses(keyA); !reflect.DeepEqual(signers, want) {
+		t.Fatalf("signers mismatch: have %x, want %x", signers, want)
+	}
+}
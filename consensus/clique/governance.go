@@ -0,0 +1,152 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// maxGovernedSigners is the maximum number of signers accepted from the signer
+// governance contract, protecting against a malicious storage layout.
+const maxGovernedSigners = 1024
+
+var (
+	// errTooManyGovernedSigners is returned if the signer governance contract
+	// lists more signers than the allowed maximum.
+	errTooManyGovernedSigners = errors.New("too many signers in governance contract")
+
+	// errStateUnavailable is returned if the signers of a checkpoint block are to
+	// be read from the governance contract, but the chain can't provide its state.
+	errStateUnavailable = errors.New("signer governance state unavailable")
+)
+
+// stateReader is implemented by chains able to provide historical state, which is
+// needed to read the signer list from the governance contract.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// ContractSigners reads the list of signers from the storage of a governance
+// contract. The list is expected to be stored as a dynamic array of addresses in
+// storage slot 0, i.e. the first state variable of the contract being declared
+// as `address[] signers`. The returned list is sorted, without duplicates or the
+// zero address.
+func ContractSigners(statedb *state.StateDB, contract common.Address) ([]common.Address, error) {
+	length := statedb.GetState(contract, common.Hash{}).Big()
+	if length.Cmp(big.NewInt(maxGovernedSigners)) > 0 {
+		return nil, errTooManyGovernedSigners
+	}
+	var (
+		base    = crypto.Keccak256Hash(common.Hash{}.Bytes()).Big()
+		seen    = make(map[common.Address]struct{})
+		signers = make([]common.Address, 0, length.Uint64())
+	)
+	for i := uint64(0); i < length.Uint64(); i++ {
+		slot := common.BigToHash(new(big.Int).Add(base, new(big.Int).SetUint64(i)))
+		signer := common.BytesToAddress(statedb.GetState(contract, slot).Bytes())
+
+		if _, ok := seen[signer]; ok || signer == (common.Address{}) {
+			continue
+		}
+		seen[signer] = struct{}{}
+		signers = append(signers, signer)
+	}
+	sort.Sort(signersAscending(signers))
+	return signers, nil
+}
+
+// extraSigners retrieves the signer list from the extra-data of a checkpoint header.
+func extraSigners(header *types.Header) []common.Address {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil
+	}
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	return signers
+}
+
+// checkpointSigners returns the signers a checkpoint block needs to list on top
+// of the given parent snapshot and state: the ones of the governance contract,
+// with the outcome of the passed votes applied on top. If the result is empty,
+// the voted signers are retained.
+func (c *Clique) checkpointSigners(snap *Snapshot, statedb *state.StateDB) ([]common.Address, error) {
+	if c.config.SignerContract == nil {
+		return snap.signers(), nil
+	}
+	signers, err := ContractSigners(statedb, *c.config.SignerContract)
+	if err != nil {
+		return nil, err
+	}
+	if signers = snap.overridden(signers); len(signers) == 0 {
+		return snap.signers(), nil
+	}
+	return signers, nil
+}
+
+// governedSigners reads the signers a checkpoint block needs to list from the
+// governance contract, as of the state of its parent block.
+func (c *Clique) governedSigners(chain consensus.ChainReader, header *types.Header, snap *Snapshot) ([]common.Address, error) {
+	reader, ok := chain.(stateReader)
+	if !ok {
+		return nil, errStateUnavailable
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := reader.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	return c.checkpointSigners(snap, statedb)
+}
+
+// VerifyState implements consensus.StateVerifier, checking that the signer list
+// of a checkpoint block matches the governance contract in its parent state.
+func (c *Clique) VerifyState(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB) error {
+	number := header.Number.Uint64()
+	if c.config.SignerContract == nil || number == 0 || number%c.config.Epoch != 0 {
+		return nil
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	signers, err := c.checkpointSigners(snap, statedb)
+	if err != nil {
+		return err
+	}
+	want := make([]byte, 0, len(signers)*common.AddressLength)
+	for _, signer := range signers {
+		want = append(want, signer[:]...)
+	}
+	if !bytes.Equal(header.Extra[extraVanity:len(header.Extra)-extraSeal], want) {
+		return errMismatchingCheckpointSigners
+	}
+	return nil
+}
@@ -57,6 +57,8 @@ type Snapshot struct {
 	Recents map[uint64]common.Address   `json:"recents"` // Set of recent signers for spam protections
 	Votes   []*Vote                     `json:"votes"`   // List of votes cast in chronological order
 	Tally   map[common.Address]Tally    `json:"tally"`   // Current vote tally to avoid recalculating
+
+	Overrides map[common.Address]bool `json:"overrides,omitempty"` // Passed votes taking precedence over the governance contract
 }
 
 // signersAscending implements the sort interface to allow sorting a list of addresses
@@ -131,6 +133,12 @@ func (s *Snapshot) copy() *Snapshot {
 	for address, tally := range s.Tally {
 		cpy.Tally[address] = tally
 	}
+	if s.Overrides != nil {
+		cpy.Overrides = make(map[common.Address]bool)
+		for address, authorize := range s.Overrides {
+			cpy.Overrides[address] = authorize
+		}
+	}
 	copy(cpy.Votes, s.Votes)
 
 	return cpy
@@ -260,6 +268,13 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 		}
 		// If the vote passed, update the list of signers
 		if tally := snap.Tally[header.Coinbase]; tally.Votes > len(snap.Signers)/2 {
+			// Remember the outcome to apply it on top of the governance contract
+			if s.config.SignerContract != nil {
+				if snap.Overrides == nil {
+					snap.Overrides = make(map[common.Address]bool)
+				}
+				snap.Overrides[header.Coinbase] = tally.Authorize
+			}
 			if tally.Authorize {
 				snap.Signers[header.Coinbase] = struct{}{}
 			} else {
@@ -291,6 +306,23 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 			}
 			delete(snap.Tally, header.Coinbase)
 		}
+		// If the signers are governed by a contract, switch over to the checkpoint's
+		// list. It's validated against the contract, with the passed votes applied on
+		// top, when the block is processed; nodes not processing blocks refuse to
+		// follow such chains.
+		if s.config.SignerContract != nil && number%s.config.Epoch == 0 {
+			snap.Signers = make(map[common.Address]struct{})
+			for _, signer := range extraSigners(header) {
+				snap.Signers[signer] = struct{}{}
+			}
+			// Signer list might have shrunk, delete any leftover recent caches
+			limit := uint64(len(snap.Signers)/2 + 1)
+			for seen := range snap.Recents {
+				if seen+limit <= number {
+					delete(snap.Recents, seen)
+				}
+			}
+		}
 		// If we're taking too much time (ecrecover), notify the user once a while
 		if time.Since(logged) > 8*time.Second {
 			log.Info("Reconstructing voting history", "processed", i, "total", len(headers), "elapsed", common.PrettyDuration(time.Since(start)))
@@ -306,6 +338,30 @@ func (s *Snapshot) apply(headers []*types.Header) (*Snapshot, error) {
 	return snap, nil
 }
 
+// overridden applies the outcome of the passed votes to a signer list read from
+// the governance contract, votes taking precedence over the contract. Snapshots
+// are built from headers alone and can't tell when the contract catches up with
+// a vote, so an override lasts until a later vote on the same signer passes.
+func (s *Snapshot) overridden(signers []common.Address) []common.Address {
+	set := make(map[common.Address]struct{})
+	for _, signer := range signers {
+		set[signer] = struct{}{}
+	}
+	for signer, authorize := range s.Overrides {
+		if authorize {
+			set[signer] = struct{}{}
+		} else {
+			delete(set, signer)
+		}
+	}
+	result := make([]common.Address, 0, len(set))
+	for signer := range set {
+		result = append(result, signer)
+	}
+	sort.Sort(signersAscending(result))
+	return result
+}
+
 // signers retrieves the list of authorized signers in ascending order.
 func (s *Snapshot) signers() []common.Address {
 	sigs := make([]common.Address, 0, len(s.Signers))
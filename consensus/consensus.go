@@ -23,6 +23,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -116,6 +117,16 @@ type Engine interface {
 	Close() error
 }
 
+// StateVerifier is a consensus engine with rules depending on the chain state,
+// which can't be checked by header verification alone.
+type StateVerifier interface {
+	Engine
+
+	// VerifyState checks the consensus fields of a header against the state of
+	// its parent block, before any of the block's transactions are executed.
+	VerifyState(chain ChainReader, header *types.Header, state *state.StateDB) error
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
@@ -123,3 +134,25 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// BFT is a consensus engine reaching agreement on blocks by exchanging messages
+// with the other validators over a dedicated devp2p sub-protocol. Blocks sealed
+// by a BFT engine are final as soon as they are imported, they are never reorged.
+type BFT interface {
+	Engine
+
+	// Protocols returns the devp2p sub-protocols the engine uses to exchange
+	// consensus messages.
+	Protocols() []p2p.Protocol
+
+	// Start begins participating in the consensus on top of the given chain. The
+	// insert callback is used to import blocks agreed upon, but proposed remotely.
+	Start(chain ChainReader, insert func(*types.Block) error) error
+
+	// NewChainHead notifies the engine that the canonical chain was extended,
+	// moving the consensus onto the next block.
+	NewChainHead(head *types.Header)
+
+	// Stop terminates participation in the consensus.
+	Stop() error
+}
@@ -0,0 +1,739 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	eventQueueSize  = 256 // Number of events to queue up for the state machine
+	maxFutureBlocks = 16  // Maximum number of blocks ahead to keep consensus messages for
+	maxFutureRounds = 10  // Maximum number of rounds ahead to keep round changes for
+	maxRoundBackoff = 10  // Maximum number of times the round timeout is doubled
+)
+
+var (
+	errInvalidProposal = errors.New("invalid proposal")
+	errLockedProposal  = errors.New("proposal conflicts with locked block")
+)
+
+// coreState is the stage a validator reached in the current round.
+type coreState int
+
+const (
+	stateAcceptRequest coreState = iota // Waiting for the proposal of the round
+	statePreprepared                    // Proposal accepted, waiting for prepares
+	statePrepared                       // Quorum prepared, waiting for commits
+	stateCommitted                      // Quorum committed, waiting for the block import
+)
+
+// sealRequest is a block handed over by the miner for proposing.
+type sealRequest struct {
+	block   *types.Block
+	results chan<- *types.Block
+}
+
+// newHeadEvent notifies the state machine that the chain head changed.
+type newHeadEvent struct {
+	head *types.Header
+}
+
+// timeoutEvent is fired if a round did not complete in time.
+type timeoutEvent struct {
+	sequence uint64
+	round    uint64
+}
+
+// proposeEvent is fired when a delayed proposal's timestamp is reached.
+type proposeEvent struct {
+	sequence uint64
+	round    uint64
+}
+
+// roundMessages gathers the consensus messages of a single round.
+type roundMessages struct {
+	preprepare   *message
+	prepares     map[common.Address]*message
+	commits      map[common.Address]*message
+	roundChanges map[common.Address]*message
+}
+
+func newRoundMessages() *roundMessages {
+	return &roundMessages{
+		prepares:     make(map[common.Address]*message),
+		commits:      make(map[common.Address]*message),
+		roundChanges: make(map[common.Address]*message),
+	}
+}
+
+// count returns the number of messages in a set agreeing on the given digest.
+func count(msgs map[common.Address]*message, digest common.Hash) int {
+	var n int
+	for _, msg := range msgs {
+		if msg.Digest == digest {
+			n++
+		}
+	}
+	return n
+}
+
+// machine is the consensus state machine, driving the agreement on the block of a
+// single height through rounds of pre-prepare, prepare and commit messages. If
+// a round fails to complete in time, the validators vote to change rounds with
+// the next validator proposing.
+//
+// All the fields below the channels are only accessed from the event loop.
+type machine struct {
+	engine *IBFT
+	chain  consensus.ChainReader
+	insert func(*types.Block) error
+
+	events chan interface{}
+	quit   chan struct{}
+	wg     sync.WaitGroup
+
+	parent     *types.Header    // Head of the chain the consensus builds on
+	sequence   uint64           // Number of the block being agreed upon
+	round      uint64           // Current round at the height
+	state      coreState        // Stage reached in the current round
+	validators []common.Address // Validators at the current height, ascending
+
+	request  *sealRequest              // Latest block handed over by the miner
+	proposal *types.Block              // Proposal accepted in the current round
+	locked   *types.Block              // Block prepared by a quorum, the only one acceptable
+	rounds   map[uint64]*roundMessages // Messages gathered for the rounds of the height
+	changed  uint64                    // Highest round a round change was sent for
+
+	lockedRound uint64   // Round in which the locked block was prepared
+	lockedCert  [][]byte // Prepares and commits of a quorum justifying the locked block
+
+	backlog map[uint64][]*message // Messages for future heights
+	timer   *time.Timer           // Round timeout timer
+}
+
+// newMachine creates and starts a consensus state machine.
+func newMachine(engine *IBFT, chain consensus.ChainReader, insert func(*types.Block) error) *machine {
+	c := &machine{
+		engine:  engine,
+		chain:   chain,
+		insert:  insert,
+		events:  make(chan interface{}, eventQueueSize),
+		quit:    make(chan struct{}),
+		rounds:  make(map[uint64]*roundMessages),
+		backlog: make(map[uint64][]*message),
+	}
+	c.wg.Add(1)
+	go c.loop()
+	return c
+}
+
+// post feeds an event into the state machine.
+func (c *machine) post(ev interface{}) {
+	select {
+	case c.events <- ev:
+	case <-c.quit:
+	}
+}
+
+// stop terminates the state machine and waits for it to exit.
+func (c *machine) stop() {
+	close(c.quit)
+	c.wg.Wait()
+}
+
+// loop is the event loop of the state machine.
+func (c *machine) loop() {
+	defer c.wg.Done()
+	defer func() {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case ev := <-c.events:
+			switch ev := ev.(type) {
+			case *newHeadEvent:
+				c.handleNewHead(ev.head)
+			case *sealRequest:
+				c.handleRequest(ev)
+			case *message:
+				c.handleMessage(ev)
+			case *timeoutEvent:
+				c.handleTimeout(ev)
+			case *proposeEvent:
+				if ev.sequence == c.sequence && ev.round == c.round {
+					c.propose()
+				}
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// self returns the address of the local validator.
+func (c *machine) self() common.Address {
+	return c.engine.address()
+}
+
+// isValidator returns whether the address is a validator at the current height.
+func (c *machine) isValidator(addr common.Address) bool {
+	for _, validator := range c.validators {
+		if validator == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// proposer returns the validator proposing in the given round of the current height.
+func (c *machine) proposer(round uint64) common.Address {
+	return c.validators[(c.sequence+round)%uint64(len(c.validators))]
+}
+
+// quorum returns the number of validators that need to agree on something.
+func (c *machine) quorum() int {
+	return quorumSize(len(c.validators))
+}
+
+// faulty returns the number of faulty validators tolerated.
+func (c *machine) faulty() int {
+	return (len(c.validators) - 1) / 3
+}
+
+// handleNewHead moves the consensus onto the block following the new head.
+func (c *machine) handleNewHead(head *types.Header) {
+	if c.parent != nil && head.Number.Uint64() < c.sequence {
+		return // Stale or already known head
+	}
+	snap, err := c.engine.snapshot(c.chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		log.Error("Failed to retrieve validators", "number", head.Number, "hash", head.Hash(), "err", err)
+		return
+	}
+	if len(snap.Validators) == 0 {
+		log.Error("Empty validator set", "number", head.Number, "hash", head.Hash())
+		return
+	}
+	c.parent, c.sequence = head, head.Number.Uint64()+1
+	c.validators = snap.validators()
+	c.locked, c.lockedRound, c.lockedCert, c.changed = nil, 0, nil, 0
+	c.rounds = make(map[uint64]*roundMessages)
+
+	if c.request != nil && c.request.block.ParentHash() != head.Hash() {
+		c.request = nil
+	}
+	// Drop the stale backlog and collect the messages of the new height
+	var queued []*message
+	for seq, msgs := range c.backlog {
+		if seq == c.sequence {
+			queued = msgs
+		}
+		if seq <= c.sequence {
+			delete(c.backlog, seq)
+		}
+	}
+	log.Debug("Starting consensus on new height", "sequence", c.sequence, "validators", len(c.validators))
+	c.startRound(0)
+
+	for _, msg := range queued {
+		c.handleMessage(msg)
+	}
+}
+
+// handleRequest stores a block handed over by the miner, proposing it if the
+// local validator is the proposer of the current round.
+func (c *machine) handleRequest(req *sealRequest) {
+	if c.parent != nil && req.block.NumberU64() < c.sequence {
+		return
+	}
+	c.request = req
+	c.propose()
+}
+
+// handleTimeout requests a round change if the round didn't complete in time.
+func (c *machine) handleTimeout(ev *timeoutEvent) {
+	if ev.sequence != c.sequence {
+		return
+	}
+	next := c.round + 1
+	if c.changed >= next {
+		next = c.changed + 1
+	}
+	if ev.round != c.round && ev.round != c.changed {
+		return // Timer of an obsolete round
+	}
+	// Don't request rounds the other validators wouldn't keep the round changes for
+	if next > c.round+maxFutureRounds {
+		c.resetTimer(c.changed)
+		return
+	}
+	log.Debug("Consensus round timed out", "sequence", c.sequence, "round", c.round, "next", next)
+	c.sendRoundChange(next)
+}
+
+// resetTimer restarts the timeout of the given round, backing off exponentially
+// for later rounds.
+func (c *machine) resetTimer(round uint64) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	backoff := round
+	if backoff > maxRoundBackoff {
+		backoff = maxRoundBackoff
+	}
+	var (
+		timeout  = time.Duration(c.engine.config.RequestTimeout) * time.Millisecond << backoff
+		sequence = c.sequence
+	)
+	c.timer = time.AfterFunc(timeout, func() {
+		c.post(&timeoutEvent{sequence: sequence, round: round})
+	})
+}
+
+// startRound moves the consensus onto the given round of the current height.
+func (c *machine) startRound(round uint64) {
+	c.round, c.state, c.proposal = round, stateAcceptRequest, nil
+	if c.rounds[round] == nil {
+		c.rounds[round] = newRoundMessages()
+	}
+	// Forget about older rounds, they can't complete any more
+	for r := range c.rounds {
+		if r < round {
+			delete(c.rounds, r)
+		}
+	}
+	c.resetTimer(round)
+
+	log.Debug("Starting consensus round", "sequence", c.sequence, "round", round, "proposer", c.proposer(round))
+	c.propose()
+	c.advance()
+}
+
+// propose broadcasts the proposal of the current round if the local validator is
+// its proposer. A locked block is always re-proposed, otherwise the latest block
+// handed over by the miner is sealed and proposed once its timestamp is reached.
+func (c *machine) propose() {
+	if c.parent == nil || c.state != stateAcceptRequest || c.proposer(c.round) != c.self() {
+		return
+	}
+	if c.rounds[c.round].preprepare != nil {
+		return // Already proposed in this round
+	}
+	// Re-propose the block prepared in the highest round, as justified by the
+	// prepared certificates of the round changes
+	block, round := c.locked, c.lockedRound
+	for _, msg := range c.rounds[c.round].roundChanges {
+		if msg.block == nil || (block != nil && msg.PreparedRound <= round) {
+			continue
+		}
+		if c.verifyProposal(msg.block) == nil {
+			block, round = msg.block, msg.PreparedRound
+		}
+	}
+	if block == nil {
+		if c.request == nil || c.request.block.NumberU64() != c.sequence || c.request.block.ParentHash() != c.parent.Hash() {
+			return // Nothing to propose yet
+		}
+		// Wait until the block's timestamp is reached
+		if delay := time.Until(time.Unix(int64(c.request.block.Time()), 0)); delay > 0 {
+			sequence, round := c.sequence, c.round
+			time.AfterFunc(delay, func() {
+				c.post(&proposeEvent{sequence: sequence, round: round})
+			})
+			return
+		}
+		sealed, err := c.seal(c.request.block)
+		if err != nil {
+			log.Error("Failed to seal proposal", "sequence", c.sequence, "err", err)
+			return
+		}
+		block = sealed
+	}
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		log.Error("Failed to encode proposal", "sequence", c.sequence, "err", err)
+		return
+	}
+	digest := proposalHash(block.Header())
+	log.Debug("Proposing block", "sequence", c.sequence, "round", c.round, "digest", digest, "txs", len(block.Transactions()))
+	c.broadcast(&message{Code: msgPreprepare, Digest: digest, Proposal: enc})
+	c.advance()
+}
+
+// seal signs a block with the local validator key as its proposer.
+func (c *machine) seal(block *types.Block) (*types.Block, error) {
+	header := block.Header()
+	extra, err := types.ExtractIBFTExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	if extra.Seal, err = c.engine.sign(IBFTRLP(header)); err != nil {
+		return nil, err
+	}
+	if header.Extra, err = types.EncodeIBFTExtra(header.Extra, extra); err != nil {
+		return nil, err
+	}
+	return block.WithSeal(header), nil
+}
+
+// verifyProposal checks whether a proposed block can be agreed upon at the
+// current height.
+func (c *machine) verifyProposal(block *types.Block) error {
+	if block.NumberU64() != c.sequence || !c.extendsParent(block) {
+		return errInvalidProposal
+	}
+	if c.locked != nil && proposalHash(block.Header()) != proposalHash(c.locked.Header()) {
+		return errLockedProposal
+	}
+	if hash := types.DeriveSha(block.Transactions()); hash != block.TxHash() {
+		return errInvalidProposal
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return errInvalidProposal
+	}
+	return c.engine.verifyHeader(c.chain, block.Header(), nil, false)
+}
+
+// extendsParent reports whether the block builds on the parent of the current
+// height. Copies of the parent differing only in their seals are accepted too, as
+// the proposers of different rounds may assemble the same block with different
+// committed seals.
+func (c *machine) extendsParent(block *types.Block) bool {
+	if block.ParentHash() == c.parent.Hash() {
+		return true
+	}
+	parent := c.chain.GetHeader(block.ParentHash(), c.sequence-1)
+	return parent != nil && SealHash(parent) == SealHash(c.parent)
+}
+
+// broadcast signs a consensus message of the current height and round, sends it
+// to the network and records it locally.
+func (c *machine) broadcast(msg *message) {
+	if !c.isValidator(c.self()) {
+		return
+	}
+	msg.Sequence = c.sequence
+	if msg.Round == 0 {
+		msg.Round = c.round
+	}
+	if err := msg.sign(c.engine.sign); err != nil {
+		log.Error("Failed to sign consensus message", "msg", msg, "err", err)
+		return
+	}
+	msg.sender = c.self()
+	if msg.Code == msgPreprepare {
+		msg.block, _ = decodeBlock(msg.Proposal)
+	}
+	c.engine.gossip(msg.payload)
+	c.store(msg)
+}
+
+// decodeBlock decodes an RLP encoded block.
+func decodeBlock(enc []byte) (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(enc, block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// store records a consensus message of the current height.
+func (c *machine) store(msg *message) {
+	msgs := c.rounds[msg.Round]
+	if msgs == nil {
+		msgs = newRoundMessages()
+		c.rounds[msg.Round] = msgs
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		if msgs.preprepare == nil {
+			msgs.preprepare = msg
+		}
+	case msgPrepare:
+		msgs.prepares[msg.sender] = msg
+	case msgCommit:
+		msgs.commits[msg.sender] = msg
+	case msgRoundChange:
+		// Keep only the latest round change of a sender for the future rounds
+		if msg.Round > c.round {
+			for round, other := range c.rounds {
+				if round <= c.round || round == msg.Round || other.roundChanges[msg.sender] == nil {
+					continue
+				}
+				if round > msg.Round {
+					return
+				}
+				delete(other.roundChanges, msg.sender)
+			}
+		}
+		msgs.roundChanges[msg.sender] = msg
+	}
+}
+
+// handleMessage processes a consensus message received from a validator.
+func (c *machine) handleMessage(msg *message) {
+	if c.parent == nil || msg.Sequence < c.sequence {
+		return // Stale message, or not yet running
+	}
+	// Only store and relay messages of validators. Future heights are checked
+	// against the current validator set too, messages of validators joining in
+	// the meantime are recovered by their round changes.
+	if !c.isValidator(msg.sender) {
+		log.Debug("Discarding consensus message from non-validator", "msg", msg)
+		return
+	}
+	if msg.Sequence > c.sequence {
+		// Message of a future height, keep it around if not too far ahead
+		if msg.Sequence < c.sequence+maxFutureBlocks {
+			c.backlog[msg.Sequence] = append(c.backlog[msg.Sequence], msg)
+			c.engine.gossip(msg.payload)
+		}
+		return
+	}
+	if msg.Round < c.round {
+		return // Message of a past round
+	}
+	// Of the future rounds, only round changes not too far ahead are of interest
+	if msg.Round > c.round && (msg.Code != msgRoundChange || msg.Round > c.round+maxFutureRounds) {
+		return
+	}
+	switch msg.Code {
+	case msgPreprepare:
+		if msg.sender != c.proposer(msg.Round) || msg.block == nil || proposalHash(msg.block.Header()) != msg.Digest {
+			log.Debug("Discarding invalid pre-prepare", "msg", msg)
+			return
+		}
+	case msgCommit:
+		signer, err := recoverAddress(commitData(msg.Digest), msg.CommittedSeal)
+		if err != nil || signer != msg.sender {
+			log.Debug("Discarding commit with invalid seal", "msg", msg)
+			return
+		}
+	case msgRoundChange:
+		if msg.block != nil && !c.verifyPrepared(msg) {
+			log.Debug("Discarding round change without prepared certificate", "msg", msg)
+			return
+		}
+	}
+	c.engine.gossip(msg.payload)
+	c.store(msg)
+	c.advance()
+}
+
+// verifyPrepared checks whether the block carried by a round change is justified
+// by a prepared certificate: a quorum of distinct validators that prepared, or
+// committed to, the block in an earlier round of the current height.
+func (c *machine) verifyPrepared(msg *message) bool {
+	if msg.PreparedRound >= msg.Round || proposalHash(msg.block.Header()) != msg.Digest {
+		return false
+	}
+	signers := make(map[common.Address]struct{})
+	for _, payload := range msg.PreparedCert {
+		vote, err := decodeMessage(payload)
+		if err != nil || (vote.Code != msgPrepare && vote.Code != msgCommit) {
+			return false
+		}
+		if vote.Sequence != msg.Sequence || vote.Round != msg.PreparedRound || vote.Digest != msg.Digest || !c.isValidator(vote.sender) {
+			return false
+		}
+		signers[vote.sender] = struct{}{}
+	}
+	return len(signers) >= c.quorum()
+}
+
+// lock locks onto the proposal of the current round, keeping the prepares and
+// commits of the round agreeing on it as the prepared certificate.
+func (c *machine) lock(msgs *roundMessages, digest common.Hash) {
+	var (
+		cert = make([][]byte, 0, len(msgs.prepares))
+		seen = make(map[common.Address]struct{})
+	)
+	for _, votes := range []map[common.Address]*message{msgs.prepares, msgs.commits} {
+		for sender, msg := range votes {
+			if _, ok := seen[sender]; ok || msg.Digest != digest {
+				continue
+			}
+			seen[sender] = struct{}{}
+			cert = append(cert, msg.payload)
+		}
+	}
+	c.locked, c.lockedRound, c.lockedCert = c.proposal, c.round, cert
+}
+
+// advance moves the current round through the consensus stages as far as the
+// gathered messages allow, and handles round changes.
+func (c *machine) advance() {
+	if c.parent == nil {
+		return
+	}
+	// Committed validators wait for the block of the proposer, only moving on if
+	// the round times out before it's imported
+	if c.state == stateCommitted {
+		c.checkRoundChange()
+		return
+	}
+	msgs := c.rounds[c.round]
+
+	// Accept the proposal of the round if it's valid, preparing it
+	if c.state == stateAcceptRequest && msgs.preprepare != nil {
+		block := msgs.preprepare.block
+		if err := c.verifyProposal(block); err != nil {
+			log.Warn("Rejecting consensus proposal", "sequence", c.sequence, "round", c.round, "hash", block.Hash(), "err", err)
+			c.sendRoundChange(c.round + 1)
+			return
+		}
+		c.proposal, c.state = block, statePreprepared
+		c.broadcast(&message{Code: msgPrepare, Digest: proposalHash(block.Header())})
+	}
+	if c.state == stateAcceptRequest {
+		c.checkRoundChange()
+		return
+	}
+	digest := proposalHash(c.proposal.Header())
+
+	// Once a quorum prepared the proposal, lock on it and commit to it
+	if c.state == statePreprepared && count(msgs.prepares, digest) >= c.quorum() {
+		seal, err := c.engine.sign(commitData(digest))
+		if err != nil {
+			log.Error("Failed to sign committed seal", "err", err)
+			return
+		}
+		c.lock(msgs, digest)
+		c.state = statePrepared
+		c.broadcast(&message{Code: msgCommit, Digest: digest, CommittedSeal: seal})
+	}
+	// Once a quorum committed to the proposal, finalize it
+	if count(msgs.commits, digest) >= c.quorum() {
+		c.lock(msgs, digest)
+		c.state = stateCommitted
+		c.commit(msgs, digest)
+		return
+	}
+	c.checkRoundChange()
+}
+
+// sendRoundChange votes to move the current height onto the given round. Locked
+// validators include their locked block for the next proposer to adopt.
+func (c *machine) sendRoundChange(round uint64) {
+	if round <= c.changed {
+		return
+	}
+	c.changed = round
+
+	msg := &message{Code: msgRoundChange, Round: round}
+	if c.locked != nil {
+		enc, err := rlp.EncodeToBytes(c.locked)
+		if err == nil {
+			msg.Digest, msg.Proposal = proposalHash(c.locked.Header()), enc
+			msg.PreparedRound, msg.PreparedCert = c.lockedRound, c.lockedCert
+			msg.block = c.locked
+		}
+	}
+	c.broadcast(msg)
+	c.resetTimer(round)
+	c.checkRoundChange()
+}
+
+// checkRoundChange catches up with round changes requested by enough validators
+// to include an honest one, and moves onto a round once a quorum requested it.
+func (c *machine) checkRoundChange() {
+	rounds := make([]uint64, 0, len(c.rounds))
+	for round := range c.rounds {
+		if round > c.round {
+			rounds = append(rounds, round)
+		}
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] > rounds[j] })
+
+	for _, round := range rounds {
+		changes := len(c.rounds[round].roundChanges)
+		if changes >= c.quorum() {
+			c.startRound(round)
+			return
+		}
+		if changes >= c.faulty()+1 && round > c.changed {
+			c.sendRoundChange(round)
+			return
+		}
+	}
+}
+
+// commit assembles the agreed upon block with the committed seals of the quorum
+// and hands it over for import. Only the proposer of the round assembles the
+// block, so that all validators import the same set of committed seals; the
+// others wait for it to arrive through the chain, changing rounds on timeout
+// for the next proposer to assemble it instead.
+func (c *machine) commit(msgs *roundMessages, digest common.Hash) {
+	if c.proposer(c.round) != c.self() {
+		log.Debug("Committed to block, waiting for proposer", "sequence", c.sequence, "round", c.round, "digest", digest)
+		return
+	}
+	var committers []common.Address
+	for sender, msg := range msgs.commits {
+		if msg.Digest == digest {
+			committers = append(committers, sender)
+		}
+	}
+	sort.Slice(committers, func(i, j int) bool {
+		return bytes.Compare(committers[i][:], committers[j][:]) < 0
+	})
+	seals := make([][]byte, 0, len(committers))
+	for _, committer := range committers {
+		seals = append(seals, msgs.commits[committer].CommittedSeal)
+	}
+	header := c.proposal.Header()
+	extra, err := types.ExtractIBFTExtra(header)
+	if err != nil {
+		log.Error("Failed to decode committed block", "err", err)
+		return
+	}
+	extra.CommittedSeal = seals
+	if header.Extra, err = types.EncodeIBFTExtra(header.Extra, extra); err != nil {
+		log.Error("Failed to encode committed block", "err", err)
+		return
+	}
+	block := c.proposal.WithSeal(header)
+	log.Info("Committed new block", "number", block.Number(), "hash", block.Hash(), "round", c.round, "seals", len(seals))
+
+	// If the block is the one the local miner built, hand it back, otherwise import it
+	if c.request != nil && SealHash(c.request.block.Header()) == SealHash(header) {
+		select {
+		case c.request.results <- block:
+			return
+		default:
+			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header))
+		}
+	}
+	go func() {
+		if err := c.insert(block); err != nil {
+			log.Error("Failed to import committed block", "number", block.Number(), "hash", block.Hash(), "err", err)
+		}
+	}()
+}
@@ -0,0 +1,764 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package ibft implements the Istanbul byzantine fault tolerant consensus engine.
+//
+// A fixed set of validators agrees on every block through a three phase commit
+// (pre-prepare, prepare, commit), exchanging messages over a dedicated devp2p
+// sub-protocol. A block is only imported once a quorum of validators committed
+// to it, so blocks are final and the chain never reorgs.
+package ibft
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	checkpointInterval = 1024 // Number of blocks after which to save the vote snapshot to the database
+	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
+	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryMessages   = 4096 // Number of recent consensus messages to remember to avoid reprocessing
+)
+
+// IBFT protocol constants.
+var (
+	epochLength           = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
+	defaultRequestTimeout = uint64(10000) // Default milliseconds to wait for a proposal before changing rounds
+
+	nonceAuthVote = hexutil.MustDecode("0xffffffffffffffff") // Magic nonce number to vote on adding a new validator
+	nonceDropVote = hexutil.MustDecode("0x0000000000000000") // Magic nonce number to vote on removing a validator.
+
+	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	defaultDifficulty = big.NewInt(1) // Block difficulty, constant as there are no forks to choose from
+)
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	// errUnknownBlock is returned when the list of validators is requested for a
+	// block that is not part of the local blockchain.
+	errUnknownBlock = errors.New("unknown block")
+
+	// errInvalidCheckpointBeneficiary is returned if a checkpoint/epoch transition
+	// block has a beneficiary set to non-zeroes.
+	errInvalidCheckpointBeneficiary = errors.New("beneficiary in checkpoint block non-zero")
+
+	// errInvalidVote is returned if a nonce value is something else that the two
+	// allowed constants of 0x00..0 or 0xff..f.
+	errInvalidVote = errors.New("vote nonce not 0x00..0 or 0xff..f")
+
+	// errInvalidCheckpointVote is returned if a checkpoint/epoch transition block
+	// has a vote nonce set to non-zeroes.
+	errInvalidCheckpointVote = errors.New("vote nonce in checkpoint block non-zero")
+
+	// errExtraValidators is returned if non-checkpoint block contain validator data
+	// in their extra-data fields.
+	errExtraValidators = errors.New("non-checkpoint block contains extra validator list")
+
+	// errMismatchingCheckpointValidators is returned if a checkpoint block contains
+	// a list of validators different than the one the local node calculated.
+	errMismatchingCheckpointValidators = errors.New("mismatching validator list on checkpoint block")
+
+	// errInvalidMixDigest is returned if a block's mix digest is not the IBFT digest.
+	errInvalidMixDigest = errors.New("invalid ibft mix digest")
+
+	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
+	errInvalidUncleHash = errors.New("non empty uncle hash")
+
+	// errInvalidDifficulty is returned if the difficulty of a block is not 1.
+	errInvalidDifficulty = errors.New("invalid difficulty")
+
+	// errInvalidTimestamp is returned if the timestamp of a block is lower than
+	// the previous block's timestamp + the minimum block period.
+	errInvalidTimestamp = errors.New("invalid timestamp")
+
+	// errInvalidVotingChain is returned if an authorization list is attempted to
+	// be modified via out-of-range or non-contiguous headers.
+	errInvalidVotingChain = errors.New("invalid voting chain")
+
+	// errUnauthorizedProposer is returned if a header is sealed by a non-validator.
+	errUnauthorizedProposer = errors.New("unauthorized proposer")
+
+	// errInvalidCommittedSeals is returned if a header's committed seals are not
+	// signed by a quorum of distinct validators.
+	errInvalidCommittedSeals = errors.New("invalid committed seals")
+
+	// errNotStarted is returned if sealing is requested before the engine was
+	// started, as no consensus messages can be exchanged.
+	errNotStarted = errors.New("consensus engine not started")
+)
+
+// SignerFn is a signer callback function to request a hash to be signed by a
+// backing account.
+type SignerFn func(accounts.Account, string, []byte) ([]byte, error)
+
+// ecrecover extracts the Ethereum account address of the proposer of a block.
+func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, error) {
+	// If the signature's already cached, return that
+	hash := proposalHash(header)
+	if address, known := sigcache.Get(hash); known {
+		return address.(common.Address), nil
+	}
+	// Retrieve the signature from the header extra-data
+	extra, err := types.ExtractIBFTExtra(header)
+	if err != nil {
+		return common.Address{}, err
+	}
+	signer, err := recoverAddress(IBFTRLP(header), extra.Seal)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sigcache.Add(hash, signer)
+	return signer, nil
+}
+
+// recoverAddress extracts the Ethereum account address that signed the hash of
+// the given data.
+func recoverAddress(data []byte, sig []byte) (common.Address, error) {
+	pubkey, err := crypto.Ecrecover(crypto.Keccak256(data), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// IBFT is the Istanbul byzantine fault tolerant consensus engine, offering
+// instant finality to permissioned networks.
+type IBFT struct {
+	config *params.IBFTConfig // Consensus engine configuration parameters
+	db     ethdb.Database     // Database to store and retrieve snapshot checkpoints
+
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	messages   *lru.Cache    // Hashes of recent consensus messages to avoid reprocessing
+
+	proposals map[common.Address]bool // Current list of proposals we are pushing
+
+	takeover           uint64           // Block number of the last block sealed by a preceding engine
+	takeoverValidators []common.Address // Initial validators when taking over a chain from another engine
+
+	signer common.Address // Ethereum address of the signing key
+	signFn SignerFn       // Signer function to authorize hashes with
+	lock   sync.RWMutex   // Protects the signer fields
+
+	core   *machine     // Consensus state machine, running between Start and Stop
+	peers  *peerSet     // Remote peers speaking the consensus sub-protocol
+	coreMu sync.RWMutex // Protects the consensus state machine
+}
+
+// New creates an IBFT consensus engine with the initial validators set to the
+// ones in the genesis block.
+func New(config *params.IBFTConfig, db ethdb.Database) *IBFT {
+	// Set any missing consensus parameters to their defaults
+	conf := *config
+	if conf.Epoch == 0 {
+		conf.Epoch = epochLength
+	}
+	if conf.RequestTimeout == 0 {
+		conf.RequestTimeout = defaultRequestTimeout
+	}
+	// Allocate the snapshot caches and create the engine
+	recents, _ := lru.NewARC(inmemorySnapshots)
+	signatures, _ := lru.NewARC(inmemorySignatures)
+	messages, _ := lru.New(inmemoryMessages)
+
+	return &IBFT{
+		config:     &conf,
+		db:         db,
+		recents:    recents,
+		signatures: signatures,
+		messages:   messages,
+		proposals:  make(map[common.Address]bool),
+		peers:      newPeerSet(),
+	}
+}
+
+// Takeover configures the engine to seal an existing chain from the given block
+// onward, taking over from a different consensus engine. The validator set before
+// the given block is the one provided, instead of the one in the genesis block.
+func (e *IBFT) Takeover(number uint64, validators []common.Address) {
+	e.takeover = number - 1
+	e.takeoverValidators = append([]common.Address(nil), validators...)
+}
+
+// Author implements consensus.Engine, returning the Ethereum address recovered
+// from the proposer seal in the header's extra-data section.
+func (e *IBFT) Author(header *types.Header) (common.Address, error) {
+	return ecrecover(header, e.signatures)
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules.
+func (e *IBFT) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return e.verifyHeader(chain, header, nil, true)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers. The
+// method returns a quit channel to abort the operations and a results channel to
+// retrieve the async verifications (the order is that of the input slice).
+func (e *IBFT) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := e.verifyHeader(chain, header, headers[:i], true)
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules. The
+// caller may optionally pass in a batch of parents (ascending order) to avoid
+// looking those up from the database. Committed seals are only checked if
+// requested, as proposals are verified before validators commit to them.
+func (e *IBFT) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header, committed bool) error {
+	if header.Number == nil {
+		return errUnknownBlock
+	}
+	number := header.Number.Uint64()
+
+	// Don't waste time checking blocks from the future
+	if header.Time > uint64(time.Now().Unix()) {
+		return consensus.ErrFutureBlock
+	}
+	// Ensure that the extra-data contains the consensus fields
+	extra, err := types.ExtractIBFTExtra(header)
+	if err != nil {
+		return types.ErrInvalidIBFTExtra
+	}
+	// Checkpoint blocks need to enforce zero beneficiary and carry the validators
+	checkpoint := (number % e.config.Epoch) == 0
+	if checkpoint && header.Coinbase != (common.Address{}) {
+		return errInvalidCheckpointBeneficiary
+	}
+	if !checkpoint && len(extra.Validators) != 0 {
+		return errExtraValidators
+	}
+	// Nonces must be 0x00..0 or 0xff..f, zeroes enforced on checkpoints
+	if !bytes.Equal(header.Nonce[:], nonceAuthVote) && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidVote
+	}
+	if checkpoint && !bytes.Equal(header.Nonce[:], nonceDropVote) {
+		return errInvalidCheckpointVote
+	}
+	// Ensure that the mix digest identifies the block as an IBFT one
+	if header.MixDigest != types.IBFTDigest {
+		return errInvalidMixDigest
+	}
+	// Ensure that the block doesn't contain any uncles which are meaningless in BFT
+	if header.UncleHash != uncleHash {
+		return errInvalidUncleHash
+	}
+	if number > 0 && (header.Difficulty == nil || header.Difficulty.Cmp(defaultDifficulty) != 0) {
+		return errInvalidDifficulty
+	}
+	// If all checks passed, validate any special fields for hard forks
+	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
+		return err
+	}
+	// All basic checks passed, verify cascading fields
+	return e.verifyCascadingFields(chain, header, parents, committed)
+}
+
+// verifyCascadingFields verifies all the header fields that are not standalone,
+// rather depend on a batch of previous headers.
+func (e *IBFT) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, parents []*types.Header, committed bool) error {
+	// The genesis block is the always valid dead-end
+	number := header.Number.Uint64()
+	if number == 0 {
+		return nil
+	}
+	// Ensure that the block's timestamp isn't too close to its parent
+	var parent *types.Header
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	} else {
+		parent = chain.GetHeader(header.ParentHash, number-1)
+	}
+	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
+		return consensus.ErrUnknownAncestor
+	}
+	if parent.Time+e.config.Period > header.Time {
+		return errInvalidTimestamp
+	}
+	// Retrieve the snapshot needed to verify this header and cache it
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, parents)
+	if err != nil {
+		return err
+	}
+	// If the block is a checkpoint block, verify the validator list
+	if number%e.config.Epoch == 0 {
+		extra, _ := types.ExtractIBFTExtra(header)
+
+		validators := snap.validators()
+		if len(extra.Validators) != len(validators) {
+			return errMismatchingCheckpointValidators
+		}
+		for i, validator := range validators {
+			if extra.Validators[i] != validator {
+				return errMismatchingCheckpointValidators
+			}
+		}
+	}
+	// All basic checks passed, verify the seals and return
+	if err := e.verifyProposerSeal(header, snap); err != nil {
+		return err
+	}
+	if committed {
+		return e.verifyCommittedSeals(header, snap)
+	}
+	return nil
+}
+
+// snapshot retrieves the validator snapshot at a given point in time.
+func (e *IBFT) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*Snapshot, error) {
+	// Search for a snapshot in memory or on disk for checkpoints
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+	)
+	for snap == nil {
+		// If an in-memory snapshot was found, use that
+		if s, ok := e.recents.Get(hash); ok {
+			snap = s.(*Snapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(e.config, e.signatures, e.db, hash); err == nil {
+				log.Trace("Loaded validator snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// If we're at the last block of a preceding engine, snapshot the initial validators
+		if len(e.takeoverValidators) > 0 && number == e.takeover {
+			snap = newSnapshot(e.config, e.signatures, number, hash, e.takeoverValidators)
+			log.Info("Created takeover snapshot", "number", number, "hash", hash)
+			break
+		}
+		// If we're at the genesis, snapshot the initial state. Alternatively if we're
+		// at a checkpoint block without a parent (light client CHT), or we have piled
+		// up more headers than allowed to be reorged (chain reinit from a freezer),
+		// consider the checkpoint trusted and snapshot it.
+		if number == 0 || (number%e.config.Epoch == 0 && (len(headers) > params.ImmutabilityThreshold || chain.GetHeaderByNumber(number-1) == nil)) {
+			checkpoint := chain.GetHeaderByNumber(number)
+			if checkpoint != nil {
+				extra, err := types.ExtractIBFTExtra(checkpoint)
+				if err != nil {
+					return nil, err
+				}
+				hash := checkpoint.Hash()
+				snap = newSnapshot(e.config, e.signatures, number, hash, extra.Validators)
+				if err := snap.store(e.db); err != nil {
+					return nil, err
+				}
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				break
+			}
+		}
+		// No snapshot for this header, gather the header and move backward
+		var header *types.Header
+		if len(parents) > 0 {
+			// If we have explicit parents, pick from there (enforced)
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else {
+			// No explicit parents (or no more left), reach out to the database
+			header = chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+		}
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	e.recents.Add(snap.Hash, snap)
+
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && len(headers) > 0 {
+		if err = snap.store(e.db); err != nil {
+			return nil, err
+		}
+		log.Trace("Stored validator snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, err
+}
+
+// VerifyUncles implements consensus.Engine, always returning an error for any
+// uncles as this consensus mechanism doesn't permit uncles.
+func (e *IBFT) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	if len(block.Uncles()) > 0 {
+		return errors.New("uncles not allowed")
+	}
+	return nil
+}
+
+// VerifySeal implements consensus.Engine, checking whether the proposer seal and
+// the committed seals contained in the header satisfy the consensus protocol
+// requirements.
+func (e *IBFT) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	// Verifying the genesis block is not supported
+	number := header.Number.Uint64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	if err := e.verifyProposerSeal(header, snap); err != nil {
+		return err
+	}
+	return e.verifyCommittedSeals(header, snap)
+}
+
+// verifyProposerSeal checks whether the header was sealed by a validator.
+func (e *IBFT) verifyProposerSeal(header *types.Header, snap *Snapshot) error {
+	proposer, err := ecrecover(header, e.signatures)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[proposer]; !ok {
+		return errUnauthorizedProposer
+	}
+	return nil
+}
+
+// verifyCommittedSeals checks whether a quorum of distinct validators committed
+// to the header.
+func (e *IBFT) verifyCommittedSeals(header *types.Header, snap *Snapshot) error {
+	extra, err := types.ExtractIBFTExtra(header)
+	if err != nil {
+		return err
+	}
+	var (
+		data   = commitData(proposalHash(header))
+		signed = make(map[common.Address]struct{})
+	)
+	for _, seal := range extra.CommittedSeal {
+		validator, err := recoverAddress(data, seal)
+		if err != nil {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := snap.Validators[validator]; !ok {
+			return errInvalidCommittedSeals
+		}
+		if _, ok := signed[validator]; ok {
+			return errInvalidCommittedSeals
+		}
+		signed[validator] = struct{}{}
+	}
+	if len(signed) < snap.quorum() {
+		return errInvalidCommittedSeals
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, preparing all the consensus fields of the
+// header for running the transactions on top.
+func (e *IBFT) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	// If the block isn't a checkpoint, cast a random vote (good enough for now)
+	header.Coinbase = common.Address{}
+	header.Nonce = types.BlockNonce{}
+
+	number := header.Number.Uint64()
+	// Assemble the validator snapshot to check which votes make sense
+	snap, err := e.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	checkpoint := number%e.config.Epoch == 0
+	if !checkpoint {
+		e.lock.RLock()
+
+		// Gather all the proposals that make sense voting on
+		addresses := make([]common.Address, 0, len(e.proposals))
+		for address, authorize := range e.proposals {
+			if snap.validVote(address, authorize) {
+				addresses = append(addresses, address)
+			}
+		}
+		// If there's pending proposals, cast a vote on them
+		if len(addresses) > 0 {
+			header.Coinbase = addresses[rand.Intn(len(addresses))]
+			if e.proposals[header.Coinbase] {
+				copy(header.Nonce[:], nonceAuthVote)
+			} else {
+				copy(header.Nonce[:], nonceDropVote)
+			}
+		}
+		e.lock.RUnlock()
+	}
+	header.Difficulty = new(big.Int).Set(defaultDifficulty)
+
+	// Assemble the consensus fields, leaving the seals empty
+	extra := &types.IBFTExtra{Seal: []byte{}, CommittedSeal: [][]byte{}}
+	if checkpoint {
+		extra.Validators = snap.validators()
+	}
+	vanity := header.Extra
+	if len(vanity) > types.IBFTExtraVanity {
+		vanity = vanity[:types.IBFTExtraVanity]
+	}
+	if header.Extra, err = types.EncodeIBFTExtra(vanity, extra); err != nil {
+		return err
+	}
+	header.MixDigest = types.IBFTDigest
+
+	// Ensure the timestamp has the correct delay
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Time = parent.Time + e.config.Period
+	if header.Time < uint64(time.Now().Unix()) {
+		header.Time = uint64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Finalize implements consensus.Engine, ensuring no uncles are set, nor block
+// rewards given.
+func (e *IBFT) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	// No block rewards in BFT, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+}
+
+// FinalizeAndAssemble implements consensus.Engine, ensuring no uncles are set,
+// nor block rewards given, and returns the final block.
+func (e *IBFT) FinalizeAndAssemble(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// No block rewards in BFT, so the state remains as is and uncles are dropped
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+	header.UncleHash = types.CalcUncleHash(nil)
+
+	// Assemble and return the final block for sealing
+	return types.NewBlock(header, txs, nil, receipts), nil
+}
+
+// Authorize injects a private key into the consensus engine to propose and
+// commit to blocks with.
+func (e *IBFT) Authorize(signer common.Address, signFn SignerFn) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.signer = signer
+	e.signFn = signFn
+}
+
+// sign signs the given data with the local validator key.
+func (e *IBFT) sign(data []byte) ([]byte, error) {
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+
+	if signFn == nil {
+		return nil, errUnauthorizedProposer
+	}
+	return signFn(accounts.Account{Address: signer}, accounts.MimetypeIBFT, data)
+}
+
+// address returns the address of the local validator key.
+func (e *IBFT) address() common.Address {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	return e.signer
+}
+
+// Seal implements consensus.Engine, handing the block over to the consensus
+// state machine. If the local validator is the proposer of the block's round,
+// the block is proposed to the other validators, and is returned through the
+// results channel once a quorum committed to it.
+func (e *IBFT) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	// Sealing the genesis block is not supported
+	number := block.NumberU64()
+	if number == 0 {
+		return errUnknownBlock
+	}
+	// Bail out if we're not a validator
+	snap, err := e.snapshot(chain, number-1, block.ParentHash(), nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[e.address()]; !ok {
+		return errUnauthorizedProposer
+	}
+	e.coreMu.RLock()
+	defer e.coreMu.RUnlock()
+
+	if e.core == nil {
+		return errNotStarted
+	}
+	e.core.post(&sealRequest{block: block, results: results})
+	return nil
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (e *IBFT) SealHash(header *types.Header) common.Hash {
+	return SealHash(header)
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
+// that a new block should have, which is constant in IBFT.
+func (e *IBFT) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	return new(big.Int).Set(defaultDifficulty)
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC API to allow
+// controlling the validator voting.
+func (e *IBFT) APIs(chain consensus.ChainReader) []rpc.API {
+	return []rpc.API{{
+		Namespace: "ibft",
+		Version:   "1.0",
+		Service:   &API{chain: chain, ibft: e},
+		Public:    false,
+	}}
+}
+
+// Protocols implements consensus.BFT, returning the devp2p sub-protocol used to
+// exchange consensus messages.
+func (e *IBFT) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    protocolName,
+		Version: protocolVersion,
+		Length:  protocolLength,
+		Run:     e.runPeer,
+	}}
+}
+
+// Start implements consensus.BFT, starting the consensus state machine on top
+// of the current head of the chain.
+func (e *IBFT) Start(chain consensus.ChainReader, insert func(*types.Block) error) error {
+	e.coreMu.Lock()
+	defer e.coreMu.Unlock()
+
+	if e.core != nil {
+		return nil
+	}
+	e.core = newMachine(e, chain, insert)
+	e.core.post(&newHeadEvent{head: chain.CurrentHeader()})
+	return nil
+}
+
+// NewChainHead implements consensus.BFT, moving the consensus state machine
+// onto the block following the new head.
+func (e *IBFT) NewChainHead(head *types.Header) {
+	e.coreMu.RLock()
+	defer e.coreMu.RUnlock()
+
+	if e.core != nil {
+		e.core.post(&newHeadEvent{head: head})
+	}
+}
+
+// Stop implements consensus.BFT, terminating the consensus state machine.
+func (e *IBFT) Stop() error {
+	e.coreMu.Lock()
+	defer e.coreMu.Unlock()
+
+	if e.core != nil {
+		e.core.stop()
+		e.core = nil
+	}
+	return nil
+}
+
+// Close implements consensus.Engine, terminating the consensus state machine.
+func (e *IBFT) Close() error {
+	return e.Stop()
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func SealHash(header *types.Header) common.Hash {
+	return crypto.Keccak256Hash(IBFTRLP(header))
+}
+
+// IBFTRLP returns the rlp bytes which needs to be signed by the proposer of a
+// block. The RLP to sign consists of the entire header apart from the proposer
+// and committed seals contained in the extra data.
+func IBFTRLP(header *types.Header) []byte {
+	filtered := types.IBFTFilteredHeader(header, false)
+	if filtered == nil {
+		filtered = header // Malformed extra-data, signature checks will fail anyway
+	}
+	enc, err := rlp.EncodeToBytes(filtered)
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return enc
+}
+
+// proposalHash returns the hash validators agree upon when committing to a block,
+// which is the hash of the header without the committed seals. The proposer seal
+// is retained, so re-sealed proposals of the same block are told apart.
+func proposalHash(header *types.Header) common.Hash {
+	filtered := types.IBFTFilteredHeader(header, true)
+	if filtered == nil {
+		filtered = header // Malformed extra-data, signature checks will fail anyway
+	}
+	return filtered.Hash()
+}
+
+// commitData returns the data validators sign to commit to the proposal with the
+// given hash.
+func commitData(hash common.Hash) []byte {
+	return append(hash.Bytes(), byte(msgCommit))
+}
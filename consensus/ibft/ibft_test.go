@@ -0,0 +1,422 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testNode is a single validator of a simulated consensus network.
+type testNode struct {
+	key    *ecdsa.PrivateKey
+	addr   common.Address
+	engine *IBFT
+	chain  *core.BlockChain
+	peers  []*testNode // Other nodes of the network, receiving the imported blocks
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// testConfig returns a chain configuration running the IBFT engine.
+func testConfig() *params.ChainConfig {
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.IBFT = &params.IBFTConfig{Epoch: 30000, RequestTimeout: 250}
+	return &config
+}
+
+// newTestNetwork creates a network of validators sharing the same genesis, with
+// consensus connections established between all of them.
+func newTestNetwork(t *testing.T, validators int) []*testNode {
+	config := testConfig()
+
+	nodes := make([]*testNode, validators)
+	addrs := make([]common.Address, validators)
+	for i := range nodes {
+		key, _ := crypto.GenerateKey()
+		nodes[i] = &testNode{key: key, addr: crypto.PubkeyToAddress(key.PublicKey), quit: make(chan struct{})}
+		addrs[i] = nodes[i].addr
+	}
+	sort.Sort(validatorsAscending(addrs))
+
+	extra, err := types.EncodeIBFTExtra(nil, &types.IBFTExtra{Validators: addrs, Seal: []byte{}, CommittedSeal: [][]byte{}})
+	if err != nil {
+		t.Fatalf("failed to encode genesis extra-data: %v", err)
+	}
+	genspec := &core.Genesis{Config: config, ExtraData: extra, GasLimit: params.GenesisGasLimit, Difficulty: big.NewInt(1)}
+
+	for _, node := range nodes {
+		db := rawdb.NewMemoryDatabase()
+		genspec.MustCommit(db)
+
+		node.engine = New(config.IBFT, db)
+		key := node.key
+		node.engine.Authorize(node.addr, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), key)
+		})
+		if node.chain, err = core.NewBlockChain(db, nil, config, node.engine, vm.Config{}, nil); err != nil {
+			t.Fatalf("failed to create chain: %v", err)
+		}
+	}
+	for i, node := range nodes {
+		node.peers = append(append([]*testNode{}, nodes[:i]...), nodes[i+1:]...)
+	}
+	for i := 0; i < len(nodes); i++ {
+		for j := i + 1; j < len(nodes); j++ {
+			rw1, rw2 := p2p.MsgPipe()
+			go nodes[i].engine.runPeer(p2p.NewPeer(enode.ID{byte(j)}, fmt.Sprintf("node-%d", j), nil), rw1)
+			go nodes[j].engine.runPeer(p2p.NewPeer(enode.ID{byte(i)}, fmt.Sprintf("node-%d", i), nil), rw2)
+		}
+	}
+	return nodes
+}
+
+// start runs the consensus state machine of the node, along with a minimal miner
+// handing an empty block over for sealing on every new chain head.
+func (n *testNode) start(t *testing.T) {
+	insert := func(block *types.Block) error {
+		if _, err := n.chain.InsertChain(types.Blocks{block}); err != nil {
+			return err
+		}
+		n.broadcast(block)
+		return nil
+	}
+	if err := n.engine.Start(n.chain, insert); err != nil {
+		t.Fatalf("failed to start consensus: %v", err)
+	}
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := n.chain.SubscribeChainHeadEvent(heads)
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer sub.Unsubscribe()
+
+		results := make(chan *types.Block, 1)
+		n.seal(t, n.chain.CurrentBlock(), results)
+		for {
+			select {
+			case ev := <-heads:
+				n.engine.NewChainHead(ev.Block.Header())
+				n.seal(t, ev.Block, results)
+			case block := <-results:
+				if err := insert(block); err != nil {
+					t.Errorf("failed to insert sealed block: %v", err)
+				}
+			case <-n.quit:
+				return
+			}
+		}
+	}()
+}
+
+// broadcast emulates the block propagation of the eth protocol, importing the
+// given block into the chains of the other nodes, along with any ancestors they
+// are missing.
+func (n *testNode) broadcast(block *types.Block) {
+	for _, peer := range n.peers {
+		var blocks types.Blocks
+		for b := block; b != nil && b.NumberU64() > peer.chain.CurrentBlock().NumberU64(); b = n.chain.GetBlock(b.ParentHash(), b.NumberU64()-1) {
+			blocks = append(types.Blocks{b}, blocks...)
+		}
+		peer.chain.InsertChain(blocks)
+	}
+}
+
+// seal builds an empty block on top of the given parent and hands it over to the
+// consensus engine.
+func (n *testNode) seal(t *testing.T, parent *types.Block, results chan *types.Block) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	if err := n.engine.Prepare(n.chain, header); err != nil {
+		t.Errorf("failed to prepare header: %v", err)
+		return
+	}
+	statedb, err := n.chain.StateAt(parent.Root())
+	if err != nil {
+		t.Errorf("failed to retrieve parent state: %v", err)
+		return
+	}
+	block, err := n.engine.FinalizeAndAssemble(n.chain, header, statedb, nil, nil, nil)
+	if err != nil {
+		t.Errorf("failed to assemble block: %v", err)
+		return
+	}
+	if err := n.engine.Seal(n.chain, block, results, nil); err != nil {
+		t.Errorf("failed to seal block: %v", err)
+	}
+}
+
+// stop terminates the consensus and the chain of the node, waiting for the miner
+// to exit first so it doesn't use the stopped engine.
+func (n *testNode) stop() {
+	close(n.quit)
+	n.wg.Wait()
+	n.engine.Stop()
+	n.chain.Stop()
+}
+
+// waitHeight waits until all the given nodes imported the block of the given
+// number, failing the test after a timeout.
+func waitHeight(t *testing.T, nodes []*testNode, number uint64) {
+	deadline := time.Now().Add(20 * time.Second)
+	for _, node := range nodes {
+		for node.chain.CurrentBlock().NumberU64() < number {
+			if time.Now().After(deadline) {
+				t.Fatalf("node %x: timeout waiting for block #%d, head #%d", node.addr, number, node.chain.CurrentBlock().NumberU64())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// checkChains verifies that the nodes agree on the first blocks of their chains,
+// and that all those blocks were committed by a quorum of validators.
+func checkChains(t *testing.T, nodes []*testNode, number uint64) {
+	for n := uint64(1); n <= number; n++ {
+		block := nodes[0].chain.GetBlockByNumber(n)
+		for _, node := range nodes[1:] {
+			if have := node.chain.GetBlockByNumber(n); have.Hash() != block.Hash() {
+				t.Fatalf("block #%d mismatch: have %x, want %x", n, have.Hash(), block.Hash())
+			}
+		}
+		extra, err := types.ExtractIBFTExtra(block.Header())
+		if err != nil {
+			t.Fatalf("block #%d: failed to decode extra-data: %v", n, err)
+		}
+		if have, want := len(extra.CommittedSeal), quorumSize(len(nodes)); have < want {
+			t.Errorf("block #%d: committed seal count mismatch: have %d, want at least %d", n, have, want)
+		}
+		if err := nodes[0].engine.VerifySeal(nodes[0].chain, block.Header()); err != nil {
+			t.Errorf("block #%d: invalid seals: %v", n, err)
+		}
+	}
+}
+
+// Tests that a network of honest validators agrees on and imports new blocks.
+func TestConsensus(t *testing.T) {
+	nodes := newTestNetwork(t, 4)
+	for _, node := range nodes {
+		node.start(t)
+		defer node.stop()
+	}
+	waitHeight(t, nodes, 3)
+	checkChains(t, nodes, 3)
+}
+
+// Tests that the network keeps making progress if a validator is offline, its
+// rounds timing out and being moved on to the next proposer.
+func TestConsensusOfflineValidator(t *testing.T) {
+	nodes := newTestNetwork(t, 4)
+	for _, node := range nodes[1:] {
+		node.start(t)
+		defer node.stop()
+	}
+	// Wait for enough blocks for the offline validator to be the first proposer
+	waitHeight(t, nodes[1:], 4)
+	checkChains(t, nodes[1:], 4)
+}
+
+// Tests that the proposal hash validators agree upon doesn't depend on the
+// committed seals, which are only gathered after the agreement, whereas the block
+// hash does, as for any other header.
+func TestProposalHashExcludesCommittedSeals(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	extra := &types.IBFTExtra{Validators: []common.Address{crypto.PubkeyToAddress(key.PublicKey)}, Seal: []byte{}, CommittedSeal: [][]byte{}}
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), MixDigest: types.IBFTDigest}
+	header.Extra, _ = types.EncodeIBFTExtra(nil, extra)
+	hash, digest := header.Hash(), proposalHash(header)
+
+	seal, _ := crypto.Sign(crypto.Keccak256(commitData(digest)), key)
+	extra.CommittedSeal = [][]byte{seal}
+	header.Extra, _ = types.EncodeIBFTExtra(nil, extra)
+	if have := proposalHash(header); have != digest {
+		t.Errorf("proposal hash changed by committed seals: have %x, want %x", have, digest)
+	}
+	if have := header.Hash(); have == hash {
+		t.Errorf("block hash not changed by committed seals")
+	}
+	signer, err := recoverAddress(commitData(proposalHash(header)), seal)
+	if err != nil || signer != extra.Validators[0] {
+		t.Errorf("committed seal signer mismatch: have %x (%v), want %x", signer, err, extra.Validators[0])
+	}
+	// The proposer seal on the other hand must be part of the proposal hash
+	extra.Seal = seal
+	header.Extra, _ = types.EncodeIBFTExtra(nil, extra)
+	if have := proposalHash(header); have == digest {
+		t.Errorf("proposal hash not changed by proposer seal")
+	}
+}
+
+// Tests that messages of future heights are only kept around and relayed if they
+// were sent by a validator.
+func TestFutureMessagesFromNonValidators(t *testing.T) {
+	var (
+		validator = common.HexToAddress("0x01")
+		outsider  = common.HexToAddress("0x02")
+	)
+	c := &machine{
+		engine:     New(&params.IBFTConfig{}, rawdb.NewMemoryDatabase()),
+		parent:     &types.Header{Number: big.NewInt(0)},
+		sequence:   1,
+		validators: []common.Address{validator},
+		rounds:     make(map[uint64]*roundMessages),
+		backlog:    make(map[uint64][]*message),
+	}
+	c.handleMessage(&message{Code: msgPrepare, Sequence: 2, sender: outsider, payload: []byte{0x01}})
+	if have := len(c.backlog[2]); have != 0 {
+		t.Fatalf("non-validator message backlogged: have %d, want %d", have, 0)
+	}
+	if c.engine.messages.Contains(crypto.Keccak256Hash([]byte{0x01})) {
+		t.Fatalf("non-validator message relayed")
+	}
+	c.handleMessage(&message{Code: msgPrepare, Sequence: 2, sender: validator, payload: []byte{0x02}})
+	if have := len(c.backlog[2]); have != 1 {
+		t.Fatalf("validator message not backlogged: have %d, want %d", have, 1)
+	}
+	if !c.engine.messages.Contains(crypto.Keccak256Hash([]byte{0x02})) {
+		t.Fatalf("validator message not relayed")
+	}
+}
+
+// newTestMachine creates a consensus state machine at the first block of a chain
+// with the given number of validators, without running its event loop.
+func newTestMachine(validators int) (*machine, []*ecdsa.PrivateKey) {
+	keys := make([]*ecdsa.PrivateKey, validators)
+	addrs := make([]common.Address, validators)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+	}
+	sort.Sort(validatorsAscending(addrs))
+
+	c := &machine{
+		engine:     New(&params.IBFTConfig{}, rawdb.NewMemoryDatabase()),
+		parent:     &types.Header{Number: big.NewInt(0)},
+		sequence:   1,
+		validators: addrs,
+		rounds:     map[uint64]*roundMessages{0: newRoundMessages()},
+		backlog:    make(map[uint64][]*message),
+	}
+	return c, keys
+}
+
+// signMessage signs a consensus message of the first block with the given key,
+// decoding it back as if it was received from the network.
+func signMessage(t *testing.T, key *ecdsa.PrivateKey, msg *message) *message {
+	msg.Sequence = 1
+	if err := msg.sign(func(data []byte) ([]byte, error) { return crypto.Sign(crypto.Keccak256(data), key) }); err != nil {
+		t.Fatalf("failed to sign message: %v", err)
+	}
+	decoded, err := decodeMessage(msg.payload)
+	if err != nil {
+		t.Fatalf("failed to decode message: %v", err)
+	}
+	return decoded
+}
+
+// roundChanges returns the number of round changes kept for the given round.
+func (c *machine) roundChanges(round uint64) int {
+	if msgs := c.rounds[round]; msgs != nil {
+		return len(msgs.roundChanges)
+	}
+	return 0
+}
+
+// Tests that round changes only carry a block to re-propose if it's justified by
+// a quorum of validators having prepared it.
+func TestRoundChangePreparedCertificate(t *testing.T) {
+	c, keys := newTestMachine(4)
+
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	digest := proposalHash(block.Header())
+	enc, _ := rlp.EncodeToBytes(block)
+
+	certificate := func(signers int, round uint64) [][]byte {
+		var cert [][]byte
+		for _, key := range keys[:signers] {
+			cert = append(cert, signMessage(t, key, &message{Code: msgPrepare, Round: round, Digest: digest}).payload)
+		}
+		return cert
+	}
+	tests := []struct {
+		cert  [][]byte
+		round uint64
+		keep  bool
+	}{
+		{cert: nil, keep: false},                                             // No certificate at all
+		{cert: certificate(2, 0), keep: false},                               // Less than a quorum
+		{cert: certificate(3, 1), round: 1, keep: false},                     // Prepared in the round being changed to
+		{cert: certificate(3, 0)[:1], keep: false},                           // Truncated certificate
+		{cert: append(certificate(1, 0), certificate(1, 0)...), keep: false}, // Duplicate signer
+		{cert: certificate(3, 0), keep: true},                                // Valid certificate
+	}
+	for i, tt := range tests {
+		c.rounds = map[uint64]*roundMessages{0: newRoundMessages()}
+		c.handleMessage(signMessage(t, keys[3], &message{Code: msgRoundChange, Round: 1, Digest: digest, Proposal: enc, PreparedRound: tt.round, PreparedCert: tt.cert}))
+		if have := c.roundChanges(1) == 1; have != tt.keep {
+			t.Errorf("test %d: round change kept mismatch: have %v, want %v", i, have, tt.keep)
+		}
+	}
+}
+
+// Tests that only round changes are kept for future rounds, a bounded number of
+// rounds ahead and only the latest one of each validator.
+func TestFutureRoundMessages(t *testing.T) {
+	c, keys := newTestMachine(4)
+
+	c.handleMessage(signMessage(t, keys[0], &message{Code: msgPrepare, Round: 1}))
+	if msgs := c.rounds[1]; msgs != nil && len(msgs.prepares) > 0 {
+		t.Fatalf("future round prepare kept")
+	}
+	c.handleMessage(signMessage(t, keys[0], &message{Code: msgRoundChange, Round: maxFutureRounds + 1}))
+	if c.roundChanges(maxFutureRounds+1) != 0 {
+		t.Fatalf("round change beyond the future round window kept")
+	}
+	// Later round changes of a validator replace its earlier ones
+	c.handleMessage(signMessage(t, keys[0], &message{Code: msgRoundChange, Round: 2}))
+	c.handleMessage(signMessage(t, keys[0], &message{Code: msgRoundChange, Round: 3}))
+	if c.roundChanges(2) != 0 || c.roundChanges(3) != 1 {
+		t.Fatalf("round changes mismatch: have %d/%d, want %d/%d", c.roundChanges(2), c.roundChanges(3), 0, 1)
+	}
+	c.handleMessage(signMessage(t, keys[0], &message{Code: msgRoundChange, Round: 1}))
+	if c.roundChanges(1) != 0 || c.roundChanges(3) != 1 {
+		t.Fatalf("round changes mismatch: have %d/%d, want %d/%d", c.roundChanges(1), c.roundChanges(3), 0, 1)
+	}
+}
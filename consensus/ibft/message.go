@@ -0,0 +1,116 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Consensus message codes.
+const (
+	msgPreprepare  uint64 = iota // Proposer announcing the block of a round
+	msgPrepare                   // Validator accepting the proposal of a round
+	msgCommit                    // Validator committing to the proposal of a round
+	msgRoundChange               // Validator asking to move on to a later round
+)
+
+var (
+	errInvalidMessageCode = errors.New("invalid message code")
+	errMissingProposal    = errors.New("pre-prepare without proposal")
+)
+
+// message is a consensus message exchanged between validators.
+type message struct {
+	Code          uint64      // Type of the message
+	Sequence      uint64      // Number of the block being agreed upon
+	Round         uint64      // Round of the agreement at the given height
+	Digest        common.Hash // Hash of the proposal being prepared or committed
+	Proposal      []byte      // RLP encoded proposal, on pre-prepares and round changes of locked validators
+	CommittedSeal []byte      // Validator signature over the proposal hash, on commits
+	PreparedRound uint64      // Round the proposal was prepared in, on round changes of locked validators
+	PreparedCert  [][]byte    // Prepares and commits of a quorum for the proposal, on round changes of locked validators
+	Signature     []byte      // Signature of the sender over all other fields
+
+	sender  common.Address // Validator that sent the message
+	block   *types.Block   // Decoded proposal, if any
+	payload []byte         // RLP encoding of the entire message
+}
+
+// String implements fmt.Stringer.
+func (m *message) String() string {
+	names := []string{"PRE-PREPARE", "PREPARE", "COMMIT", "ROUND-CHANGE"}
+	name := "UNKNOWN"
+	if m.Code < uint64(len(names)) {
+		name = names[m.Code]
+	}
+	return fmt.Sprintf("%s{seq: %d, round: %d, digest: %x, sender: %x}", name, m.Sequence, m.Round, m.Digest[:4], m.sender[:4])
+}
+
+// signingData returns the rlp bytes the sender of the message signs.
+func (m *message) signingData() []byte {
+	enc, err := rlp.EncodeToBytes([]interface{}{m.Code, m.Sequence, m.Round, m.Digest, m.Proposal, m.CommittedSeal, m.PreparedRound, m.PreparedCert})
+	if err != nil {
+		panic("can't encode: " + err.Error())
+	}
+	return enc
+}
+
+// sign signs the message with the given signer, and caches its encoding.
+func (m *message) sign(signFn func([]byte) ([]byte, error)) error {
+	sig, err := signFn(m.signingData())
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+
+	m.payload, err = rlp.EncodeToBytes(m)
+	return err
+}
+
+// decodeMessage decodes a consensus message, recovering its sender and decoding
+// the proposal it carries.
+func decodeMessage(payload []byte) (*message, error) {
+	msg := new(message)
+	if err := rlp.DecodeBytes(payload, msg); err != nil {
+		return nil, err
+	}
+	if msg.Code > msgRoundChange {
+		return nil, errInvalidMessageCode
+	}
+	sender, err := recoverAddress(msg.signingData(), msg.Signature)
+	if err != nil {
+		return nil, err
+	}
+	msg.sender, msg.payload = sender, payload
+
+	if msg.Code == msgPreprepare && len(msg.Proposal) == 0 {
+		return nil, errMissingProposal
+	}
+	if len(msg.Proposal) > 0 {
+		block := new(types.Block)
+		if err := rlp.DecodeBytes(msg.Proposal, block); err != nil {
+			return nil, err
+		}
+		msg.block = block
+	}
+	return msg, nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ibft
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// Constants of the consensus sub-protocol.
+const (
+	protocolName    = "ibft"
+	protocolVersion = 1
+	protocolLength  = 1 // Number of implemented message codes
+
+	consensusMsg = 0x00 // Message code carrying a consensus message
+
+	maxMessageSize = 10 * 1024 * 1024 // Maximum cap on the size of a protocol message
+	maxKnownMsgs   = 1024             // Maximum message hashes to keep in the known list per peer
+	maxQueuedMsgs  = 256              // Maximum number of messages to queue up for sending to a peer
+)
+
+var (
+	errMsgTooLarge    = errors.New("message too long")
+	errInvalidMsgCode = errors.New("invalid message code")
+)
+
+// peer is a remote node speaking the consensus sub-protocol.
+type peer struct {
+	id    enode.ID
+	rw    p2p.MsgReadWriter
+	known *lru.Cache    // Hashes of the consensus messages known to the peer
+	queue chan []byte   // Queue of consensus messages to send to the peer
+	term  chan struct{} // Termination channel to stop the broadcaster
+}
+
+// newPeer wraps a devp2p peer speaking the consensus sub-protocol.
+func newPeer(p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
+	known, _ := lru.New(maxKnownMsgs)
+	return &peer{
+		id:    p.ID(),
+		rw:    rw,
+		known: known,
+		queue: make(chan []byte, maxQueuedMsgs),
+		term:  make(chan struct{}),
+	}
+}
+
+// broadcastLoop is a write loop that sends the queued consensus messages to the
+// remote peer. The goal is to have an async writer that does not lock up the
+// consensus state machine.
+func (p *peer) broadcastLoop() {
+	for {
+		select {
+		case payload := <-p.queue:
+			if err := p2p.Send(p.rw, consensusMsg, payload); err != nil {
+				return
+			}
+		case <-p.term:
+			return
+		}
+	}
+}
+
+// send queues a consensus message for sending to the peer, unless the peer is
+// already known to have it.
+func (p *peer) send(hash common.Hash, payload []byte) {
+	if p.known.Contains(hash) {
+		return
+	}
+	p.known.Add(hash, struct{}{})
+
+	select {
+	case p.queue <- payload:
+	default:
+		log.Debug("Dropping consensus message, peer queue full", "peer", p.id)
+	}
+}
+
+// peerSet is the set of peers participating in the consensus sub-protocol.
+type peerSet struct {
+	peers map[enode.ID]*peer
+	lock  sync.RWMutex
+}
+
+// newPeerSet creates a new peer set.
+func newPeerSet() *peerSet {
+	return &peerSet{peers: make(map[enode.ID]*peer)}
+}
+
+// register injects a new peer into the set.
+func (ps *peerSet) register(p *peer) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.peers[p.id] = p
+}
+
+// unregister removes a peer from the set.
+func (ps *peerSet) unregister(id enode.ID) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.peers, id)
+}
+
+// broadcast sends a consensus message to all peers not knowing about it yet.
+func (ps *peerSet) broadcast(hash common.Hash, payload []byte) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	for _, p := range ps.peers {
+		p.send(hash, payload)
+	}
+}
+
+// runPeer is the devp2p sub-protocol handler, feeding the consensus messages of
+// the remote peer into the state machine.
+func (e *IBFT) runPeer(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := newPeer(p, rw)
+
+	e.peers.register(peer)
+	defer e.peers.unregister(peer.id)
+
+	go peer.broadcastLoop()
+	defer close(peer.term)
+
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.Size > maxMessageSize {
+			msg.Discard()
+			return errMsgTooLarge
+		}
+		if msg.Code != consensusMsg {
+			msg.Discard()
+			return errInvalidMsgCode
+		}
+		var payload []byte
+		if err := msg.Decode(&payload); err != nil {
+			return err
+		}
+		hash := crypto.Keccak256Hash(payload)
+		peer.known.Add(hash, struct{}{})
+
+		e.handlePayload(hash, payload)
+	}
+}
+
+// handlePayload decodes a consensus message received from the network and hands
+// it over to the state machine, unless it was already seen.
+func (e *IBFT) handlePayload(hash common.Hash, payload []byte) {
+	if ok, _ := e.messages.ContainsOrAdd(hash, struct{}{}); ok {
+		return
+	}
+	msg, err := decodeMessage(payload)
+	if err != nil {
+		log.Debug("Invalid consensus message", "err", err)
+		return
+	}
+	e.coreMu.RLock()
+	defer e.coreMu.RUnlock()
+
+	if e.core != nil {
+		e.core.post(msg)
+	}
+}
+
+// gossip relays a consensus message to all peers that don't know about it yet.
+func (e *IBFT) gossip(payload []byte) {
+	hash := crypto.Keccak256Hash(payload)
+	e.messages.Add(hash, struct{}{})
+	e.peers.broadcast(hash, payload)
+}
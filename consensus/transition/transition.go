@@ -0,0 +1,326 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package transition implements a consensus engine switching between different
+// consensus engines at scheduled fork blocks.
+package transition
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Fork is a consensus engine sealing the chain from a given block onward.
+type Fork struct {
+	Block  uint64           // Number of the first block sealed by the engine
+	Engine consensus.Engine // Consensus engine to delegate to
+}
+
+// Engine is a consensus engine delegating to different consensus engines based
+// on the number of the block being handled.
+//
+// Engine implements consensus.BFT, running the consensus of the byzantine fault
+// tolerant engine sealing the block after the chain head, if any.
+type Engine struct {
+	forks []Fork // Scheduled engines in ascending block order
+
+	chain   consensus.ChainReader    // Chain to run the consensus on, nil if not started
+	insert  func(*types.Block) error // Callback importing the blocks agreed upon
+	running consensus.BFT            // Byzantine fault tolerant engine currently running
+	lock    sync.Mutex               // Protects the consensus fields
+}
+
+// New creates a consensus engine switching between the given engines at their
+// scheduled blocks. The first engine is used from genesis, regardless of the
+// block it's scheduled at.
+func New(forks []Fork) *Engine {
+	forks = append([]Fork(nil), forks...)
+	sort.SliceStable(forks, func(i, j int) bool { return forks[i].Block < forks[j].Block })
+	if len(forks) > 0 {
+		forks[0].Block = 0
+	}
+	return &Engine{forks: forks}
+}
+
+// Engines returns all the consensus engines scheduled, in ascending block order.
+func (e *Engine) Engines() []consensus.Engine {
+	engines := make([]consensus.Engine, len(e.forks))
+	for i, fork := range e.forks {
+		engines[i] = fork.Engine
+	}
+	return engines
+}
+
+// EngineAt returns the consensus engine handling the block with the given number.
+func (e *Engine) EngineAt(number uint64) consensus.Engine {
+	for i := len(e.forks) - 1; i > 0; i-- {
+		if number >= e.forks[i].Block {
+			return e.forks[i].Engine
+		}
+	}
+	return e.forks[0].Engine
+}
+
+// engineOf returns the consensus engine handling the given header.
+func (e *Engine) engineOf(header *types.Header) consensus.Engine {
+	return e.EngineAt(header.Number.Uint64())
+}
+
+// Author implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) Author(header *types.Header) (common.Address, error) {
+	return e.engineOf(header).Author(header)
+}
+
+// VerifyHeader implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return e.engineOf(header).VerifyHeader(chain, header, seal)
+}
+
+// VerifyHeaders implements consensus.Engine, splitting the headers into batches
+// handled by the same engine and verifying them in order. Later batches can see
+// the headers of the earlier ones as if they were already in the chain, so the
+// first header of a new engine can be checked against the last of the old one.
+func (e *Engine) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	var (
+		abort   = make(chan struct{})
+		results = make(chan error, len(headers))
+	)
+	go func() {
+		reader := &batchReader{ChainReader: chain, headers: make(map[common.Hash]*types.Header)}
+		for start := 0; start < len(headers); {
+			// Gather the next batch of headers belonging to the same engine
+			engine := e.engineOf(headers[start])
+
+			end := start + 1
+			for end < len(headers) && e.engineOf(headers[end]) == engine {
+				end++
+			}
+			// Verify the batch, forwarding the results in order
+			cancel, errs := engine.VerifyHeaders(reader, headers[start:end], seals[start:end])
+			for i := start; i < end; i++ {
+				select {
+				case err := <-errs:
+					results <- err
+				case <-abort:
+					close(cancel)
+					return
+				}
+			}
+			close(cancel)
+
+			// Make the batch visible to the next engine
+			for _, header := range headers[start:end] {
+				reader.headers[header.Hash()] = header
+			}
+			start = end
+		}
+	}()
+	return abort, results
+}
+
+// batchReader is a chain reader also returning the headers of previously
+// verified batches.
+type batchReader struct {
+	consensus.ChainReader
+	headers map[common.Hash]*types.Header
+}
+
+// GetHeader retrieves a block header from the verified batches or the database
+// by hash and number.
+func (r *batchReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header, ok := r.headers[hash]; ok && header.Number.Uint64() == number {
+		return header
+	}
+	return r.ChainReader.GetHeader(hash, number)
+}
+
+// GetHeaderByHash retrieves a block header from the verified batches or the
+// database by its hash.
+func (r *batchReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	if header, ok := r.headers[hash]; ok {
+		return header
+	}
+	return r.ChainReader.GetHeaderByHash(hash)
+}
+
+// VerifyUncles implements consensus.Engine, delegating to the engine of the block.
+func (e *Engine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	return e.engineOf(block.Header()).VerifyUncles(chain, block)
+}
+
+// VerifySeal implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return e.engineOf(header).VerifySeal(chain, header)
+}
+
+// VerifyState implements consensus.StateVerifier, delegating to the engine of the
+// header if it has state dependent rules.
+func (e *Engine) VerifyState(chain consensus.ChainReader, header *types.Header, state *state.StateDB) error {
+	if verifier, ok := e.engineOf(header).(consensus.StateVerifier); ok {
+		return verifier.VerifyState(chain, header, state)
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	return e.engineOf(header).Prepare(chain, header)
+}
+
+// Finalize implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	e.engineOf(header).Finalize(chain, header, state, txs, uncles)
+}
+
+// FinalizeAndAssemble implements consensus.Engine, delegating to the engine of
+// the header.
+func (e *Engine) FinalizeAndAssemble(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	return e.engineOf(header).FinalizeAndAssemble(chain, header, state, txs, uncles, receipts)
+}
+
+// Seal implements consensus.Engine, delegating to the engine of the block.
+func (e *Engine) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	return e.engineOf(block.Header()).Seal(chain, block, results, stop)
+}
+
+// SealHash implements consensus.Engine, delegating to the engine of the header.
+func (e *Engine) SealHash(header *types.Header) common.Hash {
+	return e.engineOf(header).SealHash(header)
+}
+
+// CalcDifficulty implements consensus.Engine, delegating to the engine of the
+// block following the parent.
+func (e *Engine) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	return e.EngineAt(parent.Number.Uint64()+1).CalcDifficulty(chain, time, parent)
+}
+
+// APIs implements consensus.Engine, returning the APIs of all the scheduled engines.
+func (e *Engine) APIs(chain consensus.ChainReader) []rpc.API {
+	var apis []rpc.API
+	for _, fork := range e.forks {
+		apis = append(apis, fork.Engine.APIs(chain)...)
+	}
+	return apis
+}
+
+// SetThreads updates the number of mining threads of all the scheduled engines
+// supporting it.
+func (e *Engine) SetThreads(threads int) {
+	type threaded interface {
+		SetThreads(threads int)
+	}
+	for _, fork := range e.forks {
+		if th, ok := fork.Engine.(threaded); ok {
+			th.SetThreads(threads)
+		}
+	}
+}
+
+// Protocols implements consensus.BFT, returning the sub-protocols of all the
+// scheduled byzantine fault tolerant engines. They are all returned up front, as
+// protocols can't be registered once the node is running.
+func (e *Engine) Protocols() []p2p.Protocol {
+	var protos []p2p.Protocol
+	for _, fork := range e.forks {
+		if bft, ok := fork.Engine.(consensus.BFT); ok {
+			protos = append(protos, bft.Protocols()...)
+		}
+	}
+	return protos
+}
+
+// Start implements consensus.BFT, starting the consensus of the engine sealing
+// the block after the current head, if it's byzantine fault tolerant.
+func (e *Engine) Start(chain consensus.ChainReader, insert func(*types.Block) error) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.chain, e.insert = chain, insert
+	return e.switchBFT(chain.CurrentHeader())
+}
+
+// NewChainHead implements consensus.BFT, switching the running consensus over to
+// the engine sealing the block after the new head, and notifying it of the head.
+func (e *Engine) NewChainHead(head *types.Header) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.chain == nil {
+		return
+	}
+	if err := e.switchBFT(head); err != nil {
+		log.Error("Failed to switch consensus engines", "number", head.Number, "err", err)
+		return
+	}
+	if e.running != nil {
+		e.running.NewChainHead(head)
+	}
+}
+
+// Stop implements consensus.BFT, terminating the running consensus.
+func (e *Engine) Stop() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	var err error
+	if e.running != nil {
+		err = e.running.Stop()
+	}
+	e.chain, e.insert, e.running = nil, nil, nil
+	return err
+}
+
+// switchBFT ensures that the consensus running is the one of the engine sealing
+// the block after the given head, stopping any previously running one.
+func (e *Engine) switchBFT(head *types.Header) error {
+	next, _ := e.EngineAt(head.Number.Uint64() + 1).(consensus.BFT)
+	if next == e.running {
+		return nil
+	}
+	if e.running != nil {
+		if err := e.running.Stop(); err != nil {
+			return err
+		}
+		e.running = nil
+	}
+	if next != nil {
+		if err := next.Start(e.chain, e.insert); err != nil {
+			return err
+		}
+		e.running = next
+	}
+	return nil
+}
+
+// Close implements consensus.Engine, terminating all the scheduled engines.
+func (e *Engine) Close() error {
+	var err error
+	for _, fork := range e.forks {
+		if cerr := fork.Engine.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
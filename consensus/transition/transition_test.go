@@ -0,0 +1,300 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package transition
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/ibft"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const forkBlock = 4 // First block sealed by clique in the tests
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// newTestEngine creates an engine running ethash until the fork block, and
+// clique with the test key as its single signer afterwards.
+func newTestEngine(db ethdb.Database) (*Engine, *params.ChainConfig) {
+	config := *params.AllEthashProtocolChanges
+	config.Transitions = []*params.EngineTransition{{
+		Block:   big.NewInt(forkBlock),
+		Clique:  &params.CliqueConfig{Period: 0, Epoch: 30000},
+		Signers: []common.Address{testAddress},
+	}}
+	poa := clique.New(config.Transitions[0].Clique, db)
+	poa.Takeover(forkBlock, config.Transitions[0].Signers)
+	poa.Authorize(testAddress, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), testKey)
+	})
+	return New([]Fork{{Block: 0, Engine: ethash.NewFaker()}, {Block: forkBlock, Engine: poa}}), &config
+}
+
+// makeChain creates a chain of ethash blocks up to the fork, followed by the given
+// number of clique blocks.
+func makeChain(t *testing.T, clique int) (*core.Genesis, []*types.Block) {
+	db := rawdb.NewMemoryDatabase()
+	engine, config := newTestEngine(db)
+
+	genspec := &core.Genesis{Config: config, Difficulty: big.NewInt(131072), GasLimit: params.GenesisGasLimit}
+	genesis := genspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	blocks, _ := core.GenerateChain(config, genesis, engine, db, forkBlock-1, nil)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert ethash blocks: %v", err)
+	}
+	// Seal the clique blocks on top, one by one
+	for i := 0; i < clique; i++ {
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+			Extra:      make([]byte, 32),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("block #%d: failed to prepare header: %v", header.Number, err)
+		}
+		statedb, _ := chain.StateAt(parent.Root())
+		block, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("block #%d: failed to assemble block: %v", header.Number, err)
+		}
+		// Clique refuses to seal empty blocks on 0-period chains, so seal manually
+		header = block.Header()
+		sig, _ := crypto.Sign(engine.SealHash(header).Bytes(), testKey)
+		copy(header.Extra[len(header.Extra)-crypto.SignatureLength:], sig)
+		block = block.WithSeal(header)
+
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatalf("block #%d: failed to insert clique block: %v", header.Number, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return genspec, blocks
+}
+
+// Tests that a chain switching from ethash to clique can be imported in a single
+// batch, verifying the clique headers on top of not yet imported ethash ones.
+func TestTransitionImport(t *testing.T) {
+	genspec, blocks := makeChain(t, 3)
+
+	db := rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+	engine, config := newTestEngine(db)
+
+	chain, err := core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import chain: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != uint64(len(blocks)) {
+		t.Fatalf("chain head mismatch: have %d, want %d", head, len(blocks))
+	}
+	// Ensure the blocks were verified by the right engines
+	for _, block := range blocks {
+		author, err := engine.Author(block.Header())
+		if err != nil {
+			t.Fatalf("block #%d: failed to retrieve author: %v", block.Number(), err)
+		}
+		if block.NumberU64() >= forkBlock && author != testAddress {
+			t.Errorf("block #%d: author mismatch: have %x, want %x", block.Number(), author, testAddress)
+		}
+	}
+}
+
+// Tests that the headers of a mixed chain are verified in order across the engine
+// boundary, and that the verification results are delivered for every header.
+func TestTransitionVerifyHeaders(t *testing.T) {
+	genspec, blocks := makeChain(t, 3)
+
+	db := rawdb.NewMemoryDatabase()
+	genspec.MustCommit(db)
+	engine, config := newTestEngine(db)
+
+	chain, err := core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	// Break the signature of the last header, all others must pass
+	headers[len(headers)-1].Extra = make([]byte, len(headers[len(headers)-1].Extra))
+
+	abort, results := engine.VerifyHeaders(chain, headers, make([]bool, len(headers)))
+	defer close(abort)
+
+	for i := range headers {
+		err := <-results
+		if i < len(headers)-1 && err != nil {
+			t.Errorf("header #%d: verification failed: %v", headers[i].Number, err)
+		}
+		if i == len(headers)-1 && err == nil {
+			t.Errorf("header #%d: invalid signature accepted", headers[i].Number)
+		}
+	}
+}
+
+// Tests that proof-of-work blocks are rejected after the switch to clique.
+func TestTransitionRejectsOldEngine(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	engine, config := newTestEngine(db)
+
+	genspec := &core.Genesis{Config: config, Difficulty: big.NewInt(131072), GasLimit: params.GenesisGasLimit}
+	genesis := genspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Generate a pure proof-of-work chain crossing the fork block
+	blocks, _ := core.GenerateChain(config, genesis, ethash.NewFaker(), db, forkBlock+1, nil)
+	if n, err := chain.InsertChain(blocks); err == nil {
+		t.Fatalf("proof-of-work blocks after the fork accepted")
+	} else if n != forkBlock-1 {
+		t.Fatalf("failing block mismatch: have %d, want %d", n, forkBlock-1)
+	}
+	if _, ok := engine.EngineAt(forkBlock).(consensus.PoW); ok {
+		t.Fatalf("proof-of-work engine scheduled after the fork")
+	}
+}
+
+// Tests that the consensus of a byzantine fault tolerant engine is started once
+// the chain reaches its fork block, taking over sealing from the preceding engine.
+func TestTransitionToBFT(t *testing.T) {
+	config := *params.AllEthashProtocolChanges
+	config.Transitions = []*params.EngineTransition{{
+		Block:   big.NewInt(forkBlock),
+		IBFT:    &params.IBFTConfig{Epoch: 30000, RequestTimeout: 250},
+		Signers: []common.Address{testAddress},
+	}}
+	db := rawdb.NewMemoryDatabase()
+	bft := ibft.New(config.Transitions[0].IBFT, db)
+	bft.Takeover(forkBlock, config.Transitions[0].Signers)
+	bft.Authorize(testAddress, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), testKey)
+	})
+	engine := New([]Fork{{Block: 0, Engine: ethash.NewFaker()}, {Block: forkBlock, Engine: bft}})
+
+	if protos := engine.Protocols(); len(protos) != 1 || protos[0].Name != "ibft" {
+		t.Fatalf("consensus protocols mismatch: have %v, want ibft", protos)
+	}
+	genspec := &core.Genesis{Config: &config, Difficulty: big.NewInt(131072), GasLimit: params.GenesisGasLimit}
+	genesis := genspec.MustCommit(db)
+
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	blocks, _ := core.GenerateChain(&config, genesis, engine, db, forkBlock-1, nil)
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert ethash blocks: %v", err)
+	}
+	// Run the consensus the way the eth service does, with a minimal miner on top
+	insert := func(block *types.Block) error {
+		_, err := chain.InsertChain(types.Blocks{block})
+		return err
+	}
+	if err := engine.Start(chain, insert); err != nil {
+		t.Fatalf("failed to start consensus: %v", err)
+	}
+	defer engine.Stop()
+
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := chain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	results := make(chan *types.Block, 1)
+	seal := func(parent *types.Block) {
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("block #%d: failed to prepare header: %v", header.Number, err)
+		}
+		statedb, _ := chain.StateAt(parent.Root())
+		block, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("block #%d: failed to assemble block: %v", header.Number, err)
+		}
+		if err := engine.Seal(chain, block, results, nil); err != nil {
+			t.Fatalf("block #%d: failed to seal block: %v", header.Number, err)
+		}
+	}
+	seal(chain.CurrentBlock())
+
+	timeout := time.After(10 * time.Second)
+	for chain.CurrentBlock().NumberU64() < forkBlock+1 {
+		select {
+		case ev := <-heads:
+			engine.NewChainHead(ev.Block.Header())
+			seal(ev.Block)
+		case block := <-results:
+			if err := insert(block); err != nil {
+				t.Fatalf("block #%d: failed to insert committed block: %v", block.Number(), err)
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for block #%d, head #%d", forkBlock+1, chain.CurrentBlock().NumberU64())
+		}
+	}
+	// Ensure the blocks after the fork were agreed upon by the validator
+	for n := uint64(forkBlock); n <= forkBlock+1; n++ {
+		header := chain.GetHeaderByNumber(n)
+		if author, err := engine.Author(header); err != nil || author != testAddress {
+			t.Errorf("block #%d: author mismatch: have %x (%v), want %x", n, author, err, testAddress)
+		}
+		if err := engine.VerifySeal(chain, header); err != nil {
+			t.Errorf("block #%d: invalid seals: %v", n, err)
+		}
+	}
+}
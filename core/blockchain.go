@@ -71,6 +71,7 @@ var (
 	blockPrefetchInterruptMeter = metrics.NewRegisteredMeter("chain/prefetch/interrupts", nil)
 
 	errInsertionInterrupted = errors.New("insertion is interrupted")
+	errFinalizedReorg       = errors.New("reorg would drop finalized blocks")
 )
 
 const (
@@ -1368,6 +1369,11 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 			reorg = !currentPreserve && (blockPreserve || mrand.Float64() < 0.5)
 		}
 	}
+	// Blocks committed by byzantine fault tolerant engines are final, so never
+	// drop them from the canonical chain in favor of a competing fork
+	if reorg && block.ParentHash() != currentBlock.Hash() && bc.dropsFinalized(currentBlock.Header(), block.Header()) {
+		reorg = false
+	}
 	if reorg {
 		// Reorganise the chain if the parent is not the head block
 		if block.ParentHash() != currentBlock.Hash() {
@@ -1450,6 +1456,25 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	return n, err
 }
 
+// InsertChainWithoutSealVerification works exactly the same as InsertChain,
+// except that the seal of the block is not verified. It is used to import
+// blocks produced by an external consensus client, which are not sealed by
+// the local consensus engine.
+func (bc *BlockChain) InsertChainWithoutSealVerification(block *types.Block) (int, error) {
+	bc.blockProcFeed.Send(true)
+	defer bc.blockProcFeed.Send(false)
+
+	// Pre-checks passed, start the full block imports
+	bc.wg.Add(1)
+	bc.chainmu.Lock()
+	n, events, logs, err := bc.insertChain(types.Blocks([]*types.Block{block}), false)
+	bc.chainmu.Unlock()
+	bc.wg.Done()
+
+	bc.PostChainEvents(events, logs)
+	return n, err
+}
+
 // insertChain is the internal implementation of InsertChain, which assumes that
 // 1) chains are contiguous, and 2) The chain mutex is held.
 //
@@ -1858,6 +1883,42 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 	return 0, nil, nil, nil
 }
 
+// dropsFinalized reports whether switching the canonical chain from the old head
+// onto the new one would drop blocks finalized by a byzantine fault tolerant
+// engine. Finalized blocks may only be swapped for blocks with the same seal
+// hash, carrying a different set of seals for the same contents.
+func (bc *BlockChain) dropsFinalized(oldHead, newHead *types.Header) bool {
+	for newHead != nil && newHead.Number.Uint64() > oldHead.Number.Uint64() {
+		newHead = bc.GetHeader(newHead.ParentHash, newHead.Number.Uint64()-1)
+	}
+	for oldHead != nil && newHead != nil && oldHead.Hash() != newHead.Hash() {
+		if bc.isFinalized(oldHead) {
+			if oldHead.Number.Cmp(newHead.Number) != 0 || bc.engine.SealHash(oldHead) != bc.engine.SealHash(newHead) {
+				return true
+			}
+		}
+		if oldHead.Number.Cmp(newHead.Number) == 0 {
+			newHead = bc.GetHeader(newHead.ParentHash, newHead.Number.Uint64()-1)
+		}
+		oldHead = bc.GetHeader(oldHead.ParentHash, oldHead.Number.Uint64()-1)
+	}
+	return false
+}
+
+// isFinalized reports whether the header was sealed by a byzantine fault tolerant
+// engine, taking any scheduled consensus engine switches into account.
+func (bc *BlockChain) isFinalized(header *types.Header) bool {
+	type scheduler interface {
+		EngineAt(number uint64) consensus.Engine
+	}
+	engine := bc.engine
+	if scheduled, ok := engine.(scheduler); ok {
+		engine = scheduled.EngineAt(header.Number.Uint64())
+	}
+	_, ok := engine.(consensus.BFT)
+	return ok
+}
+
 // reorg takes two blocks, an old chain and a new chain and will reconstruct the
 // blocks and inserts them to be part of the new canonical chain and accumulates
 // potential missing transactions and post an event about them.
@@ -1895,6 +1956,10 @@ func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 			}
 		}
 	)
+	// Refuse dropping blocks that were final to begin with
+	if bc.dropsFinalized(oldBlock.Header(), newBlock.Header()) {
+		return errFinalizedReorg
+	}
 	// Reduce the longer chain to the same number as the shorter one
 	if oldBlock.NumberU64() > newBlock.NumberU64() {
 		// Old chain is longer, gather all transactions and logs as deleted ones
@@ -24,6 +24,10 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// TxPoolChangeEvent is posted when transactions are dropped, replaced or
+// promoted within the transaction pool.
+type TxPoolChangeEvent struct{ Changes []*TxPoolChange }
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs []*types.Log
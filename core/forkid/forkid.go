@@ -62,6 +62,13 @@ func NewID(chain *core.BlockChain) ID {
 	)
 }
 
+// NewIDWithHead calculates the Ethereum fork ID from the chain config, genesis
+// hash and head block number. It's meant for callers which don't have access to
+// a fully initialized blockchain, such as protocol testing tools.
+func NewIDWithHead(config *params.ChainConfig, genesis common.Hash, head uint64) ID {
+	return newID(config, genesis, head)
+}
+
 // newID is the internal version of NewID, which takes extracted values as its
 // arguments instead of a chain. The reason is to allow testing the IDs without
 // having to simulate an entire blockchain.
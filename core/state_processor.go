@@ -65,6 +65,12 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		misc.ApplyDAOHardFork(statedb)
 	}
+	// Verify any consensus rules depending on the parent state
+	if verifier, ok := p.engine.(consensus.StateVerifier); ok {
+		if err := verifier.VerifyState(p.bc, header, statedb); err != nil {
+			return nil, nil, 0, err
+		}
+	}
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
 		statedb.Prepare(tx.Hash(), block.Hash(), i)
@@ -18,7 +18,6 @@ package core
 
 import (
 	"errors"
-	"fmt"
 	"math"
 	"math/big"
 	"sort"
@@ -41,6 +40,10 @@ const (
 )
 
 var (
+	// ErrAlreadyKnown is returned if the transactions is already contained
+	// within the pool.
+	ErrAlreadyKnown = errors.New("already known")
+
 	// ErrInvalidSender is returned if the transaction contains an invalid signature.
 	ErrInvalidSender = errors.New("invalid sender")
 
@@ -76,10 +79,30 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrEmptyBundle is returned if a bundle without any transactions is submitted.
+	ErrEmptyBundle = errors.New("empty bundle")
+
+	// ErrBundleTooLarge is returned if a bundle contains more transactions than
+	// allowed in a single bundle.
+	ErrBundleTooLarge = errors.New("bundle too large")
+
+	// ErrStaleBundle is returned if a bundle targets a block that was already mined.
+	ErrStaleBundle = errors.New("bundle target block already mined")
+
+	// ErrFutureBundle is returned if a bundle targets a block too far ahead of
+	// the current head.
+	ErrFutureBundle = errors.New("bundle target block too far in the future")
+
+	// ErrBundlePoolFull is returned if the bundle pool reached its capacity.
+	ErrBundlePoolFull = errors.New("bundle pool full")
 )
 
 var (
 	evictionInterval    = time.Minute     // Time interval to check for evictable transactions
+	maxBundleTxs        = 64              // Maximum number of transactions in a single bundle
+	maxBundles          = 1024            // Maximum number of bundles tracked by the pool
+	maxBundleFuture     = int64(25)       // Maximum number of blocks a bundle may target ahead of the head
 	statsReportInterval = 8 * time.Second // Time interval to report transaction pool stats
 )
 
@@ -117,6 +140,52 @@ const (
 	TxStatusIncluded
 )
 
+// TxChangeKind is the type of lifecycle change a pooled transaction underwent.
+type TxChangeKind uint
+
+const (
+	TxDropped  TxChangeKind = iota // Transaction was removed from the pool without inclusion
+	TxReplaced                     // Transaction was replaced by another with the same nonce
+	TxPromoted                     // Transaction was moved from the queue into the pending set
+)
+
+// String implements fmt.Stringer.
+func (k TxChangeKind) String() string {
+	switch k {
+	case TxDropped:
+		return "dropped"
+	case TxReplaced:
+		return "replaced"
+	case TxPromoted:
+		return "promoted"
+	default:
+		return "unknown"
+	}
+}
+
+// Reasons attached to transaction pool changes, explaining why a transaction
+// was dropped, replaced or promoted.
+const (
+	TxReasonUnderpriced  = "underpriced"            // Pool full, evicted by better paying transactions
+	TxReasonReplaced     = "replaced"               // Replaced by a same-nonce transaction with a price bump
+	TxReasonDiscarded    = "discarded"              // Failed to replace a pending same-nonce transaction
+	TxReasonNonceTooLow  = "nonce too low"          // Account nonce advanced past the transaction
+	TxReasonUnpayable    = "insufficient funds"     // Balance or block gas limit can't cover the transaction
+	TxReasonAccountLimit = "account limit exceeded" // Account queued more than its permitted slots
+	TxReasonPoolLimit    = "pool limit exceeded"    // Pool above its global limits, fairness eviction
+	TxReasonExpired      = "expired"                // Queued longer than the configured lifetime
+	TxReasonPriceLimit   = "below price limit"      // Pool minimum gas price raised above the transaction's
+	TxReasonExecutable   = "executable"             // Nonce gap closed, transaction became processable
+)
+
+// TxPoolChange describes a single lifecycle change of a pooled transaction.
+type TxPoolChange struct {
+	Kind   TxChangeKind
+	Tx     *types.Transaction // Transaction that was changed
+	By     *types.Transaction // Replacement transaction, if any
+	Reason string             // Human readable reason of the change
+}
+
 // blockChain provides the state of blockchain and current gas limit to do
 // some pre checks in tx pool and event subscribers.
 type blockChain interface {
@@ -214,6 +283,7 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	changeFeed  event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
@@ -232,6 +302,8 @@ type TxPool struct {
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	changes []*TxPoolChange              // Lifecycle changes accumulated since the last notification
+	bundles []types.MevBundle            // Bundles waiting for inclusion at their target block
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -359,12 +431,16 @@ func (pool *TxPool) loop() {
 				// Any non-locals old enough should be removed
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
+						pool.recordChange(TxDropped, tx, nil, TxReasonExpired)
 						pool.removeTx(tx.Hash(), true)
 					}
 				}
 			}
+			changes := pool.takeChanges()
 			pool.mu.Unlock()
 
+			pool.sendChanges(changes)
+
 		// Handle local transaction journal rotation
 		case <-journal.C:
 			if pool.journal != nil {
@@ -399,6 +475,36 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeTxPoolChangeEvent registers a subscription of TxPoolChangeEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeTxPoolChangeEvent(ch chan<- TxPoolChangeEvent) event.Subscription {
+	return pool.scope.Track(pool.changeFeed.Subscribe(ch))
+}
+
+// recordChange queues a transaction lifecycle change for the next notification.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) recordChange(kind TxChangeKind, tx, by *types.Transaction, reason string) {
+	pool.changes = append(pool.changes, &TxPoolChange{Kind: kind, Tx: tx, By: by, Reason: reason})
+}
+
+// takeChanges retrieves and clears the accumulated lifecycle changes.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) takeChanges() []*TxPoolChange {
+	changes := pool.changes
+	pool.changes = nil
+	return changes
+}
+
+// sendChanges notifies subscribers of a batch of lifecycle changes. It must be
+// called without holding the pool lock.
+func (pool *TxPool) sendChanges(changes []*TxPoolChange) {
+	if len(changes) > 0 {
+		pool.changeFeed.Send(TxPoolChangeEvent{changes})
+	}
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -411,12 +517,15 @@ func (pool *TxPool) GasPrice() *big.Int {
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
-
 	pool.gasPrice = price
 	for _, tx := range pool.priced.Cap(price, pool.locals) {
+		pool.recordChange(TxDropped, tx, nil, TxReasonPriceLimit)
 		pool.removeTx(tx.Hash(), false)
 	}
+	changes := pool.takeChanges()
+	pool.mu.Unlock()
+
+	pool.sendChanges(changes)
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
 
@@ -469,6 +578,109 @@ func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common
 	return pending, queued
 }
 
+// ContentFrom retrieves the data content of the transaction pool, returning the
+// pending as well as queued transactions of this address, grouped by nonce.
+func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var pending types.Transactions
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Flatten()
+	}
+	var queued types.Transactions
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Flatten()
+	}
+	return pending, queued
+}
+
+// AddMevBundle adds an ordered list of transactions to be included atomically
+// at the top of the given block. The bundle is only considered for blocks whose
+// timestamp falls between minTimestamp and maxTimestamp (zero meaning unbounded).
+//
+// The target block must be at most maxBundleFuture blocks ahead of the head. If
+// the pool is full, the bundle targeting the farthest block is evicted.
+func (pool *TxPool) AddMevBundle(txs types.Transactions, blockNumber *big.Int, minTimestamp, maxTimestamp uint64) error {
+	if len(txs) == 0 {
+		return ErrEmptyBundle
+	}
+	if len(txs) > maxBundleTxs {
+		return ErrBundleTooLarge
+	}
+	for _, tx := range txs {
+		if _, err := types.Sender(pool.signer, tx); err != nil {
+			return ErrInvalidSender
+		}
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	head := pool.chain.CurrentBlock().Number()
+	if blockNumber.Cmp(head) <= 0 {
+		return ErrStaleBundle
+	}
+	if blockNumber.Cmp(new(big.Int).Add(head, big.NewInt(maxBundleFuture))) > 0 {
+		return ErrFutureBundle
+	}
+	bundle := types.MevBundle{
+		Txs:          txs,
+		BlockNumber:  new(big.Int).Set(blockNumber),
+		MinTimestamp: minTimestamp,
+		MaxTimestamp: maxTimestamp,
+	}
+	if len(pool.bundles) < maxBundles {
+		pool.bundles = append(pool.bundles, bundle)
+		return nil
+	}
+	// The pool is full, make room by evicting the bundle targeting the farthest
+	// block, unless the new bundle targets an even later one
+	farthest := 0
+	for i, b := range pool.bundles {
+		if b.BlockNumber.Cmp(pool.bundles[farthest].BlockNumber) > 0 {
+			farthest = i
+		}
+	}
+	if blockNumber.Cmp(pool.bundles[farthest].BlockNumber) >= 0 {
+		return ErrBundlePoolFull
+	}
+	pool.bundles[farthest] = bundle
+	return nil
+}
+
+// MevBundles returns the bundles targeting the given block number that are valid
+// for the given block timestamp. Bundles for earlier blocks are discarded.
+func (pool *TxPool) MevBundles(blockNumber *big.Int, blockTimestamp uint64) []types.MevBundle {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var (
+		keep  []types.MevBundle
+		ready []types.MevBundle
+	)
+	for _, bundle := range pool.bundles {
+		// Drop bundles whose target block was passed already
+		if bundle.BlockNumber.Cmp(blockNumber) < 0 {
+			continue
+		}
+		keep = append(keep, bundle)
+
+		// Only return the bundles valid for the requested block
+		if bundle.BlockNumber.Cmp(blockNumber) != 0 {
+			continue
+		}
+		if bundle.MinTimestamp != 0 && blockTimestamp < bundle.MinTimestamp {
+			continue
+		}
+		if bundle.MaxTimestamp != 0 && blockTimestamp > bundle.MaxTimestamp {
+			continue
+		}
+		ready = append(ready, bundle)
+	}
+	pool.bundles = keep
+	return ready
+}
+
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -566,7 +778,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 	if pool.all.Get(hash) != nil {
 		log.Trace("Discarding already known transaction", "hash", hash)
 		knownTxMeter.Mark(1)
-		return false, fmt.Errorf("known transaction: %x", hash)
+		return false, ErrAlreadyKnown
 	}
 	// If the transaction fails basic validation, discard it
 	if err := pool.validateTx(tx, local); err != nil {
@@ -587,6 +799,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxMeter.Mark(1)
+			pool.recordChange(TxDropped, tx, nil, TxReasonUnderpriced)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -604,6 +817,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.recordChange(TxReplaced, old, tx, TxReasonReplaced)
 		}
 		pool.all.Add(tx)
 		pool.priced.Put(tx)
@@ -653,6 +867,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.recordChange(TxReplaced, old, tx, TxReasonReplaced)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -694,6 +909,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed(1)
 
 		pendingDiscardMeter.Mark(1)
+		pool.recordChange(TxDropped, tx, nil, TxReasonDiscarded)
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -702,6 +918,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.priced.Removed(1)
 
 		pendingReplaceMeter.Mark(1)
+		pool.recordChange(TxReplaced, old, tx, TxReasonReplaced)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
@@ -773,7 +990,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	for i, tx := range txs {
 		// If the transaction is known, pre-set the error slot
 		if pool.all.Get(tx.Hash()) != nil {
-			errs[i] = fmt.Errorf("known transaction: %x", tx.Hash())
+			errs[i] = ErrAlreadyKnown
 			knownTxMeter.Mark(1)
 			continue
 		}
@@ -790,8 +1007,11 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
 	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	changes := pool.takeChanges()
 	pool.mu.Unlock()
 
+	pool.sendChanges(changes)
+
 	var nilSlot = 0
 	for _, err := range newErrs {
 		for errs[nilSlot] != nil {
@@ -851,6 +1071,18 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all.Get(hash)
 }
 
+// ArrivalTime returns the time a transaction entered the pool, or the zero time
+// if it is not contained in the pool.
+func (pool *TxPool) ArrivalTime(hash common.Hash) time.Time {
+	return pool.all.Arrival(hash)
+}
+
+// Has returns an indicator whether txpool has a transaction cached with the
+// given hash.
+func (pool *TxPool) Has(hash common.Hash) bool {
+	return pool.all.Get(hash) != nil
+}
+
 // removeTx removes a single transaction from the queue, moving all subsequent
 // transactions back to the future queue.
 func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
@@ -1052,8 +1284,11 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		txs := list.Flatten() // Heavy but will be cached and is needed by the miner anyway
 		pool.pendingNonces.set(addr, txs[len(txs)-1].Nonce()+1)
 	}
+	changes := pool.takeChanges()
 	pool.mu.Unlock()
 
+	pool.sendChanges(changes)
+
 	// Notify subsystems for newly added transactions
 	if len(events) > 0 {
 		var txs []*types.Transaction
@@ -1170,6 +1405,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range forwards {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.recordChange(TxDropped, tx, nil, TxReasonNonceTooLow)
 			log.Trace("Removed old queued transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas)
@@ -1177,6 +1413,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.recordChange(TxDropped, tx, nil, TxReasonUnpayable)
 			log.Trace("Removed unpayable queued transaction", "hash", hash)
 		}
 		queuedNofundsMeter.Mark(int64(len(drops)))
@@ -1187,6 +1424,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			hash := tx.Hash()
 			if pool.promoteTx(addr, hash, tx) {
 				log.Trace("Promoting queued transaction", "hash", hash)
+				pool.recordChange(TxPromoted, tx, nil, TxReasonExecutable)
 				promoted = append(promoted, tx)
 			}
 		}
@@ -1199,6 +1437,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.recordChange(TxDropped, tx, nil, TxReasonAccountLimit)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
@@ -1260,6 +1499,7 @@ func (pool *TxPool) truncatePending() {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
 						pool.all.Remove(hash)
+						pool.recordChange(TxDropped, tx, nil, TxReasonPoolLimit)
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
@@ -1287,6 +1527,7 @@ func (pool *TxPool) truncatePending() {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
 					pool.all.Remove(hash)
+					pool.recordChange(TxDropped, tx, nil, TxReasonPoolLimit)
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1333,6 +1574,7 @@ func (pool *TxPool) truncateQueue() {
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
+				pool.recordChange(TxDropped, tx, nil, TxReasonPoolLimit)
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1342,6 +1584,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.recordChange(TxDropped, txs[i], nil, TxReasonPoolLimit)
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1357,7 +1600,8 @@ func (pool *TxPool) demoteUnexecutables() {
 	for addr, list := range pool.pending {
 		nonce := pool.currentState.GetNonce(addr)
 
-		// Drop all transactions that are deemed too old (low nonce)
+		// Drop all transactions that are deemed too old (low nonce). These are not
+		// reported as dropped since they were almost always included in a block.
 		olds := list.Forward(nonce)
 		for _, tx := range olds {
 			hash := tx.Hash()
@@ -1370,6 +1614,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.recordChange(TxDropped, tx, nil, TxReasonUnpayable)
 		}
 		pool.priced.Removed(len(olds) + len(drops))
 		pendingNofundsMeter.Mark(int64(len(drops)))
@@ -1493,14 +1738,16 @@ func (as *accountSet) merge(other *accountSet) {
 // peeking into the pool in TxPool.Get without having to acquire the widely scoped
 // TxPool.mu mutex.
 type txLookup struct {
-	all  map[common.Hash]*types.Transaction
-	lock sync.RWMutex
+	all      map[common.Hash]*types.Transaction
+	arrivals map[common.Hash]time.Time // Time when each transaction was first added
+	lock     sync.RWMutex
 }
 
 // newTxLookup returns a new txLookup structure.
 func newTxLookup() *txLookup {
 	return &txLookup{
-		all: make(map[common.Hash]*types.Transaction),
+		all:      make(map[common.Hash]*types.Transaction),
+		arrivals: make(map[common.Hash]time.Time),
 	}
 }
 
@@ -1524,6 +1771,15 @@ func (t *txLookup) Get(hash common.Hash) *types.Transaction {
 	return t.all[hash]
 }
 
+// Arrival returns the time a transaction was added to the lookup, or the zero
+// time if not found.
+func (t *txLookup) Arrival(hash common.Hash) time.Time {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	return t.arrivals[hash]
+}
+
 // Count returns the current number of items in the lookup.
 func (t *txLookup) Count() int {
 	t.lock.RLock()
@@ -1537,7 +1793,11 @@ func (t *txLookup) Add(tx *types.Transaction) {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
-	t.all[tx.Hash()] = tx
+	hash := tx.Hash()
+	t.all[hash] = tx
+	if _, ok := t.arrivals[hash]; !ok {
+		t.arrivals[hash] = time.Now()
+	}
 }
 
 // Remove removes a transaction from the lookup.
@@ -1546,4 +1806,5 @@ func (t *txLookup) Remove(hash common.Hash) {
 	defer t.lock.Unlock()
 
 	delete(t.all, hash)
+	delete(t.arrivals, hash)
 }
@@ -1583,6 +1583,195 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
+// Tests that transaction promotions, replacements and drops are reported via
+// the change feed together with the reason.
+func TestTransactionChangeEvents(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account, _ := deriveSender(transaction(0, 0, key))
+	pool.currentState.AddBalance(account, big.NewInt(1000000))
+
+	changes := make(chan TxPoolChangeEvent, 16)
+	sub := pool.SubscribeTxPoolChangeEvent(changes)
+	defer sub.Unsubscribe()
+
+	expect := func(kind TxChangeKind, tx, by *types.Transaction, reason string) {
+		t.Helper()
+
+		select {
+		case ev := <-changes:
+			if len(ev.Changes) != 1 {
+				t.Fatalf("change count mismatch: have %d, want %d", len(ev.Changes), 1)
+			}
+			change := ev.Changes[0]
+			if change.Kind != kind {
+				t.Errorf("change kind mismatch: have %v, want %v", change.Kind, kind)
+			}
+			if change.Tx.Hash() != tx.Hash() {
+				t.Errorf("changed transaction mismatch: have %x, want %x", change.Tx.Hash(), tx.Hash())
+			}
+			if (change.By == nil) != (by == nil) || (by != nil && change.By.Hash() != by.Hash()) {
+				t.Errorf("replacement transaction mismatch: have %v, want %v", change.By, by)
+			}
+			if change.Reason != reason {
+				t.Errorf("change reason mismatch: have %q, want %q", change.Reason, reason)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("change event timeout")
+		}
+	}
+	// Add a gapped transaction, then fill the gap to have it promoted
+	future := pricedTransaction(1, 100000, big.NewInt(1), key)
+	if err := pool.addRemoteSync(future); err != nil {
+		t.Fatalf("failed to add future transaction: %v", err)
+	}
+	select {
+	case ev := <-changes:
+		t.Fatalf("unexpected change events: %v", ev.Changes)
+	default:
+	}
+	if err := pool.addRemoteSync(pricedTransaction(0, 100000, big.NewInt(1), key)); err != nil {
+		t.Fatalf("failed to add gap filling transaction: %v", err)
+	}
+	select {
+	case ev := <-changes:
+		if len(ev.Changes) != 2 {
+			t.Fatalf("promotion count mismatch: have %d, want %d", len(ev.Changes), 2)
+		}
+		for _, change := range ev.Changes {
+			if change.Kind != TxPromoted || change.Reason != TxReasonExecutable {
+				t.Errorf("promotion mismatch: have %v (%s)", change.Kind, change.Reason)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("promotion event timeout")
+	}
+	// Replace the pending transaction with a higher priced one
+	replacement := pricedTransaction(1, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(replacement); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	expect(TxReplaced, future, replacement, TxReasonReplaced)
+
+	// Raise the price limit above the replacement to get it dropped
+	pool.SetGasPrice(big.NewInt(3))
+	select {
+	case ev := <-changes:
+		if len(ev.Changes) != 2 {
+			t.Fatalf("drop count mismatch: have %d, want %d", len(ev.Changes), 2)
+		}
+		for _, change := range ev.Changes {
+			if change.Kind != TxDropped || change.Reason != TxReasonPriceLimit {
+				t.Errorf("drop mismatch: have %v (%s)", change.Kind, change.Reason)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drop event timeout")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that bundles are only returned for their target block and timestamp
+// window, and are discarded once the target block passes.
+func TestTransactionBundles(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	txs := types.Transactions{transaction(0, 100000, key)}
+	if err := pool.AddMevBundle(nil, big.NewInt(1), 0, 0); err != ErrEmptyBundle {
+		t.Fatalf("empty bundle error mismatch: have %v, want %v", err, ErrEmptyBundle)
+	}
+	if err := pool.AddMevBundle(txs, big.NewInt(0), 0, 0); err != ErrStaleBundle {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, ErrStaleBundle)
+	}
+	if err := pool.AddMevBundle(txs, big.NewInt(1), 0, 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if err := pool.AddMevBundle(txs, big.NewInt(2), 100, 200); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	if bundles := pool.MevBundles(big.NewInt(1), 0); len(bundles) != 1 {
+		t.Fatalf("block 1 bundle count mismatch: have %d, want %d", len(bundles), 1)
+	}
+	if bundles := pool.MevBundles(big.NewInt(2), 50); len(bundles) != 0 {
+		t.Fatalf("early bundle returned")
+	}
+	if bundles := pool.MevBundles(big.NewInt(2), 250); len(bundles) != 0 {
+		t.Fatalf("late bundle returned")
+	}
+	if bundles := pool.MevBundles(big.NewInt(2), 150); len(bundles) != 1 {
+		t.Fatalf("block 2 bundle count mismatch: have %d, want %d", len(bundles), 1)
+	}
+	if len(pool.bundles) != 1 {
+		t.Fatalf("stale bundles not discarded: have %d, want %d", len(pool.bundles), 1)
+	}
+}
+
+// Tests that bundles targeting blocks too far ahead are rejected, and that a full
+// bundle pool evicts the bundles targeting the farthest blocks first.
+func TestTransactionBundleLimits(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	txs := types.Transactions{transaction(0, 100000, key)}
+	if err := pool.AddMevBundle(txs, big.NewInt(maxBundleFuture+1), 0, 0); err != ErrFutureBundle {
+		t.Fatalf("future bundle error mismatch: have %v, want %v", err, ErrFutureBundle)
+	}
+	for i := 0; i < maxBundles; i++ {
+		if err := pool.AddMevBundle(txs, big.NewInt(maxBundleFuture), 0, 0); err != nil {
+			t.Fatalf("failed to add bundle %d: %v", i, err)
+		}
+	}
+	if err := pool.AddMevBundle(txs, big.NewInt(maxBundleFuture), 0, 0); err != ErrBundlePoolFull {
+		t.Fatalf("full pool error mismatch: have %v, want %v", err, ErrBundlePoolFull)
+	}
+	if err := pool.AddMevBundle(txs, big.NewInt(1), 0, 0); err != nil {
+		t.Fatalf("failed to add bundle to full pool: %v", err)
+	}
+	if len(pool.bundles) != maxBundles {
+		t.Fatalf("bundle count mismatch: have %d, want %d", len(pool.bundles), maxBundles)
+	}
+	if bundles := pool.MevBundles(big.NewInt(1), 0); len(bundles) != 1 {
+		t.Fatalf("block 1 bundle count mismatch: have %d, want %d", len(bundles), 1)
+	}
+}
+
+// Tests that the arrival time of transactions is tracked while they are pooled.
+func TestTransactionArrivalTime(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	account, _ := deriveSender(transaction(0, 0, key))
+	pool.currentState.AddBalance(account, big.NewInt(1000000))
+
+	tx := transaction(0, 100000, key)
+	before := time.Now()
+	if err := pool.addRemoteSync(tx); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if arrival := pool.ArrivalTime(tx.Hash()); arrival.Before(before) || arrival.After(time.Now()) {
+		t.Fatalf("arrival time out of range: have %v, added after %v", arrival, before)
+	}
+	pool.mu.Lock()
+	pool.removeTx(tx.Hash(), true)
+	pool.mu.Unlock()
+
+	if arrival := pool.ArrivalTime(tx.Hash()); !arrival.IsZero() {
+		t.Fatalf("arrival time retained after removal: %v", arrival)
+	}
+}
+
 // Tests that local transactions are journaled to disk, but remote transactions
 // get discarded between restarts.
 func TestTransactionJournaling(t *testing.T)         { testTransactionJournaling(t, false) }
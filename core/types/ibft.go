@@ -0,0 +1,93 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// IBFTDigest is the magic mix digest identifying blocks sealed by the IBFT
+	// consensus engine ("practical byzantine fault tolerance").
+	IBFTDigest = common.HexToHash("0x63746963616c2062797a616e74696e65206661756c7420746f6c6572616e6365")
+
+	// IBFTExtraVanity is the fixed number of extra-data prefix bytes reserved for
+	// validator vanity.
+	IBFTExtraVanity = 32
+
+	// ErrInvalidIBFTExtra is returned if the extra-data of a header can't be
+	// decoded into the IBFT consensus fields.
+	ErrInvalidIBFTExtra = errors.New("invalid ibft header extra-data")
+)
+
+// IBFTExtra contains the consensus fields of an IBFT block, RLP encoded into the
+// header's extra-data after the vanity prefix.
+type IBFTExtra struct {
+	Validators    []common.Address // Validator set, only present on checkpoint blocks
+	Seal          []byte           // Signature of the block's proposer
+	CommittedSeal [][]byte         // Signatures of the validators committing to the block
+}
+
+// ExtractIBFTExtra decodes the IBFT consensus fields from a header's extra-data.
+func ExtractIBFTExtra(h *Header) (*IBFTExtra, error) {
+	if len(h.Extra) < IBFTExtraVanity {
+		return nil, ErrInvalidIBFTExtra
+	}
+	extra := new(IBFTExtra)
+	if err := rlp.DecodeBytes(h.Extra[IBFTExtraVanity:], extra); err != nil {
+		return nil, err
+	}
+	return extra, nil
+}
+
+// EncodeIBFTExtra assembles a header extra-data from a vanity prefix, padded or
+// truncated to the required length, and the IBFT consensus fields.
+func EncodeIBFTExtra(vanity []byte, extra *IBFTExtra) ([]byte, error) {
+	prefix := make([]byte, IBFTExtraVanity)
+	copy(prefix, vanity)
+
+	payload, err := rlp.EncodeToBytes(extra)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, payload...), nil
+}
+
+// IBFTFilteredHeader returns a copy of the header with the committed seals, and
+// optionally the proposer seal, removed from its extra-data. It returns nil if
+// the extra-data is malformed.
+func IBFTFilteredHeader(h *Header, keepSeal bool) *Header {
+	extra, err := ExtractIBFTExtra(h)
+	if err != nil {
+		return nil
+	}
+	if !keepSeal {
+		extra.Seal = []byte{}
+	}
+	extra.CommittedSeal = [][]byte{}
+
+	enc, err := EncodeIBFTExtra(h.Extra[:IBFTExtraVanity], extra)
+	if err != nil {
+		return nil
+	}
+	cpy := CopyHeader(h)
+	cpy.Extra = enc
+	return cpy
+}
@@ -417,3 +417,12 @@ func (m Message) Gas() uint64          { return m.gasLimit }
 func (m Message) Nonce() uint64        { return m.nonce }
 func (m Message) Data() []byte         { return m.data }
 func (m Message) CheckNonce() bool     { return m.checkNonce }
+
+// MevBundle is an ordered list of transactions that must be included atomically
+// and in order at the top of a specific block, or not at all.
+type MevBundle struct {
+	Txs          Transactions
+	BlockNumber  *big.Int
+	MinTimestamp uint64 // Earliest block timestamp the bundle is valid for (0 = unbounded)
+	MaxTimestamp uint64 // Latest block timestamp the bundle is valid for (0 = unbounded)
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Roles of the accounts in the allow list precompile.
+const (
+	AllowListNone    = 0 // Account not listed
+	AllowListEnabled = 1 // Account allowed
+	AllowListAdmin   = 2 // Account allowed, may modify the list
+)
+
+var (
+	allowListRead       = crypto.Keccak256([]byte("readAllowList(address)"))[:4]
+	allowListSetNone    = crypto.Keccak256([]byte("setNone(address)"))[:4]
+	allowListSetEnabled = crypto.Keccak256([]byte("setEnabled(address)"))[:4]
+	allowListSetAdmin   = crypto.Keccak256([]byte("setAdmin(address)"))[:4]
+
+	errAllowListInput    = errors.New("invalid allow list call")
+	errAllowListDelegate = errors.New("allow list cannot be modified via delegate calls")
+	errAllowListNotAdmin = errors.New("caller is not an allow list admin")
+	errAllowListNoState  = errors.New("allow list requires state access")
+)
+
+// allowList is a precompiled contract maintaining a list of accounts with roles,
+// modifiable by the admins of the list. The roles are stored in the storage of
+// the precompile, keyed by account. The admins of the chain config are admins
+// regardless of the stored roles.
+//
+// The contract implements the following Solidity interface:
+//
+//	function readAllowList(address addr) external view returns (uint256 role);
+//	function setNone(address addr) external;
+//	function setEnabled(address addr) external;
+//	function setAdmin(address addr) external;
+type allowList struct {
+	admins []common.Address
+}
+
+// configure implements configurablePrecompiledContract, returning an allow list
+// with the admins of the config.
+func (c *allowList) configure(config *params.PrecompileConfig) PrecompiledContract {
+	return &allowList{admins: config.Admins}
+}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *allowList) RequiredGas(input []byte) uint64 {
+	if len(input) >= 4 && bytes.Equal(input[:4], allowListRead) {
+		return params.SloadGasEIP1884
+	}
+	return params.SstoreInitGasEIP2200
+}
+
+// Run implements PrecompiledContract. The allow list can only be executed with
+// access to the state, through RunStateful.
+func (c *allowList) Run(input []byte) ([]byte, error) {
+	return nil, errAllowListNoState
+}
+
+// RunStateful implements StatefulPrecompiledContract.
+func (c *allowList) RunStateful(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
+	if len(input) != 4+common.HashLength || !allZero(input[4:4+common.HashLength-common.AddressLength]) {
+		return nil, errAllowListInput
+	}
+	var (
+		self     = *contract.CodeAddr
+		selector = input[:4]
+		addr     = common.BytesToAddress(input[4:])
+	)
+	if bytes.Equal(selector, allowListRead) {
+		return common.BigToHash(new(big.Int).SetUint64(c.role(evm.StateDB, self, addr))).Bytes(), nil
+	}
+	var role int64
+	switch {
+	case bytes.Equal(selector, allowListSetNone):
+		role = AllowListNone
+	case bytes.Equal(selector, allowListSetEnabled):
+		role = AllowListEnabled
+	case bytes.Equal(selector, allowListSetAdmin):
+		role = AllowListAdmin
+	default:
+		return nil, errAllowListInput
+	}
+	if readOnly {
+		return nil, errWriteProtection
+	}
+	if contract.Address() != self {
+		return nil, errAllowListDelegate
+	}
+	if c.role(evm.StateDB, self, contract.Caller()) != AllowListAdmin {
+		return nil, errAllowListNotAdmin
+	}
+	// Keep the precompile account from being deleted as empty along with the roles
+	if evm.StateDB.GetNonce(self) == 0 {
+		evm.StateDB.SetNonce(self, 1)
+	}
+	evm.StateDB.SetState(self, common.BytesToHash(addr.Bytes()), common.BigToHash(big.NewInt(role)))
+	return nil, nil
+}
+
+// role returns the role of the account in the allow list stored at self.
+func (c *allowList) role(db StateDB, self, addr common.Address) uint64 {
+	for _, admin := range c.admins {
+		if admin == addr {
+			return AllowListAdmin
+		}
+	}
+	return db.GetState(self, common.BytesToHash(addr.Bytes())).Big().Uint64()
+}
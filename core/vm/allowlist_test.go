@@ -0,0 +1,104 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the allow list precompile reports the roles of accounts and only
+// lets admins modify them, outside of static calls.
+func TestAllowList(t *testing.T) {
+	var (
+		list  = common.BytesToAddress([]byte{0x02, 0x00})
+		admin = common.HexToAddress("0xad")
+		user  = common.HexToAddress("0x01")
+		other = common.HexToAddress("0x02")
+	)
+	config := *params.TestChainConfig
+	config.Precompiles = []*params.PrecompileConfig{{Block: big.NewInt(0), Address: list, Name: "allowList", Admins: []common.Address{admin}}}
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	vmctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(0),
+	}
+	vmenv := NewEVM(vmctx, statedb, &config, Config{})
+
+	call := func(from common.Address, selector []byte, addr common.Address) error {
+		input := append(append([]byte{}, selector...), common.BytesToHash(addr.Bytes()).Bytes()...)
+		_, _, err := vmenv.Call(AccountRef(from), list, input, 100000, new(big.Int))
+		return err
+	}
+	role := func(addr common.Address) uint64 {
+		input := append(append([]byte{}, allowListRead...), common.BytesToHash(addr.Bytes()).Bytes()...)
+		ret, _, err := vmenv.StaticCall(AccountRef(other), list, input, 100000)
+		if err != nil {
+			t.Fatalf("failed to read role of %x: %v", addr, err)
+		}
+		return new(big.Int).SetBytes(ret).Uint64()
+	}
+	if have := role(admin); have != AllowListAdmin {
+		t.Fatalf("configured admin role mismatch: have %d, want %d", have, AllowListAdmin)
+	}
+	if have := role(user); have != AllowListNone {
+		t.Fatalf("unlisted role mismatch: have %d, want %d", have, AllowListNone)
+	}
+	// Only admins may modify the list
+	if err := call(user, allowListSetEnabled, user); err != errAllowListNotAdmin {
+		t.Fatalf("non-admin modification error mismatch: have %v, want %v", err, errAllowListNotAdmin)
+	}
+	if err := call(admin, allowListSetEnabled, user); err != nil {
+		t.Fatalf("failed to enable account: %v", err)
+	}
+	if have := role(user); have != AllowListEnabled {
+		t.Fatalf("enabled role mismatch: have %d, want %d", have, AllowListEnabled)
+	}
+	// Admins granted by the list may modify it too
+	if err := call(admin, allowListSetAdmin, user); err != nil {
+		t.Fatalf("failed to grant admin role: %v", err)
+	}
+	if err := call(user, allowListSetEnabled, other); err != nil {
+		t.Fatalf("failed to enable account by granted admin: %v", err)
+	}
+	if have := role(other); have != AllowListEnabled {
+		t.Fatalf("enabled role mismatch: have %d, want %d", have, AllowListEnabled)
+	}
+	// Static calls must not modify the list
+	input := append(append([]byte{}, allowListSetNone...), common.BytesToHash(other.Bytes()).Bytes()...)
+	if _, _, err := vmenv.StaticCall(AccountRef(admin), list, input, 100000); err != errWriteProtection {
+		t.Fatalf("static modification error mismatch: have %v, want %v", err, errWriteProtection)
+	}
+	if err := call(admin, allowListSetNone, other); err != nil {
+		t.Fatalf("failed to remove account: %v", err)
+	}
+	if have := role(other); have != AllowListNone {
+		t.Fatalf("removed role mismatch: have %d, want %d", have, AllowListNone)
+	}
+	// The roles must survive the removal of empty accounts
+	statedb.Finalise(true)
+	if have := role(user); have != AllowListAdmin {
+		t.Fatalf("granted admin role lost: have %d, want %d", have, AllowListAdmin)
+	}
+}
@@ -33,6 +33,8 @@ func EnableEIP(eipNum int, jt *JumpTable) error {
 		enable1884(jt)
 	case 1344:
 		enable1344(jt)
+	case 2537:
+		// EIP-2537 only adds precompiled contracts, which are resolved by the EVM
 	default:
 		return fmt.Errorf("undefined eip %d", eipNum)
 	}
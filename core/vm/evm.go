@@ -22,7 +22,9 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 )
 
@@ -43,14 +45,14 @@ type (
 // run runs the given contract and takes care of running precompiles with a fallback to the byte code interpreter.
 func run(evm *EVM, contract *Contract, input []byte, readOnly bool) ([]byte, error) {
 	if contract.CodeAddr != nil {
-		precompiles := PrecompiledContractsHomestead
-		if evm.chainRules.IsByzantium {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if evm.chainRules.IsIstanbul {
-			precompiles = PrecompiledContractsIstanbul
-		}
-		if p := precompiles[*contract.CodeAddr]; p != nil {
+		if p := evm.precompiles[*contract.CodeAddr]; p != nil {
+			if sp, ok := p.(StatefulPrecompiledContract); ok {
+				// Calls made from within a static call are read only too
+				if in, ok := evm.interpreter.(*EVMInterpreter); ok && in.readOnly {
+					readOnly = true
+				}
+				return runStatefulPrecompiledContract(evm, sp, input, contract, readOnly)
+			}
 			return RunPrecompiledContract(p, input, contract)
 		}
 	}
@@ -114,6 +116,8 @@ type EVM struct {
 	chainConfig *params.ChainConfig
 	// chain rules contains the chain rules for the current epoch
 	chainRules params.Rules
+	// precompiles contains the precompiled contracts active in the current block
+	precompiles map[common.Address]PrecompiledContract
 	// virtual machine configuration options used to initialise the
 	// evm.
 	vmConfig Config
@@ -139,33 +143,47 @@ func NewEVM(ctx Context, statedb StateDB, chainConfig *params.ChainConfig, vmCon
 		vmConfig:     vmConfig,
 		chainConfig:  chainConfig,
 		chainRules:   chainConfig.Rules(ctx.BlockNumber),
+		precompiles:  ActivePrecompiledContracts(chainConfig, ctx.BlockNumber),
 		interpreters: make([]Interpreter, 0, 1),
 	}
+	for _, eip := range vmConfig.ExtraEips {
+		if eip == 2537 {
+			evm.precompiles = extendPrecompiledContracts(evm.precompiles, PrecompiledContractsBLS)
+		}
+	}
 
 	if chainConfig.IsEWASM(ctx.BlockNumber) {
-		// to be implemented by EVM-C and Wagon PRs.
-		// if vmConfig.EWASMInterpreter != "" {
-		//  extIntOpts := strings.Split(vmConfig.EWASMInterpreter, ":")
-		//  path := extIntOpts[0]
-		//  options := []string{}
-		//  if len(extIntOpts) > 1 {
-		//    options = extIntOpts[1..]
-		//  }
-		//  evm.interpreters = append(evm.interpreters, NewEVMVCInterpreter(evm, vmConfig, options))
-		// } else {
-		// 	evm.interpreters = append(evm.interpreters, NewEWASMInterpreter(evm, vmConfig))
-		// }
-		panic("No supported ewasm interpreter yet.")
-	}
-
-	// vmConfig.EVMInterpreter will be used by EVM-C, it won't be checked here
-	// as we always want to have the built-in EVM as the failover option.
+		if vmConfig.EWASMInterpreter == "" {
+			panic("No supported ewasm interpreter yet.")
+		}
+		if in, err := NewEVMC(evmc.CapabilityEWASM, vmConfig.EWASMInterpreter, evm); err != nil {
+			log.Error("Failed to load external ewasm interpreter", "config", vmConfig.EWASMInterpreter, "err", err)
+		} else {
+			evm.interpreters = append(evm.interpreters, in)
+		}
+	}
+	if vmConfig.EVMInterpreter != "" {
+		// Configurations are validated upfront, fall back to the built-in EVM if
+		// the external one still can't be loaded
+		if in, err := NewEVMC(evmc.CapabilityEVM1, vmConfig.EVMInterpreter, evm); err != nil {
+			log.Error("Failed to load external EVM", "config", vmConfig.EVMInterpreter, "err", err)
+		} else {
+			evm.interpreters = append(evm.interpreters, in)
+		}
+	}
+	// The built-in EVM is always added as the failover option.
 	evm.interpreters = append(evm.interpreters, NewEVMInterpreter(evm, vmConfig))
 	evm.interpreter = evm.interpreters[0]
 
 	return evm
 }
 
+// ActivePrecompiles returns the precompiled contracts active in the current
+// block. The returned set must not be modified.
+func (evm *EVM) ActivePrecompiles() map[common.Address]PrecompiledContract {
+	return evm.precompiles
+}
+
 // Cancel cancels any running EVM operation. This may be called concurrently and
 // it's safe to be called multiple times.
 func (evm *EVM) Cancel() {
@@ -205,14 +223,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		snapshot = evm.StateDB.Snapshot()
 	)
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsHomestead
-		if evm.chainRules.IsByzantium {
-			precompiles = PrecompiledContractsByzantium
-		}
-		if evm.chainRules.IsIstanbul {
-			precompiles = PrecompiledContractsIstanbul
-		}
-		if precompiles[addr] == nil && evm.chainRules.IsEIP158 && value.Sign() == 0 {
+		if evm.precompiles[addr] == nil && evm.chainRules.IsEIP158 && value.Sign() == 0 {
 			// Calling a non existing account, don't do anything, but ping the tracer
 			if evm.vmConfig.Debug && evm.depth == 0 {
 				evm.vmConfig.Tracer.CaptureStart(caller.Address(), addr, false, input, gas, value)
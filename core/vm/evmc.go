@@ -0,0 +1,362 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// EVMC represents the reference to a common EVMC-based VM instance and
+// the current execution context as required by go-ethereum design.
+type EVMC struct {
+	instance evmc.VM         // The reference to the EVMC VM instance.
+	env      *EVM            // The execution context.
+	cap      evmc.Capability // The supported EVMC capability (EVM or Ewasm)
+	readOnly bool            // Whether state modifications are forbidden
+}
+
+var (
+	evmcModules = make(map[string]evmc.VM) // Loaded VM instances, keyed by configuration
+	evmcLock    sync.Mutex
+)
+
+// LoadEVMC loads and configures the external virtual machine described by the
+// config string, which is the path or registered name of the virtual machine,
+// optionally followed by comma separated options in the form name=value. Every
+// configuration is only loaded once, subsequent calls return the same instance.
+func LoadEVMC(config string, capability evmc.Capability) (evmc.VM, error) {
+	evmcLock.Lock()
+	defer evmcLock.Unlock()
+
+	if instance, ok := evmcModules[config]; ok {
+		if !instance.HasCapability(capability) {
+			return nil, fmt.Errorf("EVMC module %s does not have requested capability %d", instance.Name(), capability)
+		}
+		return instance, nil
+	}
+	options := strings.Split(config, ",")
+	path, options := options[0], options[1:]
+	if path == "" {
+		return nil, fmt.Errorf("EVMC module path missing in %q", config)
+	}
+	instance, err := evmc.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("EVMC loading error: %v", err)
+	}
+	for _, option := range options {
+		kv := strings.SplitN(option, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("EVMC option %q invalid, expected name=value", option)
+		}
+		if err := instance.SetOption(kv[0], kv[1]); err != nil {
+			return nil, fmt.Errorf("EVMC option %q error: %v", option, err)
+		}
+	}
+	if !instance.HasCapability(capability) {
+		return nil, fmt.Errorf("EVMC module %s does not have requested capability %d", instance.Name(), capability)
+	}
+	evmcModules[config] = instance
+	return instance, nil
+}
+
+// NewEVMC creates a new interpreter running contracts on the external virtual
+// machine described by the config string.
+func NewEVMC(cap evmc.Capability, config string, env *EVM) (*EVMC, error) {
+	instance, err := LoadEVMC(config, cap)
+	if err != nil {
+		return nil, err
+	}
+	return &EVMC{instance, env, cap, false}, nil
+}
+
+// hostContext implements evmc.Host interface.
+type hostContext struct {
+	env      *EVM      // The reference to the EVM execution context.
+	contract *Contract // The reference to the current contract, needed by Call-like methods.
+}
+
+func (host *hostContext) AccountExists(addr common.Address) bool {
+	if host.env.ChainConfig().IsEIP158(host.env.BlockNumber) {
+		if !host.env.StateDB.Empty(addr) {
+			return true
+		}
+	} else if host.env.StateDB.Exist(addr) {
+		return true
+	}
+	return false
+}
+
+func (host *hostContext) GetStorage(addr common.Address, key common.Hash) common.Hash {
+	return host.env.StateDB.GetState(addr, key)
+}
+
+func (host *hostContext) SetStorage(addr common.Address, key common.Hash, value common.Hash) (status evmc.StorageStatus) {
+	current := host.env.StateDB.GetState(addr, key)
+	if current == value {
+		return evmc.StorageUnchanged
+	}
+	original := host.env.StateDB.GetCommittedState(addr, key)
+	host.env.StateDB.SetState(addr, key, value)
+
+	// Legacy rules (Frontier -> Byzantium and Petersburg) only refund clearing slots
+	rules := host.env.chainRules
+	if !(rules.IsConstantinople && !rules.IsPetersburg) && !rules.IsIstanbul {
+		switch {
+		case current == (common.Hash{}):
+			return evmc.StorageAdded
+		case value == (common.Hash{}):
+			host.env.StateDB.AddRefund(params.SstoreRefundGas)
+			return evmc.StorageDeleted
+		default:
+			return evmc.StorageModified
+		}
+	}
+	// Net gas metering rules of EIP-1283 (Constantinople) and EIP-2200 (Istanbul)
+	clearRefund, resetClearRefund, resetRefund := params.NetSstoreClearRefund, params.NetSstoreResetClearRefund, params.NetSstoreResetRefund
+	if rules.IsIstanbul {
+		clearRefund, resetClearRefund, resetRefund = params.SstoreClearRefundEIP2200, params.SstoreInitRefundEIP2200, params.SstoreCleanRefundEIP2200
+	}
+	if original == current {
+		if original == (common.Hash{}) { // create slot (2.1.1)
+			return evmc.StorageAdded
+		}
+		if value == (common.Hash{}) { // delete slot (2.1.2b)
+			host.env.StateDB.AddRefund(clearRefund)
+			return evmc.StorageDeleted
+		}
+		return evmc.StorageModified
+	}
+	if original != (common.Hash{}) {
+		if current == (common.Hash{}) { // recreate slot (2.2.1.1)
+			host.env.StateDB.SubRefund(clearRefund)
+		} else if value == (common.Hash{}) { // delete slot (2.2.1.2)
+			host.env.StateDB.AddRefund(clearRefund)
+		}
+	}
+	if original == value {
+		if original == (common.Hash{}) { // reset to original inexistent slot (2.2.2.1)
+			host.env.StateDB.AddRefund(resetClearRefund)
+		} else { // reset to original existing slot (2.2.2.2)
+			host.env.StateDB.AddRefund(resetRefund)
+		}
+	}
+	return evmc.StorageModifiedAgain
+}
+
+func (host *hostContext) GetBalance(addr common.Address) common.Hash {
+	return common.BigToHash(host.env.StateDB.GetBalance(addr))
+}
+
+func (host *hostContext) GetCodeSize(addr common.Address) int {
+	return host.env.StateDB.GetCodeSize(addr)
+}
+
+func (host *hostContext) GetCodeHash(addr common.Address) common.Hash {
+	if host.env.StateDB.Empty(addr) {
+		return common.Hash{}
+	}
+	return host.env.StateDB.GetCodeHash(addr)
+}
+
+func (host *hostContext) GetCode(addr common.Address) []byte {
+	return host.env.StateDB.GetCode(addr)
+}
+
+func (host *hostContext) Selfdestruct(addr common.Address, beneficiary common.Address) {
+	db := host.env.StateDB
+	if !db.HasSuicided(addr) {
+		db.AddRefund(params.SelfdestructRefundGas)
+	}
+	db.AddBalance(beneficiary, db.GetBalance(addr))
+	db.Suicide(addr)
+}
+
+func (host *hostContext) GetTxContext() evmc.TxContext {
+	return evmc.TxContext{
+		GasPrice:   bigToHash(host.env.GasPrice),
+		Origin:     host.env.Origin,
+		Coinbase:   host.env.Coinbase,
+		Number:     host.env.BlockNumber.Int64(),
+		Timestamp:  host.env.Time.Int64(),
+		GasLimit:   int64(host.env.GasLimit),
+		Difficulty: bigToHash(host.env.Difficulty),
+		ChainID:    bigToHash(host.env.ChainConfig().ChainID),
+	}
+}
+
+func (host *hostContext) GetBlockHash(number int64) common.Hash {
+	b := host.env.BlockNumber.Int64()
+	if number >= (b-256) && number < b {
+		return host.env.GetHash(uint64(number))
+	}
+	return common.Hash{}
+}
+
+func (host *hostContext) EmitLog(addr common.Address, topics []common.Hash, data []byte) {
+	host.env.StateDB.AddLog(&types.Log{
+		Address:     addr,
+		Topics:      topics,
+		Data:        data,
+		BlockNumber: host.env.BlockNumber.Uint64(),
+	})
+}
+
+func (host *hostContext) Call(msg *evmc.Message) (output []byte, gasLeft int64, createAddr common.Address, err error) {
+	var (
+		gas   = uint64(msg.Gas)
+		value = msg.Value.Big()
+		left  uint64
+	)
+	switch msg.Kind {
+	case evmc.Call:
+		if msg.Static {
+			output, left, err = host.env.StaticCall(host.contract, msg.Recipient, msg.Input, gas)
+		} else {
+			output, left, err = host.env.Call(host.contract, msg.Recipient, msg.Input, gas, value)
+		}
+	case evmc.DelegateCall:
+		output, left, err = host.env.DelegateCall(host.contract, msg.Recipient, msg.Input, gas)
+	case evmc.CallCode:
+		output, left, err = host.env.CallCode(host.contract, msg.Recipient, msg.Input, gas, value)
+	case evmc.Create:
+		var ret []byte
+		ret, createAddr, left, err = host.env.Create(host.contract, msg.Input, gas, value)
+		if !host.env.chainRules.IsHomestead && err == ErrCodeStoreOutOfGas {
+			err = nil
+		}
+		if err == errExecutionReverted {
+			// Only the revert reason is returned to the caller, not the code
+			output = ret
+		}
+	case evmc.Create2:
+		var ret []byte
+		ret, createAddr, left, err = host.env.Create2(host.contract, msg.Input, gas, value, msg.Create2Salt.Big())
+		if err == errExecutionReverted {
+			output = ret
+		}
+	default:
+		log.Error("EVMC VM requested unknown call kind", "kind", msg.Kind)
+		return nil, 0, common.Address{}, evmc.ErrFailure
+	}
+	// Map the errors onto the two outcomes known by EVMC
+	if err == errExecutionReverted {
+		err = evmc.ErrRevert
+	} else if err != nil {
+		err = evmc.ErrFailure
+	}
+	return output, int64(left), createAddr, err
+}
+
+// bigToHash converts an optional big integer into a hash, treating nil as zero.
+func bigToHash(n *big.Int) common.Hash {
+	if n == nil {
+		return common.Hash{}
+	}
+	return common.BigToHash(n)
+}
+
+// getRevision translates the chain rules into the EVMC revision.
+func getRevision(env *EVM) evmc.Revision {
+	rules := env.chainRules
+	switch {
+	case rules.IsIstanbul:
+		return evmc.Istanbul
+	case rules.IsPetersburg:
+		return evmc.Petersburg
+	case rules.IsConstantinople:
+		return evmc.Constantinople
+	case rules.IsByzantium:
+		return evmc.Byzantium
+	case rules.IsEIP158:
+		return evmc.SpuriousDragon
+	case rules.IsEIP150:
+		return evmc.TangerineWhistle
+	case rules.IsHomestead:
+		return evmc.Homestead
+	default:
+		return evmc.Frontier
+	}
+}
+
+// Run implements Interpreter.Run(), executing the contract on the external
+// virtual machine.
+func (evm *EVMC) Run(contract *Contract, input []byte, readOnly bool) (ret []byte, err error) {
+	evm.env.depth++
+	defer func() { evm.env.depth-- }()
+
+	// Don't bother with the execution if there's no code.
+	if len(contract.Code) == 0 {
+		return nil, nil
+	}
+	// Guess whether this is a contract creation, as the code of new contracts is
+	// only deployed after the execution of their init code.
+	kind := evmc.Call
+	if evm.env.StateDB.GetCodeSize(contract.Address()) == 0 {
+		kind = evmc.Create
+	}
+	// Make sure the readOnly is only set if we aren't in readOnly yet.
+	// This makes also sure that the readOnly flag isn't removed for child calls.
+	if readOnly && !evm.readOnly {
+		evm.readOnly = true
+		defer func() { evm.readOnly = false }()
+	}
+	msg := &evmc.Message{
+		Kind:      kind,
+		Static:    evm.readOnly,
+		Depth:     evm.env.depth - 1,
+		Gas:       int64(contract.Gas),
+		Recipient: contract.Address(),
+		Sender:    contract.Caller(),
+		Input:     input,
+		Value:     bigToHash(contract.value),
+	}
+	output, gasLeft, err := evm.instance.Execute(&hostContext{evm.env, contract}, getRevision(evm.env), msg, contract.Code)
+
+	contract.Gas = uint64(gasLeft)
+
+	switch err {
+	case nil, evmc.ErrFailure:
+	case evmc.ErrRevert:
+		err = errExecutionReverted
+	default:
+		// Internal errors of the VM fail the execution, consuming all its gas
+		log.Error("EVMC VM internal error", "vm", evm.instance.Name(), "err", err)
+		err = fmt.Errorf("EVMC VM internal error: %v", err)
+	}
+	return output, err
+}
+
+// CanRun implements Interpreter.CanRun(), accepting the code if it's of the
+// kind handled by the external virtual machine.
+func (evm *EVMC) CanRun(code []byte) bool {
+	required := evmc.CapabilityEVM1
+	wasmPreamble := []byte("\x00asm")
+	if bytes.HasPrefix(code, wasmPreamble) {
+		required = evmc.CapabilityEWASM
+	}
+	return evm.cap == required
+}
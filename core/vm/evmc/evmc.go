@@ -0,0 +1,216 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package evmc defines the interface between go-ethereum and external virtual
+// machines, modeled after the EVMC API (https://github.com/ethereum/evmc).
+//
+// A virtual machine is handed a Host when executing code, through which it can
+// access the state and environment of the chain, and spawn nested calls. Virtual
+// machines are either linked into the binary and registered by name, or loaded
+// from Go plugins exporting a constructor named PluginSymbol. Loading plugins
+// requires cgo and is only supported in binaries built with the evmc build tag.
+package evmc
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Capability is a kind of code a virtual machine is able to execute.
+type Capability uint32
+
+const (
+	CapabilityEVM1  Capability = 0 // Ethereum Virtual Machine bytecode
+	CapabilityEWASM Capability = 1 // Ethereum flavored WebAssembly
+)
+
+// Revision is the Ethereum specification revision to execute code under.
+type Revision int32
+
+const (
+	Frontier Revision = iota
+	Homestead
+	TangerineWhistle
+	SpuriousDragon
+	Byzantium
+	Constantinople
+	Petersburg
+	Istanbul
+)
+
+// CallKind is the type of a call message.
+type CallKind int32
+
+const (
+	Call CallKind = iota
+	DelegateCall
+	CallCode
+	Create
+	Create2
+)
+
+// StorageStatus is the effect of a storage update, based on which the virtual
+// machine charges gas.
+type StorageStatus int32
+
+const (
+	StorageUnchanged     StorageStatus = iota // The value of the slot was not changed
+	StorageModified                           // The value of a clean slot was changed
+	StorageModifiedAgain                      // The value of a dirty slot was changed
+	StorageAdded                              // A clean empty slot was set to a non-zero value
+	StorageDeleted                            // A clean non-empty slot was cleared
+)
+
+var (
+	// ErrFailure is returned if the execution failed, consuming all its gas.
+	ErrFailure = errors.New("evmc: failure")
+
+	// ErrRevert is returned if the execution was reverted, returning the gas
+	// left and its output to the caller.
+	ErrRevert = errors.New("evmc: revert")
+)
+
+// Message is a call or contract creation to execute.
+type Message struct {
+	Kind        CallKind       // Type of the call
+	Static      bool           // Whether state modifications are forbidden
+	Depth       int            // Depth of the call, starting from zero
+	Gas         int64          // Gas available for the execution
+	Recipient   common.Address // Account the code is executed on behalf of
+	Sender      common.Address // Account sending the message
+	Input       []byte         // Call data of the message
+	Value       common.Hash    // Value transferred with the message
+	Create2Salt common.Hash    // Salt of CREATE2 contract creations
+}
+
+// TxContext is the transaction and block environment of an execution.
+type TxContext struct {
+	GasPrice   common.Hash
+	Origin     common.Address
+	Coinbase   common.Address
+	Number     int64
+	Timestamp  int64
+	GasLimit   int64
+	Difficulty common.Hash
+	ChainID    common.Hash
+}
+
+// Host is the interface through which virtual machines access the chain.
+type Host interface {
+	// AccountExists reports whether the given account exists in the state.
+	AccountExists(addr common.Address) bool
+
+	// GetStorage retrieves the value of a storage slot.
+	GetStorage(addr common.Address, key common.Hash) common.Hash
+
+	// SetStorage updates a storage slot, applying any gas refunds and reporting
+	// how the slot changed.
+	SetStorage(addr common.Address, key common.Hash, value common.Hash) StorageStatus
+
+	// GetBalance retrieves the balance of an account.
+	GetBalance(addr common.Address) common.Hash
+
+	// GetCodeSize retrieves the size of the code of an account.
+	GetCodeSize(addr common.Address) int
+
+	// GetCodeHash retrieves the hash of the code of an account, or the zero hash
+	// if the account doesn't exist.
+	GetCodeHash(addr common.Address) common.Hash
+
+	// GetCode retrieves the code of an account.
+	GetCode(addr common.Address) []byte
+
+	// Selfdestruct destroys an account, transferring its balance to the beneficiary.
+	Selfdestruct(addr common.Address, beneficiary common.Address)
+
+	// GetTxContext retrieves the environment of the execution.
+	GetTxContext() TxContext
+
+	// GetBlockHash retrieves the hash of one of the 256 most recent blocks, or
+	// the zero hash if the block is not available.
+	GetBlockHash(number int64) common.Hash
+
+	// EmitLog records a log entry of the execution.
+	EmitLog(addr common.Address, topics []common.Hash, data []byte)
+
+	// Call executes a nested message, returning its output, the gas left and the
+	// address of the created contract in case of contract creations.
+	Call(msg *Message) (output []byte, gasLeft int64, createAddr common.Address, err error)
+}
+
+// VM is an external virtual machine implementation.
+type VM interface {
+	// Name returns the name of the virtual machine.
+	Name() string
+
+	// Version returns the version of the virtual machine.
+	Version() string
+
+	// HasCapability reports whether the virtual machine can execute the given
+	// kind of code.
+	HasCapability(capability Capability) bool
+
+	// SetOption configures an implementation specific option.
+	SetOption(name string, value string) error
+
+	// Execute runs the code of a message under the given revision, returning its
+	// output and the gas left. Failures are reported as ErrFailure and reverts
+	// as ErrRevert, any other error is considered an internal error of the VM.
+	Execute(host Host, rev Revision, msg *Message, code []byte) (output []byte, gasLeft int64, err error)
+}
+
+// Constructor creates a new instance of a virtual machine.
+type Constructor func() (VM, error)
+
+// PluginSymbol is the name of the Constructor Go plugins need to export to be
+// loadable as virtual machines.
+const PluginSymbol = "NewVM"
+
+var (
+	registry     = make(map[string]Constructor)
+	registryLock sync.RWMutex
+)
+
+// Register makes a virtual machine linked into the binary loadable by name. It
+// panics if a virtual machine with the same name is already registered.
+func Register(name string, create Constructor) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("evmc: virtual machine %q registered twice", name))
+	}
+	registry[name] = create
+}
+
+// Load creates a new instance of the virtual machine registered with the given
+// name, or if there is none, loads the Go plugin at the given path.
+func Load(path string) (VM, error) {
+	registryLock.RLock()
+	create, ok := registry[path]
+	registryLock.RUnlock()
+
+	if !ok {
+		var err error
+		if create, err = loadPlugin(path); err != nil {
+			return nil, err
+		}
+	}
+	return create()
+}
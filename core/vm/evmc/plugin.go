@@ -0,0 +1,46 @@
+//go:build evmc
+// +build evmc
+
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package evmc
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// loadPlugin opens the Go plugin at the given path and looks up the constructor
+// of its virtual machine.
+func loadPlugin(path string) (Constructor, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	switch fn := sym.(type) {
+	case func() (VM, error):
+		return fn, nil
+	case *Constructor:
+		return *fn, nil
+	default:
+		return nil, fmt.Errorf("evmc: invalid %s type %T in plugin %s", PluginSymbol, sym, path)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func init() {
+	evmc.Register("teststub", func() (evmc.VM, error) { return &stubVM{opGas: 3}, nil })
+	evmc.Register("testbroken", func() (evmc.VM, error) { return &brokenVM{stubVM{opGas: 3}}, nil })
+}
+
+// brokenVM is an external virtual machine failing every execution with an
+// internal error.
+type brokenVM struct {
+	stubVM
+}
+
+func (vm *brokenVM) Execute(host evmc.Host, rev evmc.Revision, msg *evmc.Message, code []byte) ([]byte, int64, error) {
+	return nil, msg.Gas, errors.New("internal error")
+}
+
+// stubVM is a pure Go stand-in for an external virtual machine, interpreting a
+// small subset of the EVM instruction set solely through the EVMC host interface.
+type stubVM struct {
+	opGas uint64 // Flat gas charged per instruction
+	execs uint64 // Number of executions, accessed atomically
+}
+
+func (vm *stubVM) Name() string    { return "teststub" }
+func (vm *stubVM) Version() string { return "1.0.0" }
+
+func (vm *stubVM) HasCapability(capability evmc.Capability) bool {
+	return capability == evmc.CapabilityEVM1
+}
+
+func (vm *stubVM) SetOption(name string, value string) error {
+	if name != "opgas" {
+		return fmt.Errorf("unknown option %q", name)
+	}
+	gas, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	vm.opGas = gas
+	return nil
+}
+
+func (vm *stubVM) Execute(host evmc.Host, rev evmc.Revision, msg *evmc.Message, code []byte) ([]byte, int64, error) {
+	atomic.AddUint64(&vm.execs, 1)
+
+	var (
+		gas   = msg.Gas
+		stack []*big.Int
+		mem   []byte
+	)
+	pop := func() *big.Int {
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v
+	}
+	memory := func(offset, size *big.Int) []byte {
+		if end := int(offset.Int64() + size.Int64()); end > len(mem) {
+			mem = append(mem, make([]byte, end-len(mem))...)
+		}
+		return mem[offset.Int64() : offset.Int64()+size.Int64()]
+	}
+	for pc := 0; pc < len(code); pc++ {
+		if gas -= int64(vm.opGas); gas < 0 {
+			return nil, 0, evmc.ErrFailure
+		}
+		op := OpCode(code[pc])
+		switch {
+		case op.IsPush():
+			size := int(op - PUSH1 + 1)
+			stack = append(stack, new(big.Int).SetBytes(code[pc+1:pc+1+size]))
+			pc += size
+		case op == STOP:
+			return nil, gas, nil
+		case op == ADD:
+			stack = append(stack, new(big.Int).Add(pop(), pop()))
+		case op == SLOAD:
+			val := host.GetStorage(msg.Recipient, common.BigToHash(pop()))
+			stack = append(stack, val.Big())
+		case op == SSTORE:
+			if msg.Static {
+				return nil, 0, evmc.ErrFailure
+			}
+			key, val := pop(), pop()
+			if host.SetStorage(msg.Recipient, common.BigToHash(key), common.BigToHash(val)) == evmc.StorageAdded {
+				gas -= int64(params.SstoreSetGas)
+			}
+		case op == MSTORE:
+			offset, val := pop(), pop()
+			copy(memory(offset, big.NewInt(32)), common.BigToHash(val).Bytes())
+		case op == LOG0:
+			offset, size := pop(), pop()
+			host.EmitLog(msg.Recipient, nil, common.CopyBytes(memory(offset, size)))
+		case op == CALL:
+			callGas, addr, value := pop(), pop(), pop()
+			inOffset, inSize, outOffset, outSize := pop(), pop(), pop(), pop()
+
+			out, left, _, err := host.Call(&evmc.Message{
+				Kind:      evmc.Call,
+				Static:    msg.Static,
+				Depth:     msg.Depth + 1,
+				Gas:       callGas.Int64(),
+				Recipient: common.BigToAddress(addr),
+				Sender:    msg.Recipient,
+				Input:     common.CopyBytes(memory(inOffset, inSize)),
+				Value:     common.BigToHash(value),
+			})
+			gas -= callGas.Int64() - left
+			copy(memory(outOffset, outSize), out)
+			if err != nil {
+				stack = append(stack, new(big.Int))
+			} else {
+				stack = append(stack, big.NewInt(1))
+			}
+		case op == RETURN:
+			offset, size := pop(), pop()
+			return common.CopyBytes(memory(offset, size)), gas, nil
+		case op == REVERT:
+			offset, size := pop(), pop()
+			return common.CopyBytes(memory(offset, size)), gas, evmc.ErrRevert
+		default:
+			return nil, 0, evmc.ErrFailure
+		}
+	}
+	return nil, gas, nil
+}
+
+// newEVMCTestEnv creates an Istanbul EVM running on the given external virtual
+// machine configuration, with the given contracts deployed.
+func newEVMCTestEnv(t testing.TB, config string, contracts map[common.Address][]byte) (*EVM, *state.StateDB) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	for addr, code := range contracts {
+		statedb.SetCode(addr, code)
+	}
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = state.New(root, statedb.Database())
+
+	ctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(0),
+		GasPrice:    big.NewInt(1),
+		Difficulty:  big.NewInt(1),
+	}
+	return NewEVM(ctx, statedb, params.AllEthashProtocolChanges, Config{EVMInterpreter: config}), statedb
+}
+
+var (
+	evmcCaller = AccountRef(common.HexToAddress("0xc0ffee"))
+	evmcTarget = common.HexToAddress("0x1000")
+	evmcCallee = common.HexToAddress("0x2000")
+)
+
+// Tests that the external virtual machine gets to execute contracts, and that its
+// storage updates end up in the state.
+func TestEVMCStorage(t *testing.T) {
+	code := []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0x01, byte(SSTORE), // sstore(1, 42)
+		byte(PUSH1), 0x01, byte(SLOAD), byte(PUSH1), 0x00, byte(MSTORE), // mstore(0, sload(1))
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN), // return(0, 32)
+	}
+	for _, config := range []string{"", "teststub"} {
+		env, statedb := newEVMCTestEnv(t, config, map[common.Address][]byte{evmcTarget: code})
+		var stub *stubVM
+		if config != "" {
+			in, ok := env.Interpreter().(*EVMC)
+			if !ok {
+				t.Fatalf("%q: interpreter mismatch: have %T, want *EVMC", config, env.Interpreter())
+			}
+			stub = in.instance.(*stubVM)
+		}
+		var execs uint64
+		if stub != nil {
+			execs = atomic.LoadUint64(&stub.execs)
+		}
+		ret, _, err := env.Call(evmcCaller, evmcTarget, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("%q: call failed: %v", config, err)
+		}
+		if stub != nil && atomic.LoadUint64(&stub.execs) != execs+1 {
+			t.Errorf("%q: contract not executed by external VM", config)
+		}
+		if want := common.BigToHash(big.NewInt(42)).Bytes(); !bytes.Equal(ret, want) {
+			t.Errorf("%q: output mismatch: have %x, want %x", config, ret, want)
+		}
+		if have := statedb.GetState(evmcTarget, common.BigToHash(big.NewInt(1))); have.Big().Uint64() != 42 {
+			t.Errorf("%q: storage mismatch: have %x, want 42", config, have)
+		}
+	}
+}
+
+// Tests that storage updates done by the external virtual machine are refunded
+// according to the net gas metering rules.
+func TestEVMCStorageRefunds(t *testing.T) {
+	env, statedb := newEVMCTestEnv(t, "teststub", nil)
+	host := &hostContext{env: env}
+
+	// Seed a committed slot and make sure it's considered original state
+	key := common.HexToHash("0x01")
+	statedb.SetNonce(evmcTarget, 1)
+	statedb.SetState(evmcTarget, key, common.HexToHash("0x01"))
+	root, _ := statedb.Commit(true)
+	statedb, _ = state.New(root, statedb.Database())
+	env.StateDB = statedb
+
+	tests := []struct {
+		value  common.Hash
+		status evmc.StorageStatus
+		refund uint64
+	}{
+		{common.HexToHash("0x01"), evmc.StorageUnchanged, 0},
+		{common.Hash{}, evmc.StorageDeleted, params.SstoreClearRefundEIP2200},
+		{common.HexToHash("0x02"), evmc.StorageModifiedAgain, 0},
+		{common.HexToHash("0x01"), evmc.StorageModifiedAgain, params.SstoreCleanRefundEIP2200},
+	}
+	for i, tt := range tests {
+		if status := host.SetStorage(evmcTarget, key, tt.value); status != tt.status {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, status, tt.status)
+		}
+		if refund := statedb.GetRefund(); refund != tt.refund {
+			t.Errorf("test %d: refund mismatch: have %d, want %d", i, refund, tt.refund)
+		}
+	}
+}
+
+// Tests that nested calls issued by the external virtual machine are executed by
+// the EVM, with reverts reported back to the caller.
+func TestEVMCNestedCall(t *testing.T) {
+	caller := []byte{
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(PUSH1), 0x00, // out: 0..32, in: empty
+		byte(PUSH1), 0x00, byte(PUSH2), 0x20, 0x00, byte(PUSH2), 0xff, 0xff, // value 0, callee, gas
+		byte(CALL),
+		byte(PUSH1), 0x01, byte(SSTORE), // sstore(1, success)
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN), // return(0, 32)
+	}
+	callee := []byte{
+		byte(PUSH1), 0x07, byte(PUSH1), 0x00, byte(MSTORE), // mstore(0, 7)
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(REVERT), // revert(0, 32)
+	}
+	env, statedb := newEVMCTestEnv(t, "teststub", map[common.Address][]byte{evmcTarget: caller, evmcCallee: callee})
+
+	ret, _, err := env.Call(evmcCaller, evmcTarget, nil, 100000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if want := common.BigToHash(big.NewInt(7)).Bytes(); !bytes.Equal(ret, want) {
+		t.Errorf("revert reason mismatch: have %x, want %x", ret, want)
+	}
+	if have := statedb.GetState(evmcTarget, common.BigToHash(big.NewInt(1))); have != (common.Hash{}) {
+		t.Errorf("reverted call reported as success: %x", have)
+	}
+	// Calling the reverting contract directly should surface the revert
+	ret, gas, err := env.Call(evmcCaller, evmcCallee, nil, 100000, new(big.Int))
+	if err != errExecutionReverted {
+		t.Fatalf("error mismatch: have %v, want %v", err, errExecutionReverted)
+	}
+	if gas == 0 {
+		t.Errorf("reverted call consumed all gas")
+	}
+	if want := common.BigToHash(big.NewInt(7)).Bytes(); !bytes.Equal(ret, want) {
+		t.Errorf("revert reason mismatch: have %x, want %x", ret, want)
+	}
+}
+
+// Tests that internal errors of the external virtual machine fail the execution,
+// consuming all its gas, instead of crashing the node.
+func TestEVMCInternalError(t *testing.T) {
+	code := []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0x01, byte(SSTORE)}
+	env, statedb := newEVMCTestEnv(t, "testbroken", map[common.Address][]byte{evmcTarget: code})
+
+	_, gas, err := env.Call(evmcCaller, evmcTarget, nil, 100000, new(big.Int))
+	if err == nil {
+		t.Fatalf("internal error not reported")
+	}
+	if gas != 0 {
+		t.Errorf("failed call returned gas: %d", gas)
+	}
+	if have := statedb.GetState(evmcTarget, common.BigToHash(big.NewInt(1))); have != (common.Hash{}) {
+		t.Errorf("failed call modified storage: %x", have)
+	}
+}
+
+// Tests that external virtual machine configurations are validated on load.
+func TestLoadEVMC(t *testing.T) {
+	tests := []struct {
+		config string
+		cap    evmc.Capability
+		fail   bool
+	}{
+		{"teststub", evmc.CapabilityEVM1, false},
+		{"teststub,opgas=2", evmc.CapabilityEVM1, false},
+		{"teststub,opgas=two", evmc.CapabilityEVM1, true},
+		{"teststub,opgas", evmc.CapabilityEVM1, true},
+		{"teststub,unknown=1", evmc.CapabilityEVM1, true},
+		{"teststub", evmc.CapabilityEWASM, true},
+		{",opgas=2", evmc.CapabilityEVM1, true},
+		{"/nonexistent/evmc.so", evmc.CapabilityEVM1, true},
+	}
+	for i, tt := range tests {
+		_, err := LoadEVMC(tt.config, tt.cap)
+		if tt.fail && err == nil {
+			t.Errorf("test %d: expected failure for %q", i, tt.config)
+		}
+		if !tt.fail && err != nil {
+			t.Errorf("test %d: unexpected failure for %q: %v", i, tt.config, err)
+		}
+	}
+	if vm, _ := LoadEVMC("teststub,opgas=2", evmc.CapabilityEVM1); vm.(*stubVM).opGas != 2 {
+		t.Errorf("option not applied: opgas %d", vm.(*stubVM).opGas)
+	}
+}
+
+func BenchmarkEVMCStorage(b *testing.B) {
+	code := []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0x01, byte(SSTORE),
+		byte(PUSH1), 0x01, byte(SLOAD), byte(PUSH1), 0x00, byte(MSTORE),
+		byte(PUSH1), 0x20, byte(PUSH1), 0x00, byte(RETURN),
+	}
+	for _, config := range []string{"", "teststub"} {
+		name := config
+		if name == "" {
+			name = "builtin"
+		}
+		b.Run(name, func(b *testing.B) {
+			env, _ := newEVMCTestEnv(b, config, map[common.Address][]byte{evmcTarget: code})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				env.Call(evmcCaller, evmcTarget, nil, 100000, new(big.Int))
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ProfileStat is the aggregated cost of a group of executed instructions.
+//
+// Gas and time are exclusive: the gas and time spent in the nested calls of a
+// CALL-like or CREATE-like instruction are attributed to the instructions of the
+// callee, not to the instruction initiating the call.
+type ProfileStat struct {
+	Count uint64        `json:"count"` // Number of instructions executed
+	Gas   uint64        `json:"gas"`   // Gas consumed by the instructions
+	Time  time.Duration `json:"time"`  // Wall time spent executing, in nanoseconds
+}
+
+// add accounts a single executed instruction into the stat.
+func (s *ProfileStat) add(gas uint64, elapsed time.Duration) {
+	s.Count++
+	s.Gas += gas
+	s.Time += elapsed
+}
+
+// Profile is the aggregated gas and time profile of an execution.
+type Profile struct {
+	GasUsed   uint64                          `json:"gasUsed"`   // Gas used by the entire execution
+	Time      time.Duration                   `json:"time"`      // Wall time of the entire execution, in nanoseconds
+	Opcodes   map[string]*ProfileStat         `json:"opcodes"`   // Instructions aggregated by opcode
+	Contracts map[common.Address]*ProfileStat `json:"contracts"` // Instructions aggregated by executing account
+	Depths    map[int]*ProfileStat            `json:"depths"`    // Instructions aggregated by call depth
+}
+
+// profileStep is an executed instruction whose cost is not yet known, as that
+// depends on the gas left when the next instruction of the same frame starts.
+type profileStep struct {
+	op    OpCode
+	gas   uint64    // Gas available before the instruction
+	cost  uint64    // Gas charged upfront for the instruction
+	start time.Time // Time the instruction started executing
+	burn  bool      // Whether the instruction failed, consuming all gas
+
+	childGas  uint64        // Gas used by nested calls of the instruction
+	childTime time.Duration // Time spent in nested calls of the instruction
+}
+
+// profileFrame is a call frame being executed.
+type profileFrame struct {
+	depth   int
+	addr    common.Address
+	path    string    // Key of the call stack leading to the frame
+	start   time.Time // Time the first instruction of the frame started
+	gasUsed uint64    // Gas used by the finished instructions of the frame
+	pending *profileStep
+}
+
+// profileSample is the cost of an opcode executed in a particular call stack,
+// used to assemble pprof profiles.
+type profileSample struct {
+	stack []common.Address // Executing accounts, innermost first
+	op    OpCode
+	stat  ProfileStat
+}
+
+// Profiler is an EVM tracer aggregating the gas usage, execution count and wall
+// time of the executed instructions by opcode, by executing account and by call
+// depth. It implements Tracer.
+//
+// A Profiler can be used for multiple consecutive executions, in which case the
+// profile covers all of them.
+type Profiler struct {
+	frames []*profileFrame // Call frames being executed, outermost first
+
+	profile Profile
+	samples map[string]*profileSample
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Reason for the interruption
+}
+
+// NewProfiler creates a new profiling tracer.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		profile: Profile{
+			Opcodes:   make(map[string]*ProfileStat),
+			Contracts: make(map[common.Address]*ProfileStat),
+			Depths:    make(map[int]*ProfileStat),
+		},
+		samples: make(map[string]*profileSample),
+	}
+}
+
+// CaptureStart implements the Tracer interface to initialize the tracing operation.
+func (p *Profiler) CaptureStart(from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	return nil
+}
+
+// CaptureState implements the Tracer interface, settling the cost of the previous
+// instruction of the frame and starting to account the current one.
+func (p *Profiler) CaptureState(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if atomic.LoadUint32(&p.interrupt) > 0 {
+		env.Cancel()
+		return nil
+	}
+	now := time.Now()
+
+	// Finish any frames returned from and settle the previous instruction
+	p.unwind(depth, now)
+
+	var frame *profileFrame
+	if n := len(p.frames); n > 0 && p.frames[n-1].depth == depth {
+		frame = p.frames[n-1]
+		if frame.pending != nil {
+			p.settle(frame, frame.pending.gas-gas, now)
+		}
+	} else {
+		frame = &profileFrame{depth: depth, addr: contract.Address(), start: now}
+		if n > 0 {
+			frame.path = p.frames[n-1].path
+		}
+		frame.path += string(frame.addr[:])
+		p.frames = append(p.frames, frame)
+	}
+	frame.pending = &profileStep{op: op, gas: gas, cost: cost, start: now}
+
+	// Instructions failing before execution consume all the gas of the frame
+	if err != nil {
+		frame.pending.burn = true
+		p.settle(frame, gas, now)
+	}
+	return nil
+}
+
+// CaptureFault implements the Tracer interface, marking the current instruction
+// as having consumed all the gas of its frame, unless it merely reverted.
+func (p *Profiler) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost uint64, memory *Memory, stack *Stack, contract *Contract, depth int, err error) error {
+	if err == errExecutionReverted {
+		return nil
+	}
+	if n := len(p.frames); n > 0 && p.frames[n-1].depth == depth && p.frames[n-1].pending != nil {
+		p.frames[n-1].pending.burn = true
+	}
+	return nil
+}
+
+// CaptureEnd implements the Tracer interface, settling all instructions still
+// pending when the execution terminates.
+func (p *Profiler) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
+	p.unwind(0, time.Now())
+
+	p.profile.GasUsed += gasUsed
+	p.profile.Time += t
+	return nil
+}
+
+// unwind terminates all the frames deeper than the given depth, attributing their
+// gas usage and time to the instruction that called into them.
+func (p *Profiler) unwind(depth int, now time.Time) {
+	for len(p.frames) > 0 && p.frames[len(p.frames)-1].depth > depth {
+		frame := p.frames[len(p.frames)-1]
+		if step := frame.pending; step != nil {
+			// The last instruction of a frame only used its upfront cost, unless it
+			// failed and consumed everything.
+			used := step.cost
+			if step.burn {
+				used = step.gas
+			}
+			p.settle(frame, used, now)
+		}
+		p.frames = p.frames[:len(p.frames)-1]
+
+		if n := len(p.frames); n > 0 && p.frames[n-1].pending != nil {
+			caller := p.frames[n-1].pending
+			caller.childGas += frame.gasUsed
+			caller.childTime += now.Sub(frame.start)
+		}
+	}
+}
+
+// settle accounts the pending instruction of a frame, given the total gas it used
+// including its nested calls.
+func (p *Profiler) settle(frame *profileFrame, used uint64, now time.Time) {
+	step := frame.pending
+	frame.pending = nil
+	frame.gasUsed += used
+
+	gas := uint64(0)
+	if used > step.childGas {
+		gas = used - step.childGas
+	}
+	elapsed := now.Sub(step.start) - step.childTime
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	opname := step.op.String()
+	if p.profile.Opcodes[opname] == nil {
+		p.profile.Opcodes[opname] = new(ProfileStat)
+	}
+	p.profile.Opcodes[opname].add(gas, elapsed)
+
+	if p.profile.Contracts[frame.addr] == nil {
+		p.profile.Contracts[frame.addr] = new(ProfileStat)
+	}
+	p.profile.Contracts[frame.addr].add(gas, elapsed)
+
+	if p.profile.Depths[frame.depth] == nil {
+		p.profile.Depths[frame.depth] = new(ProfileStat)
+	}
+	p.profile.Depths[frame.depth].add(gas, elapsed)
+
+	key := frame.path + string(step.op)
+	sample := p.samples[key]
+	if sample == nil {
+		sample = &profileSample{op: step.op}
+		for i := len(p.frames) - 1; i >= 0; i-- {
+			sample.stack = append(sample.stack, p.frames[i].addr)
+		}
+		p.samples[key] = sample
+	}
+	sample.stat.add(gas, elapsed)
+}
+
+// Stop aborts the profiled execution at the next instruction. The given error
+// is reported by Err afterwards.
+func (p *Profiler) Stop(err error) {
+	p.reason = err
+	atomic.StoreUint32(&p.interrupt, 1)
+}
+
+// Err returns the reason the profiler was stopped, or nil if it wasn't.
+func (p *Profiler) Err() error {
+	if atomic.LoadUint32(&p.interrupt) == 0 {
+		return nil
+	}
+	return p.reason
+}
+
+// Profile returns the profile aggregated so far.
+func (p *Profiler) Profile() *Profile {
+	return &p.profile
+}
+
+// sortedSamples returns the samples aggregated so far in a stable order.
+func (p *Profiler) sortedSamples() []*profileSample {
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]*profileSample, len(keys))
+	for i, key := range keys {
+		samples[i] = p.samples[key]
+	}
+	return samples
+}
+
+// WriteProfile writes a formatted profile to the given writer, listing the most
+// expensive opcodes, contracts and call depths first.
+func WriteProfile(writer io.Writer, profile *Profile) {
+	fmt.Fprintf(writer, "gas=%d time=%v\n", profile.GasUsed, profile.Time)
+
+	type row struct {
+		name string
+		stat *ProfileStat
+	}
+	section := func(title string, rows []row) {
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].stat.Gas > rows[j].stat.Gas })
+
+		fmt.Fprintf(writer, "\n%-42s %12s %14s %14s\n", title, "count", "gas", "time")
+		for _, r := range rows {
+			fmt.Fprintf(writer, "%-42s %12d %14d %14v\n", r.name, r.stat.Count, r.stat.Gas, r.stat.Time)
+		}
+	}
+	var rows []row
+	for op, stat := range profile.Opcodes {
+		rows = append(rows, row{op, stat})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+	section("Opcode", rows)
+
+	rows = rows[:0]
+	for addr, stat := range profile.Contracts {
+		rows = append(rows, row{addr.Hex(), stat})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+	section("Contract", rows)
+
+	depths := make([]int, 0, len(profile.Depths))
+	for depth := range profile.Depths {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+
+	rows = rows[:0]
+	for _, depth := range depths {
+		rows = append(rows, row{fmt.Sprintf("%d", depth), profile.Depths[depth]})
+	}
+	section("Depth", rows)
+}
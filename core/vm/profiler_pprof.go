@@ -0,0 +1,148 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+)
+
+// Field numbers of the pprof protocol buffer messages, as defined in
+// https://github.com/google/pprof/blob/master/proto/profile.proto.
+const (
+	pprofProfileSampleType        = 1
+	pprofProfileSample            = 2
+	pprofProfileLocation          = 4
+	pprofProfileFunction          = 5
+	pprofProfileStringTable       = 6
+	pprofProfileDefaultSampleType = 14
+
+	pprofValueTypeType = 1
+	pprofValueTypeUnit = 2
+
+	pprofSampleLocationID = 1
+	pprofSampleValue      = 2
+
+	pprofLocationID   = 1
+	pprofLocationLine = 4
+
+	pprofLineFunctionID = 1
+
+	pprofFunctionID   = 1
+	pprofFunctionName = 2
+)
+
+// pprofBuffer is a minimal protocol buffer encoder, supporting just enough of the
+// wire format to assemble pprof profiles.
+type pprofBuffer struct {
+	data []byte
+}
+
+func (b *pprofBuffer) varint(v uint64) {
+	var enc [binary.MaxVarintLen64]byte
+	b.data = append(b.data, enc[:binary.PutUvarint(enc[:], v)]...)
+}
+
+func (b *pprofBuffer) uint64(field int, v uint64) {
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *pprofBuffer) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *pprofBuffer) packed(field int, vs []uint64) {
+	var packed pprofBuffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytes(field, packed.data)
+}
+
+// WritePprof writes the profile aggregated so far in the gzipped protocol buffer
+// format of pprof, so it can be inspected with `go tool pprof`.
+//
+// Every sample is the stack of executing accounts, outermost at the root, with the
+// opcode as the leaf. The sample values are the instruction count, the gas used
+// and the wall time spent.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var (
+		profile pprofBuffer
+		strings = map[string]uint64{"": 0}
+		table   = []string{""}
+		funcs   = make(map[string]uint64)
+	)
+	str := func(s string) uint64 {
+		if id, ok := strings[s]; ok {
+			return id
+		}
+		strings[s] = uint64(len(table))
+		table = append(table, s)
+		return strings[s]
+	}
+	// Functions and locations are one-to-one, sharing the same identifiers
+	fn := func(name string) uint64 {
+		if id, ok := funcs[name]; ok {
+			return id
+		}
+		id := uint64(len(funcs) + 1)
+		funcs[name] = id
+
+		var function pprofBuffer
+		function.uint64(pprofFunctionID, id)
+		function.uint64(pprofFunctionName, str(name))
+		profile.bytes(pprofProfileFunction, function.data)
+
+		var line, location pprofBuffer
+		line.uint64(pprofLineFunctionID, id)
+		location.uint64(pprofLocationID, id)
+		location.bytes(pprofLocationLine, line.data)
+		profile.bytes(pprofProfileLocation, location.data)
+
+		return id
+	}
+	for _, kind := range [][2]string{{"instructions", "count"}, {"gas", "gas"}, {"time", "nanoseconds"}} {
+		var valueType pprofBuffer
+		valueType.uint64(pprofValueTypeType, str(kind[0]))
+		valueType.uint64(pprofValueTypeUnit, str(kind[1]))
+		profile.bytes(pprofProfileSampleType, valueType.data)
+	}
+	profile.uint64(pprofProfileDefaultSampleType, str("gas"))
+
+	for _, sample := range p.sortedSamples() {
+		locations := []uint64{fn(sample.op.String())}
+		for _, addr := range sample.stack {
+			locations = append(locations, fn(addr.Hex()))
+		}
+		var enc pprofBuffer
+		enc.packed(pprofSampleLocationID, locations)
+		enc.packed(pprofSampleValue, []uint64{sample.stat.Count, sample.stat.Gas, uint64(sample.stat.Time)})
+		profile.bytes(pprofProfileSample, enc.data)
+	}
+	for _, s := range table {
+		profile.bytes(pprofProfileStringTable, []byte(s))
+	}
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(profile.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
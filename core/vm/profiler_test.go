@@ -0,0 +1,203 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	profileCaller = common.HexToAddress("0xc0ffee")
+	profileOuter  = common.HexToAddress("0x1000")
+	profileInner  = common.HexToAddress("0x2000")
+)
+
+// profileRun executes the outer test contract calling into the inner one with
+// the profiler attached, returning the gas used and the profile.
+func profileRun(t *testing.T, inner []byte) (uint64, *Profiler) {
+	outer := []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0x01, byte(SSTORE), // sstore(1, 42)
+		byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(PUSH1), 0x00, byte(PUSH1), 0x00, // no input or output
+		byte(PUSH1), 0x00, byte(PUSH2), 0x20, 0x00, byte(PUSH3), 0x01, 0x00, 0x00, // value 0, inner, gas
+		byte(CALL), byte(POP), byte(STOP),
+	}
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(profileOuter, outer)
+	statedb.SetCode(profileInner, inner)
+
+	profiler := NewProfiler()
+	ctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(1),
+	}
+	env := NewEVM(ctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: profiler})
+
+	_, left, err := env.Call(AccountRef(profileCaller), profileOuter, nil, 1000000, new(big.Int))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	return 1000000 - left, profiler
+}
+
+// checkProfileTotals verifies that the gas attributed to the individual groups
+// of instructions adds up to the gas used by the entire execution.
+func checkProfileTotals(t *testing.T, used uint64, profile *Profile) {
+	if profile.GasUsed != used {
+		t.Errorf("gas used mismatch: have %d, want %d", profile.GasUsed, used)
+	}
+	for name, stats := range map[string][]*ProfileStat{
+		"opcode":   statsOf(profile.Opcodes),
+		"contract": statsOf(profile.Contracts),
+		"depth":    statsOf(profile.Depths),
+	} {
+		var gas uint64
+		for _, stat := range stats {
+			gas += stat.Gas
+		}
+		if gas != used {
+			t.Errorf("%s gas total mismatch: have %d, want %d", name, gas, used)
+		}
+	}
+}
+
+func statsOf(groups interface{}) []*ProfileStat {
+	var stats []*ProfileStat
+	switch groups := groups.(type) {
+	case map[string]*ProfileStat:
+		for _, stat := range groups {
+			stats = append(stats, stat)
+		}
+	case map[common.Address]*ProfileStat:
+		for _, stat := range groups {
+			stats = append(stats, stat)
+		}
+	case map[int]*ProfileStat:
+		for _, stat := range groups {
+			stats = append(stats, stat)
+		}
+	}
+	return stats
+}
+
+// Tests that the profiler attributes gas to the instructions, contracts and call
+// depths actually consuming it, excluding nested calls from their callers.
+func TestProfiler(t *testing.T) {
+	inner := []byte{byte(PUSH1), 0x01, byte(PUSH1), 0x00, byte(SSTORE), byte(STOP)} // sstore(0, 1)
+
+	used, profiler := profileRun(t, inner)
+	profile := profiler.Profile()
+	checkProfileTotals(t, used, profile)
+
+	if stat := profile.Opcodes["SSTORE"]; stat == nil || stat.Count != 2 || stat.Gas != 2*params.SstoreInitGasEIP2200 {
+		t.Errorf("SSTORE stat mismatch: have %+v, want 2 executions using %d gas", stat, 2*params.SstoreInitGasEIP2200)
+	}
+	if stat := profile.Opcodes["CALL"]; stat == nil || stat.Count != 1 || stat.Gas != params.CallGasEIP150 {
+		t.Errorf("CALL stat mismatch: have %+v, want 1 execution using %d gas", stat, params.CallGasEIP150)
+	}
+	want := 2*GasFastestStep + params.SstoreInitGasEIP2200
+	if stat := profile.Contracts[profileInner]; stat == nil || stat.Count != 4 || stat.Gas != want {
+		t.Errorf("inner contract stat mismatch: have %+v, want 4 executions using %d gas", stat, want)
+	}
+	if stat := profile.Depths[2]; stat == nil || stat.Count != 4 || stat.Gas != want {
+		t.Errorf("depth 2 stat mismatch: have %+v, want 4 executions using %d gas", stat, want)
+	}
+	if stat := profile.Depths[1]; stat == nil || stat.Count != 13 {
+		t.Errorf("depth 1 stat mismatch: have %+v, want 13 executions", stat)
+	}
+}
+
+// Tests that gas burnt by failing nested calls is attributed to the instruction
+// failing, not the call.
+func TestProfilerFailure(t *testing.T) {
+	used, profiler := profileRun(t, []byte{byte(PUSH1), 0x00, 0xfe}) // push, invalid
+	profile := profiler.Profile()
+	checkProfileTotals(t, used, profile)
+
+	if stat := profile.Opcodes["CALL"]; stat == nil || stat.Gas != params.CallGasEIP150 {
+		t.Errorf("CALL stat mismatch: have %+v, want %d gas", stat, params.CallGasEIP150)
+	}
+	if stat := profile.Contracts[profileInner]; stat == nil || stat.Count != 2 || stat.Gas < 0x010000-GasFastestStep {
+		t.Errorf("inner contract stat mismatch: have %+v, want all forwarded gas", stat)
+	}
+}
+
+// Tests that stopping the profiler aborts the execution and reports the reason.
+func TestProfilerStop(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()))
+	statedb.SetCode(profileOuter, []byte{byte(JUMPDEST), byte(PUSH1), 0x00, byte(JUMP)}) // endless loop
+
+	profiler := NewProfiler()
+	ctx := Context{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: big.NewInt(1),
+	}
+	env := NewEVM(ctx, statedb, params.AllEthashProtocolChanges, Config{Debug: true, Tracer: profiler})
+
+	reason := errors.New("stopped")
+	profiler.Stop(reason)
+	if _, left, _ := env.Call(AccountRef(profileCaller), profileOuter, nil, math.MaxUint64, new(big.Int)); left == 0 {
+		t.Fatalf("execution not aborted")
+	}
+	if err := profiler.Err(); err != reason {
+		t.Errorf("error mismatch: have %v, want %v", err, reason)
+	}
+	if n := len(profiler.Profile().Opcodes); n != 0 {
+		t.Errorf("profiled %d opcodes after stop", n)
+	}
+}
+
+// Tests that the pprof export contains the executed opcodes and contracts.
+func TestProfilerPprof(t *testing.T) {
+	_, profiler := profileRun(t, []byte{byte(STOP)})
+
+	var buf bytes.Buffer
+	if err := profiler.WritePprof(&buf); err != nil {
+		t.Fatalf("failed to write pprof profile: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("profile not gzipped: %v", err)
+	}
+	blob, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("failed to decompress profile: %v", err)
+	}
+	for _, want := range []string{"SSTORE", "CALL", "gas", profileOuter.Hex(), profileInner.Hex()} {
+		if !bytes.Contains(blob, []byte(want)) {
+			t.Errorf("profile missing %q", want)
+		}
+	}
+	var out bytes.Buffer
+	WriteProfile(&out, profiler.Profile())
+	if !strings.Contains(out.String(), "SSTORE") || !strings.Contains(out.String(), profileInner.Hex()) {
+		t.Errorf("formatted profile incomplete:\n%s", out.String())
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PublicBundleAPI provides an API to submit and simulate transaction bundles,
+// ordered lists of transactions that are included atomically at the top of a
+// block by the miner.
+type PublicBundleAPI struct {
+	e *Ethereum
+}
+
+// NewPublicBundleAPI creates a new bundle API for full nodes.
+func NewPublicBundleAPI(e *Ethereum) *PublicBundleAPI {
+	return &PublicBundleAPI{e}
+}
+
+// decodeBundle decodes a list of RLP encoded signed transactions.
+func decodeBundle(encodedTxs []hexutil.Bytes) (types.Transactions, error) {
+	if len(encodedTxs) == 0 {
+		return nil, core.ErrEmptyBundle
+	}
+	txs := make(types.Transactions, 0, len(encodedTxs))
+	for i, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// SendBundle submits an ordered list of signed transactions to be included
+// atomically at the top of the given block. The bundle is only considered for
+// blocks with a timestamp within the optional minimum and maximum bounds.
+func (api *PublicBundleAPI) SendBundle(ctx context.Context, encodedTxs []hexutil.Bytes, blockNumber rpc.BlockNumber, minTimestamp *uint64, maxTimestamp *uint64) error {
+	if blockNumber < 0 {
+		return errors.New("bundle target must be an explicit block number")
+	}
+	txs, err := decodeBundle(encodedTxs)
+	if err != nil {
+		return err
+	}
+	var minTime, maxTime uint64
+	if minTimestamp != nil {
+		minTime = *minTimestamp
+	}
+	if maxTimestamp != nil {
+		maxTime = *maxTimestamp
+	}
+	return api.e.TxPool().AddMevBundle(txs, big.NewInt(blockNumber.Int64()), minTime, maxTime)
+}
+
+// BundleTxResult is the outcome of simulating a single transaction of a bundle.
+type BundleTxResult struct {
+	TxHash            common.Hash     `json:"txHash"`
+	From              common.Address  `json:"fromAddress"`
+	To                *common.Address `json:"toAddress"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	GasPrice          *hexutil.Big    `json:"gasPrice"`
+	GasFees           *hexutil.Big    `json:"gasFees"`
+	CoinbaseDiff      *hexutil.Big    `json:"coinbaseDiff"`
+	EthSentToCoinbase *hexutil.Big    `json:"ethSentToCoinbase"`
+	Reverted          bool            `json:"reverted"`
+}
+
+// BundleResult is the outcome of simulating an entire bundle.
+type BundleResult struct {
+	StateBlockNumber  hexutil.Uint64    `json:"stateBlockNumber"`
+	BlockNumber       hexutil.Uint64    `json:"blockNumber"`
+	Coinbase          common.Address    `json:"coinbase"`
+	TotalGasUsed      hexutil.Uint64    `json:"totalGasUsed"`
+	GasFees           *hexutil.Big      `json:"gasFees"`
+	CoinbaseDiff      *hexutil.Big      `json:"coinbaseDiff"`
+	EthSentToCoinbase *hexutil.Big      `json:"ethSentToCoinbase"`
+	BundleGasPrice    *hexutil.Big      `json:"bundleGasPrice"`
+	Results           []*BundleTxResult `json:"results"`
+}
+
+// CallBundle simulates a bundle on top of the state of the given block, as if it
+// were included at the top of the next block. It reports the gas used, revert
+// status and coinbase payment of each transaction, without modifying any state.
+//
+// The coinbase and timestamp of the simulated block default to the coinbase of
+// the parent and its timestamp plus one.
+func (api *PublicBundleAPI) CallBundle(ctx context.Context, encodedTxs []hexutil.Bytes, blockNrOrHash rpc.BlockNumberOrHash, coinbase *common.Address, timestamp *uint64) (*BundleResult, error) {
+	txs, err := decodeBundle(encodedTxs)
+	if err != nil {
+		return nil, err
+	}
+	statedb, parent, err := api.e.APIBackend.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + 1,
+		Difficulty: parent.Difficulty,
+		Coinbase:   parent.Coinbase,
+	}
+	if timestamp != nil {
+		header.Time = *timestamp
+	}
+	if coinbase != nil {
+		header.Coinbase = *coinbase
+	}
+	var (
+		config  = api.e.blockchain.Config()
+		signer  = types.MakeSigner(config, header.Number)
+		gasPool = new(core.GasPool).AddGas(header.GasLimit)
+		vmconf  = *api.e.blockchain.GetVMConfig()
+
+		totalFees = new(big.Int)
+		before    = statedb.GetBalance(header.Coinbase)
+		results   = make([]*BundleTxResult, 0, len(txs))
+	)
+	for i, tx := range txs {
+		from, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+
+		coinbaseBefore := statedb.GetBalance(header.Coinbase)
+		receipt, err := core.ApplyTransaction(config, api.e.blockchain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vmconf)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d (%x): %v", i, tx.Hash(), err)
+		}
+		var (
+			fees = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), tx.GasPrice())
+			diff = new(big.Int).Sub(statedb.GetBalance(header.Coinbase), coinbaseBefore)
+		)
+		totalFees.Add(totalFees, fees)
+
+		results = append(results, &BundleTxResult{
+			TxHash:            tx.Hash(),
+			From:              from,
+			To:                tx.To(),
+			GasUsed:           hexutil.Uint64(receipt.GasUsed),
+			GasPrice:          (*hexutil.Big)(tx.GasPrice()),
+			GasFees:           (*hexutil.Big)(fees),
+			CoinbaseDiff:      (*hexutil.Big)(diff),
+			EthSentToCoinbase: (*hexutil.Big)(new(big.Int).Sub(diff, fees)),
+			Reverted:          receipt.Status == types.ReceiptStatusFailed,
+		})
+	}
+	diff := new(big.Int).Sub(statedb.GetBalance(header.Coinbase), before)
+	return &BundleResult{
+		StateBlockNumber:  hexutil.Uint64(parent.Number.Uint64()),
+		BlockNumber:       hexutil.Uint64(header.Number.Uint64()),
+		Coinbase:          header.Coinbase,
+		TotalGasUsed:      hexutil.Uint64(header.GasUsed),
+		GasFees:           (*hexutil.Big)(totalFees),
+		CoinbaseDiff:      (*hexutil.Big)(diff),
+		EthSentToCoinbase: (*hexutil.Big)(new(big.Int).Sub(diff, totalFees)),
+		BundleGasPrice:    (*hexutil.Big)(new(big.Int).Div(diff, new(big.Int).SetUint64(header.GasUsed))),
+		Results:           results,
+	}, nil
+}
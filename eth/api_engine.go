@@ -0,0 +1,230 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/miner"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// maxTrackedPayloads is the maximum number of payloads kept around waiting to
+// be retrieved. Older ones are discarded when new payloads are requested.
+const maxTrackedPayloads = 10
+
+// Payload execution statuses reported to the consensus client.
+const (
+	PayloadValid   = "VALID"
+	PayloadInvalid = "INVALID"
+)
+
+var errUnknownPayload = errors.New("unknown payload")
+
+// PayloadAttributes are the attributes of a block payload requested by an
+// external consensus client.
+type PayloadAttributes struct {
+	ParentHash   common.Hash    `json:"parentHash"`
+	Timestamp    hexutil.Uint64 `json:"timestamp"`
+	FeeRecipient common.Address `json:"feeRecipient"`
+	Random       common.Hash    `json:"random"`
+}
+
+// ExecutableData is an unsealed block payload exchanged with an external
+// consensus client.
+type ExecutableData struct {
+	BlockHash    common.Hash     `json:"blockHash"`
+	ParentHash   common.Hash     `json:"parentHash"`
+	FeeRecipient common.Address  `json:"feeRecipient"`
+	StateRoot    common.Hash     `json:"stateRoot"`
+	ReceiptRoot  common.Hash     `json:"receiptRoot"`
+	LogsBloom    hexutil.Bytes   `json:"logsBloom"`
+	Random       common.Hash     `json:"random"`
+	Difficulty   *hexutil.Big    `json:"difficulty"`
+	Number       hexutil.Uint64  `json:"blockNumber"`
+	GasLimit     hexutil.Uint64  `json:"gasLimit"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Timestamp    hexutil.Uint64  `json:"timestamp"`
+	ExtraData    hexutil.Bytes   `json:"extraData"`
+	Transactions []hexutil.Bytes `json:"transactions"`
+}
+
+// ExecutePayloadResult is the outcome of importing a payload.
+type ExecutePayloadResult struct {
+	Status string `json:"status"`
+	Error  string `json:"validationError,omitempty"`
+}
+
+// blockToExecutableData converts a block into a payload.
+func blockToExecutableData(block *types.Block) (*ExecutableData, error) {
+	txs := make([]hexutil.Bytes, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		enc, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, enc)
+	}
+	return &ExecutableData{
+		BlockHash:    block.Hash(),
+		ParentHash:   block.ParentHash(),
+		FeeRecipient: block.Coinbase(),
+		StateRoot:    block.Root(),
+		ReceiptRoot:  block.ReceiptHash(),
+		LogsBloom:    block.Bloom().Bytes(),
+		Random:       block.MixDigest(),
+		Difficulty:   (*hexutil.Big)(block.Difficulty()),
+		Number:       hexutil.Uint64(block.NumberU64()),
+		GasLimit:     hexutil.Uint64(block.GasLimit()),
+		GasUsed:      hexutil.Uint64(block.GasUsed()),
+		Timestamp:    hexutil.Uint64(block.Time()),
+		ExtraData:    block.Extra(),
+		Transactions: txs,
+	}, nil
+}
+
+// executableDataToBlock reconstructs a block from a payload, verifying that it
+// hashes to the advertised block hash.
+func executableDataToBlock(data *ExecutableData) (*types.Block, error) {
+	txs := make([]*types.Transaction, 0, len(data.Transactions))
+	for i, enc := range data.Transactions {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, tx); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	header := &types.Header{
+		ParentHash:  data.ParentHash,
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    data.FeeRecipient,
+		Root:        data.StateRoot,
+		TxHash:      types.DeriveSha(types.Transactions(txs)),
+		ReceiptHash: data.ReceiptRoot,
+		Bloom:       types.BytesToBloom(data.LogsBloom),
+		Difficulty:  new(big.Int),
+		Number:      new(big.Int).SetUint64(uint64(data.Number)),
+		GasLimit:    uint64(data.GasLimit),
+		GasUsed:     uint64(data.GasUsed),
+		Time:        uint64(data.Timestamp),
+		Extra:       data.ExtraData,
+		MixDigest:   data.Random,
+	}
+	if data.Difficulty != nil {
+		header.Difficulty = data.Difficulty.ToInt()
+	}
+	block := types.NewBlockWithHeader(header).WithBody(txs, nil)
+	if block.Hash() != data.BlockHash {
+		return nil, fmt.Errorf("block hash mismatch: have %x, want %x", block.Hash(), data.BlockHash)
+	}
+	return block, nil
+}
+
+// PrivateEngineAPI allows an external consensus client to drive block production
+// and import: it requests block payloads to be built by the local miner and
+// feeds in payloads produced elsewhere.
+type PrivateEngineAPI struct {
+	e *Ethereum
+
+	lock     sync.Mutex
+	payloads map[uint64]*miner.Payload // Payloads being built, waiting to be retrieved
+	order    []uint64                  // Payload ids in the order of their creation
+	nextID   uint64                    // Identifier of the next payload to build
+}
+
+// NewPrivateEngineAPI creates a new payload building API for full nodes.
+func NewPrivateEngineAPI(e *Ethereum) *PrivateEngineAPI {
+	return &PrivateEngineAPI{
+		e:        e,
+		payloads: make(map[uint64]*miner.Payload),
+	}
+}
+
+// PreparePayload starts building a block on top of the given parent with the
+// given attributes. The block is built asynchronously and keeps being improved
+// until it is retrieved via GetPayload with the returned identifier.
+func (api *PrivateEngineAPI) PreparePayload(attrs PayloadAttributes) (hexutil.Uint64, error) {
+	payload, err := api.e.Miner().BuildPayload(&miner.BuildPayloadArgs{
+		Parent:       attrs.ParentHash,
+		Timestamp:    uint64(attrs.Timestamp),
+		FeeRecipient: attrs.FeeRecipient,
+		Random:       attrs.Random,
+	})
+	if err != nil {
+		return 0, err
+	}
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	id := api.nextID
+	api.nextID++
+
+	api.payloads[id] = payload
+	api.order = append(api.order, id)
+
+	// Drop the oldest payloads if too many are being tracked
+	for len(api.order) > maxTrackedPayloads {
+		if old, ok := api.payloads[api.order[0]]; ok {
+			old.Resolve()
+			delete(api.payloads, api.order[0])
+		}
+		api.order = api.order[1:]
+	}
+	return hexutil.Uint64(id), nil
+}
+
+// GetPayload stops improving the payload with the given identifier and returns
+// the best block built so far. A payload can only be retrieved once.
+func (api *PrivateEngineAPI) GetPayload(id hexutil.Uint64) (*ExecutableData, error) {
+	api.lock.Lock()
+	payload, ok := api.payloads[uint64(id)]
+	delete(api.payloads, uint64(id))
+	api.lock.Unlock()
+
+	if !ok {
+		return nil, errUnknownPayload
+	}
+	return blockToExecutableData(payload.Resolve())
+}
+
+// ExecutePayload imports an externally produced payload into the local chain.
+// The payload's seal is not verified, but its execution must match the state
+// and receipt roots it commits to.
+func (api *PrivateEngineAPI) ExecutePayload(data ExecutableData) (*ExecutePayloadResult, error) {
+	block, err := executableDataToBlock(&data)
+	if err != nil {
+		return &ExecutePayloadResult{Status: PayloadInvalid, Error: err.Error()}, nil
+	}
+	if api.e.blockchain.HasBlock(block.Hash(), block.NumberU64()) {
+		return &ExecutePayloadResult{Status: PayloadValid}, nil
+	}
+	if parent := api.e.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1); parent == nil {
+		return nil, fmt.Errorf("unknown parent %x", block.ParentHash())
+	}
+	if _, err := api.e.blockchain.InsertChainWithoutSealVerification(block); err != nil {
+		log.Warn("Rejected external payload", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return &ExecutePayloadResult{Status: PayloadInvalid, Error: err.Error()}, nil
+	}
+	return &ExecutePayloadResult{Status: PayloadValid}, nil
+}
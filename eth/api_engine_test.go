@@ -0,0 +1,70 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that blocks survive a round trip through the payload representation and
+// that tampered payloads are rejected.
+func TestExecutableDataConversion(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := types.HomesteadSigner{}
+
+	var txs []*types.Transaction
+	for i := uint64(0); i < 3; i++ {
+		tx, _ := types.SignTx(types.NewTransaction(i, common.Address{0xaa}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		txs = append(txs, tx)
+	}
+	header := &types.Header{
+		ParentHash: common.Hash{0x01},
+		Coinbase:   common.Address{0x02},
+		Root:       common.Hash{0x03},
+		Difficulty: big.NewInt(131072),
+		Number:     big.NewInt(1),
+		GasLimit:   params.GenesisGasLimit,
+		GasUsed:    3 * params.TxGas,
+		Time:       10,
+		Extra:      []byte("payload"),
+		MixDigest:  common.Hash{0x04},
+	}
+	block := types.NewBlock(header, txs, nil, nil)
+
+	data, err := blockToExecutableData(block)
+	if err != nil {
+		t.Fatalf("failed to convert block: %v", err)
+	}
+	restored, err := executableDataToBlock(data)
+	if err != nil {
+		t.Fatalf("failed to restore block: %v", err)
+	}
+	if restored.Hash() != block.Hash() {
+		t.Fatalf("block hash mismatch: have %x, want %x", restored.Hash(), block.Hash())
+	}
+	// Dropping a transaction should invalidate the payload
+	data.Transactions = data.Transactions[1:]
+	if _, err := executableDataToBlock(data); err == nil {
+		t.Fatalf("tampered payload accepted")
+	}
+}
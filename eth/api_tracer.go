@@ -52,6 +52,10 @@ const (
 	// and reexecute to produce missing historical state necessary to run a specific
 	// trace.
 	defaultTraceReexec = uint64(128)
+
+	// profileTracer is the name of the native tracer aggregating the gas usage and
+	// execution time of a transaction by opcode, contract and call depth.
+	profileTracer = "profileTracer"
 )
 
 // TraceConfig holds extra parameters to trace functions.
@@ -737,15 +741,22 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = tracers.New(*config.Tracer); err != nil {
-			return nil, err
+		// Constuct the profiler or the JavaScript tracer to execute with
+		var stop func(error)
+		if *config.Tracer == profileTracer {
+			profiler := vm.NewProfiler()
+			tracer, stop = profiler, profiler.Stop
+		} else {
+			if tracer, err = tracers.New(*config.Tracer); err != nil {
+				return nil, err
+			}
+			stop = tracer.(*tracers.Tracer).Stop
 		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*tracers.Tracer).Stop(errors.New("execution timeout"))
+			stop(errors.New("execution timeout"))
 		}()
 		defer cancel()
 
@@ -775,6 +786,12 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 	case *tracers.Tracer:
 		return tracer.GetResult()
 
+	case *vm.Profiler:
+		if err := tracer.Err(); err != nil {
+			return nil, err
+		}
+		return tracer.Profile(), nil
+
 	default:
 		panic(fmt.Sprintf("bad tracer type %T", tracer))
 	}
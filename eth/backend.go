@@ -32,11 +32,14 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/ibft"
+	"github.com/ethereum/go-ethereum/consensus/transition"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vm/evmc"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
@@ -141,6 +144,11 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	// Contract governed signers can only be verified by processing the blocks
+	if chainConfig.HasSignerContract() && config.SyncMode != downloader.FullSync {
+		log.Warn("Switching to full sync for contract governed signers", "mode", config.SyncMode)
+		config.SyncMode = downloader.FullSync
+	}
 	eth := &Ethereum{
 		config:         config,
 		chainDb:        chainDb,
@@ -170,6 +178,16 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 			rawdb.WriteDatabaseVersion(chainDb, core.BlockChainVersion)
 		}
 	}
+	if config.EVMInterpreter != "" {
+		if _, err := vm.LoadEVMC(config.EVMInterpreter, evmc.CapabilityEVM1); err != nil {
+			return nil, err
+		}
+	}
+	if config.EWASMInterpreter != "" {
+		if _, err := vm.LoadEVMC(config.EWASMInterpreter, evmc.CapabilityEWASM); err != nil {
+			return nil, err
+		}
+	}
 	var (
 		vmConfig = vm.Config{
 			EnablePreimageRecording: config.EnablePreimageRecording,
@@ -242,9 +260,45 @@ func makeExtraData(extra []byte) []byte {
 
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
 func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
+	engine := createConsensusEngine(ctx, chainConfig.Clique, chainConfig.IBFT, config, notify, noverify, db)
+	if len(chainConfig.Transitions) == 0 {
+		return engine
+	}
+	// If consensus engine switches are scheduled, delegate based on block numbers
+	forks := []transition.Fork{{Block: 0, Engine: engine}}
+	pow, _ := engine.(*ethash.Ethash)
+	for _, t := range chainConfig.Transitions {
+		var next consensus.Engine
+		switch {
+		case t.Clique != nil:
+			clique := clique.New(t.Clique, db)
+			clique.Takeover(t.Block.Uint64(), t.Signers)
+			next = clique
+		case t.IBFT != nil:
+			ibft := ibft.New(t.IBFT, db)
+			ibft.Takeover(t.Block.Uint64(), t.Signers)
+			next = ibft
+		case pow != nil:
+			next = pow // Reuse the ethash caches and datasets
+		default:
+			next = createConsensusEngine(ctx, nil, nil, config, notify, noverify, db)
+			pow, _ = next.(*ethash.Ethash)
+		}
+		forks = append(forks, transition.Fork{Block: t.Block.Uint64(), Engine: next})
+	}
+	return transition.New(forks)
+}
+
+// createConsensusEngine creates a single consensus engine instance, either one of
+// the proof-of-authority ones if configured, or proof-of-work otherwise.
+func createConsensusEngine(ctx *node.ServiceContext, cliqueConfig *params.CliqueConfig, ibftConfig *params.IBFTConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
 	// If proof-of-authority is requested, set it up
-	if chainConfig.Clique != nil {
-		return clique.New(chainConfig.Clique, db)
+	if cliqueConfig != nil {
+		return clique.New(cliqueConfig, db)
+	}
+	// If byzantine fault tolerance is requested, set it up
+	if ibftConfig != nil {
+		return ibft.New(ibftConfig, db)
 	}
 	// Otherwise assume proof-of-work
 	switch config.PowMode {
@@ -300,6 +354,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicMinerAPI(s),
 			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicBundleAPI(s),
+			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -310,6 +369,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPrivateMinerAPI(s),
 			Public:    false,
+		}, {
+			Namespace: "engine",
+			Version:   "1.0",
+			Service:   NewPrivateEngineAPI(s),
+			Public:    false,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -456,13 +520,28 @@ func (s *Ethereum) StartMining(threads int) error {
 			log.Error("Cannot start mining without etherbase", "err", err)
 			return fmt.Errorf("etherbase missing: %v", err)
 		}
-		if clique, ok := s.engine.(*clique.Clique); ok {
-			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
-			if wallet == nil || err != nil {
-				log.Error("Etherbase account unavailable locally", "err", err)
-				return fmt.Errorf("signer missing: %v", err)
+		// Authorize the signing engines, including any scheduled for later blocks
+		engines := []consensus.Engine{s.engine}
+		if scheduled, ok := s.engine.(*transition.Engine); ok {
+			engines = scheduled.Engines()
+		}
+		for _, engine := range engines {
+			if clique, ok := engine.(*clique.Clique); ok {
+				wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+				if wallet == nil || err != nil {
+					log.Error("Etherbase account unavailable locally", "err", err)
+					return fmt.Errorf("signer missing: %v", err)
+				}
+				clique.Authorize(eb, wallet.SignData)
+			}
+			if ibft, ok := engine.(*ibft.IBFT); ok {
+				wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+				if wallet == nil || err != nil {
+					log.Error("Etherbase account unavailable locally", "err", err)
+					return fmt.Errorf("validator missing: %v", err)
+				}
+				ibft.Authorize(eb, wallet.SignData)
 			}
-			clique.Authorize(eb, wallet.SignData)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
@@ -514,6 +593,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	if s.lesServer != nil {
 		protos = append(protos, s.lesServer.Protocols()...)
 	}
+	if bft, ok := s.engine.(consensus.BFT); ok {
+		protos = append(protos, bft.Protocols()...)
+	}
 	return protos
 }
 
@@ -541,6 +623,43 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	if s.lesServer != nil {
 		s.lesServer.Start(srvr)
 	}
+	// Start the consensus rounds if running a byzantine fault tolerant engine
+	if bft, ok := s.engine.(consensus.BFT); ok {
+		if err := s.startBFT(bft); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startBFT starts the consensus state machine of a byzantine fault tolerant
+// engine, feeding it the chain head events and importing the blocks agreed upon.
+func (s *Ethereum) startBFT(bft consensus.BFT) error {
+	insert := func(block *types.Block) error {
+		if _, err := s.blockchain.InsertChain(types.Blocks{block}); err != nil {
+			return err
+		}
+		s.eventMux.Post(core.NewMinedBlockEvent{Block: block})
+		return nil
+	}
+	if err := bft.Start(s.blockchain, insert); err != nil {
+		return err
+	}
+	heads := make(chan core.ChainHeadEvent, 16)
+	sub := s.blockchain.SubscribeChainHeadEvent(heads)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-heads:
+				bft.NewChainHead(ev.Block.Header())
+			case <-sub.Err():
+				return
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
 	return nil
 }
 
@@ -0,0 +1,303 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	// testTxs is a set of transactions to use during testing that have meaningful hashes.
+	testTxs = []*types.Transaction{
+		types.NewTransaction(5577006791947779410, common.Address{0x0f}, new(big.Int), 0, new(big.Int), nil),
+		types.NewTransaction(15352856648520921629, common.Address{0xbb}, new(big.Int), 0, new(big.Int), nil),
+		types.NewTransaction(3916589616287113937, common.Address{0x86}, new(big.Int), 0, new(big.Int), nil),
+		types.NewTransaction(9828766684487745566, common.Address{0xac}, new(big.Int), 0, new(big.Int), nil),
+	}
+	// testTxsHashes is the hashes of the test transactions above
+	testTxsHashes = []common.Hash{testTxs[0].Hash(), testTxs[1].Hash(), testTxs[2].Hash(), testTxs[3].Hash()}
+)
+
+// txFetcherTester is a test simulator for mocking out the local transaction
+// pool and the remote peers serving transaction retrievals.
+type txFetcherTester struct {
+	fetcher *TxFetcher
+	clock   *mclock.Simulated
+
+	pool     map[common.Hash]*types.Transaction // Transactions in the mock pool
+	requests chan txFetcherRequest              // Retrieval requests issued by the fetcher
+
+	lock sync.RWMutex
+}
+
+// txFetcherRequest is a single retrieval request issued by the fetcher.
+type txFetcherRequest struct {
+	peer   string
+	hashes []common.Hash
+}
+
+// newTxFetcherTester creates a new transaction fetcher test mocker.
+func newTxFetcherTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		clock:    new(mclock.Simulated),
+		pool:     make(map[common.Hash]*types.Transaction),
+		requests: make(chan txFetcherRequest, 16),
+	}
+	tester.fetcher = NewTxFetcherForTests(tester.hasTx, tester.addTxs, tester.fetchTxs, tester.clock)
+	tester.fetcher.step = make(chan struct{})
+	tester.fetcher.Start()
+
+	return tester
+}
+
+// hasTx checks whether the mock pool contains a transaction.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the mock pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// fetchTxs records a retrieval request issued by the fetcher.
+func (f *txFetcherTester) fetchTxs(peer string, hashes []common.Hash) error {
+	f.requests <- txFetcherRequest{peer: peer, hashes: hashes}
+	return nil
+}
+
+// expectRequest waits for a retrieval request and checks its contents.
+func (f *txFetcherTester) expectRequest(t *testing.T, peer string, hashes ...common.Hash) {
+	t.Helper()
+
+	select {
+	case req := <-f.requests:
+		if req.peer != peer {
+			t.Fatalf("request peer mismatch: have %s, want %s", req.peer, peer)
+		}
+		if len(req.hashes) != len(hashes) {
+			t.Fatalf("request size mismatch: have %d, want %d", len(req.hashes), len(hashes))
+		}
+		want := make(map[common.Hash]struct{})
+		for _, hash := range hashes {
+			want[hash] = struct{}{}
+		}
+		for _, hash := range req.hashes {
+			if _, ok := want[hash]; !ok {
+				t.Fatalf("unexpected hash requested: %x", hash)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("retrieval request timeout")
+	}
+}
+
+// expectNoRequest checks that no retrieval request was issued.
+func (f *txFetcherTester) expectNoRequest(t *testing.T) {
+	t.Helper()
+
+	select {
+	case req := <-f.requests:
+		t.Fatalf("unexpected request to %s: %v", req.peer, req.hashes)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// Tests that announced transactions are put on a waitlist first and are only
+// requested after the arrival timeout expires.
+func TestTransactionFetcherWaiting(t *testing.T) {
+	tester := newTxFetcherTester()
+	defer tester.fetcher.Stop()
+
+	go tester.fetcher.Notify("A", []common.Hash{testTxsHashes[0], testTxsHashes[1]})
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.waitlist) != 2 {
+		t.Fatalf("waitlist size mismatch: have %d, want %d", len(tester.fetcher.waitlist), 2)
+	}
+	tester.expectNoRequest(t)
+
+	// A second peer announcing the same transaction becomes an alternate source
+	go tester.fetcher.Notify("B", []common.Hash{testTxsHashes[0]})
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.waitlist[testTxsHashes[0]]) != 2 {
+		t.Fatalf("waitlist origins mismatch: have %d, want %d", len(tester.fetcher.waitlist[testTxsHashes[0]]), 2)
+	}
+	// Expire the wait timer and ensure the transactions are requested once
+	tester.clock.Run(txArriveTimeout)
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.waitlist) != 0 {
+		t.Fatalf("waitlist not drained: %d left", len(tester.fetcher.waitlist))
+	}
+	// Depending on scheduling order, A may be asked for both transactions or B
+	// for the shared one, but each hash must be requested exactly once
+	requested := make(map[common.Hash]int)
+	for len(requested) < 2 {
+		select {
+		case req := <-tester.requests:
+			for _, hash := range req.hashes {
+				requested[hash]++
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("retrieval request timeout")
+		}
+	}
+	tester.expectNoRequest(t)
+	for hash, count := range requested {
+		if count != 1 {
+			t.Fatalf("transaction %x requested %d times", hash, count)
+		}
+	}
+	if len(tester.fetcher.fetching) != 2 {
+		t.Fatalf("fetching set mismatch: have %d, want %d", len(tester.fetcher.fetching), 2)
+	}
+}
+
+// Tests that transactions delivered via broadcast while still on the waitlist
+// are never explicitly requested.
+func TestTransactionFetcherBroadcastCleanup(t *testing.T) {
+	tester := newTxFetcherTester()
+	defer tester.fetcher.Stop()
+
+	go tester.fetcher.Notify("A", []common.Hash{testTxsHashes[0]})
+	<-tester.fetcher.step
+
+	go tester.fetcher.Enqueue("B", []*types.Transaction{testTxs[0]}, false)
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.waitlist) != 0 || len(tester.fetcher.waitslots) != 0 {
+		t.Fatalf("waitlist not cleaned up: %d hashes, %d peers", len(tester.fetcher.waitlist), len(tester.fetcher.waitslots))
+	}
+	tester.clock.Run(txArriveTimeout)
+	<-tester.fetcher.step
+	tester.expectNoRequest(t)
+
+	// Announcements of already known transactions should be filtered out entirely
+	if err := tester.fetcher.Notify("C", []common.Hash{testTxsHashes[0]}); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+	if len(tester.fetcher.waitlist) != 0 {
+		t.Fatalf("known transaction added to waitlist")
+	}
+}
+
+// Tests that partial deliveries and request timeouts reschedule the missing
+// transactions to alternate peers.
+func TestTransactionFetcherRescheduling(t *testing.T) {
+	tester := newTxFetcherTester()
+	defer tester.fetcher.Stop()
+
+	go tester.fetcher.Notify("A", []common.Hash{testTxsHashes[0], testTxsHashes[1]})
+	<-tester.fetcher.step
+	tester.clock.Run(txArriveTimeout)
+	<-tester.fetcher.step
+	tester.expectRequest(t, "A", testTxsHashes[0], testTxsHashes[1])
+
+	// Announce the same transactions from another peer, which should be queued
+	// as an alternate, but not requested while A is in flight
+	go tester.fetcher.Notify("B", []common.Hash{testTxsHashes[0], testTxsHashes[1]})
+	<-tester.fetcher.step
+	tester.expectNoRequest(t)
+
+	// Deliver only one transaction, the other should be requested from B
+	go tester.fetcher.Enqueue("A", []*types.Transaction{testTxs[0]}, true)
+	<-tester.fetcher.step
+	tester.expectRequest(t, "B", testTxsHashes[1])
+
+	if _, ok := tester.fetcher.announces["A"]; ok {
+		t.Fatalf("peer A still tracked after partial delivery")
+	}
+	// Let the request to B time out and ensure everything is forgotten
+	tester.clock.Run(txFetchTimeout)
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.announced) != 0 || len(tester.fetcher.fetching) != 0 || len(tester.fetcher.requests) != 0 {
+		t.Fatalf("fetcher not cleaned up: announced %d, fetching %d, requests %d", len(tester.fetcher.announced), len(tester.fetcher.fetching), len(tester.fetcher.requests))
+	}
+}
+
+// Tests that dropping a peer with an in-flight request reschedules the
+// retrieval to alternate peers.
+func TestTransactionFetcherDrop(t *testing.T) {
+	tester := newTxFetcherTester()
+	defer tester.fetcher.Stop()
+
+	go tester.fetcher.Notify("A", []common.Hash{testTxsHashes[0]})
+	<-tester.fetcher.step
+	go tester.fetcher.Notify("B", []common.Hash{testTxsHashes[0]})
+	<-tester.fetcher.step
+
+	tester.clock.Run(txArriveTimeout)
+	<-tester.fetcher.step
+
+	req := <-tester.requests
+	alternate := "A"
+	if req.peer == "A" {
+		alternate = "B"
+	}
+	go tester.fetcher.Drop(req.peer)
+	<-tester.fetcher.step
+	tester.expectRequest(t, alternate, testTxsHashes[0])
+
+	go tester.fetcher.Drop(alternate)
+	<-tester.fetcher.step
+
+	if len(tester.fetcher.announces) != 0 || len(tester.fetcher.announced) != 0 || len(tester.fetcher.fetching) != 0 {
+		t.Fatalf("fetcher not cleaned up after drops")
+	}
+}
+
+// Tests that a peer cannot announce more transactions than the allowed limit.
+func TestTransactionFetcherDOSProtection(t *testing.T) {
+	tester := newTxFetcherTester()
+	defer tester.fetcher.Stop()
+
+	hashes := make([]common.Hash, maxTxAnnounces+10)
+	for i := range hashes {
+		hashes[i] = common.BigToHash(big.NewInt(int64(i)))
+	}
+	go tester.fetcher.Notify("A", hashes)
+	<-tester.fetcher.step
+
+	if have := len(tester.fetcher.waitslots["A"]); have != maxTxAnnounces {
+		t.Fatalf("waitslots mismatch: have %d, want %d", have, maxTxAnnounces)
+	}
+	go tester.fetcher.Notify("A", []common.Hash{testTxsHashes[0]})
+	<-tester.fetcher.step
+
+	if _, ok := tester.fetcher.waitlist[testTxsHashes[0]]; ok {
+		t.Fatalf("announcement accepted above the limit")
+	}
+}
@@ -28,6 +28,7 @@ import (
 	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -168,6 +169,59 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// DroppedTransaction is the notification sent to droppedTransactions
+// subscribers whenever a transaction leaves the pool without being included.
+type DroppedTransaction struct {
+	Hash       common.Hash  `json:"hash"`
+	Status     string       `json:"status"`
+	Reason     string       `json:"reason"`
+	ReplacedBy *common.Hash `json:"replacedBy,omitempty"`
+}
+
+// DroppedTransactions creates a subscription that is triggered each time a
+// transaction is dropped from or replaced in the transaction pool. The
+// notification carries the reason, allowing clients to tell why a previously
+// submitted transaction disappeared.
+func (api *PublicFilterAPI) DroppedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		changes := make(chan []*core.TxPoolChange, 128)
+		droppedTxSub := api.events.SubscribeDroppedTxs(changes)
+
+		for {
+			select {
+			case batch := <-changes:
+				for _, change := range batch {
+					dropped := &DroppedTransaction{
+						Hash:   change.Tx.Hash(),
+						Status: change.Kind.String(),
+						Reason: change.Reason,
+					}
+					if change.By != nil {
+						hash := change.By.Hash()
+						dropped.ReplacedBy = &hash
+					}
+					notifier.Notify(rpcSub.ID, dropped)
+				}
+			case <-rpcSub.Err():
+				droppedTxSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				droppedTxSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
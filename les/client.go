@@ -18,6 +18,7 @@
 package les
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/accounts"
@@ -77,6 +78,9 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 		return nil, genesisErr
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
+	if chainConfig.HasSignerContract() {
+		return nil, errors.New("can't run a light client on a chain with contract governed signers")
+	}
 
 	peers := newPeerSet()
 	leth := &LightEthereum{
@@ -51,6 +51,9 @@ type Config struct {
 	GasPrice  *big.Int       // Minimum gas price for mining a transaction
 	Recommit  time.Duration  // The time interval for miner to re-create mining work.
 	Noverify  bool           // Disable remote mining solution verification(only useful in ethash).
+
+	Ordering          string           `toml:",omitempty"` // Transaction ordering policy (price, fifo, fair, allowlist)
+	OrderingAllowlist []common.Address `toml:",omitempty"` // Senders prioritised by the allowlist ordering policy
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -182,3 +185,10 @@ func (self *Miner) SetEtherbase(addr common.Address) {
 	self.coinbase = addr
 	self.worker.setEtherbase(addr)
 }
+
+// BuildPayload starts building a block with the given attributes on demand,
+// without sealing it. The returned payload keeps being improved with pending
+// transactions in the background until it is resolved.
+func (self *Miner) BuildPayload(args *BuildPayloadArgs) (*Payload, error) {
+	return self.worker.buildPayload(args)
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"container/heap"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Names of the built in transaction ordering policies.
+const (
+	OrderingPrice     = "price"     // Highest gas price first, the default
+	OrderingFIFO      = "fifo"      // Earliest arrival in the transaction pool first
+	OrderingFair      = "fair"      // Round robin between senders, one transaction each
+	OrderingAllowlist = "allowlist" // Allowlisted senders first, then by gas price
+)
+
+// TxIterator iterates over pending transactions in the order they should be
+// committed into a block, ensuring transactions of a single account are always
+// returned in nonce order.
+type TxIterator interface {
+	// Peek returns the next transaction to commit, or nil if there are none left.
+	Peek() *types.Transaction
+
+	// Shift replaces the current transaction with the next one from the same account.
+	Shift()
+
+	// Pop removes the current transaction along with all subsequent ones from the
+	// same account. It is used when an account's transactions can't be executed.
+	Pop()
+}
+
+// TxOrdering is a block building policy, deciding the order in which pending
+// transactions are attempted when filling a block.
+type TxOrdering interface {
+	// Order creates an iterator over the pending transactions, each account's list
+	// sorted by nonce. The arrival callback returns the time a transaction entered
+	// the transaction pool.
+	Order(signer types.Signer, pending map[common.Address]types.Transactions, arrival func(common.Hash) time.Time) TxIterator
+}
+
+// NewTxOrdering creates the transaction ordering policy with the given name. The
+// allowlist is only used by the allowlist-first policy.
+func NewTxOrdering(name string, allowlist []common.Address) (TxOrdering, error) {
+	switch name {
+	case "", OrderingPrice:
+		return priceOrdering{}, nil
+	case OrderingFIFO:
+		return fifoOrdering{}, nil
+	case OrderingFair:
+		return fairOrdering{}, nil
+	case OrderingAllowlist:
+		allowed := make(map[common.Address]struct{}, len(allowlist))
+		for _, addr := range allowlist {
+			allowed[addr] = struct{}{}
+		}
+		return allowlistOrdering{allowed: allowed}, nil
+	default:
+		return nil, fmt.Errorf("unknown transaction ordering %q", name)
+	}
+}
+
+// priceOrdering orders transactions by gas price, the default behaviour.
+type priceOrdering struct{}
+
+func (priceOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions, arrival func(common.Hash) time.Time) TxIterator {
+	return types.NewTransactionsByPriceAndNonce(signer, pending)
+}
+
+// fifoOrdering orders transactions by their arrival in the transaction pool.
+type fifoOrdering struct{}
+
+func (fifoOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions, arrival func(common.Hash) time.Time) TxIterator {
+	return newHeadsIterator(signer, pending, func(a, b *types.Transaction) bool {
+		return arrival(a.Hash()).Before(arrival(b.Hash()))
+	})
+}
+
+// allowlistOrdering orders transactions of allowlisted senders before all others,
+// each group by gas price.
+type allowlistOrdering struct {
+	allowed map[common.Address]struct{}
+}
+
+func (o allowlistOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions, arrival func(common.Hash) time.Time) TxIterator {
+	return newHeadsIterator(signer, pending, func(a, b *types.Transaction) bool {
+		fromA, _ := types.Sender(signer, a)
+		fromB, _ := types.Sender(signer, b)
+
+		_, allowedA := o.allowed[fromA]
+		_, allowedB := o.allowed[fromB]
+		if allowedA != allowedB {
+			return allowedA
+		}
+		return a.GasPrice().Cmp(b.GasPrice()) > 0
+	})
+}
+
+// headsIterator is a TxIterator returning the account heads in the order of an
+// arbitrary comparator.
+type headsIterator struct {
+	txs    map[common.Address]types.Transactions // Per account nonce-sorted list of transactions
+	heads  *txHeads                              // Next transaction for each unique account
+	signer types.Signer                          // Signer for the set of transactions
+}
+
+// newHeadsIterator creates a transaction iterator ordering the account heads by
+// the given comparator.
+//
+// Note, the input map is reowned so the caller should not interact any more with
+// it after providing it to the constructor.
+func newHeadsIterator(signer types.Signer, txs map[common.Address]types.Transactions, less func(a, b *types.Transaction) bool) *headsIterator {
+	heads := &txHeads{less: less}
+	for from, accTxs := range txs {
+		// Ensure the sender address is from the signer
+		if acc, _ := types.Sender(signer, accTxs[0]); acc != from {
+			delete(txs, from)
+			continue
+		}
+		heads.txs = append(heads.txs, accTxs[0])
+		txs[from] = accTxs[1:]
+	}
+	heap.Init(heads)
+
+	return &headsIterator{
+		txs:    txs,
+		heads:  heads,
+		signer: signer,
+	}
+}
+
+// Peek returns the next transaction by the iterator's order.
+func (it *headsIterator) Peek() *types.Transaction {
+	if len(it.heads.txs) == 0 {
+		return nil
+	}
+	return it.heads.txs[0]
+}
+
+// Shift replaces the current best head with the next one from the same account.
+func (it *headsIterator) Shift() {
+	acc, _ := types.Sender(it.signer, it.heads.txs[0])
+	if txs, ok := it.txs[acc]; ok && len(txs) > 0 {
+		it.heads.txs[0], it.txs[acc] = txs[0], txs[1:]
+		heap.Fix(it.heads, 0)
+		return
+	}
+	heap.Pop(it.heads)
+}
+
+// Pop removes the best transaction, *not* replacing it with the next one from
+// the same account.
+func (it *headsIterator) Pop() {
+	heap.Pop(it.heads)
+}
+
+// txHeads is a heap of transactions ordered by an arbitrary comparator.
+type txHeads struct {
+	txs  types.Transactions
+	less func(a, b *types.Transaction) bool
+}
+
+func (h txHeads) Len() int           { return len(h.txs) }
+func (h txHeads) Less(i, j int) bool { return h.less(h.txs[i], h.txs[j]) }
+func (h txHeads) Swap(i, j int)      { h.txs[i], h.txs[j] = h.txs[j], h.txs[i] }
+
+func (h *txHeads) Push(x interface{}) {
+	h.txs = append(h.txs, x.(*types.Transaction))
+}
+
+func (h *txHeads) Pop() interface{} {
+	old := h.txs
+	n := len(old)
+	x := old[n-1]
+	h.txs = old[0 : n-1]
+	return x
+}
+
+// fairOrdering cycles through the senders in a round robin fashion, including a
+// single transaction of each before moving on to the next. Senders are visited
+// in the arrival order of their first pending transaction.
+type fairOrdering struct{}
+
+func (fairOrdering) Order(signer types.Signer, pending map[common.Address]types.Transactions, arrival func(common.Hash) time.Time) TxIterator {
+	// Establish a deterministic sender order by first arrival
+	order := newHeadsIterator(signer, pending, func(a, b *types.Transaction) bool {
+		return arrival(a.Hash()).Before(arrival(b.Hash()))
+	})
+	it := &roundRobinIterator{txs: make(map[common.Address]types.Transactions)}
+	for len(order.heads.txs) > 0 {
+		head := heap.Pop(order.heads).(*types.Transaction)
+		from, _ := types.Sender(signer, head)
+
+		it.senders = append(it.senders, from)
+		it.txs[from] = append(types.Transactions{head}, order.txs[from]...)
+	}
+	return it
+}
+
+// roundRobinIterator is a TxIterator returning one transaction of each sender
+// in turn.
+type roundRobinIterator struct {
+	senders []common.Address                      // Senders in the order of their next turn
+	txs     map[common.Address]types.Transactions // Per account nonce-sorted list of transactions
+}
+
+// Peek returns the next transaction of the sender whose turn it is.
+func (it *roundRobinIterator) Peek() *types.Transaction {
+	if len(it.senders) == 0 {
+		return nil
+	}
+	return it.txs[it.senders[0]][0]
+}
+
+// Shift consumes the current transaction and moves its sender to the end of
+// the queue if it has any more transactions left.
+func (it *roundRobinIterator) Shift() {
+	from := it.senders[0]
+	it.senders = it.senders[1:]
+
+	if txs := it.txs[from][1:]; len(txs) > 0 {
+		it.txs[from] = txs
+		it.senders = append(it.senders, from)
+		return
+	}
+	delete(it.txs, from)
+}
+
+// Pop drops the current sender along with all its transactions.
+func (it *roundRobinIterator) Pop() {
+	delete(it.txs, it.senders[0])
+	it.senders = it.senders[1:]
+}
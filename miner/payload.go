@@ -0,0 +1,129 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// maxPayloadBuildTime is the maximum time a payload keeps being improved in the
+// background if nobody retrieves it.
+const maxPayloadBuildTime = 12 * time.Second
+
+// BuildPayloadArgs contains the attributes of a block payload requested by an
+// external consensus client.
+type BuildPayloadArgs struct {
+	Parent       common.Hash    // The hash of the block to build on top of
+	Timestamp    uint64         // The timestamp of the block
+	FeeRecipient common.Address // The address receiving the block's fees
+	Random       common.Hash    // The randomness value placed in the mix digest
+}
+
+// Payload is a block being built on demand. It starts out empty and is updated
+// in the background with more profitable versions until it is resolved.
+type Payload struct {
+	lock  sync.Mutex
+	block *types.Block // Most profitable block built so far
+	fees  *big.Int     // Coinbase profit collected by the block's transactions
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// newPayload creates a payload from an initial, usually empty, block.
+func newPayload(block *types.Block, fees *big.Int) *Payload {
+	return &Payload{
+		block: block,
+		fees:  fees,
+		stop:  make(chan struct{}),
+	}
+}
+
+// update replaces the payload's block if the new one is at least as profitable.
+func (p *Payload) update(block *types.Block, fees *big.Int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	select {
+	case <-p.stop:
+		return // Resolved in the mean time, don't change what was handed out
+	default:
+	}
+	if fees.Cmp(p.fees) >= 0 {
+		p.block, p.fees = block, fees
+		log.Debug("Updated payload", "number", block.Number(), "hash", block.Hash(), "txs", len(block.Transactions()), "fees", fees)
+	}
+}
+
+// Resolve stops improving the payload and returns the best block built so far.
+func (p *Payload) Resolve() *types.Block {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.stopOnce.Do(func() { close(p.stop) })
+	return p.block
+}
+
+// buildPayload builds an empty block with the given attributes and keeps filling
+// it with pending transactions in the background, periodically rebuilding it to
+// pull in more profitable ones, until the payload is resolved or times out.
+func (w *worker) buildPayload(args *BuildPayloadArgs) (*Payload, error) {
+	empty, fees, err := w.getSealingBlock(args, true)
+	if err != nil {
+		return nil, err
+	}
+	payload := newPayload(empty, fees)
+
+	recommit := w.config.Recommit
+	if recommit < minRecommitInterval {
+		recommit = minRecommitInterval
+	}
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		deadline := time.NewTimer(maxPayloadBuildTime)
+		defer deadline.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				block, fees, err := w.getSealingBlock(args, false)
+				if err != nil {
+					log.Warn("Failed to build payload", "parent", args.Parent, "err", err)
+					return
+				}
+				payload.update(block, fees)
+				timer.Reset(recommit)
+
+			case <-payload.stop:
+				return
+			case <-deadline.C:
+				return
+			case <-w.exitCh:
+				return
+			}
+		}
+	}()
+	return payload, nil
+}
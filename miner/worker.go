@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -92,6 +93,32 @@ type environment struct {
 	receipts []*types.Receipt
 }
 
+var (
+	// errUnknownParent is returned if a payload is requested on top of a block
+	// that is not known locally.
+	errUnknownParent = errors.New("unknown parent")
+
+	// errInvalidTimestamp is returned if a payload is requested with a timestamp
+	// not later than its parent's.
+	errInvalidTimestamp = errors.New("timestamp not after parent")
+
+	// errWorkerClosed is returned if a payload is requested from a terminated worker.
+	errWorkerClosed = errors.New("worker closed")
+)
+
+// errBundleReverted is returned if a transaction within a bundle reverted, which
+// invalidates the entire bundle.
+var errBundleReverted = errors.New("bundle transaction reverted")
+
+// simulatedBundle is a bundle along with the results of executing it on top of
+// the pending state.
+type simulatedBundle struct {
+	bundle      types.MevBundle
+	gasUsed     uint64   // Total gas used by the bundle's transactions
+	profit      *big.Int // Coinbase balance increase caused by the bundle
+	mevGasPrice *big.Int // Profit per unit of gas used, the bundle's ordering key
+}
+
 // task contains all information for consensus engine sealing and result submitting.
 type task struct {
 	receipts  []*types.Receipt
@@ -113,6 +140,21 @@ type newWorkReq struct {
 	timestamp int64
 }
 
+// getWorkReq represents a request for building a block payload with the given
+// attributes, outside of the regular mining cycle.
+type getWorkReq struct {
+	args   *BuildPayloadArgs
+	noTxs  bool // Whether to build an empty block, without any transactions
+	result chan *getWorkResult
+}
+
+// getWorkResult is the outcome of a payload building request.
+type getWorkResult struct {
+	block *types.Block
+	fees  *big.Int
+	err   error
+}
+
 // intervalAdjust represents a resubmitting interval adjustment.
 type intervalAdjust struct {
 	ratio float64
@@ -127,6 +169,7 @@ type worker struct {
 	engine      consensus.Engine
 	eth         Backend
 	chain       *core.BlockChain
+	ordering    TxOrdering // Policy deciding the order of pending transactions in a block
 
 	// Subscriptions
 	mux          *event.TypeMux
@@ -139,6 +182,7 @@ type worker struct {
 
 	// Channels
 	newWorkCh          chan *newWorkReq
+	getWorkCh          chan *getWorkReq
 	taskCh             chan *task
 	resultCh           chan *types.Block
 	startCh            chan struct{}
@@ -193,6 +237,7 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
 		chainSideCh:        make(chan core.ChainSideEvent, chainSideChanSize),
 		newWorkCh:          make(chan *newWorkReq),
+		getWorkCh:          make(chan *getWorkReq),
 		taskCh:             make(chan *task),
 		resultCh:           make(chan *types.Block, resultQueueSize),
 		exitCh:             make(chan struct{}),
@@ -200,6 +245,14 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
 	}
+	// Set up the transaction ordering policy, falling back to the default one
+	ordering, err := NewTxOrdering(config.Ordering, config.OrderingAllowlist)
+	if err != nil {
+		log.Warn("Invalid transaction ordering, using default", "ordering", config.Ordering, "err", err)
+		ordering, _ = NewTxOrdering(OrderingPrice, nil)
+	}
+	worker.ordering = ordering
+
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
 	// Subscribe events for blockchain
@@ -407,6 +460,10 @@ func (w *worker) mainLoop() {
 		case req := <-w.newWorkCh:
 			w.commitNewWork(req.interrupt, req.noempty, req.timestamp)
 
+		case req := <-w.getWorkCh:
+			block, fees, err := w.generateWork(req.args, req.noTxs)
+			req.result <- &getWorkResult{block: block, fees: fees, err: err}
+
 		case ev := <-w.chainSideCh:
 			// Short circuit for duplicate side blocks
 			if _, exist := w.localUncles[ev.Block.Hash()]; exist {
@@ -466,7 +523,7 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs)
+				txset := w.ordering.Order(w.current.signer, txs, w.eth.TxPool().ArrivalTime)
 				tcount := w.current.tcount
 				w.commitTransactions(txset, coinbase, nil)
 				// Only update the snapshot if any new transactons were added
@@ -715,7 +772,119 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+// simulateBundle executes a bundle on a copy of the current state and returns
+// the coinbase profit it yields. Bundles that fail or revert are rejected.
+func (w *worker) simulateBundle(bundle types.MevBundle, coinbase common.Address) (*simulatedBundle, error) {
+	var (
+		state   = w.current.state.Copy()
+		header  = types.CopyHeader(w.current.header)
+		gasPool = new(core.GasPool).AddGas(w.current.gasPool.Gas())
+		before  = state.GetBalance(coinbase)
+		gasUsed uint64
+	)
+	for i, tx := range bundle.Txs {
+		state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount+i)
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, state, header, tx, &header.GasUsed, *w.chain.GetVMConfig())
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return nil, errBundleReverted
+		}
+		gasUsed += receipt.GasUsed
+	}
+	profit := new(big.Int).Sub(state.GetBalance(coinbase), before)
+	return &simulatedBundle{
+		bundle:      bundle,
+		gasUsed:     gasUsed,
+		profit:      profit,
+		mevGasPrice: new(big.Int).Div(profit, new(big.Int).SetUint64(gasUsed)),
+	}, nil
+}
+
+// commitBundle applies all transactions of a bundle to the current state and
+// returns their logs. If any of them fails or reverts, the entire bundle is
+// rolled back.
+func (w *worker) commitBundle(txs types.Transactions, coinbase common.Address) ([]*types.Log, error) {
+	// Snapshots don't survive transaction finalisation, back up the entire state
+	var (
+		backup  = w.current.state.Copy()
+		gas     = w.current.gasPool.Gas()
+		gasUsed = w.current.header.GasUsed
+		count   = len(w.current.txs)
+		tcount  = w.current.tcount
+	)
+	revert := func() {
+		w.current.state = backup
+		w.current.gasPool = new(core.GasPool).AddGas(gas)
+		w.current.header.GasUsed = gasUsed
+		w.current.txs = w.current.txs[:count]
+		w.current.receipts = w.current.receipts[:count]
+		w.current.tcount = tcount
+	}
+	var logs []*types.Log
+	for _, tx := range txs {
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		txLogs, err := w.commitTransaction(tx, coinbase)
+		if err != nil {
+			revert()
+			return nil, err
+		}
+		if w.current.receipts[len(w.current.receipts)-1].Status == types.ReceiptStatusFailed {
+			revert()
+			return nil, errBundleReverted
+		}
+		logs = append(logs, txLogs...)
+		w.current.tcount++
+	}
+	return logs, nil
+}
+
+// commitBundles simulates the given bundles on top of the current state, orders
+// them by profitability and commits every one that still executes cleanly on
+// top of the previously committed ones. It returns whether any was included.
+func (w *worker) commitBundles(bundles []types.MevBundle, coinbase common.Address) bool {
+	// Short circuit if current is nil or there's nothing to do
+	if w.current == nil || len(bundles) == 0 {
+		return false
+	}
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	simulated := make([]*simulatedBundle, 0, len(bundles))
+	for _, bundle := range bundles {
+		sim, err := w.simulateBundle(bundle, coinbase)
+		if err != nil {
+			log.Trace("Discarding failing bundle", "number", bundle.BlockNumber, "txs", len(bundle.Txs), "err", err)
+			continue
+		}
+		simulated = append(simulated, sim)
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].mevGasPrice.Cmp(simulated[j].mevGasPrice) > 0
+	})
+	// Greedily include the bundles, skipping any that conflict with an earlier one
+	var (
+		included      bool
+		coalescedLogs []*types.Log
+	)
+	for _, sim := range simulated {
+		logs, err := w.commitBundle(sim.bundle.Txs, coinbase)
+		if err != nil {
+			log.Trace("Skipping conflicting bundle", "number", sim.bundle.BlockNumber, "txs", len(sim.bundle.Txs), "err", err)
+			continue
+		}
+		log.Debug("Committed bundle to block", "number", sim.bundle.BlockNumber, "txs", len(sim.bundle.Txs), "gas", sim.gasUsed, "profit", sim.profit)
+		coalescedLogs = append(coalescedLogs, logs...)
+		included = true
+	}
+	w.postPendingLogs(coalescedLogs)
+	return included
+}
+
+func (w *worker) commitTransactions(txs TxIterator, coinbase common.Address, interrupt *int32) bool {
 	// Short circuit if current is nil
 	if w.current == nil {
 		return true
@@ -805,7 +974,19 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		}
 	}
 
-	if !w.isRunning() && len(coalescedLogs) > 0 {
+	w.postPendingLogs(coalescedLogs)
+
+	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
+	// than the user-specified one.
+	if interrupt != nil {
+		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
+	}
+	return false
+}
+
+// postPendingLogs announces the logs of transactions included in the pending block.
+func (w *worker) postPendingLogs(logs []*types.Log) {
+	if !w.isRunning() && len(logs) > 0 {
 		// We don't push the pendingLogsEvent while we are mining. The reason is that
 		// when we are mining, the worker will regenerate a mining block every 3 seconds.
 		// In order to avoid pushing the repeated pendingLog, we disable the pending log pushing.
@@ -813,19 +994,13 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
 		// logs by filling in the block hash when the block was mined by the local miner. This can
 		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
-		cpy := make([]*types.Log, len(coalescedLogs))
-		for i, l := range coalescedLogs {
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
 			cpy[i] = new(types.Log)
 			*cpy[i] = *l
 		}
 		go w.mux.Post(core.PendingLogsEvent{Logs: cpy})
 	}
-	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
-	// than the user-specified one.
-	if interrupt != nil {
-		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
-	}
-	return false
 }
 
 // commitNewWork generates several new sealing tasks based on the parent block.
@@ -921,6 +1096,9 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
+	// Include the most profitable bundles ahead of the pool transactions
+	bundled := w.commitBundles(w.eth.TxPool().MevBundles(header.Number, header.Time), w.coinbase)
+
 	// Fill the block with all available pending transactions.
 	pending, err := w.eth.TxPool().Pending()
 	if err != nil {
@@ -928,7 +1106,7 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		return
 	}
 	// Short circuit if there is no available pending transactions
-	if len(pending) == 0 {
+	if len(pending) == 0 && !bundled {
 		w.updateSnapshot()
 		return
 	}
@@ -941,13 +1119,13 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs)
+		txs := w.ordering.Order(w.current.signer, localTxs, w.eth.TxPool().ArrivalTime)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs)
+		txs := w.ordering.Order(w.current.signer, remoteTxs, w.eth.TxPool().ArrivalTime)
 		if w.commitTransactions(txs, w.coinbase, interrupt) {
 			return
 		}
@@ -955,6 +1133,94 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	w.commit(uncles, w.fullTaskHook, true, tstart)
 }
 
+// getSealingBlock requests the main loop to build a block with the given
+// attributes and waits for the result. It returns the block along with the
+// coinbase profit collected by its transactions.
+func (w *worker) getSealingBlock(args *BuildPayloadArgs, noTxs bool) (*types.Block, *big.Int, error) {
+	req := &getWorkReq{args: args, noTxs: noTxs, result: make(chan *getWorkResult, 1)}
+	select {
+	case w.getWorkCh <- req:
+		res := <-req.result
+		return res.block, res.fees, res.err
+	case <-w.exitCh:
+		return nil, nil, errWorkerClosed
+	}
+}
+
+// generateWork builds a block on top of an arbitrary parent with the given
+// attributes. The block is not sealed, nor submitted to the consensus engine.
+//
+// Note, this method must be called from the main loop, it temporarily replaces
+// the current mining environment.
+func (w *worker) generateWork(args *BuildPayloadArgs, noTxs bool) (*types.Block, *big.Int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	prev := w.current
+	defer func() { w.current = prev }()
+
+	parent := w.chain.GetBlockByHash(args.Parent)
+	if parent == nil {
+		return nil, nil, errUnknownParent
+	}
+	if parent.Time() >= args.Timestamp {
+		return nil, nil, errInvalidTimestamp
+	}
+	num := parent.Number()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(num, common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, w.config.GasFloor, w.config.GasCeil),
+		Extra:      w.extra,
+		Time:       args.Timestamp,
+		Coinbase:   args.FeeRecipient,
+	}
+	if err := w.engine.Prepare(w.chain, header); err != nil {
+		return nil, nil, err
+	}
+	header.MixDigest = args.Random
+
+	if err := w.makeCurrent(parent, header); err != nil {
+		return nil, nil, err
+	}
+	env := w.current
+	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
+		misc.ApplyDAOHardFork(env.state)
+	}
+	before := env.state.GetBalance(header.Coinbase)
+
+	if !noTxs {
+		w.commitBundles(w.eth.TxPool().MevBundles(header.Number, header.Time), header.Coinbase)
+
+		pending, err := w.eth.TxPool().Pending()
+		if err != nil {
+			return nil, nil, err
+		}
+		localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
+		for _, account := range w.eth.TxPool().Locals() {
+			if txs := remoteTxs[account]; len(txs) > 0 {
+				delete(remoteTxs, account)
+				localTxs[account] = txs
+			}
+		}
+		if len(localTxs) > 0 {
+			w.commitTransactions(w.ordering.Order(env.signer, localTxs, w.eth.TxPool().ArrivalTime), header.Coinbase, nil)
+		}
+		if len(remoteTxs) > 0 {
+			w.commitTransactions(w.ordering.Order(env.signer, remoteTxs, w.eth.TxPool().ArrivalTime), header.Coinbase, nil)
+		}
+	}
+	// Bundles may have replaced the state, make sure to use the final one
+	env = w.current
+	fees := new(big.Int).Sub(env.state.GetBalance(header.Coinbase), before)
+
+	block, err := w.engine.FinalizeAndAssemble(w.chain, env.header, env.state, env.txs, nil, env.receipts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, fees, nil
+}
+
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(uncles []*types.Header, interval func(), update bool, start time.Time) error {
@@ -17,8 +17,11 @@
 package miner
 
 import (
+	"crypto/ecdsa"
+	"fmt"
 	"math/big"
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 
@@ -585,3 +588,215 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+// makeTestEnvironment creates a fresh mining context on top of the current head
+// for tests to commit transactions into directly.
+func makeTestEnvironment(t *testing.T, w *worker, b *testWorkerBackend) *types.Header {
+	parent := b.chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, testConfig.GasFloor, testConfig.GasCeil),
+		Time:       parent.Time() + 1,
+		Difficulty: big.NewInt(1),
+	}
+	if err := w.makeCurrent(parent, header); err != nil {
+		t.Fatalf("failed to create mining context: %v", err)
+	}
+	return header
+}
+
+func TestCommitBundles(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	// Block the worker from generating new work while the environment is tampered with
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	header := makeTestEnvironment(t, w, b)
+
+	sign := func(nonce uint64, price int64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(price), nil), types.HomesteadSigner{}, testBankKey)
+		return tx
+	}
+	var (
+		coinbase = common.Address{0x01}
+		cheap    = sign(0, 1)
+		pricey   = sign(0, 10)
+	)
+	// Commit two conflicting bundles, only the more profitable one should be included
+	bundles := []types.MevBundle{
+		{Txs: types.Transactions{cheap}, BlockNumber: big.NewInt(1)},
+		{Txs: types.Transactions{pricey}, BlockNumber: big.NewInt(1)},
+	}
+	if !w.commitBundles(bundles, coinbase) {
+		t.Fatalf("no bundle included")
+	}
+	if len(w.current.txs) != 1 || w.current.txs[0].Hash() != pricey.Hash() {
+		t.Fatalf("included transactions mismatch: have %v, want [%x]", w.current.txs, pricey.Hash())
+	}
+	// Commit a bundle that fails half way through and ensure it's fully rolled back
+	if logs, err := w.commitBundle(types.Transactions{sign(1, 1), sign(1, 2)}, coinbase); err == nil || logs != nil {
+		t.Fatalf("failing bundle committed")
+	}
+	if len(w.current.txs) != 1 || len(w.current.receipts) != 1 || w.current.tcount != 1 {
+		t.Errorf("transactions not rolled back: txs %d, receipts %d, count %d", len(w.current.txs), len(w.current.receipts), w.current.tcount)
+	}
+	if w.current.header.GasUsed != params.TxGas {
+		t.Errorf("gas used not rolled back: have %d, want %d", w.current.header.GasUsed, params.TxGas)
+	}
+	if have, want := w.current.gasPool.Gas(), header.GasLimit-params.TxGas; have != want {
+		t.Errorf("gas pool not rolled back: have %d, want %d", have, want)
+	}
+	if nonce := w.current.state.GetNonce(testBankAddress); nonce != 1 {
+		t.Errorf("state not rolled back: have nonce %d, want %d", nonce, 1)
+	}
+}
+
+func TestOrderingPrice(t *testing.T) {
+	testOrdering(t, OrderingPrice, nil, []string{"B0", "B1", "C0", "A0", "A1"})
+}
+
+func TestOrderingFIFO(t *testing.T) {
+	testOrdering(t, OrderingFIFO, nil, []string{"A0", "B0", "B1", "C0", "A1"})
+}
+
+func TestOrderingFair(t *testing.T) {
+	testOrdering(t, OrderingFair, nil, []string{"A0", "B0", "C0", "A1", "B1"})
+}
+
+func TestOrderingAllowlist(t *testing.T) {
+	testOrdering(t, OrderingAllowlist, []string{"C"}, []string{"C0", "B0", "B1", "A0", "A1"})
+}
+
+func testOrdering(t *testing.T, policy string, allowlist []string, want []string) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	// Block the worker from generating new work while the environment is tampered with
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	makeTestEnvironment(t, w, b)
+
+	// Create a few funded senders with transactions of various prices and arrivals
+	keys := make(map[string]*ecdsa.PrivateKey)
+	for _, name := range []string{"A", "B", "C"} {
+		keys[name], _ = crypto.GenerateKey()
+		w.current.state.AddBalance(crypto.PubkeyToAddress(keys[name].PublicKey), testBankFunds)
+	}
+	var (
+		start    = time.Now()
+		names    = make(map[common.Hash]string)
+		arrivals = make(map[common.Hash]time.Time)
+		pending  = make(map[common.Address]types.Transactions)
+	)
+	add := func(sender string, nonce uint64, price int64, arrival time.Duration) {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, testUserAddress, big.NewInt(1000), params.TxGas, big.NewInt(price), nil), types.HomesteadSigner{}, keys[sender])
+		from := crypto.PubkeyToAddress(keys[sender].PublicKey)
+
+		names[tx.Hash()] = fmt.Sprintf("%s%d", sender, nonce)
+		arrivals[tx.Hash()] = start.Add(arrival)
+		pending[from] = append(pending[from], tx)
+	}
+	add("A", 0, 1, 0)
+	add("A", 1, 1, 5*time.Second)
+	add("B", 0, 5, 1*time.Second)
+	add("B", 1, 5, 1500*time.Millisecond)
+	add("C", 0, 3, 2*time.Second)
+
+	var allowed []common.Address
+	for _, name := range allowlist {
+		allowed = append(allowed, crypto.PubkeyToAddress(keys[name].PublicKey))
+	}
+	ordering, err := NewTxOrdering(policy, allowed)
+	if err != nil {
+		t.Fatalf("failed to create ordering: %v", err)
+	}
+	arrival := func(hash common.Hash) time.Time { return arrivals[hash] }
+	w.commitTransactions(ordering.Order(w.current.signer, pending, arrival), testBankAddress, nil)
+
+	var have []string
+	for _, tx := range w.current.txs {
+		have = append(have, names[tx.Hash()])
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("transaction order mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestBuildPayload(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var (
+		parent    = b.chain.CurrentBlock()
+		recipient = common.HexToAddress("0xdeadbeef")
+		random    = common.HexToHash("0xcafebabe")
+	)
+	// Requesting payloads with invalid attributes should fail
+	if _, err := w.buildPayload(&BuildPayloadArgs{Parent: common.Hash{0x01}, Timestamp: parent.Time() + 1}); err != errUnknownParent {
+		t.Fatalf("unknown parent error mismatch: have %v, want %v", err, errUnknownParent)
+	}
+	if _, err := w.buildPayload(&BuildPayloadArgs{Parent: parent.Hash(), Timestamp: parent.Time()}); err != errInvalidTimestamp {
+		t.Fatalf("invalid timestamp error mismatch: have %v, want %v", err, errInvalidTimestamp)
+	}
+	// Request a valid payload and wait until the pending transactions are included
+	args := &BuildPayloadArgs{
+		Parent:       parent.Hash(),
+		Timestamp:    parent.Time() + 10,
+		FeeRecipient: recipient,
+		Random:       random,
+	}
+	payload, err := w.buildPayload(args)
+	if err != nil {
+		t.Fatalf("failed to build payload: %v", err)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		payload.lock.Lock()
+		txs := len(payload.block.Transactions())
+		payload.lock.Unlock()
+
+		if txs == len(pendingTxs) {
+			break
+		}
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("payload transaction count mismatch: have %d, want %d", txs, len(pendingTxs))
+		}
+	}
+	block := payload.Resolve()
+	if block.ParentHash() != parent.Hash() {
+		t.Errorf("parent mismatch: have %x, want %x", block.ParentHash(), parent.Hash())
+	}
+	if block.Time() != args.Timestamp {
+		t.Errorf("timestamp mismatch: have %d, want %d", block.Time(), args.Timestamp)
+	}
+	if block.Coinbase() != recipient {
+		t.Errorf("fee recipient mismatch: have %x, want %x", block.Coinbase(), recipient)
+	}
+	if block.MixDigest() != random {
+		t.Errorf("randomness mismatch: have %x, want %x", block.MixDigest(), random)
+	}
+	// Resolved payloads must not change any more
+	payload.update(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)}), big.NewInt(1))
+	if resolved := payload.Resolve(); resolved != block {
+		t.Errorf("resolved payload changed")
+	}
+	// The unsealed payload should be importable into the chain
+	if _, err := b.chain.InsertChainWithoutSealVerification(block); err != nil {
+		t.Fatalf("failed to import payload: %v", err)
+	}
+	if head := b.chain.CurrentBlock().Hash(); head != block.Hash() {
+		t.Errorf("chain head mismatch: have %x, want %x", head, block.Hash())
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -104,6 +105,45 @@ func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 
+// BanPeer refuses connections to and from a node or IP network. The target can be
+// an enode URL, ENR, node ID, IP address or CIDR network. The ban lasts for the
+// given number of seconds, or forever if no duration is given.
+func (api *PrivateAdminAPI) BanPeer(target string, duration *uint64) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	var d time.Duration
+	if duration != nil {
+		d = time.Duration(*duration) * time.Second
+	}
+	if err := server.BanPeer(target, d); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Unban lifts a ban created by BanPeer.
+func (api *PrivateAdminAPI) Unban(target string) (bool, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return false, ErrNodeStopped
+	}
+	return server.UnbanPeer(target)
+}
+
+// ListBans returns the active bans.
+func (api *PrivateAdminAPI) ListBans() ([]p2p.Ban, error) {
+	// Make sure the server is running, fail otherwise
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.Bans(), nil
+}
+
 // PeerEvents creates an RPC subscription which receives peer events from the
 // node's p2p.Server
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
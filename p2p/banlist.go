@@ -0,0 +1,196 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// Ban describes an entry of the server's ban list.
+type Ban struct {
+	Target string    `json:"target"` // node ID or IP network
+	Until  time.Time `json:"until"`  // zero for permanent bans
+}
+
+// banEntry is a parsed ban list entry. Exactly one of id and net is set.
+type banEntry struct {
+	id    *enode.ID
+	net   *net.IPNet
+	until time.Time
+}
+
+func (e *banEntry) matches(id enode.ID, ip net.IP) bool {
+	if e.id != nil {
+		return *e.id == id
+	}
+	return ip != nil && e.net.Contains(ip)
+}
+
+// banList holds nodes and IP networks that may not connect. Bans are persisted
+// in the node database. The query methods list, isBanned and isBannedIP can be
+// called on a nil banList; add and remove cannot.
+type banList struct {
+	mu      sync.Mutex
+	db      *enode.DB
+	entries map[string]*banEntry // keyed by canonical target
+	now     func() time.Time
+}
+
+func newBanList(db *enode.DB) *banList {
+	bl := &banList{db: db, entries: make(map[string]*banEntry), now: time.Now}
+	for target, until := range db.Bans() {
+		key, e, err := parseBanTarget(target)
+		if err != nil {
+			db.DeleteBan(target)
+			continue
+		}
+		e.until = until
+		bl.entries[key] = e
+	}
+	return bl
+}
+
+// parseBanTarget parses an enode URL, ENR, hex node ID, IP address or CIDR
+// network. It returns the canonical form of the target and the parsed entry.
+func parseBanTarget(target string) (string, *banEntry, error) {
+	switch {
+	case strings.HasPrefix(target, "enode://") || strings.HasPrefix(target, "enr:"):
+		n, err := enode.Parse(enode.ValidSchemes, target)
+		if err != nil {
+			return "", nil, err
+		}
+		id := n.ID()
+		return id.String(), &banEntry{id: &id}, nil
+	case strings.Contains(target, "/"):
+		_, network, err := net.ParseCIDR(target)
+		if err != nil {
+			return "", nil, err
+		}
+		return network.String(), &banEntry{net: network}, nil
+	}
+	if ip := net.ParseIP(target); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 8*net.IPv4len
+		}
+		network := &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return network.String(), &banEntry{net: network}, nil
+	}
+	if b, err := hex.DecodeString(target); err == nil && len(b) == len(enode.ID{}) {
+		var id enode.ID
+		copy(id[:], b)
+		return id.String(), &banEntry{id: &id}, nil
+	}
+	return "", nil, fmt.Errorf("invalid ban target %q", target)
+}
+
+// add bans target for the given duration. Zero duration bans permanently.
+func (bl *banList) add(target string, d time.Duration) error {
+	key, e, err := parseBanTarget(target)
+	if err != nil {
+		return err
+	}
+	if d > 0 {
+		e.until = bl.now().Add(d)
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.entries[key] = e
+	return bl.db.StoreBan(key, e.until)
+}
+
+// remove lifts the ban of target. It returns false if target wasn't banned.
+func (bl *banList) remove(target string) (bool, error) {
+	key, _, err := parseBanTarget(target)
+	if err != nil {
+		return false, err
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	if _, ok := bl.entries[key]; !ok {
+		return false, nil
+	}
+	delete(bl.entries, key)
+	return true, bl.db.DeleteBan(key)
+}
+
+// list returns the active bans, sorted by target.
+func (bl *banList) list() []Ban {
+	if bl == nil {
+		return nil
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.expire()
+	bans := make([]Ban, 0, len(bl.entries))
+	for key, e := range bl.entries {
+		bans = append(bans, Ban{Target: key, Until: e.until})
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Target < bans[j].Target })
+	return bans
+}
+
+// isBanned reports whether the node or IP is banned. The IP may be nil.
+func (bl *banList) isBanned(id enode.ID, ip net.IP) bool {
+	if bl == nil {
+		return false
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.expire()
+	for _, e := range bl.entries {
+		if e.matches(id, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBannedIP reports whether the IP is banned.
+func (bl *banList) isBannedIP(ip net.IP) bool {
+	if bl == nil {
+		return false
+	}
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.expire()
+	for _, e := range bl.entries {
+		if e.net != nil && e.net.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// expire removes bans that have run out. The lock must be held.
+func (bl *banList) expire() {
+	now := bl.now()
+	for key, e := range bl.entries {
+		if !e.until.IsZero() && !now.Before(e.until) {
+			delete(bl.entries, key)
+			bl.db.DeleteBan(key)
+		}
+	}
+}
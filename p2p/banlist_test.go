@@ -0,0 +1,137 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func TestParseBanTarget(t *testing.T) {
+	key := newkey()
+	id := enode.PubkeyToIDV4(&key.PublicKey)
+	url := enode.NewV4(&key.PublicKey, net.IP{10, 0, 0, 1}, 30303, 30303).URLv4()
+
+	tests := []struct {
+		target, want string
+	}{
+		{url, id.String()},
+		{id.String(), id.String()},
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"10.0.0.1/24", "10.0.0.0/24"},
+		{"2001:db8::1", "2001:db8::1/128"},
+		{"2001:db8::1/64", "2001:db8::/64"},
+		{"foo", ""},
+		{"10.0.0.1/33", ""},
+		{"enode://1234@10.0.0.1:30303", ""},
+	}
+	for _, test := range tests {
+		key, _, err := parseBanTarget(test.target)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected error, got %q", test.target, key)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.target, err)
+		} else if key != test.want {
+			t.Errorf("%q: wrong key %q, want %q", test.target, key, test.want)
+		}
+	}
+}
+
+func TestBanList(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	now := time.Unix(1000000, 0)
+	bl := newBanList(db)
+	bl.now = func() time.Time { return now }
+
+	var (
+		key = newkey()
+		id  = enode.PubkeyToIDV4(&key.PublicKey)
+		ip  = net.IP{10, 0, 0, 1}
+	)
+	if err := bl.add(id.String(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.add("10.0.0.0/24", 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bl.isBanned(id, nil) {
+		t.Error("banned node not detected")
+	}
+	if !bl.isBanned(enode.ID{}, ip) || !bl.isBannedIP(ip) {
+		t.Error("banned network not detected")
+	}
+	if bl.isBannedIP(net.IP{10, 0, 1, 1}) {
+		t.Error("IP outside of banned network is banned")
+	}
+
+	// Bans are restored from the database.
+	bl2 := newBanList(db)
+	bl2.now = bl.now
+	want := []Ban{{Target: "10.0.0.0/24"}, {Target: id.String(), Until: now.Add(time.Hour)}}
+	if bans := bl2.list(); len(bans) != len(want) || bans[0] != want[0] || !bans[1].Until.Equal(want[1].Until) || bans[1].Target != want[1].Target {
+		t.Fatalf("wrong bans after reload: %v", bans)
+	}
+
+	// Temporary bans expire, permanent bans must be removed.
+	now = now.Add(time.Hour)
+	if bl.isBanned(id, nil) {
+		t.Error("ban did not expire")
+	}
+	if ok, err := bl.remove("10.0.0.1/24"); !ok || err != nil {
+		t.Errorf("remove failed: %v %v", ok, err)
+	}
+	if ok, _ := bl.remove("10.0.0.1/24"); ok {
+		t.Error("removed ban twice")
+	}
+	if bans := bl.list(); len(bans) != 0 {
+		t.Errorf("bans left: %v", bans)
+	}
+	if bans := db.Bans(); len(bans) != 0 {
+		t.Errorf("bans left in database: %v", bans)
+	}
+}
+
+func TestDialStateBans(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+
+	key := newkey()
+	n := enode.NewV4(&key.PublicKey, net.IP{10, 0, 0, 1}, 30303, 30303)
+	s := newDialState(enode.ID{}, 10, &Config{})
+	s.bans = newBanList(db)
+	if err := s.checkDial(n, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.bans.add("10.0.0.1", 0)
+	if err := s.checkDial(n, nil); err != errBanned {
+		t.Fatalf("wrong error for banned IP: %v", err)
+	}
+	s.bans.remove("10.0.0.1")
+	s.bans.add(n.URLv4(), time.Minute)
+	if err := s.checkDial(n, nil); err != errBanned {
+		t.Fatalf("wrong error for banned node: %v", err)
+	}
+}
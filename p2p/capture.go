@@ -0,0 +1,233 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+const (
+	defaultCaptureFileSize = 64 * 1024 * 1024 // rotation size if CaptureFileSize is zero
+	captureBackups         = 3                // number of rotated capture files kept
+)
+
+// Message directions in capture records.
+const (
+	CaptureInbound  = "in"  // message received from the peer
+	CaptureOutbound = "out" // message sent to the peer
+)
+
+// CaptureRecord is a protocol message recorded in capture mode. Capture files
+// contain one JSON-encoded record per line.
+type CaptureRecord struct {
+	Time      time.Time     `json:"time"`
+	Peer      enode.ID      `json:"peer"`
+	Protocol  string        `json:"protocol"` // name/version, e.g. eth/65
+	Direction string        `json:"dir"`
+	Code      uint64        `json:"code"` // relative to the protocol offset
+	Size      uint32        `json:"size"`
+	Payload   hexutil.Bytes `json:"payload"`
+}
+
+// Msg returns the recorded message.
+func (r *CaptureRecord) Msg() Msg {
+	return Msg{Code: r.Code, Size: uint32(len(r.Payload)), Payload: bytes.NewReader(r.Payload), ReceivedAt: r.Time}
+}
+
+// ReadCapture reads all records of a capture file.
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var (
+		records []CaptureRecord
+		dec     = json.NewDecoder(bufio.NewReader(r))
+	)
+	for {
+		var rec CaptureRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, fmt.Errorf("invalid capture record %d: %v", len(records), err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// captureWriter appends capture records to a file, rotating it when it grows
+// beyond maxSize. Rotated files get the suffixes .1, .2, ... with .1 being the
+// most recent one.
+type captureWriter struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	size    int64
+	file    *os.File
+	failed  bool // set after a write error has been logged
+}
+
+var errCaptureClosed = errors.New("capture file closed")
+
+func newCaptureWriter(path string, maxSize int64) (*captureWriter, error) {
+	if maxSize <= 0 {
+		maxSize = defaultCaptureFileSize
+	}
+	w := &captureWriter{path: path, maxSize: maxSize}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *captureWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.size = f, info.Size()
+	return nil
+}
+
+func (w *captureWriter) rotate() error {
+	w.file.Close()
+	w.file = nil
+	for i := captureBackups - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *captureWriter) write(rec *CaptureRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return errCaptureClosed
+	}
+	if w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	if err == nil {
+		w.failed = false
+	}
+	return err
+}
+
+// logError logs a write error. Errors are only logged once until a write
+// succeeds again, so a full disk doesn't flood the log.
+func (w *captureWriter) logError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.failed {
+		w.failed = true
+		log.Error("Failed to write capture record", "path", w.path, "err", err)
+	}
+}
+
+func (w *captureWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// msgCapturer wraps a MsgReadWriter and records all messages which pass
+// through it.
+type msgCapturer struct {
+	MsgReadWriter
+
+	w      *captureWriter
+	peerID enode.ID
+	proto  string
+}
+
+func newMsgCapturer(rw MsgReadWriter, w *captureWriter, peerID enode.ID, proto string) *msgCapturer {
+	return &msgCapturer{MsgReadWriter: rw, w: w, peerID: peerID, proto: proto}
+}
+
+// ReadMsg reads a message from the underlying MsgReadWriter and records it.
+func (c *msgCapturer) ReadMsg() (Msg, error) {
+	msg, err := c.MsgReadWriter.ReadMsg()
+	if err != nil {
+		return msg, err
+	}
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return msg, err
+	}
+	msg.Payload = bytes.NewReader(payload)
+	c.record(msg.ReceivedAt, CaptureInbound, msg.Code, payload)
+	return msg, nil
+}
+
+// WriteMsg records a message and writes it to the underlying MsgReadWriter.
+func (c *msgCapturer) WriteMsg(msg Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Payload = bytes.NewReader(payload)
+	c.record(time.Now(), CaptureOutbound, msg.Code, payload)
+	return c.MsgReadWriter.WriteMsg(msg)
+}
+
+func (c *msgCapturer) record(t time.Time, dir string, code uint64, payload []byte) {
+	err := c.w.write(&CaptureRecord{
+		Time:      t,
+		Peer:      c.peerID,
+		Protocol:  c.proto,
+		Direction: dir,
+		Code:      code,
+		Size:      uint32(len(payload)),
+		Payload:   payload,
+	})
+	// Peers may still exchange messages while the server shuts down.
+	if err != nil && err != errCaptureClosed {
+		c.w.logError(err)
+	}
+}
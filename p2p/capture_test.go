@@ -0,0 +1,150 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+func readCaptureFile(t *testing.T, path string) []CaptureRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := ReadCapture(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestMsgCapturer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture")
+	w, err := newCaptureWriter(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		id           = enode.ID{1}
+		local, other = MsgPipe()
+		rw           = newMsgCapturer(local, w, id, "test/1")
+	)
+	defer local.Close()
+	go func() {
+		Send(other, 3, []uint{1, 2})
+		ExpectMsg(other, 4, "reply")
+	}()
+	if err := ExpectMsg(rw, 3, []uint{1, 2}); err != nil {
+		t.Fatal("inbound message corrupted:", err)
+	}
+	if err := Send(rw, 4, "reply"); err != nil {
+		t.Fatal(err)
+	}
+	w.close()
+
+	records := readCaptureFile(t, path)
+	if len(records) != 2 {
+		t.Fatalf("wrong number of records: %d", len(records))
+	}
+	want := []struct {
+		dir     string
+		code    uint64
+		payload []byte
+	}{
+		{CaptureInbound, 3, []byte{0xc2, 0x01, 0x02}},
+		{CaptureOutbound, 4, []byte{0x85, 'r', 'e', 'p', 'l', 'y'}},
+	}
+	for i, rec := range records {
+		if rec.Peer != id || rec.Protocol != "test/1" {
+			t.Errorf("record %d: wrong peer/protocol %v %s", i, rec.Peer, rec.Protocol)
+		}
+		if rec.Direction != want[i].dir || rec.Code != want[i].code || !bytes.Equal(rec.Payload, want[i].payload) {
+			t.Errorf("record %d: got %s code %d payload %x, want %s code %d payload %x", i, rec.Direction, rec.Code, []byte(rec.Payload), want[i].dir, want[i].code, want[i].payload)
+		}
+		if int(rec.Size) != len(rec.Payload) {
+			t.Errorf("record %d: wrong size %d", i, rec.Size)
+		}
+	}
+}
+
+func TestCaptureRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "capture")
+	w, err := newCaptureWriter(path, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 50
+	for i := 0; i < n; i++ {
+		rec := &CaptureRecord{Code: uint64(i), Direction: CaptureInbound, Payload: make([]byte, 20)}
+		if err := w.write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.close()
+
+	// The newest records must be in the current file, older ones in the backups.
+	var files []string
+	for i := captureBackups; i > 0; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", path, i))
+	}
+	files = append(files, path)
+	next := uint64(0)
+	for i, file := range files {
+		records := readCaptureFile(t, file)
+		if len(records) == 0 {
+			t.Fatalf("%s is empty", file)
+		}
+		if i == 0 {
+			next = records[0].Code
+		}
+		for _, rec := range records {
+			if rec.Code != next {
+				t.Fatalf("%s: got record %d, want %d", file, rec.Code, next)
+			}
+			next++
+		}
+		if info, _ := os.Stat(file); info.Size() > 500 {
+			t.Errorf("%s exceeds the size limit: %d", file, info.Size())
+		}
+	}
+	if next != n {
+		t.Errorf("last record is %d, want %d", next-1, n-1)
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, captureBackups+1)); !os.IsNotExist(err) {
+		t.Errorf("too many backups kept")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
@@ -71,6 +72,8 @@ type dialstate struct {
 	netrestrict *netutil.Netlist
 	self        enode.ID
 	bootnodes   []*enode.Node // default dials when there are no peers
+	rep         *reputation   // optional, used to skip banned and prefer good nodes
+	bans        *banList      // optional, nodes and networks which are never dialed
 	log         log.Logger
 
 	start         time.Time // time when the dialer was first used
@@ -131,7 +134,7 @@ func (s *dialstate) newTasks(nRunning int, peers map[enode.ID]*Peer, now time.Ti
 	if s.start.IsZero() {
 		s.start = now
 	}
-	s.hist.expire(now)
+	s.hist.expire(now, nil)
 
 	// Create dials for static nodes if they are not connected.
 	for id, t := range s.static {
@@ -203,6 +206,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errBanned           = errors.New("banned")
 )
 
 func (s *dialstate) checkDial(n *enode.Node, peers map[enode.ID]*Peer) error {
@@ -216,6 +220,8 @@ func (s *dialstate) checkDial(n *enode.Node, peers map[enode.ID]*Peer) error {
 		return errSelf
 	case s.netrestrict != nil && !s.netrestrict.Contains(n.IP()):
 		return errNotWhitelisted
+	case s.rep.isBanned(n.ID()) || s.bans.isBanned(n.ID(), n.IP()):
+		return errBanned
 	case s.hist.contains(string(n.ID().Bytes())):
 		return errRecentlyDialed
 	}
@@ -230,9 +236,25 @@ func (s *dialstate) taskDone(t task, now time.Time) {
 	case *discoverTask:
 		s.lookupRunning = false
 		s.lookupBuf = append(s.lookupBuf, t.results...)
+		s.sortLookupBuf()
 	}
 }
 
+// sortLookupBuf orders the discovery results by reputation, so that nodes
+// which served us well in the past are dialed first.
+func (s *dialstate) sortLookupBuf() {
+	if s.rep == nil {
+		return
+	}
+	scores := make(map[enode.ID]int64, len(s.lookupBuf))
+	for _, n := range s.lookupBuf {
+		scores[n.ID()] = s.rep.score(n.ID())
+	}
+	sort.SliceStable(s.lookupBuf, func(i, j int) bool {
+		return scores[s.lookupBuf[i].ID()] > scores[s.lookupBuf[j].ID()]
+	})
+}
+
 // A dialTask is generated for each node that is dialed. Its
 // fields cannot be accessed while the task is running.
 type dialTask struct {
@@ -0,0 +1,954 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Discovery v5 packet types.
+const (
+	p_pingV5 byte = iota + 1
+	p_pongV5
+	p_findnodeV5
+	p_nodesV5
+	p_talkreqV5
+	p_talkrespV5
+	p_unknownV5   = byte(255) // any non-decryptable packet
+	p_whoareyouV5 = byte(254) // the WHOAREYOU packet
+)
+
+// Discovery v5 packet structures.
+type (
+	// unknownV5 represents any packet that can't be decrypted.
+	unknownV5 struct {
+		Nonce v5Nonce
+	}
+
+	// whoareyouV5 contains the handshake challenge.
+	whoareyouV5 struct {
+		ChallengeData []byte   // encoded challenge, the unmasked packet header
+		Nonce         v5Nonce  // nonce of the request packet
+		IDNonce       [16]byte // identity proof data
+		RecordSeq     uint64   // ENR sequence number of the recipient
+
+		// node is the locally known node record of the recipient.
+		// This must be set by the caller of encode.
+		node *enode.Node
+
+		sent mclock.AbsTime // for handshake GC
+	}
+
+	// pingV5 is sent during liveness checks.
+	pingV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+	}
+
+	// pongV5 is the reply to pingV5.
+	pongV5 struct {
+		ReqID  []byte
+		ENRSeq uint64
+		ToIP   net.IP // These fields should mirror the UDP envelope address of the ping
+		ToPort uint16 // packet, which provides a way to discover the the external address (after NAT).
+	}
+
+	// findnodeV5 is a query for nodes at the given log-distances.
+	findnodeV5 struct {
+		ReqID     []byte
+		Distances []uint
+	}
+
+	// nodesV5 is the reply to findnodeV5.
+	nodesV5 struct {
+		ReqID []byte
+		Total uint8
+		Nodes []*enr.Record
+	}
+
+	// talkreqV5 is an application-level request.
+	talkreqV5 struct {
+		ReqID    []byte
+		Protocol string
+		Message  []byte
+	}
+
+	// talkrespV5 is the reply to talkreqV5.
+	talkrespV5 struct {
+		ReqID   []byte
+		Message []byte
+	}
+)
+
+func (*unknownV5) name() string      { return "UNKNOWN/v5" }
+func (*unknownV5) kind() byte        { return p_unknownV5 }
+func (*unknownV5) reqid() []byte     { return nil }
+func (*unknownV5) setreqid([]byte)   {}
+func (*whoareyouV5) name() string    { return "WHOAREYOU/v5" }
+func (*whoareyouV5) kind() byte      { return p_whoareyouV5 }
+func (*whoareyouV5) reqid() []byte   { return nil }
+func (*whoareyouV5) setreqid([]byte) {}
+
+func (*pingV5) name() string             { return "PING/v5" }
+func (*pingV5) kind() byte               { return p_pingV5 }
+func (p *pingV5) reqid() []byte          { return p.ReqID }
+func (p *pingV5) setreqid(id []byte)     { p.ReqID = id }
+func (*pongV5) name() string             { return "PONG/v5" }
+func (*pongV5) kind() byte               { return p_pongV5 }
+func (p *pongV5) reqid() []byte          { return p.ReqID }
+func (p *pongV5) setreqid(id []byte)     { p.ReqID = id }
+func (*findnodeV5) name() string         { return "FINDNODE/v5" }
+func (*findnodeV5) kind() byte           { return p_findnodeV5 }
+func (p *findnodeV5) reqid() []byte      { return p.ReqID }
+func (p *findnodeV5) setreqid(id []byte) { p.ReqID = id }
+func (*nodesV5) name() string            { return "NODES/v5" }
+func (*nodesV5) kind() byte              { return p_nodesV5 }
+func (p *nodesV5) reqid() []byte         { return p.ReqID }
+func (p *nodesV5) setreqid(id []byte)    { p.ReqID = id }
+func (*talkreqV5) name() string          { return "TALKREQ/v5" }
+func (*talkreqV5) kind() byte            { return p_talkreqV5 }
+func (p *talkreqV5) reqid() []byte       { return p.ReqID }
+func (p *talkreqV5) setreqid(id []byte)  { p.ReqID = id }
+func (*talkrespV5) name() string         { return "TALKRESP/v5" }
+func (*talkrespV5) kind() byte           { return p_talkrespV5 }
+func (p *talkrespV5) reqid() []byte      { return p.ReqID }
+func (p *talkrespV5) setreqid(id []byte) { p.ReqID = id }
+
+// Packet header flag values.
+const (
+	flagMessageV5 byte = iota
+	flagWhoareyouV5
+	flagHandshakeV5
+)
+
+// Protocol constants.
+const (
+	protocolVersionV5 = 1
+	sizeofMaskingIV   = 16
+
+	minMessageSizeV5      = 48 // size of message data following the static header
+	randomPacketMsgSizeV5 = 20 // size of the message data of random packets
+	maxReqIDSizeV5        = 8  // request IDs must not be longer than this
+
+	aesKeySizeV5   = 16
+	gcmNonceSizeV5 = 12
+)
+
+var protocolIDV5 = [6]byte{'d', 'i', 's', 'c', 'v', '5'}
+
+// Errors.
+var (
+	errTooShortV5          = errors.New("packet too short")
+	errInvalidHeader       = errors.New("invalid packet header")
+	errInvalidFlag         = errors.New("invalid flag value in header")
+	errMinVersion          = errors.New("version of packet header below minimum")
+	errMsgTooShort         = errors.New("message/handshake packet below minimum size")
+	errAuthSize            = errors.New("declared auth size is beyond packet length")
+	errUnexpectedHandshake = errors.New("unexpected auth response, not in handshake")
+	errInvalidAuthKey      = errors.New("invalid ephemeral pubkey")
+	errNoRecord            = errors.New("expected ENR in handshake but none sent")
+	errInvalidNonceSig     = errors.New("invalid ID nonce signature")
+	errMessageTooShort     = errors.New("message contains no data")
+	errMessageDecrypt      = errors.New("cannot decrypt message")
+	errInvalidReqID        = errors.New("request ID larger than 8 bytes")
+)
+
+// v5Nonce is the nonce of a message packet, used as the AES-GCM nonce.
+type v5Nonce [gcmNonceSizeV5]byte
+
+// v5Header is the header of a discovery v5 packet.
+type v5Header struct {
+	IV [sizeofMaskingIV]byte
+	v5StaticHeader
+	AuthData []byte
+
+	src enode.ID // used by decoder
+}
+
+// v5StaticHeader contains the fixed-size fields of a packet header.
+type v5StaticHeader struct {
+	ProtocolID [6]byte
+	Version    uint16
+	Flag       byte
+	Nonce      v5Nonce
+	AuthSize   uint16
+}
+
+// Authdata layouts.
+type (
+	whoareyouAuthDataV5 struct {
+		IDNonce   [16]byte // ID proof data
+		RecordSeq uint64   // highest known ENR sequence of requester
+	}
+
+	handshakeAuthDataV5 struct {
+		h struct {
+			SrcID      enode.ID
+			SigSize    byte // size of the ID signature
+			PubkeySize byte // size of the ephemeral public key
+		}
+		// Trailing variable-size data.
+		signature, pubkey, record []byte
+	}
+
+	messageAuthDataV5 struct {
+		SrcID enode.ID
+	}
+)
+
+// Packet sizes.
+var (
+	sizeofStaticHeaderV5      = binary.Size(v5StaticHeader{})
+	sizeofWhoareyouAuthDataV5 = binary.Size(whoareyouAuthDataV5{})
+	sizeofHandshakeAuthDataV5 = binary.Size(handshakeAuthDataV5{}.h)
+	sizeofMessageAuthDataV5   = binary.Size(messageAuthDataV5{})
+	sizeofStaticPacketDataV5  = sizeofMaskingIV + sizeofStaticHeaderV5
+	minPacketSizeV5           = sizeofStaticPacketDataV5 + sizeofWhoareyouAuthDataV5
+)
+
+// wireCodec encodes and decodes discovery v5 packets.
+// This type is not safe for concurrent use.
+type wireCodec struct {
+	sha256    hash.Hash
+	localnode *enode.LocalNode
+	privkey   *ecdsa.PrivateKey
+	sc        *sessionCache
+
+	// encoder buffers
+	buf      bytes.Buffer // whole packet
+	headbuf  bytes.Buffer // packet header
+	msgbuf   bytes.Buffer // message RLP plaintext
+	msgctbuf []byte       // message data ciphertext
+
+	// decoder buffer
+	reader bytes.Reader
+}
+
+// newWireCodec creates a wire codec.
+func newWireCodec(ln *enode.LocalNode, key *ecdsa.PrivateKey, clock mclock.Clock) *wireCodec {
+	return &wireCodec{
+		sha256:    sha256.New(),
+		localnode: ln,
+		privkey:   key,
+		sc:        newSessionCache(1024, clock),
+	}
+}
+
+// encode encodes a packet to a node. 'id' and 'addr' specify the destination node. The
+// 'challenge' parameter should be the most recently received WHOAREYOU packet from that
+// node.
+func (c *wireCodec) encode(id enode.ID, addr string, packet packetV5, challenge *whoareyouV5) ([]byte, v5Nonce, error) {
+	// Create the packet header.
+	var (
+		head    v5Header
+		session *session
+		msgData []byte
+		err     error
+	)
+	switch {
+	case packet.kind() == p_whoareyouV5:
+		head, err = c.encodeWhoareyou(id, packet.(*whoareyouV5))
+	case challenge != nil:
+		if s := c.sc.tieBreakSession(c.localnode.ID(), id, addr); s != nil && !s.initiator {
+			// The remote node's handshake crossed with the one we're about to
+			// send and won the tie-break. Use its session instead.
+			session = s
+			head, err = c.encodeMessageHeader(id, session)
+			break
+		}
+		// We have an unanswered challenge, send handshake.
+		head, session, err = c.encodeHandshakeHeader(id, addr, challenge)
+	default:
+		// Renew the session keys if they have been used for too many packets. This is
+		// only done for requests because they are resent after the handshake.
+		if isRequestV5(packet) {
+			c.sc.expireSession(id, addr)
+		}
+		session = c.sc.session(id, addr)
+		if session != nil {
+			// There is a session, use it.
+			head, err = c.encodeMessageHeader(id, session)
+		} else {
+			// No keys, send random data to kick off the handshake.
+			head, msgData, err = c.encodeRandom(id)
+		}
+	}
+	if err != nil {
+		return nil, v5Nonce{}, err
+	}
+
+	// Generate masking IV.
+	if err := c.sc.maskingIVGen(head.IV[:]); err != nil {
+		return nil, v5Nonce{}, fmt.Errorf("can't generate masking IV: %v", err)
+	}
+
+	// Encode header data.
+	c.writeHeaders(&head)
+
+	// Store sent WHOAREYOU challenges.
+	if challenge, ok := packet.(*whoareyouV5); ok {
+		challenge.ChallengeData = bytesCopy(&c.buf)
+		c.sc.storeSentHandshake(id, addr, challenge)
+	} else if msgData == nil {
+		headerData := c.buf.Bytes()
+		msgData, err = c.encryptMessage(session, packet, &head, headerData)
+		if err != nil {
+			return nil, v5Nonce{}, err
+		}
+	}
+	return c.encodeRaw(id, head, msgData), head.Nonce, nil
+}
+
+// isRequestV5 reports whether p is a request packet.
+func isRequestV5(p packetV5) bool {
+	switch p.kind() {
+	case p_pingV5, p_findnodeV5, p_talkreqV5:
+		return true
+	}
+	return false
+}
+
+// encodeRaw masks the given header and appends the message data.
+func (c *wireCodec) encodeRaw(id enode.ID, head v5Header, msgdata []byte) []byte {
+	c.writeHeaders(&head)
+
+	// Apply masking.
+	masked := c.buf.Bytes()[sizeofMaskingIV:]
+	mask := head.mask(id)
+	mask.XORKeyStream(masked, masked)
+
+	// Write message data.
+	c.buf.Write(msgdata)
+	return bytesCopy(&c.buf)
+}
+
+func (c *wireCodec) writeHeaders(head *v5Header) {
+	c.buf.Reset()
+	c.buf.Write(head.IV[:])
+	binary.Write(&c.buf, binary.BigEndian, &head.v5StaticHeader)
+	c.buf.Write(head.AuthData)
+}
+
+// makeHeader creates a packet header.
+func (c *wireCodec) makeHeader(flag byte, authsizeExtra int) v5Header {
+	var authsize int
+	switch flag {
+	case flagMessageV5:
+		authsize = sizeofMessageAuthDataV5
+	case flagWhoareyouV5:
+		authsize = sizeofWhoareyouAuthDataV5
+	case flagHandshakeV5:
+		authsize = sizeofHandshakeAuthDataV5
+	default:
+		panic(fmt.Errorf("BUG: invalid packet header flag %x", flag))
+	}
+	authsize += authsizeExtra
+	if authsize > int(^uint16(0)) {
+		panic(fmt.Errorf("BUG: auth size %d overflows uint16", authsize))
+	}
+	return v5Header{
+		v5StaticHeader: v5StaticHeader{
+			ProtocolID: protocolIDV5,
+			Version:    protocolVersionV5,
+			Flag:       flag,
+			AuthSize:   uint16(authsize),
+		},
+	}
+}
+
+// encodeRandom encodes a packet with random content.
+func (c *wireCodec) encodeRandom(toID enode.ID) (v5Header, []byte, error) {
+	head := c.makeHeader(flagMessageV5, 0)
+
+	// Encode auth data.
+	auth := messageAuthDataV5{SrcID: c.localnode.ID()}
+	if _, err := crand.Read(head.Nonce[:]); err != nil {
+		return head, nil, fmt.Errorf("can't get random data: %v", err)
+	}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, auth)
+	head.AuthData = c.headbuf.Bytes()
+
+	// Fill message ciphertext buffer with random bytes.
+	c.msgctbuf = append(c.msgctbuf[:0], make([]byte, randomPacketMsgSizeV5)...)
+	crand.Read(c.msgctbuf)
+	return head, c.msgctbuf, nil
+}
+
+// encodeWhoareyou encodes a WHOAREYOU packet.
+func (c *wireCodec) encodeWhoareyou(toID enode.ID, packet *whoareyouV5) (v5Header, error) {
+	// Sanity check node field to catch misbehaving callers.
+	if packet.RecordSeq > 0 && packet.node == nil {
+		panic("BUG: missing node in whoareyou with non-zero seq")
+	}
+
+	// Create header.
+	head := c.makeHeader(flagWhoareyouV5, 0)
+	head.Nonce = packet.Nonce
+
+	// Encode auth data.
+	auth := &whoareyouAuthDataV5{
+		IDNonce:   packet.IDNonce,
+		RecordSeq: packet.RecordSeq,
+	}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, auth)
+	head.AuthData = c.headbuf.Bytes()
+	return head, nil
+}
+
+// encodeHandshakeHeader encodes the handshake message packet header.
+func (c *wireCodec) encodeHandshakeHeader(toID enode.ID, addr string, challenge *whoareyouV5) (v5Header, *session, error) {
+	// Ensure calling code sets challenge.node.
+	if challenge.node == nil {
+		panic("BUG: missing challenge.node in encode")
+	}
+
+	// Generate new secrets.
+	auth, session, err := c.makeHandshakeAuth(toID, addr, challenge)
+	if err != nil {
+		return v5Header{}, nil, err
+	}
+
+	// Generate nonce for message.
+	nonce, err := c.sc.nextNonce(session)
+	if err != nil {
+		return v5Header{}, nil, fmt.Errorf("can't generate nonce: %v", err)
+	}
+
+	// The session is stored right away, the recipient will have the same keys
+	// once it has verified the handshake.
+	session.initiator = true
+	c.sc.storeNewSession(toID, addr, session)
+
+	// Encode the auth header.
+	var (
+		authsizeExtra = len(auth.pubkey) + len(auth.signature) + len(auth.record)
+		head          = c.makeHeader(flagHandshakeV5, authsizeExtra)
+	)
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, &auth.h)
+	c.headbuf.Write(auth.signature)
+	c.headbuf.Write(auth.pubkey)
+	c.headbuf.Write(auth.record)
+	head.AuthData = c.headbuf.Bytes()
+	head.Nonce = nonce
+	return head, session, err
+}
+
+// makeHandshakeAuth creates the auth header on a request packet following WHOAREYOU.
+func (c *wireCodec) makeHandshakeAuth(toID enode.ID, addr string, challenge *whoareyouV5) (*handshakeAuthDataV5, *session, error) {
+	auth := new(handshakeAuthDataV5)
+	auth.h.SrcID = c.localnode.ID()
+
+	// Create the ephemeral key. This needs to be first because the
+	// key is part of the ID nonce signature.
+	var remotePubkey = new(ecdsa.PublicKey)
+	if err := challenge.node.Load((*enode.Secp256k1)(remotePubkey)); err != nil {
+		return nil, nil, fmt.Errorf("can't find secp256k1 key for recipient")
+	}
+	ephkey, err := c.sc.ephemeralKeyGen()
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't generate ephemeral key")
+	}
+	ephpubkey := encodePubkeyV5(&ephkey.PublicKey)
+	auth.pubkey = ephpubkey
+	auth.h.PubkeySize = byte(len(auth.pubkey))
+
+	// Add ID nonce signature to response.
+	cdata := challenge.ChallengeData
+	idsig, err := makeIDSignature(c.sha256, c.privkey, cdata, ephpubkey, toID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't sign: %v", err)
+	}
+	auth.signature = idsig
+	auth.h.SigSize = byte(len(auth.signature))
+
+	// Add our record to response if it's newer than what remote side has.
+	ln := c.localnode.Node()
+	if challenge.RecordSeq < ln.Seq() {
+		auth.record, _ = rlp.EncodeToBytes(ln.Record())
+	}
+
+	// Create session keys.
+	sec := deriveKeys(sha256.New, ephkey, remotePubkey, c.localnode.ID(), challenge.node.ID(), cdata)
+	if sec == nil {
+		return nil, nil, fmt.Errorf("key derivation failed")
+	}
+	return auth, sec, err
+}
+
+// encodeMessageHeader encodes the header of an encrypted message packet.
+func (c *wireCodec) encodeMessageHeader(toID enode.ID, s *session) (v5Header, error) {
+	head := c.makeHeader(flagMessageV5, 0)
+
+	nonce, err := c.sc.nextNonce(s)
+	if err != nil {
+		return v5Header{}, fmt.Errorf("can't generate nonce: %v", err)
+	}
+	auth := messageAuthDataV5{SrcID: c.localnode.ID()}
+	c.headbuf.Reset()
+	binary.Write(&c.headbuf, binary.BigEndian, &auth)
+	head.AuthData = bytesCopy(&c.headbuf)
+	head.Nonce = nonce
+	return head, err
+}
+
+// encryptMessage encrypts the message using the write key of the session.
+func (c *wireCodec) encryptMessage(s *session, p packetV5, head *v5Header, headerData []byte) ([]byte, error) {
+	// Encode message plaintext.
+	c.msgbuf.Reset()
+	c.msgbuf.WriteByte(p.kind())
+	if err := rlp.Encode(&c.msgbuf, p); err != nil {
+		return nil, err
+	}
+	messagePT := c.msgbuf.Bytes()
+
+	// Encrypt into message ciphertext buffer.
+	messageCT, err := encryptGCM(c.msgctbuf[:0], s.writeKey, head.Nonce[:], messagePT, headerData)
+	if err == nil {
+		c.msgctbuf = messageCT
+	}
+	return messageCT, err
+}
+
+// decode decodes a discovery packet. Note that the header of the input is unmasked
+// in place.
+func (c *wireCodec) decode(input []byte, addr string) (src enode.ID, n *enode.Node, p packetV5, err error) {
+	if len(input) < minPacketSizeV5 {
+		return enode.ID{}, nil, nil, errTooShortV5
+	}
+	// Unmask the static header.
+	var head v5Header
+	copy(head.IV[:], input[:sizeofMaskingIV])
+	mask := head.mask(c.localnode.ID())
+	staticHeader := input[sizeofMaskingIV:sizeofStaticPacketDataV5]
+	mask.XORKeyStream(staticHeader, staticHeader)
+
+	// Decode and verify the static header.
+	c.reader.Reset(staticHeader)
+	binary.Read(&c.reader, binary.BigEndian, &head.v5StaticHeader)
+	remainingInput := len(input) - sizeofStaticPacketDataV5
+	if err := head.checkValid(remainingInput); err != nil {
+		return enode.ID{}, nil, nil, err
+	}
+
+	// Unmask auth data.
+	authDataEnd := sizeofStaticPacketDataV5 + int(head.AuthSize)
+	authData := input[sizeofStaticPacketDataV5:authDataEnd]
+	mask.XORKeyStream(authData, authData)
+	head.AuthData = authData
+
+	// Delete timed-out handshakes. This must happen before decoding to avoid
+	// processing the same handshake twice.
+	c.sc.handshakeGC()
+
+	// Decode auth part and message.
+	headerData := input[:authDataEnd]
+	msgData := input[authDataEnd:]
+	switch head.Flag {
+	case flagWhoareyouV5:
+		p, err = c.decodeWhoareyou(&head, headerData)
+	case flagHandshakeV5:
+		n, p, err = c.decodeHandshakeMessage(addr, &head, headerData, msgData)
+	case flagMessageV5:
+		p, err = c.decodeMessage(addr, &head, headerData, msgData)
+	default:
+		err = errInvalidFlag
+	}
+	return head.src, n, p, err
+}
+
+// decodeWhoareyou reads the authdata of a WHOAREYOU packet.
+func (c *wireCodec) decodeWhoareyou(head *v5Header, headerData []byte) (packetV5, error) {
+	if len(head.AuthData) != sizeofWhoareyouAuthDataV5 {
+		return nil, fmt.Errorf("invalid auth size %d for WHOAREYOU", len(head.AuthData))
+	}
+	var auth whoareyouAuthDataV5
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth)
+	p := &whoareyouV5{
+		Nonce:         head.Nonce,
+		IDNonce:       auth.IDNonce,
+		RecordSeq:     auth.RecordSeq,
+		ChallengeData: make([]byte, len(headerData)),
+	}
+	copy(p.ChallengeData, headerData)
+	return p, nil
+}
+
+// decodeHandshakeMessage verifies a handshake and decrypts the message it carries.
+func (c *wireCodec) decodeHandshakeMessage(fromAddr string, head *v5Header, headerData, msgData []byte) (n *enode.Node, p packetV5, err error) {
+	node, auth, session, err := c.decodeHandshake(fromAddr, head)
+	if err != nil {
+		c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+		return nil, nil, err
+	}
+
+	// Decrypt the message using the new session keys.
+	msg, err := c.decryptMessage(msgData, head.Nonce[:], headerData, session.readKey)
+	if err != nil {
+		c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+		return node, msg, err
+	}
+
+	// Handshake OK, drop the challenge and store the new session keys. If our own
+	// handshake crossed with this one and won the tie-break, keep its session. The
+	// remote node will switch to it when our handshake arrives.
+	if s := c.sc.tieBreakSession(c.localnode.ID(), auth.h.SrcID, fromAddr); s == nil || !s.initiator {
+		c.sc.storeNewSession(auth.h.SrcID, fromAddr, session)
+	}
+	c.sc.deleteHandshake(auth.h.SrcID, fromAddr)
+	return node, msg, nil
+}
+
+func (c *wireCodec) decodeHandshake(fromAddr string, head *v5Header) (n *enode.Node, auth handshakeAuthDataV5, s *session, err error) {
+	if auth, err = c.decodeHandshakeAuthData(head); err != nil {
+		return nil, auth, nil, err
+	}
+
+	// Verify against our last WHOAREYOU.
+	challenge := c.sc.getHandshake(auth.h.SrcID, fromAddr)
+	if challenge == nil {
+		return nil, auth, nil, errUnexpectedHandshake
+	}
+	// Get node record.
+	n, err = c.decodeHandshakeRecord(challenge.node, auth.h.SrcID, auth.record)
+	if err != nil {
+		return nil, auth, nil, err
+	}
+	// Verify ID nonce signature.
+	cdata := challenge.ChallengeData
+	err = verifyIDSignature(c.sha256, auth.signature, n, cdata, auth.pubkey, c.localnode.ID())
+	if err != nil {
+		return nil, auth, nil, err
+	}
+	// Verify ephemeral key is on curve.
+	ephkey, err := decodePubkeyV5(c.privkey.Curve, auth.pubkey)
+	if err != nil {
+		return nil, auth, nil, errInvalidAuthKey
+	}
+	// Derive session keys.
+	session := deriveKeys(sha256.New, c.privkey, ephkey, auth.h.SrcID, c.localnode.ID(), cdata)
+	if session == nil {
+		return nil, auth, nil, errInvalidAuthKey
+	}
+	return n, auth, session.keysFlipped(), nil
+}
+
+// decodeHandshakeAuthData reads the authdata section of a handshake packet.
+func (c *wireCodec) decodeHandshakeAuthData(head *v5Header) (auth handshakeAuthDataV5, err error) {
+	// Decode fixed size part.
+	if len(head.AuthData) < sizeofHandshakeAuthDataV5 {
+		return auth, fmt.Errorf("header authsize %d too low for handshake", head.AuthSize)
+	}
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth.h)
+	head.src = auth.h.SrcID
+
+	// Decode variable-size part.
+	var (
+		vardata       = head.AuthData[sizeofHandshakeAuthDataV5:]
+		sigAndKeySize = int(auth.h.SigSize) + int(auth.h.PubkeySize)
+		keyOffset     = int(auth.h.SigSize)
+		recOffset     = keyOffset + int(auth.h.PubkeySize)
+	)
+	if len(vardata) < sigAndKeySize {
+		return auth, errTooShortV5
+	}
+	auth.signature = vardata[:keyOffset]
+	auth.pubkey = vardata[keyOffset:recOffset]
+	auth.record = vardata[recOffset:]
+	return auth, nil
+}
+
+// decodeHandshakeRecord verifies the node record contained in a handshake packet. The
+// remote node should include the record if we don't have one or if ours is older than the
+// latest sequence number.
+func (c *wireCodec) decodeHandshakeRecord(local *enode.Node, wantID enode.ID, remote []byte) (*enode.Node, error) {
+	node := local
+	if len(remote) > 0 {
+		var record enr.Record
+		if err := rlp.DecodeBytes(remote, &record); err != nil {
+			return nil, err
+		}
+		if local == nil || local.Seq() < record.Seq() {
+			n, err := enode.New(enode.ValidSchemes, &record)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node record: %v", err)
+			}
+			if n.ID() != wantID {
+				return nil, fmt.Errorf("record in handshake has wrong ID: %v", n.ID())
+			}
+			node = n
+		}
+	}
+	if node == nil {
+		return nil, errNoRecord
+	}
+	return node, nil
+}
+
+// decodeMessage reads packet data following the header.
+func (c *wireCodec) decodeMessage(fromAddr string, head *v5Header, headerData, msgData []byte) (packetV5, error) {
+	if len(head.AuthData) != sizeofMessageAuthDataV5 {
+		return nil, fmt.Errorf("invalid auth size %d for message packet", len(head.AuthData))
+	}
+	var auth messageAuthDataV5
+	c.reader.Reset(head.AuthData)
+	binary.Read(&c.reader, binary.BigEndian, &auth)
+	head.src = auth.SrcID
+
+	// Try decrypting the message.
+	key := c.sc.readKey(auth.SrcID, fromAddr)
+	msg, err := c.decryptMessage(msgData, head.Nonce[:], headerData, key)
+	if err == errMessageDecrypt {
+		// It didn't work. Start the handshake since this is an ordinary message packet.
+		return &unknownV5{Nonce: head.Nonce}, nil
+	}
+	return msg, err
+}
+
+func (c *wireCodec) decryptMessage(input, nonce, headerData, readKey []byte) (packetV5, error) {
+	msgdata, err := decryptGCM(readKey, nonce, input, headerData)
+	if err != nil {
+		return nil, errMessageDecrypt
+	}
+	if len(msgdata) == 0 {
+		return nil, errMessageTooShort
+	}
+	return decodeMessageV5(msgdata[0], msgdata[1:])
+}
+
+// decodeMessageV5 decodes the message body of a packet.
+func decodeMessageV5(ptype byte, body []byte) (packetV5, error) {
+	var dec packetV5
+	switch ptype {
+	case p_pingV5:
+		dec = new(pingV5)
+	case p_pongV5:
+		dec = new(pongV5)
+	case p_findnodeV5:
+		dec = new(findnodeV5)
+	case p_nodesV5:
+		dec = new(nodesV5)
+	case p_talkreqV5:
+		dec = new(talkreqV5)
+	case p_talkrespV5:
+		dec = new(talkrespV5)
+	default:
+		return nil, fmt.Errorf("unknown packet type %d", ptype)
+	}
+	if err := rlp.DecodeBytes(body, dec); err != nil {
+		return nil, err
+	}
+	if dec.reqid() != nil && len(dec.reqid()) > maxReqIDSizeV5 {
+		return nil, errInvalidReqID
+	}
+	return dec, nil
+}
+
+// checkValid performs some basic validity checks on the header.
+// The packetLen here is the length remaining after the static header.
+func (h *v5StaticHeader) checkValid(packetLen int) error {
+	if h.ProtocolID != protocolIDV5 {
+		return errInvalidHeader
+	}
+	if h.Version < protocolVersionV5 {
+		return errMinVersion
+	}
+	if h.Flag != flagWhoareyouV5 && packetLen < minMessageSizeV5 {
+		return errMsgTooShort
+	}
+	if int(h.AuthSize) > packetLen {
+		return errAuthSize
+	}
+	return nil
+}
+
+// mask returns a cipher for 'masking' / 'unmasking' packet headers.
+func (h *v5Header) mask(destID enode.ID) cipher.Stream {
+	block, err := aes.NewCipher(destID[:16])
+	if err != nil {
+		panic("can't create cipher")
+	}
+	return cipher.NewCTR(block, h.IV[:])
+}
+
+func bytesCopy(r *bytes.Buffer) []byte {
+	b := make([]byte, r.Len())
+	copy(b, r.Bytes())
+	return b
+}
+
+// Cryptographic primitives of the handshake.
+
+// encodePubkeyV5 encodes a public key in compressed format.
+func encodePubkeyV5(key *ecdsa.PublicKey) []byte {
+	switch key.Curve {
+	case crypto.S256():
+		return crypto.CompressPubkey(key)
+	default:
+		panic("unsupported curve " + key.Curve.Params().Name + " in encodePubkeyV5")
+	}
+}
+
+// decodePubkeyV5 decodes a public key in compressed format.
+func decodePubkeyV5(curve elliptic.Curve, e []byte) (*ecdsa.PublicKey, error) {
+	switch curve {
+	case crypto.S256():
+		if len(e) != 33 {
+			return nil, errors.New("wrong size public key data")
+		}
+		return crypto.DecompressPubkey(e)
+	default:
+		return nil, fmt.Errorf("unsupported curve %s in decodePubkeyV5", curve.Params().Name)
+	}
+}
+
+// idNonceHash computes the hash signed by the ID signature of the handshake.
+func idNonceHash(h hash.Hash, challenge, ephkey []byte, destID enode.ID) []byte {
+	h.Reset()
+	h.Write([]byte("discovery v5 identity proof"))
+	h.Write(challenge)
+	h.Write(ephkey)
+	h.Write(destID[:])
+	return h.Sum(nil)
+}
+
+// makeIDSignature creates the ID nonce signature.
+func makeIDSignature(hash hash.Hash, key *ecdsa.PrivateKey, challenge, ephkey []byte, destID enode.ID) ([]byte, error) {
+	input := idNonceHash(hash, challenge, ephkey, destID)
+	switch key.Curve {
+	case crypto.S256():
+		idsig, err := crypto.Sign(input, key)
+		if err != nil {
+			return nil, err
+		}
+		return idsig[:len(idsig)-1], nil // remove recovery ID
+	default:
+		return nil, fmt.Errorf("unsupported curve %s", key.Curve.Params().Name)
+	}
+}
+
+// s256raw is an unparsed secp256k1 public key ENR entry.
+type s256raw []byte
+
+func (s256raw) ENRKey() string { return "secp256k1" }
+
+// verifyIDSignature checks that signature over idnonce was made by the given node.
+func verifyIDSignature(hash hash.Hash, sig []byte, n *enode.Node, challenge, ephkey []byte, destID enode.ID) error {
+	switch idscheme := n.Record().IdentityScheme(); idscheme {
+	case "v4":
+		var pubkey s256raw
+		if n.Load(&pubkey) != nil {
+			return errors.New("no secp256k1 public key in record")
+		}
+		input := idNonceHash(hash, challenge, ephkey, destID)
+		if !crypto.VerifySignature(pubkey, input, sig) {
+			return errInvalidNonceSig
+		}
+		return nil
+	default:
+		return fmt.Errorf("can't verify ID nonce signature for scheme %q", idscheme)
+	}
+}
+
+// deriveKeys creates the session keys.
+func deriveKeys(hash func() hash.Hash, priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, n1, n2 enode.ID, challenge []byte) *session {
+	const text = "discovery v5 key agreement"
+	var info = make([]byte, 0, len(text)+len(n1)+len(n2))
+	info = append(info, text...)
+	info = append(info, n1[:]...)
+	info = append(info, n2[:]...)
+
+	eph := ecdh(priv, pub)
+	if eph == nil {
+		return nil
+	}
+	kdf := hkdf.New(hash, eph, challenge, info)
+	sec := session{writeKey: make([]byte, aesKeySizeV5), readKey: make([]byte, aesKeySizeV5)}
+	kdf.Read(sec.writeKey)
+	kdf.Read(sec.readKey)
+	for i := range eph {
+		eph[i] = 0
+	}
+	return &sec
+}
+
+// ecdh creates a shared secret.
+func ecdh(privkey *ecdsa.PrivateKey, pubkey *ecdsa.PublicKey) []byte {
+	secX, secY := pubkey.ScalarMult(pubkey.X, pubkey.Y, privkey.D.Bytes())
+	if secX == nil {
+		return nil
+	}
+	sec := make([]byte, 33)
+	sec[0] = 0x02 | byte(secY.Bit(0))
+	math.ReadBits(secX, sec[1:])
+	return sec
+}
+
+// encryptGCM encrypts pt using AES-GCM with the given key and nonce. The ciphertext is
+// appended to dest, which must not overlap with plaintext. The resulting ciphertext is 16
+// bytes longer than plaintext because it contains an authentication tag.
+func encryptGCM(dest, key, nonce, plaintext, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(fmt.Errorf("can't create block cipher: %v", err))
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSizeV5)
+	if err != nil {
+		panic(fmt.Errorf("can't create GCM: %v", err))
+	}
+	return aesgcm.Seal(dest, nonce, plaintext, authData), nil
+}
+
+// decryptGCM decrypts ct using AES-GCM with the given key and nonce.
+func decryptGCM(key, nonce, ct, authData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't create block cipher: %v", err)
+	}
+	if len(nonce) != gcmNonceSizeV5 {
+		return nil, fmt.Errorf("invalid GCM nonce size: %d", len(nonce))
+	}
+	aesgcm, err := cipher.NewGCMWithNonceSize(block, gcmNonceSizeV5)
+	if err != nil {
+		return nil, fmt.Errorf("can't create GCM: %v", err)
+	}
+	pt := make([]byte, 0, len(ct))
+	return aesgcm.Open(pt, nonce, ct, authData)
+}
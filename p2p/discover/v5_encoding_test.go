@@ -0,0 +1,300 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// handshakeTest is a pair of codecs talking to each other.
+type handshakeTest struct {
+	nodeA, nodeB handshakeTestNode
+	clock        mclock.Simulated
+}
+
+type handshakeTestNode struct {
+	ln   *enode.LocalNode
+	c    *wireCodec
+	addr string
+}
+
+func newHandshakeTest(t *testing.T) *handshakeTest {
+	test := new(handshakeTest)
+	test.nodeA.init(t, newkey(), net.IP{127, 0, 0, 1}, &test.clock)
+	test.nodeB.init(t, newkey(), net.IP{127, 0, 0, 2}, &test.clock)
+	return test
+}
+
+func (n *handshakeTestNode) init(t *testing.T, key *ecdsa.PrivateKey, ip net.IP, clock mclock.Clock) {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.ln = enode.NewLocalNode(db, key)
+	n.ln.SetStaticIP(ip)
+	n.ln.SetFallbackUDP(30303)
+	n.addr = (&net.UDPAddr{IP: ip, Port: 30303}).String()
+	n.c = newWireCodec(n.ln, key, clock)
+}
+
+func (n *handshakeTestNode) encode(t *testing.T, to handshakeTestNode, p packetV5, challenge *whoareyouV5) []byte {
+	t.Helper()
+	enc, _, err := n.c.encode(to.ln.ID(), to.addr, p, challenge)
+	if err != nil {
+		t.Fatalf("%s encode error: %v", p.name(), err)
+	}
+	return enc
+}
+
+func (n *handshakeTestNode) decode(t *testing.T, from handshakeTestNode, input []byte) (*enode.Node, packetV5) {
+	t.Helper()
+	id, node, p, err := n.c.decode(input, from.addr)
+	if err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if p.kind() != p_whoareyouV5 && id != from.ln.ID() {
+		t.Fatalf("wrong source ID %v, want %v", id, from.ln.ID())
+	}
+	return node, p
+}
+
+// This test checks the full handshake: a message without session is answered by
+// WHOAREYOU, which is answered by the handshake message establishing the session.
+func TestWireCodec_handshake(t *testing.T) {
+	test := newHandshakeTest(t)
+	a, b := test.nodeA, test.nodeB
+
+	// A -> B   RANDOM PACKET
+	ping := &pingV5{ReqID: []byte("reqid"), ENRSeq: 5}
+	packet := a.encode(t, b, ping, nil)
+	_, p := b.decode(t, a, packet)
+	unknown, ok := p.(*unknownV5)
+	if !ok {
+		t.Fatalf("expected UNKNOWN, got %s", p.name())
+	}
+
+	// A <- B   WHOAREYOU
+	challenge := &whoareyouV5{Nonce: unknown.Nonce, IDNonce: [16]byte{1, 2, 3}}
+	packet = b.encode(t, a, challenge, nil)
+	_, p = a.decode(t, b, packet)
+	resp, ok := p.(*whoareyouV5)
+	if !ok {
+		t.Fatalf("expected WHOAREYOU, got %s", p.name())
+	}
+	if resp.IDNonce != challenge.IDNonce || resp.Nonce != unknown.Nonce {
+		t.Fatalf("wrong challenge content: %+v", resp)
+	}
+
+	// A -> B   HANDSHAKE
+	resp.node = b.ln.Node()
+	packet = a.encode(t, b, ping, resp)
+	node, p := b.decode(t, a, packet)
+	if node == nil || node.ID() != a.ln.ID() {
+		t.Fatalf("handshake didn't yield the record of A: %v", node)
+	}
+	if !reflect.DeepEqual(p, ping) {
+		t.Fatalf("wrong message in handshake:\n got %#v\nwant %#v", p, ping)
+	}
+
+	// A <- B   MESSAGE
+	pong := &pongV5{ReqID: ping.ReqID, ENRSeq: 7, ToIP: net.IP{127, 0, 0, 1}.To4(), ToPort: 30303}
+	packet = b.encode(t, a, pong, nil)
+	_, p = a.decode(t, b, packet)
+	if !reflect.DeepEqual(p, pong) {
+		t.Fatalf("wrong message:\n got %#v\nwant %#v", p, pong)
+	}
+
+	// A -> B   MESSAGE
+	talk := &talkreqV5{ReqID: []byte{1}, Protocol: "test", Message: []byte("hello")}
+	packet = a.encode(t, b, talk, nil)
+	_, p = b.decode(t, a, packet)
+	if !reflect.DeepEqual(p, talk) {
+		t.Fatalf("wrong message:\n got %#v\nwant %#v", p, talk)
+	}
+}
+
+// This test checks that session keys are renewed after maxPackets packets.
+func TestWireCodec_sessionRenewal(t *testing.T) {
+	test := newHandshakeTest(t)
+	a, b := test.nodeA, test.nodeB
+	a.c.sc.maxPackets = 3
+
+	// Establish the session. The handshake message is the first packet.
+	ping := &pingV5{ReqID: []byte("reqid")}
+	_, p := b.decode(t, a, a.encode(t, b, ping, nil))
+	_, p = a.decode(t, b, b.encode(t, a, &whoareyouV5{Nonce: p.(*unknownV5).Nonce}, nil))
+	challenge := p.(*whoareyouV5)
+	challenge.node = b.ln.Node()
+	b.decode(t, a, a.encode(t, b, ping, challenge))
+
+	// Two more requests can be sent using the session.
+	for i := 0; i < 2; i++ {
+		if _, p := b.decode(t, a, a.encode(t, b, ping, nil)); p.kind() != p_pingV5 {
+			t.Fatalf("request %d: expected PING, got %s", i, p.name())
+		}
+	}
+	// Responses never renew the session.
+	pong := &pongV5{ReqID: ping.ReqID}
+	if _, p := b.decode(t, a, a.encode(t, b, pong, nil)); p.kind() != p_pongV5 {
+		t.Fatalf("expected PONG, got %s", p.name())
+	}
+	// The next request starts a new handshake.
+	if _, p := b.decode(t, a, a.encode(t, b, ping, nil)); p.kind() != p_unknownV5 {
+		t.Fatalf("expected UNKNOWN, got %s", p.name())
+	}
+}
+
+// This test checks that both nodes end up with the same session keys when their
+// handshakes cross.
+func TestWireCodec_crossedHandshake(t *testing.T) {
+	for _, swap := range []bool{false, true} {
+		for _, sequential := range []bool{false, true} {
+			test := newHandshakeTest(t)
+			a, b := test.nodeA, test.nodeB
+			if swap {
+				a, b = b, a
+			}
+			testCrossedHandshake(t, a, b, sequential)
+		}
+	}
+}
+
+func testCrossedHandshake(t *testing.T, a, b handshakeTestNode, sequential bool) {
+	t.Helper()
+	pingA := &pingV5{ReqID: []byte("a")}
+	pingB := &pingV5{ReqID: []byte("b")}
+
+	// Both nodes send a request at the same time and answer the other
+	// node's request with WHOAREYOU.
+	packetA := a.encode(t, b, pingA, nil)
+	packetB := b.encode(t, a, pingB, nil)
+	_, p := b.decode(t, a, packetA)
+	whoareyouB := b.encode(t, a, &whoareyouV5{Nonce: p.(*unknownV5).Nonce}, nil)
+	_, p = a.decode(t, b, packetB)
+	whoareyouA := a.encode(t, b, &whoareyouV5{Nonce: p.(*unknownV5).Nonce}, nil)
+	_, p = a.decode(t, b, whoareyouB)
+	challengeA := p.(*whoareyouV5)
+	challengeA.node = b.ln.Node()
+	_, p = b.decode(t, a, whoareyouA)
+	challengeB := p.(*whoareyouV5)
+	challengeB.node = a.ln.Node()
+
+	// Both nodes answer the challenge.
+	if sequential {
+		// B receives the handshake of A before answering its challenge.
+		if _, p = b.decode(t, a, a.encode(t, b, pingA, challengeA)); p.kind() != p_pingV5 {
+			t.Fatalf("B expected PING, got %s", p.name())
+		}
+		if _, p = a.decode(t, b, b.encode(t, a, pingB, challengeB)); p.kind() != p_pingV5 {
+			t.Fatalf("A expected PING, got %s", p.name())
+		}
+	} else {
+		handshakeA := a.encode(t, b, pingA, challengeA)
+		handshakeB := b.encode(t, a, pingB, challengeB)
+		if _, p = b.decode(t, a, handshakeA); p.kind() != p_pingV5 {
+			t.Fatalf("B expected PING, got %s", p.name())
+		}
+		if _, p = a.decode(t, b, handshakeB); p.kind() != p_pingV5 {
+			t.Fatalf("A expected PING, got %s", p.name())
+		}
+	}
+
+	// The nodes must agree on the session.
+	pong := &pongV5{ReqID: []byte("a")}
+	if _, p = a.decode(t, b, b.encode(t, a, pong, nil)); p.kind() != p_pongV5 {
+		t.Fatalf("A expected PONG, got %s", p.name())
+	}
+	if _, p = b.decode(t, a, a.encode(t, b, pingA, nil)); p.kind() != p_pingV5 {
+		t.Fatalf("B expected PING, got %s", p.name())
+	}
+}
+
+// This test checks that handshake messages without a preceding challenge are rejected.
+func TestWireCodec_unexpectedHandshake(t *testing.T) {
+	test := newHandshakeTest(t)
+	a, b := test.nodeA, test.nodeB
+
+	challenge := &whoareyouV5{ChallengeData: []byte("fake"), node: b.ln.Node()}
+	packet := a.encode(t, b, &pingV5{ReqID: []byte{1}}, challenge)
+	if _, _, _, err := b.c.decode(packet, a.addr); err != errUnexpectedHandshake {
+		t.Fatalf("wrong error: have %v, want %v", err, errUnexpectedHandshake)
+	}
+}
+
+// This test checks that handshakes are rejected once the challenge has timed out.
+func TestWireCodec_handshakeTimeout(t *testing.T) {
+	test := newHandshakeTest(t)
+	a, b := test.nodeA, test.nodeB
+
+	challenge := &whoareyouV5{IDNonce: [16]byte{1}}
+	packet := b.encode(t, a, challenge, nil)
+	_, p := a.decode(t, b, packet)
+	resp := p.(*whoareyouV5)
+	resp.node = b.ln.Node()
+
+	test.clock.Run(handshakeTimeout + 1)
+	packet = a.encode(t, b, &pingV5{ReqID: []byte{1}}, resp)
+	if _, _, _, err := b.c.decode(packet, a.addr); err != errUnexpectedHandshake {
+		t.Fatalf("wrong error: have %v, want %v", err, errUnexpectedHandshake)
+	}
+}
+
+// This test checks that invalid packets are rejected.
+func TestWireCodec_decodeErrors(t *testing.T) {
+	test := newHandshakeTest(t)
+	a, b := test.nodeA, test.nodeB
+
+	if _, _, _, err := b.c.decode(make([]byte, 10), a.addr); err != errTooShortV5 {
+		t.Errorf("short packet: wrong error %v", err)
+	}
+	if _, _, _, err := b.c.decode(make([]byte, 100), a.addr); err != errInvalidHeader {
+		t.Errorf("zero packet: wrong error %v", err)
+	}
+	// Packets masked for another recipient don't have a valid header.
+	packet := a.encode(t, a, &pingV5{ReqID: []byte{1}}, nil)
+	if _, _, _, err := b.c.decode(packet, a.addr); err != errInvalidHeader {
+		t.Errorf("packet for other node: wrong error %v", err)
+	}
+	// Truncated packets are rejected.
+	packet = a.encode(t, b, &pingV5{ReqID: []byte{1}}, nil)
+	if _, _, _, err := b.c.decode(packet[:minPacketSizeV5], a.addr); err != errMsgTooShort {
+		t.Errorf("truncated packet: wrong error %v", err)
+	}
+}
+
+// This test checks that request IDs longer than 8 bytes are rejected.
+func TestDecodeMessageV5_reqidSize(t *testing.T) {
+	long, _ := rlp.EncodeToBytes(&pingV5{ReqID: bytes.Repeat([]byte{1}, 9)})
+	if _, err := decodeMessageV5(p_pingV5, long); err != errInvalidReqID {
+		t.Errorf("wrong error for long request ID: %v", err)
+	}
+	valid, _ := rlp.EncodeToBytes(&pingV5{ReqID: bytes.Repeat([]byte{1}, 8)})
+	if _, err := decodeMessageV5(p_pingV5, valid); err != nil {
+		t.Errorf("valid request ID rejected: %v", err)
+	}
+	if _, err := decodeMessageV5(0x50, nil); err == nil {
+		t.Error("unknown message type accepted")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+const (
+	handshakeTimeout = time.Second
+
+	// Session keys are renewed after this many packets have been sent with them.
+	maxSessionPackets = 1 << 16
+)
+
+// sessionCache keeps negotiated encryption keys and state for in-progress
+// handshakes in the discovery v5 wire protocol.
+type sessionCache struct {
+	sessions   *simplelru.LRU
+	handshakes map[sessionID]*whoareyouV5
+	clock      mclock.Clock
+	maxPackets uint32 // packets sent before the session is renewed
+
+	// hooks for overriding randomness.
+	nonceGen        func(uint32) (v5Nonce, error)
+	maskingIVGen    func([]byte) error
+	ephemeralKeyGen func() (*ecdsa.PrivateKey, error)
+}
+
+// sessionID identifies a session or handshake.
+type sessionID struct {
+	id   enode.ID
+	addr string
+}
+
+// session contains session information
+type session struct {
+	writeKey     []byte
+	readKey      []byte
+	nonceCounter uint32
+
+	initiator bool           // true if the session was created by our handshake
+	created   mclock.AbsTime // set by storeNewSession
+}
+
+// keysFlipped returns a copy of s with the read and write keys flipped.
+func (s *session) keysFlipped() *session {
+	return &session{readKey: s.writeKey, writeKey: s.readKey, nonceCounter: s.nonceCounter, initiator: s.initiator}
+}
+
+func newSessionCache(maxItems int, clock mclock.Clock) *sessionCache {
+	cache, err := simplelru.NewLRU(maxItems, nil)
+	if err != nil {
+		panic("can't create session cache")
+	}
+	return &sessionCache{
+		sessions:        cache,
+		handshakes:      make(map[sessionID]*whoareyouV5),
+		clock:           clock,
+		maxPackets:      maxSessionPackets,
+		nonceGen:        generateNonce,
+		maskingIVGen:    generateMaskingIV,
+		ephemeralKeyGen: crypto.GenerateKey,
+	}
+}
+
+func generateNonce(counter uint32) (n v5Nonce, err error) {
+	binary.BigEndian.PutUint32(n[:4], counter)
+	_, err = crand.Read(n[4:])
+	return n, err
+}
+
+func generateMaskingIV(buf []byte) error {
+	_, err := crand.Read(buf)
+	return err
+}
+
+// nextNonce creates a nonce for encrypting a message to the given session.
+func (sc *sessionCache) nextNonce(s *session) (v5Nonce, error) {
+	s.nonceCounter++
+	return sc.nonceGen(s.nonceCounter)
+}
+
+// session returns the current session for the given node, if any.
+func (sc *sessionCache) session(id enode.ID, addr string) *session {
+	item, ok := sc.sessions.Get(sessionID{id, addr})
+	if !ok {
+		return nil
+	}
+	return item.(*session)
+}
+
+// readKey returns the current read key for the given node.
+func (sc *sessionCache) readKey(id enode.ID, addr string) []byte {
+	if s := sc.session(id, addr); s != nil {
+		return s.readKey
+	}
+	return nil
+}
+
+// storeNewSession stores new encryption keys in the cache.
+func (sc *sessionCache) storeNewSession(id enode.ID, addr string, s *session) {
+	s.created = sc.clock.Now()
+	sc.sessions.Add(sessionID{id, addr}, s)
+}
+
+// expireSession deletes the session with the given node if its keys have been used
+// for too many packets. The next packet sent to the node starts a new handshake.
+func (sc *sessionCache) expireSession(id enode.ID, addr string) {
+	if s := sc.session(id, addr); s != nil && s.nonceCounter >= sc.maxPackets {
+		sc.sessions.Remove(sessionID{id, addr})
+	}
+}
+
+// tieBreakSession resolves concurrent handshakes. When two nodes answer each other's
+// WHOAREYOU at the same time, both handshakes create a session and each node may end up
+// keeping a different one. The handshake started by the node with the lower ID wins.
+//
+// tieBreakSession returns the current session with the remote node if it was created
+// by the winning handshake within handshakeTimeout, i.e. by our handshake if the local
+// ID is lower and by theirs otherwise. This session must not be replaced by the losing
+// handshake.
+func (sc *sessionCache) tieBreakSession(local, remote enode.ID, addr string) *session {
+	s := sc.session(remote, addr)
+	if s == nil || s.created < sc.clock.Now().Add(-handshakeTimeout) {
+		return nil
+	}
+	localWins := bytes.Compare(local[:], remote[:]) < 0
+	if s.initiator != localWins {
+		return nil
+	}
+	return s
+}
+
+// getHandshake gets the handshake challenge we previously sent to the given remote node.
+func (sc *sessionCache) getHandshake(id enode.ID, addr string) *whoareyouV5 {
+	return sc.handshakes[sessionID{id, addr}]
+}
+
+// storeSentHandshake stores the handshake challenge sent to the given remote node.
+func (sc *sessionCache) storeSentHandshake(id enode.ID, addr string, challenge *whoareyouV5) {
+	challenge.sent = sc.clock.Now()
+	sc.handshakes[sessionID{id, addr}] = challenge
+}
+
+// deleteHandshake deletes handshake data for the given node.
+func (sc *sessionCache) deleteHandshake(id enode.ID, addr string) {
+	delete(sc.handshakes, sessionID{id, addr})
+}
+
+// handshakeGC deletes timed-out handshakes.
+func (sc *sessionCache) handshakeGC() {
+	deadline := sc.clock.Now().Add(-handshakeTimeout)
+	for key, challenge := range sc.handshakes {
+		if challenge.sent < deadline {
+			delete(sc.handshakes, key)
+		}
+	}
+}
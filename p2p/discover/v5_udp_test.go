@@ -0,0 +1,259 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// startLocalhostV5 starts a v5 listener on a random localhost port.
+func startLocalhostV5(t *testing.T, cfg Config) *UDPv5 {
+	cfg.PrivateKey = newkey()
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, cfg.PrivateKey)
+
+	// Prefix logs with node ID.
+	lprefix := ln.ID().TerminalString()
+	lfmt := log.TerminalFormat(false)
+	cfg.Log = testlog.Logger(t, log.LvlTrace)
+	cfg.Log.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		t.Logf("%s %s", lprefix, lfmt.Format(r))
+		return nil
+	}))
+
+	// Listen.
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	realaddr := socket.LocalAddr().(*net.UDPAddr)
+	ln.SetStaticIP(realaddr.IP)
+	ln.SetFallbackUDP(realaddr.Port)
+	udp, err := ListenV5(socket, ln, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return udp
+}
+
+// This test checks that PING, FINDNODE and TALKREQ work across a real socket, including
+// the handshake performed before the first call.
+func TestUDPv5_calls(t *testing.T) {
+	t.Parallel()
+
+	node1 := startLocalhostV5(t, Config{})
+	defer node1.Close()
+	node2 := startLocalhostV5(t, Config{})
+	defer node2.Close()
+
+	// The first call performs the handshake.
+	seq, err := node1.ping(node2.Self())
+	if err != nil {
+		t.Fatal("ping failed:", err)
+	}
+	if seq != node2.Self().Seq() {
+		t.Errorf("wrong seq in pong: have %d, want %d", seq, node2.Self().Seq())
+	}
+	// The handshake added node1 to the table of node2.
+	if n := node2.tab.getNode(node1.Self().ID()); n == nil {
+		t.Error("node1 not added to table of node2 after handshake")
+	}
+
+	// Requesting the record asks for distance zero.
+	n, err := node1.RequestENR(node2.Self())
+	if err != nil {
+		t.Fatal("RequestENR failed:", err)
+	}
+	if n.ID() != node2.Self().ID() || n.Seq() != node2.Self().Seq() {
+		t.Errorf("wrong record in response: %v", n)
+	}
+
+	// Talk requests are answered by the registered handler.
+	node2.RegisterTalkHandler("test", func(id enode.ID, addr *net.UDPAddr, msg []byte) []byte {
+		if id != node1.Self().ID() {
+			t.Errorf("wrong ID in talk request: %v", id)
+		}
+		return append([]byte("re: "), msg...)
+	})
+	resp, err := node1.TalkRequest(node2.Self(), "test", []byte("hello"))
+	if err != nil {
+		t.Fatal("TalkRequest failed:", err)
+	}
+	if !bytes.Equal(resp, []byte("re: hello")) {
+		t.Errorf("wrong talk response %q", resp)
+	}
+	// Unknown protocols get an empty response.
+	resp, err = node1.TalkRequest(node2.Self(), "unknown", []byte("hello"))
+	if err != nil {
+		t.Fatal("TalkRequest failed:", err)
+	}
+	if len(resp) != 0 {
+		t.Errorf("non-empty response for unknown protocol: %q", resp)
+	}
+}
+
+// This test checks that calls keep working when session keys are renewed.
+func TestUDPv5_sessionRenewal(t *testing.T) {
+	t.Parallel()
+
+	node1 := startLocalhostV5(t, Config{})
+	defer node1.Close()
+	node2 := startLocalhostV5(t, Config{})
+	defer node2.Close()
+
+	// Renew the session with every call.
+	node1.codec.(*wireCodec).sc.maxPackets = 1
+	for i := 0; i < 3; i++ {
+		if _, err := node1.ping(node2.Self()); err != nil {
+			t.Fatalf("ping %d failed: %v", i, err)
+		}
+	}
+}
+
+// This test checks that calls to unresponsive nodes time out.
+func TestUDPv5_callTimeout(t *testing.T) {
+	t.Parallel()
+
+	node1 := startLocalhostV5(t, Config{})
+	defer node1.Close()
+
+	// Create a node record for a socket nobody reads from.
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, newkey())
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(socket.LocalAddr().(*net.UDPAddr).Port)
+
+	start := time.Now()
+	if _, err := node1.ping(ln.Node()); err != errTimeout {
+		t.Fatalf("wrong error: have %v, want %v", err, errTimeout)
+	}
+	if elapsed := time.Since(start); elapsed < respTimeoutV5 {
+		t.Errorf("call returned after %v, before the response timeout", elapsed)
+	}
+}
+
+// This test checks that FINDNODE responses only contain nodes at the requested distances
+// and are split across multiple NODES packets.
+func TestUDPv5_findnode(t *testing.T) {
+	t.Parallel()
+
+	node1 := startLocalhostV5(t, Config{})
+	defer node1.Close()
+	node2 := startLocalhostV5(t, Config{})
+	defer node2.Close()
+
+	// Fill the table of node2 with nodes at distance 253.
+	var (
+		dist  = 253
+		nodes []*enode.Node
+	)
+	for i := 0; i < 10; i++ {
+		key := newkey()
+		for enode.LogDist(node2.Self().ID(), enode.PubkeyToIDV4(&key.PublicKey)) != dist {
+			key = newkey()
+		}
+		n := nodeWithKey(t, key, net.IP{127, 0, 0, byte(i + 2)})
+		nodes = append(nodes, n)
+	}
+	fillTable(node2.tab, wrapNodes(nodes))
+
+	result, err := node1.findnode(node2.Self(), []uint{uint(dist)})
+	if err != nil {
+		t.Fatal("findnode failed:", err)
+	}
+	var want []*enode.Node
+	for _, n := range node2.AllNodes() {
+		if enode.LogDist(node2.Self().ID(), n.ID()) == dist {
+			want = append(want, n)
+		}
+	}
+	if len(want) != len(nodes) {
+		t.Fatalf("table has %d nodes at distance %d, want %d", len(want), dist, len(nodes))
+	}
+	if err := checkNodesEqual(result, want); err != nil {
+		t.Error(err)
+	}
+	// Nodes at other distances are not returned.
+	result, err = node1.findnode(node2.Self(), []uint{uint(dist - 1)})
+	if err != nil {
+		t.Fatal("findnode failed:", err)
+	}
+	if len(result) != 0 {
+		t.Errorf("got %d nodes at empty distance", len(result))
+	}
+}
+
+// This test checks that packNodes splits large results.
+func TestUDPv5_packNodes(t *testing.T) {
+	var nodes []*enode.Node
+	for i := 0; i < 7; i++ {
+		nodes = append(nodes, nodeWithKey(t, newkey(), net.IP{127, 0, 0, byte(i + 2)}))
+	}
+	packets := packNodes([]byte{1}, nodes)
+	if len(packets) != 3 {
+		t.Fatalf("wrong number of packets: have %d, want 3", len(packets))
+	}
+	for _, p := range packets {
+		if p.Total != 3 {
+			t.Errorf("wrong total %d", p.Total)
+		}
+		if len(p.Nodes) > nodesResponseItemLimit {
+			t.Errorf("too many nodes in packet: %d", len(p.Nodes))
+		}
+	}
+	if empty := packNodes([]byte{1}, nil); len(empty) != 1 || empty[0].Total != 1 {
+		t.Errorf("wrong response for empty result: %v", empty)
+	}
+}
+
+// This test checks the distances requested during lookup.
+func TestUDPv5_lookupDistances(t *testing.T) {
+	var (
+		lnID = enode.ID{}
+		tgt  = enode.ID{0x80}
+	)
+	dists := lookupDistances(tgt, lnID)
+	if len(dists) != lookupRequestLimit || dists[0] != 256 || dists[1] != 255 {
+		t.Errorf("wrong distances %v", dists)
+	}
+}
+
+// nodeWithKey creates a signed node record with the given key and IP.
+func nodeWithKey(t *testing.T, key *ecdsa.PrivateKey, ip net.IP) *enode.Node {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ln := enode.NewLocalNode(db, key)
+	ln.SetStaticIP(ip)
+	ln.SetFallbackUDP(30303)
+	return ln.Node()
+}
@@ -48,10 +48,18 @@ const (
 	dbNodePing      = "lastping"
 	dbNodePong      = "lastpong"
 	dbNodeSeq       = "seq"
+	dbNodeScore     = "score"
+	dbNodeBanned    = "banned"
 
 	// Local information is keyed by ID only, the full key is "local:<ID>:seq".
 	// Use localItemKey to create those keys.
 	dbLocalSeq = "seq"
+
+	// Nodes added at runtime as static or trusted peers are stored as
+	// "static:<ID>" and "trusted:<ID>". Bans are stored as "ban:<target>".
+	dbStaticPrefix  = "static:"
+	dbTrustedPrefix = "trusted:"
+	dbBanPrefix     = "ban:"
 )
 
 const (
@@ -378,6 +386,124 @@ func (db *DB) UpdateFindFails(id ID, ip net.IP, fails int) error {
 	return db.storeInt64(nodeItemKey(id, ip, dbNodeFindFails), int64(fails))
 }
 
+// NodeScore retrieves the reputation score of a node.
+func (db *DB) NodeScore(id ID) int64 {
+	return db.fetchInt64(nodeItemKey(id, zeroIP, dbNodeScore))
+}
+
+// UpdateNodeScore updates the reputation score of a node.
+func (db *DB) UpdateNodeScore(id ID, score int64) error {
+	return db.storeInt64(nodeItemKey(id, zeroIP, dbNodeScore), score)
+}
+
+// BannedUntil retrieves the time until which a node is banned. The zero time is
+// returned if the node was never banned.
+func (db *DB) BannedUntil(id ID) time.Time {
+	t := db.fetchInt64(nodeItemKey(id, zeroIP, dbNodeBanned))
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+// UpdateBannedUntil updates the time until which a node is banned. Passing the
+// zero time lifts the ban.
+func (db *DB) UpdateBannedUntil(id ID, until time.Time) error {
+	key := nodeItemKey(id, zeroIP, dbNodeBanned)
+	if until.IsZero() {
+		return db.lvl.Delete(key, nil)
+	}
+	return db.storeInt64(key, until.Unix())
+}
+
+// StaticNodes returns all nodes stored with StoreStaticNode.
+func (db *DB) StaticNodes() []*Node {
+	return db.nodeList(dbStaticPrefix)
+}
+
+// StoreStaticNode persists a node added as a static peer.
+func (db *DB) StoreStaticNode(node *Node) error {
+	return db.storeListNode(dbStaticPrefix, node)
+}
+
+// DeleteStaticNode removes a node stored with StoreStaticNode.
+func (db *DB) DeleteStaticNode(id ID) error {
+	return db.lvl.Delete(append([]byte(dbStaticPrefix), id[:]...), nil)
+}
+
+// TrustedNodes returns all nodes stored with StoreTrustedNode.
+func (db *DB) TrustedNodes() []*Node {
+	return db.nodeList(dbTrustedPrefix)
+}
+
+// StoreTrustedNode persists a node added as a trusted peer.
+func (db *DB) StoreTrustedNode(node *Node) error {
+	return db.storeListNode(dbTrustedPrefix, node)
+}
+
+// DeleteTrustedNode removes a node stored with StoreTrustedNode.
+func (db *DB) DeleteTrustedNode(id ID) error {
+	return db.lvl.Delete(append([]byte(dbTrustedPrefix), id[:]...), nil)
+}
+
+func (db *DB) storeListNode(prefix string, node *Node) error {
+	blob, err := rlp.EncodeToBytes(&node.r)
+	if err != nil {
+		return err
+	}
+	id := node.ID()
+	return db.lvl.Put(append([]byte(prefix), id[:]...), blob, nil)
+}
+
+func (db *DB) nodeList(prefix string) []*Node {
+	var nodes []*Node
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer it.Release()
+	for it.Next() {
+		id := it.Key()[len(prefix):]
+		if len(id) != len(ID{}) {
+			continue
+		}
+		node := new(Node)
+		if err := rlp.DecodeBytes(it.Value(), &node.r); err != nil {
+			continue
+		}
+		copy(node.id[:], id)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Bans returns all stored bans and their expiry time. Permanent bans have the
+// zero expiry time.
+func (db *DB) Bans() map[string]time.Time {
+	bans := make(map[string]time.Time)
+	it := db.lvl.NewIterator(util.BytesPrefix([]byte(dbBanPrefix)), nil)
+	defer it.Release()
+	for it.Next() {
+		var until time.Time
+		if t, read := binary.Varint(it.Value()); read > 0 && t != 0 {
+			until = time.Unix(t, 0)
+		}
+		bans[string(it.Key()[len(dbBanPrefix):])] = until
+	}
+	return bans
+}
+
+// StoreBan persists a ban of target. The zero time marks a permanent ban.
+func (db *DB) StoreBan(target string, until time.Time) error {
+	var t int64
+	if !until.IsZero() {
+		t = until.Unix()
+	}
+	return db.storeInt64([]byte(dbBanPrefix+target), t)
+}
+
+// DeleteBan removes a ban stored with StoreBan.
+func (db *DB) DeleteBan(target string) error {
+	return db.lvl.Delete([]byte(dbBanPrefix+target), nil)
+}
+
 // LocalSeq retrieves the local record sequence counter.
 func (db *DB) localSeq(id ID) uint64 {
 	return db.fetchUint64(localItemKey(id, dbLocalSeq))
@@ -154,6 +154,32 @@ func TestDBFetchStore(t *testing.T) {
 	if stored := db.FindFails(node.ID(), node.IP()); stored != num {
 		t.Errorf("find-node fails: value mismatch: have %v, want %v", stored, num)
 	}
+	// Check fetch/store operations on a node reputation score
+	if stored := db.NodeScore(node.ID()); stored != 0 {
+		t.Errorf("score: non-existing object: %v", stored)
+	}
+	if err := db.UpdateNodeScore(node.ID(), -int64(num)); err != nil {
+		t.Errorf("score: failed to update: %v", err)
+	}
+	if stored := db.NodeScore(node.ID()); stored != -int64(num) {
+		t.Errorf("score: value mismatch: have %v, want %v", stored, -num)
+	}
+	// Check fetch/store operations on a node ban
+	if stored := db.BannedUntil(node.ID()); !stored.IsZero() {
+		t.Errorf("ban: non-existing object: %v", stored)
+	}
+	if err := db.UpdateBannedUntil(node.ID(), inst); err != nil {
+		t.Errorf("ban: failed to update: %v", err)
+	}
+	if stored := db.BannedUntil(node.ID()); stored.Unix() != inst.Unix() {
+		t.Errorf("ban: value mismatch: have %v, want %v", stored, inst)
+	}
+	if err := db.UpdateBannedUntil(node.ID(), time.Time{}); err != nil {
+		t.Errorf("ban: failed to lift: %v", err)
+	}
+	if stored := db.BannedUntil(node.ID()); !stored.IsZero() {
+		t.Errorf("ban: not lifted: %v", stored)
+	}
 	// Check fetch/store operations on an actual node object
 	if stored := db.Node(node.ID()); stored != nil {
 		t.Errorf("node: non-existing object: %v", stored)
@@ -462,3 +488,50 @@ func TestDBExpiration(t *testing.T) {
 		}
 	}
 }
+
+func TestDBStaticTrustedNodes(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	var (
+		a = NewV4(hexPubkey("1dd9d65c4552b5eb43d5ad55a2ee3f56c6cbc1c64a5c8d659f51fcd51bace24351232b8d7821617d2b29b54b81cdefb9b3e9c37d7fd5f63270bcc9e1a6f6a439"), net.IP{127, 0, 0, 1}, 30303, 30303)
+		b = NewV4(hexPubkey("234dc63fe4d131212b38236c4c3411288d7bec61cbf7b120ff12c43dc60c96182882f4291d209db66f8a38e986c9c010ff59231a67f9515c7d1668b86b221a47"), net.IP{127, 0, 0, 2}, 30303, 30303)
+	)
+	db.StoreStaticNode(a)
+	db.StoreStaticNode(b)
+	db.StoreTrustedNode(b)
+
+	if nodes := db.StaticNodes(); len(nodes) != 2 {
+		t.Fatalf("wrong number of static nodes: %d", len(nodes))
+	}
+	trusted := db.TrustedNodes()
+	if len(trusted) != 1 || trusted[0].ID() != b.ID() || !trusted[0].IP().Equal(b.IP()) {
+		t.Fatalf("wrong trusted nodes: %v", trusted)
+	}
+	db.DeleteStaticNode(a.ID())
+	db.DeleteTrustedNode(b.ID())
+	if nodes := db.StaticNodes(); len(nodes) != 1 || nodes[0].ID() != b.ID() {
+		t.Fatalf("wrong static nodes after delete: %v", nodes)
+	}
+	if nodes := db.TrustedNodes(); len(nodes) != 0 {
+		t.Fatalf("wrong trusted nodes after delete: %v", nodes)
+	}
+}
+
+func TestDBBans(t *testing.T) {
+	db, _ := OpenDB("")
+	defer db.Close()
+
+	until := time.Unix(1000000, 0)
+	db.StoreBan("10.0.0.0/24", time.Time{})
+	db.StoreBan("2001:db8::/64", until)
+
+	bans := db.Bans()
+	if len(bans) != 2 || !bans["10.0.0.0/24"].IsZero() || !bans["2001:db8::/64"].Equal(until) {
+		t.Fatalf("wrong bans: %v", bans)
+	}
+	db.DeleteBan("10.0.0.0/24")
+	if bans := db.Bans(); len(bans) != 1 {
+		t.Fatalf("wrong bans after delete: %v", bans)
+	}
+}
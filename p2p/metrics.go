@@ -34,6 +34,10 @@ const (
 	MetricsOutboundTraffic  = "p2p/egress"  // Name for the registered outbound traffic meter
 	MetricsOutboundConnects = "p2p/dials"   // Name for the registered outbound connects meter
 	MetricsInboundConnects  = "p2p/serves"  // Name for the registered inbound connects meter
+	MetricsInboundRejects   = "p2p/rejects" // Prefix for the inbound rejection meters
+
+	MetricsSnappyInbound  = "p2p/snappy/ingress" // Prefix for the inbound compressed traffic meters
+	MetricsSnappyOutbound = "p2p/snappy/egress"  // Prefix for the outbound compressed traffic meters
 
 	MeteredPeerLimit = 1024 // This amount of peers are individually metered
 )
@@ -45,6 +49,22 @@ var (
 	egressTrafficMeter  = metrics.NewRegisteredMeter(MetricsOutboundTraffic, nil)  // Meter metering the cumulative egress traffic
 	activePeerGauge     = metrics.NewRegisteredGauge("p2p/peers", nil)             // Gauge tracking the current peer count
 
+	snappyIngressWireMeter    = metrics.NewRegisteredMeter(MetricsSnappyInbound+"/wire", nil)     // Meter metering compressed ingress message bytes
+	snappyIngressPayloadMeter = metrics.NewRegisteredMeter(MetricsSnappyInbound+"/payload", nil)  // Meter metering decompressed ingress message bytes
+	snappyEgressWireMeter     = metrics.NewRegisteredMeter(MetricsSnappyOutbound+"/wire", nil)    // Meter metering compressed egress message bytes
+	snappyEgressPayloadMeter  = metrics.NewRegisteredMeter(MetricsSnappyOutbound+"/payload", nil) // Meter metering uncompressed egress message bytes
+
+	// Meters counting rejected inbound connections by reason.
+	inboundRejectMeters = map[error]metrics.Meter{
+		errInboundNotWhitelisted: metrics.NewRegisteredMeter(MetricsInboundRejects+"/netrestrict", nil),
+		errInboundBanned:         metrics.NewRegisteredMeter(MetricsInboundRejects+"/banned", nil),
+		errInboundThrottled:      metrics.NewRegisteredMeter(MetricsInboundRejects+"/throttle", nil),
+		errInboundAttempts:       metrics.NewRegisteredMeter(MetricsInboundRejects+"/attempts", nil),
+		errTooManyFromIP:         metrics.NewRegisteredMeter(MetricsInboundRejects+"/ip", nil),
+		errTooManyFromSubnet:     metrics.NewRegisteredMeter(MetricsInboundRejects+"/subnet", nil),
+		DiscTooManyPeers:         metrics.NewRegisteredMeter(MetricsInboundRejects+"/peers", nil),
+	}
+
 	PeerIngressRegistry = metrics.NewPrefixedChildRegistry(metrics.EphemeralRegistry, MetricsInboundTraffic+"/")  // Registry containing the peer ingress
 	PeerEgressRegistry  = metrics.NewPrefixedChildRegistry(metrics.EphemeralRegistry, MetricsOutboundTraffic+"/") // Registry containing the peer egress
 
@@ -52,6 +72,13 @@ var (
 	meteredPeerCount int32      // Actually stored peer connection count
 )
 
+// markInboundReject counts the rejection of an inbound connection.
+func markInboundReject(err error) {
+	if m, ok := inboundRejectMeters[err]; ok {
+		m.Mark(1)
+	}
+}
+
 // MeteredPeerEventType is the type of peer events emitted by a metered connection.
 type MeteredPeerEventType int
 
@@ -116,6 +116,12 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// rep tracks the reputation of the peer if set
+	rep *reputation
+
+	// capture records protocol messages if set
+	capture *captureWriter
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -168,6 +174,15 @@ func (p *Peer) Disconnect(reason DiscReason) {
 	}
 }
 
+// Report records the given behaviour of the peer. Peers whose reputation drops
+// too low are disconnected and banned for a while. Trusted peers are never banned.
+func (p *Peer) Report(ev ReputationEvent) {
+	if p.rep.report(p.ID(), ev, !p.rw.is(trustedConn)) {
+		p.log.Debug("Banning peer", "event", ev)
+		p.Disconnect(DiscUselessPeer)
+	}
+}
+
 // String implements fmt.Stringer.
 func (p *Peer) String() string {
 	id := p.ID()
@@ -362,6 +377,9 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
 		}
+		if p.capture != nil {
+			rw = newMsgCapturer(rw, p.capture, p.ID(), proto.cap().String())
+		}
 		p.log.Trace(fmt.Sprintf("Starting protocol %s/%d", proto.Name, proto.Version))
 		go func() {
 			err := proto.Run(p, rw)
@@ -447,7 +465,8 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
-	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
+	Reputation int64                  `json:"reputation"` // Reputation score of the peer
+	Protocols  map[string]interface{} `json:"protocols"`  // Sub-protocol specific metadata fields
 }
 
 // Info gathers and returns a collection of metadata known about a peer.
@@ -473,6 +492,7 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	info.Reputation = p.rep.score(p.ID())
 
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
@@ -0,0 +1,120 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// ReputationEvent is a kind of peer behaviour reported by a protocol.
+type ReputationEvent int
+
+const (
+	// RepUsefulResponse is reported when a peer delivered requested data.
+	RepUsefulResponse ReputationEvent = iota
+	// RepTimeout is reported when a peer failed to answer a request in time.
+	RepTimeout
+	// RepInvalidData is reported when a peer sent malformed or invalid data.
+	RepInvalidData
+)
+
+const (
+	maxReputation = 100
+	minReputation = -100
+
+	// Peers whose score drops to banThreshold are disconnected and refused for
+	// banDuration. Their score is reset once the ban is issued.
+	banThreshold = -50
+	banDuration  = 30 * time.Minute
+)
+
+// reputationDelta is the score change caused by each event.
+var reputationDelta = map[ReputationEvent]int64{
+	RepUsefulResponse: 1,
+	RepTimeout:        -10,
+	RepInvalidData:    -25,
+}
+
+func (ev ReputationEvent) String() string {
+	switch ev {
+	case RepUsefulResponse:
+		return "useful response"
+	case RepTimeout:
+		return "timeout"
+	case RepInvalidData:
+		return "invalid data"
+	default:
+		return "unknown event"
+	}
+}
+
+// reputation tracks peer scores and bans in the node database. All methods
+// can be called on a nil reputation, which scores every node as zero and
+// never bans anyone.
+type reputation struct {
+	mu  sync.Mutex
+	db  *enode.DB
+	now func() time.Time
+}
+
+func newReputation(db *enode.DB) *reputation {
+	return &reputation{db: db, now: time.Now}
+}
+
+// report applies ev to the score of node id. If canBan is set and the score
+// reaches banThreshold, the node is banned and report returns true.
+func (r *reputation) report(id enode.ID, ev ReputationEvent, canBan bool) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	score := r.db.NodeScore(id) + reputationDelta[ev]
+	if score > maxReputation {
+		score = maxReputation
+	} else if score < minReputation {
+		score = minReputation
+	}
+	if canBan && score <= banThreshold {
+		r.db.UpdateBannedUntil(id, r.now().Add(banDuration))
+		r.db.UpdateNodeScore(id, 0)
+		return true
+	}
+	r.db.UpdateNodeScore(id, score)
+	return false
+}
+
+// score returns the current score of node id.
+func (r *reputation) score(id enode.ID) int64 {
+	if r == nil {
+		return 0
+	}
+	return r.db.NodeScore(id)
+}
+
+// isBanned reports whether node id is currently banned.
+func (r *reputation) isBanned(id enode.ID) bool {
+	if r == nil {
+		return false
+	}
+	until := r.db.BannedUntil(id)
+	return !until.IsZero() && r.now().Before(until)
+}
@@ -0,0 +1,129 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+func newTestReputation(t *testing.T) (*reputation, *time.Time) {
+	db, err := enode.OpenDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1000000, 0)
+	rep := newReputation(db)
+	rep.now = func() time.Time { return now }
+	return rep, &now
+}
+
+func TestReputationScore(t *testing.T) {
+	rep, _ := newTestReputation(t)
+	defer rep.db.Close()
+	id := enode.ID{1}
+
+	for i := 0; i < 2*maxReputation; i++ {
+		rep.report(id, RepUsefulResponse, true)
+	}
+	if s := rep.score(id); s != maxReputation {
+		t.Fatalf("score not capped: got %d, want %d", s, maxReputation)
+	}
+	rep.report(id, RepTimeout, true)
+	if s := rep.score(id); s != maxReputation-10 {
+		t.Fatalf("wrong score after timeout: got %d, want %d", s, maxReputation-10)
+	}
+	if rep.isBanned(id) {
+		t.Fatal("node banned with positive score")
+	}
+}
+
+func TestReputationBan(t *testing.T) {
+	rep, now := newTestReputation(t)
+	defer rep.db.Close()
+	id := enode.ID{1}
+
+	if rep.report(id, RepInvalidData, true) {
+		t.Fatal("banned after first invalid message")
+	}
+	if !rep.report(id, RepInvalidData, true) {
+		t.Fatal("not banned after reaching threshold")
+	}
+	if !rep.isBanned(id) {
+		t.Fatal("isBanned returned false for banned node")
+	}
+	if s := rep.score(id); s != 0 {
+		t.Fatalf("score not reset after ban: got %d", s)
+	}
+	*now = now.Add(banDuration)
+	if rep.isBanned(id) {
+		t.Fatal("ban did not expire")
+	}
+
+	// Nodes which can't be banned keep their negative score.
+	other := enode.ID{2}
+	for i := 0; i < 10; i++ {
+		if rep.report(other, RepInvalidData, false) {
+			t.Fatal("banned although banning was disabled")
+		}
+	}
+	if s := rep.score(other); s != minReputation {
+		t.Fatalf("score not capped: got %d, want %d", s, minReputation)
+	}
+}
+
+func TestReputationNil(t *testing.T) {
+	var rep *reputation
+	if rep.report(enode.ID{1}, RepInvalidData, true) || rep.isBanned(enode.ID{1}) || rep.score(enode.ID{1}) != 0 {
+		t.Fatal("nil reputation should be a no-op")
+	}
+}
+
+func TestDialStateReputation(t *testing.T) {
+	rep, _ := newTestReputation(t)
+	defer rep.db.Close()
+
+	var (
+		good   = enode.SignNull(new(enr.Record), enode.ID{1})
+		bad    = enode.SignNull(new(enr.Record), enode.ID{2})
+		plain  = enode.SignNull(new(enr.Record), enode.ID{3})
+		banned = enode.SignNull(new(enr.Record), enode.ID{4})
+	)
+	rep.report(good.ID(), RepUsefulResponse, true)
+	rep.report(bad.ID(), RepTimeout, true)
+	rep.report(banned.ID(), RepInvalidData, true)
+	rep.report(banned.ID(), RepInvalidData, true)
+
+	s := newDialState(enode.ID{}, 10, &Config{})
+	s.rep = rep
+	s.taskDone(&discoverTask{results: []*enode.Node{bad, plain, good}}, time.Now())
+	want := []*enode.Node{good, plain, bad}
+	for i := range want {
+		if s.lookupBuf[i] != want[i] {
+			t.Fatalf("wrong lookup order at %d: got %v, want %v", i, s.lookupBuf[i].ID(), want[i].ID())
+		}
+	}
+	if err := s.checkDial(banned, nil); err != errBanned {
+		t.Fatalf("wrong error for banned node: %v", err)
+	}
+	if err := s.checkDial(bad, nil); err != nil {
+		t.Fatalf("wrong error for low-score node: %v", err)
+	}
+}
@@ -121,6 +121,77 @@ func (t *rlpx) close(err error) {
 	t.fd.Close()
 }
 
+// RLPxConn is a standalone RLPx connection. It exposes the encryption handshake
+// and message framing of the transport used by Server, which allows tools to
+// speak devp2p without running a full server.
+//
+// The devp2p protocol handshake (hello) is not performed by RLPxConn. Callers
+// exchange hello messages themselves and enable Snappy compression afterwards
+// if the negotiated base protocol version supports it.
+type RLPxConn struct {
+	t *rlpx
+}
+
+// NewRLPxConn wraps the given network connection.
+func NewRLPxConn(fd net.Conn) *RLPxConn {
+	return &RLPxConn{t: &rlpx{fd: fd}}
+}
+
+// Handshake performs the RLPx encryption handshake. If remote is non-nil, the
+// connection acts as the initiator. The public key of the remote side is returned.
+func (c *RLPxConn) Handshake(prv *ecdsa.PrivateKey, remote *ecdsa.PublicKey) (*ecdsa.PublicKey, error) {
+	c.t.fd.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.t.fd.SetDeadline(time.Time{})
+	return c.t.doEncHandshake(prv, remote)
+}
+
+// SetSnappy enables or disables Snappy compression of message payloads.
+// It must be called after Handshake.
+func (c *RLPxConn) SetSnappy(snappy bool) {
+	c.t.wmu.Lock()
+	c.t.rmu.Lock()
+	c.t.rw.snappy = snappy
+	c.t.rmu.Unlock()
+	c.t.wmu.Unlock()
+}
+
+// ReadMsg reads a message from the connection. Unlike the transport used by
+// Server, RLPxConn does not set any deadlines, use SetReadDeadline to limit the
+// time spent waiting. The message payload must be consumed before the next call
+// to ReadMsg.
+func (c *RLPxConn) ReadMsg() (Msg, error) {
+	c.t.rmu.Lock()
+	defer c.t.rmu.Unlock()
+	return c.t.rw.ReadMsg()
+}
+
+// WriteMsg sends a message on the connection.
+func (c *RLPxConn) WriteMsg(msg Msg) error {
+	c.t.wmu.Lock()
+	defer c.t.wmu.Unlock()
+	return c.t.rw.WriteMsg(msg)
+}
+
+// SetReadDeadline sets the deadline for reads on the underlying connection.
+func (c *RLPxConn) SetReadDeadline(t time.Time) error {
+	return c.t.fd.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for writes on the underlying connection.
+func (c *RLPxConn) SetWriteDeadline(t time.Time) error {
+	return c.t.fd.SetWriteDeadline(t)
+}
+
+// Close closes the underlying network connection.
+func (c *RLPxConn) Close() error {
+	return c.t.fd.Close()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *RLPxConn) RemoteAddr() net.Addr {
+	return c.t.fd.RemoteAddr()
+}
+
 func (t *rlpx) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err error) {
 	// Writing our handshake happens concurrently, we prefer
 	// returning the handshake read error. If the remote side
@@ -135,8 +206,8 @@ func (t *rlpx) doProtoHandshake(our *protoHandshake) (their *protoHandshake, err
 	if err := <-werr; err != nil {
 		return nil, fmt.Errorf("write error: %v", err)
 	}
-	// If the protocol version supports Snappy encoding, upgrade immediately
-	t.rw.snappy = their.Version >= snappyProtocolVersion
+	// If both sides support Snappy encoding, upgrade immediately
+	t.rw.snappy = our.Version >= snappyProtocolVersion && their.Version >= snappyProtocolVersion
 
 	return their, nil
 }
@@ -588,10 +659,12 @@ func (rw *rlpxFrameRW) WriteMsg(msg Msg) error {
 			return errPlainMessageTooLarge
 		}
 		payload, _ := ioutil.ReadAll(msg.Payload)
-		payload = snappy.Encode(nil, payload)
+		compressed := snappy.Encode(nil, payload)
+		snappyEgressPayloadMeter.Mark(int64(len(payload)))
+		snappyEgressWireMeter.Mark(int64(len(compressed)))
 
-		msg.Payload = bytes.NewReader(payload)
-		msg.Size = uint32(len(payload))
+		msg.Payload = bytes.NewReader(compressed)
+		msg.Size = uint32(len(compressed))
 	}
 	msg.meterSize = msg.Size
 	if metrics.Enabled && msg.meterCap.Name != "" { // don't meter non-subprotocol messages
@@ -694,13 +767,17 @@ func (rw *rlpxFrameRW) ReadMsg() (msg Msg, err error) {
 		if err != nil {
 			return msg, err
 		}
+		// Check the decompressed size before allocating the output buffer,
+		// a tiny compressed payload may claim to expand to an enormous message.
 		if size > int(maxUint24) {
 			return msg, errPlainMessageTooLarge
 		}
+		snappyIngressWireMeter.Mark(int64(len(payload)))
 		payload, err = snappy.Decode(nil, payload)
 		if err != nil {
 			return msg, err
 		}
+		snappyIngressPayloadMeter.Mark(int64(size))
 		msg.Size, msg.Payload = uint32(size), bytes.NewReader(payload)
 	}
 	return msg, nil
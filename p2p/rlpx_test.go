@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -221,6 +222,45 @@ func TestProtocolHandshake(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRLPxConn(t *testing.T) {
+	prv0, _ := crypto.GenerateKey()
+	prv1, _ := crypto.GenerateKey()
+	fd0, fd1, err := pipes.TCPPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, c1 := NewRLPxConn(fd0), NewRLPxConn(fd1)
+	defer c0.Close()
+	defer c1.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		pub, err := c1.Handshake(prv1, nil)
+		if err == nil && !reflect.DeepEqual(pub, &prv0.PublicKey) {
+			err = fmt.Errorf("listen side remote pubkey mismatch")
+		}
+		if err == nil {
+			c1.SetSnappy(true)
+			err = ExpectMsg(c1, 0x10, []uint{1, 2, 3})
+		}
+		errc <- err
+	}()
+	pub, err := c0.Handshake(prv0, &prv1.PublicKey)
+	if err != nil {
+		t.Fatal("dial side handshake failed:", err)
+	}
+	if !reflect.DeepEqual(pub, &prv1.PublicKey) {
+		t.Fatalf("dial side remote pubkey mismatch: got %v", pub)
+	}
+	c0.SetSnappy(true)
+	if err := SendItems(c0, 0x10, uint(1), uint(2), uint(3)); err != nil {
+		t.Fatal("write error:", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestProtocolHandshakeErrors(t *testing.T) {
 	tests := []struct {
 		code uint64
@@ -375,6 +415,131 @@ func TestRLPXFrameRW(t *testing.T) {
 	}
 }
 
+// newFrameRWPair creates two frame readers/writers with matching secrets. Messages
+// written by one of them can be read by the other.
+func newFrameRWPair(conn io.ReadWriter) (*rlpxFrameRW, *rlpxFrameRW) {
+	var (
+		aesSecret      = make([]byte, 16)
+		macSecret      = make([]byte, 16)
+		egressMACinit  = make([]byte, 32)
+		ingressMACinit = make([]byte, 32)
+	)
+	for _, s := range [][]byte{aesSecret, macSecret, egressMACinit, ingressMACinit} {
+		rand.Read(s)
+	}
+	s1 := secrets{
+		AES:        aesSecret,
+		MAC:        macSecret,
+		EgressMAC:  sha3.NewLegacyKeccak256(),
+		IngressMAC: sha3.NewLegacyKeccak256(),
+	}
+	s1.EgressMAC.Write(egressMACinit)
+	s1.IngressMAC.Write(ingressMACinit)
+
+	s2 := secrets{
+		AES:        aesSecret,
+		MAC:        macSecret,
+		EgressMAC:  sha3.NewLegacyKeccak256(),
+		IngressMAC: sha3.NewLegacyKeccak256(),
+	}
+	s2.EgressMAC.Write(ingressMACinit)
+	s2.IngressMAC.Write(egressMACinit)
+	return newRLPXFrameRW(conn, s1), newRLPXFrameRW(conn, s2)
+}
+
+func TestRLPXFrameRWSnappy(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newFrameRWPair(conn)
+	rw1.snappy, rw2.snappy = true, true
+
+	wmsg := []interface{}{strings.Repeat("compressible", 1000)}
+	wantPayload, _ := rlp.EncodeToBytes(wmsg)
+	if err := Send(rw1, 8, wmsg); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if conn.Len() >= len(wantPayload) {
+		t.Errorf("message not compressed: %d bytes on the wire, payload is %d bytes", conn.Len(), len(wantPayload))
+	}
+	msg, err := rw2.ReadMsg()
+	if err != nil {
+		t.Fatalf("ReadMsg error: %v", err)
+	}
+	if msg.Size != uint32(len(wantPayload)) {
+		t.Errorf("msg size mismatch: got %d, want %d", msg.Size, len(wantPayload))
+	}
+	payload, _ := ioutil.ReadAll(msg.Payload)
+	if !bytes.Equal(payload, wantPayload) {
+		t.Fatalf("msg payload mismatch:\ngot  %x\nwant %x", payload, wantPayload)
+	}
+}
+
+// This test checks that compressed messages claiming a decompressed size above
+// the limit are rejected.
+func TestRLPXFrameRWSnappyBomb(t *testing.T) {
+	conn := new(bytes.Buffer)
+	rw1, rw2 := newFrameRWPair(conn)
+	rw2.snappy = true
+
+	// A snappy block starts with the uvarint-encoded decompressed length.
+	bomb := make([]byte, binary.MaxVarintLen64)
+	bomb = bomb[:binary.PutUvarint(bomb, uint64(maxUint24)+1)]
+	if err := rw1.WriteMsg(Msg{Code: 8, Size: uint32(len(bomb)), Payload: bytes.NewReader(bomb)}); err != nil {
+		t.Fatalf("WriteMsg error: %v", err)
+	}
+	if _, err := rw2.ReadMsg(); err != errPlainMessageTooLarge {
+		t.Fatalf("wrong error: got %v, want %v", err, errPlainMessageTooLarge)
+	}
+}
+
+// This test checks that snappy compression is enabled only if both sides
+// advertise a protocol version which supports it.
+func TestProtocolHandshakeSnappy(t *testing.T) {
+	tests := []struct {
+		ours, theirs uint64
+		want         bool
+	}{
+		{ours: snappyProtocolVersion, theirs: snappyProtocolVersion, want: true},
+		{ours: snappyProtocolVersion, theirs: snappyProtocolVersion + 1, want: true},
+		{ours: snappyProtocolVersion, theirs: snappyProtocolVersion - 1, want: false},
+		{ours: snappyProtocolVersion - 1, theirs: snappyProtocolVersion, want: false},
+	}
+	for i, test := range tests {
+		prv0, _ := crypto.GenerateKey()
+		prv1, _ := crypto.GenerateKey()
+		hs0 := &protoHandshake{Version: test.ours, ID: crypto.FromECDSAPub(&prv0.PublicKey)[1:]}
+		hs1 := &protoHandshake{Version: test.theirs, ID: crypto.FromECDSAPub(&prv1.PublicKey)[1:]}
+		fd0, fd1, err := pipes.TCPPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c0, c1 := newRLPX(fd0).(*rlpx), newRLPX(fd1).(*rlpx)
+
+		errc := make(chan error, 1)
+		go func() {
+			if _, err := c1.doEncHandshake(prv1, nil); err != nil {
+				errc <- err
+				return
+			}
+			_, err := c1.doProtoHandshake(hs1)
+			errc <- err
+		}()
+		if _, err := c0.doEncHandshake(prv0, &prv1.PublicKey); err != nil {
+			t.Fatalf("test %d: enc handshake failed: %v", i, err)
+		}
+		if _, err := c0.doProtoHandshake(hs0); err != nil {
+			t.Fatalf("test %d: proto handshake failed: %v", i, err)
+		}
+		if err := <-errc; err != nil {
+			t.Fatalf("test %d: remote handshake failed: %v", i, err)
+		}
+		if c0.rw.snappy != test.want || c1.rw.snappy != test.want {
+			t.Errorf("test %d: snappy enabled: ours %t, theirs %t, want %t", i, c0.rw.snappy, c1.rw.snappy, test.want)
+		}
+		fd0.Close()
+		fd1.Close()
+	}
+}
+
 type handshakeAuthTest struct {
 	input       string
 	isPlain     bool
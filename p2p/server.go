@@ -22,7 +22,6 @@ import (
 	"crypto/ecdsa"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"net"
 	"sort"
 	"sync"
@@ -58,6 +57,14 @@ const (
 	// This time limits inbound connection attempts per source IP.
 	inboundThrottleTime = 30 * time.Second
 
+	// Inbound connection attempts are counted against MaxInboundAttempts
+	// within this window.
+	inboundAttemptWindow = 10 * time.Minute
+
+	// Prefix lengths of the networks limited by MaxInboundPerSubnet.
+	inboundSubnetV4 = 24
+	inboundSubnetV6 = 64
+
 	// Maximum time allowed for reading a complete message.
 	// This is effectively the amount of time a connection can be idle.
 	frameReadTimeout = 30 * time.Second
@@ -66,7 +73,17 @@ const (
 	frameWriteTimeout = 20 * time.Second
 )
 
-var errServerStopped = errors.New("server stopped")
+var (
+	errServerStopped = errors.New("server stopped")
+
+	// Inbound connection rejection reasons.
+	errInboundNotWhitelisted = errors.New("not whitelisted in NetRestrict")
+	errInboundBanned         = errors.New("banned")
+	errInboundThrottled      = errors.New("too many attempts")
+	errInboundAttempts       = errors.New("too many recent attempts")
+	errTooManyFromIP         = errors.New("too many inbound peers from IP")
+	errTooManyFromSubnet     = errors.New("too many inbound peers from subnet")
+)
 
 // Config holds Server options.
 type Config struct {
@@ -87,6 +104,19 @@ type Config struct {
 	// Setting DialRatio to zero defaults it to 3.
 	DialRatio int `toml:",omitempty"`
 
+	// MaxInboundPerIP limits the number of inbound peers connected from a single
+	// IP address. Trusted peers are not counted. Zero means no limit.
+	MaxInboundPerIP int `toml:",omitempty"`
+
+	// MaxInboundPerSubnet limits the number of inbound peers connected from a
+	// single /24 IPv4 or /64 IPv6 network. Trusted peers are not counted. Zero
+	// means no limit.
+	MaxInboundPerSubnet int `toml:",omitempty"`
+
+	// MaxInboundAttempts limits the number of inbound connection attempts accepted
+	// from a single Internet IP address within ten minutes. Zero means no limit.
+	MaxInboundAttempts int `toml:",omitempty"`
+
 	// NoDiscovery can be used to disable the peer discovery mechanism.
 	// Disabling is useful for protocol debugging (manual topology).
 	NoDiscovery bool
@@ -95,6 +125,11 @@ type Config struct {
 	// protocol should be started or not.
 	DiscoveryV5 bool `toml:",omitempty"`
 
+	// DiscoveryV5ENR specifies whether the ENR-based discovery v5 protocol
+	// should be started or not. It runs on the same UDP socket as the other
+	// discovery protocols.
+	DiscoveryV5ENR bool `toml:",omitempty"`
+
 	// Name sets the node name of this server.
 	// Use common.MakeName to create a name that follows existing conventions.
 	Name string `toml:"-"`
@@ -108,6 +143,11 @@ type Config struct {
 	// protocol.
 	BootstrapNodesV5 []*discv5.Node `toml:",omitempty"`
 
+	// BootstrapNodesV5ENR are used to establish connectivity
+	// with the rest of the network using the ENR-based V5
+	// discovery protocol.
+	BootstrapNodesV5ENR []*enode.Node `toml:",omitempty"`
+
 	// Static nodes are used as pre-configured connections which are always
 	// maintained and re-connected on disconnects.
 	StaticNodes []*enode.Node
@@ -154,6 +194,12 @@ type Config struct {
 	// whenever a message is sent to or received from a peer
 	EnableMsgEvents bool
 
+	// If CaptureFile is set, all protocol messages exchanged with peers are
+	// recorded to this file. It is rotated when its size exceeds CaptureFileSize
+	// bytes (64 MB if zero). Use ReadCapture to load the recorded messages.
+	CaptureFile     string `toml:",omitempty"`
+	CaptureFileSize int64  `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 }
@@ -178,11 +224,15 @@ type Server struct {
 	peerFeed     event.Feed
 	log          log.Logger
 
-	nodedb    *enode.DB
-	localnode *enode.LocalNode
-	ntab      *discover.UDPv4
-	DiscV5    *discv5.Network
-	discmix   *enode.FairMix
+	nodedb     *enode.DB
+	reputation *reputation
+	bans       *banList
+	capture    *captureWriter
+	localnode  *enode.LocalNode
+	ntab       *discover.UDPv4
+	ntabV5     *discover.UDPv5
+	DiscV5     *discv5.Network
+	discmix    *enode.FairMix
 
 	staticNodeResolver nodeResolver
 
@@ -199,7 +249,9 @@ type Server struct {
 	checkpointAddPeer       chan *conn
 
 	// State of run loop and listenLoop.
-	inboundHistory expHeap
+	inboundHistory      expHeap
+	inboundAttempts     expHeap        // recent attempts, for MaxInboundAttempts
+	inboundAttemptCount map[string]int // number of recent attempts per IP
 }
 
 type peerOpFunc func(map[enode.ID]*Peer)
@@ -363,6 +415,38 @@ func (srv *Server) RemoveTrustedPeer(node *enode.Node) {
 	}
 }
 
+// BanPeer refuses connections to and from the given target for duration d and
+// disconnects matching peers. The target can be an enode URL, ENR, node ID, IP
+// address or CIDR network. A zero duration bans permanently. Bans are stored in
+// the node database and survive restarts.
+func (srv *Server) BanPeer(target string, d time.Duration) error {
+	if srv.bans == nil {
+		return errServerStopped
+	}
+	if err := srv.bans.add(target, d); err != nil {
+		return err
+	}
+	for _, p := range srv.Peers() {
+		if srv.bans.isBanned(p.ID(), netutil.AddrIP(p.RemoteAddr())) {
+			p.Disconnect(DiscUselessPeer)
+		}
+	}
+	return nil
+}
+
+// UnbanPeer lifts a ban created by BanPeer. It reports whether the target was banned.
+func (srv *Server) UnbanPeer(target string) (bool, error) {
+	if srv.bans == nil {
+		return false, errServerStopped
+	}
+	return srv.bans.remove(target)
+}
+
+// Bans returns the active bans.
+func (srv *Server) Bans() []Ban {
+	return srv.bans.list()
+}
+
 // SubscribePeers subscribes the given channel to peer events
 func (srv *Server) SubscribeEvents(ch chan *PeerEvent) event.Subscription {
 	return srv.peerFeed.Subscribe(ch)
@@ -476,9 +560,18 @@ func (srv *Server) Start() (err error) {
 	if err := srv.setupDiscovery(); err != nil {
 		return err
 	}
+	if srv.CaptureFile != "" {
+		w, err := newCaptureWriter(srv.CaptureFile, srv.CaptureFileSize)
+		if err != nil {
+			return err
+		}
+		srv.capture = w
+	}
 
 	dynPeers := srv.maxDialedConns()
 	dialer := newDialState(srv.localnode.ID(), dynPeers, &srv.Config)
+	dialer.rep = srv.reputation
+	dialer.bans = srv.bans
 	srv.loopWG.Add(1)
 	go srv.run(dialer)
 	return nil
@@ -499,6 +592,8 @@ func (srv *Server) setupLocalNode() error {
 		return err
 	}
 	srv.nodedb = db
+	srv.reputation = newReputation(db)
+	srv.bans = newBanList(db)
 	srv.localnode = enode.NewLocalNode(db, srv.PrivateKey)
 	srv.localnode.SetFallbackIP(net.IP{127, 0, 0, 1})
 	// TODO: check conflicts
@@ -541,7 +636,7 @@ func (srv *Server) setupDiscovery() error {
 	}
 
 	// Don't listen on UDP endpoint if DHT is disabled.
-	if srv.NoDiscovery && !srv.DiscoveryV5 {
+	if srv.NoDiscovery && !srv.DiscoveryV5 && !srv.DiscoveryV5ENR {
 		return nil
 	}
 
@@ -562,13 +657,15 @@ func (srv *Server) setupDiscovery() error {
 	}
 	srv.localnode.SetFallbackUDP(realaddr.Port)
 
+	// All discovery protocols share the UDP socket. The first listener reads from
+	// the socket, packets it can't handle are passed on to the next one.
+	var readConn discover.UDPConn = conn
+
 	// Discovery V4
-	var unhandled chan discover.ReadPacket
-	var sconn *sharedUDPConn
 	if !srv.NoDiscovery {
-		if srv.DiscoveryV5 {
+		var unhandled chan discover.ReadPacket
+		if srv.DiscoveryV5ENR || srv.DiscoveryV5 {
 			unhandled = make(chan discover.ReadPacket, 100)
-			sconn = &sharedUDPConn{conn, unhandled}
 		}
 		cfg := discover.Config{
 			PrivateKey:  srv.PrivateKey,
@@ -577,24 +674,48 @@ func (srv *Server) setupDiscovery() error {
 			Unhandled:   unhandled,
 			Log:         srv.log,
 		}
-		ntab, err := discover.ListenUDP(conn, srv.localnode, cfg)
+		ntab, err := discover.ListenUDP(readConn, srv.localnode, cfg)
 		if err != nil {
 			return err
 		}
 		srv.ntab = ntab
 		srv.discmix.AddSource(ntab.RandomNodes())
 		srv.staticNodeResolver = ntab
+		if unhandled != nil {
+			readConn = &sharedUDPConn{conn, unhandled}
+		}
 	}
 
-	// Discovery V5
-	if srv.DiscoveryV5 {
-		var ntab *discv5.Network
-		var err error
-		if sconn != nil {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, sconn, "", srv.NetRestrict)
-		} else {
-			ntab, err = discv5.ListenUDP(srv.PrivateKey, conn, "", srv.NetRestrict)
+	// Discovery V5 (ENR-based)
+	if srv.DiscoveryV5ENR {
+		var unhandled chan discover.ReadPacket
+		if srv.DiscoveryV5 {
+			unhandled = make(chan discover.ReadPacket, 100)
+		}
+		cfg := discover.Config{
+			PrivateKey:  srv.PrivateKey,
+			NetRestrict: srv.NetRestrict,
+			Bootnodes:   srv.BootstrapNodesV5ENR,
+			Unhandled:   unhandled,
+			Log:         srv.log,
+		}
+		ntab, err := discover.ListenV5(readConn, srv.localnode, cfg)
+		if err != nil {
+			return err
+		}
+		srv.ntabV5 = ntab
+		srv.discmix.AddSource(ntab.RandomNodes())
+		if srv.staticNodeResolver == nil {
+			srv.staticNodeResolver = ntab
 		}
+		if unhandled != nil {
+			readConn = &sharedUDPConn{conn, unhandled}
+		}
+	}
+
+	// Discovery V5 (topic discovery)
+	if srv.DiscoveryV5 {
+		ntab, err := discv5.ListenUDP(srv.PrivateKey, readConn, "", srv.NetRestrict)
 		if err != nil {
 			return err
 		}
@@ -644,6 +765,9 @@ func (srv *Server) run(dialstate dialer) {
 	defer srv.loopWG.Done()
 	defer srv.nodedb.Close()
 	defer srv.discmix.Close()
+	if srv.capture != nil {
+		defer srv.capture.close()
+	}
 
 	var (
 		peers        = make(map[enode.ID]*Peer)
@@ -658,6 +782,13 @@ func (srv *Server) run(dialstate dialer) {
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID()] = true
 	}
+	// Restore the static and trusted nodes added at runtime before the last shutdown.
+	for _, n := range srv.nodedb.TrustedNodes() {
+		trusted[n.ID()] = true
+	}
+	for _, n := range srv.nodedb.StaticNodes() {
+		dialstate.addStatic(n)
+	}
 
 	// removes t from runningTasks
 	delTask := func(t task) {
@@ -704,6 +835,9 @@ running:
 			// it will keep the node connected.
 			srv.log.Trace("Adding static node", "node", n)
 			dialstate.addStatic(n)
+			if err := srv.nodedb.StoreStaticNode(n); err != nil {
+				srv.log.Warn("Failed to store static node", "node", n, "err", err)
+			}
 
 		case n := <-srv.removestatic:
 			// This channel is used by RemovePeer to send a
@@ -711,6 +845,7 @@ running:
 			// stop keeping the node connected.
 			srv.log.Trace("Removing static node", "node", n)
 			dialstate.removeStatic(n)
+			srv.nodedb.DeleteStaticNode(n.ID())
 			if p, ok := peers[n.ID()]; ok {
 				p.Disconnect(DiscRequested)
 			}
@@ -720,6 +855,9 @@ running:
 			// to the trusted node set.
 			srv.log.Trace("Adding trusted node", "node", n)
 			trusted[n.ID()] = true
+			if err := srv.nodedb.StoreTrustedNode(n); err != nil {
+				srv.log.Warn("Failed to store trusted node", "node", n, "err", err)
+			}
 			// Mark any already-connected peer as trusted
 			if p, ok := peers[n.ID()]; ok {
 				p.rw.set(trustedConn, true)
@@ -730,6 +868,7 @@ running:
 			// from the trusted node set.
 			srv.log.Trace("Removing trusted node", "node", n)
 			delete(trusted, n.ID())
+			srv.nodedb.DeleteTrustedNode(n.ID())
 
 			// Unmark any already-connected peer as trusted
 			if p, ok := peers[n.ID()]; ok {
@@ -766,11 +905,13 @@ running:
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(srv.log, c, srv.Protocols)
+				p.rep = srv.reputation
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
 					p.events = &srv.peerFeed
 				}
+				p.capture = srv.capture
 				name := truncateName(c.name)
 				p.log.Debug("Adding p2p peer", "addr", p.RemoteAddr(), "peers", len(peers)+1, "name", name)
 				go srv.runPeer(p)
@@ -804,6 +945,9 @@ running:
 	if srv.ntab != nil {
 		srv.ntab.Close()
 	}
+	if srv.ntabV5 != nil {
+		srv.ntabV5.Close()
+	}
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
@@ -831,6 +975,48 @@ func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount in
 		return DiscAlreadyConnected
 	case c.node.ID() == srv.localnode.ID():
 		return DiscSelf
+	case srv.bans.isBanned(c.node.ID(), netutil.AddrIP(c.fd.RemoteAddr())):
+		return DiscUselessPeer
+	case !c.is(trustedConn) && srv.reputation.isBanned(c.node.ID()):
+		return DiscUselessPeer
+	case !c.is(trustedConn) && c.is(inboundConn):
+		return srv.checkInboundLimits(peers, c)
+	default:
+		return nil
+	}
+}
+
+// checkInboundLimits enforces MaxInboundPerIP and MaxInboundPerSubnet.
+func (srv *Server) checkInboundLimits(peers map[enode.ID]*Peer, c *conn) error {
+	ip := netutil.AddrIP(c.fd.RemoteAddr())
+	if ip == nil || (srv.MaxInboundPerIP == 0 && srv.MaxInboundPerSubnet == 0) {
+		return nil
+	}
+	bits := uint(inboundSubnetV6)
+	if ip.To4() != nil {
+		bits = inboundSubnetV4
+	}
+	var sameIP, sameNet int
+	for _, p := range peers {
+		if !p.rw.is(inboundConn) || p.rw.is(trustedConn) {
+			continue
+		}
+		pip := netutil.AddrIP(p.RemoteAddr())
+		if pip == nil {
+			continue
+		}
+		if pip.Equal(ip) {
+			sameIP++
+		}
+		if netutil.SameNet(bits, ip, pip) {
+			sameNet++
+		}
+	}
+	switch {
+	case srv.MaxInboundPerIP > 0 && sameIP >= srv.MaxInboundPerIP:
+		return errTooManyFromIP
+	case srv.MaxInboundPerSubnet > 0 && sameNet >= srv.MaxInboundPerSubnet:
+		return errTooManyFromSubnet
 	default:
 		return nil
 	}
@@ -899,6 +1085,7 @@ func (srv *Server) listenLoop() {
 		remoteIP := netutil.AddrIP(fd.RemoteAddr())
 		if err := srv.checkInboundConn(fd, remoteIP); err != nil {
 			srv.log.Debug("Rejected inbound connnection", "addr", fd.RemoteAddr(), "err", err)
+			markInboundReject(err)
 			fd.Close()
 			slots <- struct{}{}
 			continue
@@ -922,18 +1109,51 @@ func (srv *Server) checkInboundConn(fd net.Conn, remoteIP net.IP) error {
 	if remoteIP != nil {
 		// Reject connections that do not match NetRestrict.
 		if srv.NetRestrict != nil && !srv.NetRestrict.Contains(remoteIP) {
-			return fmt.Errorf("not whitelisted in NetRestrict")
+			return errInboundNotWhitelisted
+		}
+		// Reject banned addresses.
+		if srv.bans.isBannedIP(remoteIP) {
+			return errInboundBanned
 		}
 		// Reject Internet peers that try too often.
-		srv.inboundHistory.expire(time.Now())
+		now := time.Now()
+		srv.inboundHistory.expire(now, nil)
+		if !netutil.IsLAN(remoteIP) && srv.MaxInboundAttempts > 0 {
+			if srv.countInboundAttempt(remoteIP, now) > srv.MaxInboundAttempts {
+				return errInboundAttempts
+			}
+		}
 		if !netutil.IsLAN(remoteIP) && srv.inboundHistory.contains(remoteIP.String()) {
-			return fmt.Errorf("too many attempts")
+			return errInboundThrottled
 		}
-		srv.inboundHistory.add(remoteIP.String(), time.Now().Add(inboundThrottleTime))
+		srv.inboundHistory.add(remoteIP.String(), now.Add(inboundThrottleTime))
 	}
 	return nil
 }
 
+// countInboundAttempt records a connection attempt from ip and returns the number
+// of attempts within inboundAttemptWindow. Attempts beyond MaxInboundAttempts are
+// not recorded, which keeps the history bounded.
+func (srv *Server) countInboundAttempt(ip net.IP, now time.Time) int {
+	if srv.inboundAttemptCount == nil {
+		srv.inboundAttemptCount = make(map[string]int)
+	}
+	srv.inboundAttempts.expire(now, func(key string) {
+		if srv.inboundAttemptCount[key] <= 1 {
+			delete(srv.inboundAttemptCount, key)
+		} else {
+			srv.inboundAttemptCount[key]--
+		}
+	})
+	key := ip.String()
+	n := srv.inboundAttemptCount[key]
+	if n < srv.MaxInboundAttempts {
+		srv.inboundAttempts.add(key, now.Add(inboundAttemptWindow))
+		srv.inboundAttemptCount[key] = n + 1
+	}
+	return n + 1
+}
+
 // SetupConn runs the handshakes and attempts to add the connection
 // as a peer. It returns when the connection has been added as a peer
 // or the handshakes have failed.
@@ -983,8 +1203,7 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 	clog := srv.log.New("id", c.node.ID(), "addr", c.fd.RemoteAddr(), "conn", c.flags)
 	err = srv.checkpoint(c, srv.checkpointPostHandshake)
 	if err != nil {
-		clog.Trace("Rejected peer", "err", err)
-		return err
+		return srv.rejectConn(clog, c, err)
 	}
 
 	// Run the capability negotiation handshake.
@@ -1000,8 +1219,7 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 	c.caps, c.name = phs.Caps, phs.Name
 	err = srv.checkpoint(c, srv.checkpointAddPeer)
 	if err != nil {
-		clog.Trace("Rejected peer", "err", err)
-		return err
+		return srv.rejectConn(clog, c, err)
 	}
 
 	// If the checks completed successfully, the connection has been added as a peer and
@@ -1010,6 +1228,23 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 	return nil
 }
 
+// rejectConn logs the rejection of a connection by the post-handshake checks and
+// returns the error to disconnect it with. The per-IP and per-subnet inbound limits
+// are reported to the remote end as DiscTooManyPeers.
+func (srv *Server) rejectConn(clog log.Logger, c *conn, err error) error {
+	if c.is(inboundConn) {
+		markInboundReject(err)
+	}
+	switch err {
+	case errTooManyFromIP, errTooManyFromSubnet:
+		clog.Debug("Rejected inbound peer", "err", err)
+		return DiscTooManyPeers
+	default:
+		clog.Trace("Rejected peer", "err", err)
+		return err
+	}
+}
+
 func nodeFromConn(pubkey *ecdsa.PublicKey, conn net.Conn) *enode.Node {
 	var ip net.IP
 	var port int
@@ -20,8 +20,11 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -29,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/testlog"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/enode"
 	"github.com/ethereum/go-ethereum/p2p/enr"
 	"golang.org/x/crypto/sha3"
@@ -694,6 +698,183 @@ func TestServerInboundThrottle(t *testing.T) {
 	}
 }
 
+func TestServerInboundAttempts(t *testing.T) {
+	srv := &Server{Config: Config{MaxInboundAttempts: 2}}
+	var (
+		ip  = net.IP{95, 33, 21, 2}
+		lan = net.IP{192, 168, 0, 1}
+	)
+	if err := srv.checkInboundConn(nil, ip); err != nil {
+		t.Fatalf("first attempt rejected: %v", err)
+	}
+	if err := srv.checkInboundConn(nil, ip); err != errInboundThrottled {
+		t.Fatalf("wrong error for second attempt: %v", err)
+	}
+	// Clear the short-term history. The third attempt still exceeds the limit.
+	srv.inboundHistory = nil
+	if err := srv.checkInboundConn(nil, ip); err != errInboundAttempts {
+		t.Fatalf("wrong error for third attempt: %v", err)
+	}
+	// LAN addresses are not limited.
+	for i := 0; i < 5; i++ {
+		if err := srv.checkInboundConn(nil, lan); err != nil {
+			t.Fatalf("LAN attempt %d rejected: %v", i, err)
+		}
+	}
+	// Attempts are forgotten after the window passes.
+	srv.inboundHistory = nil
+	if n := srv.countInboundAttempt(ip, time.Now().Add(inboundAttemptWindow+time.Second)); n != 1 {
+		t.Fatalf("wrong attempt count after window: %d", n)
+	}
+}
+
+func TestServerInboundLimits(t *testing.T) {
+	db, _ := enode.OpenDB("")
+	defer db.Close()
+	srv := &Server{
+		Config:    Config{MaxPeers: 10, MaxInboundPerIP: 1, MaxInboundPerSubnet: 2},
+		localnode: enode.NewLocalNode(db, newkey()),
+	}
+	newConn := func(ip net.IP, flags connFlag) *conn {
+		pipe, _ := net.Pipe()
+		fd := &fakeAddrConn{pipe, &net.TCPAddr{IP: ip, Port: 30303}}
+		return &conn{fd: fd, node: enode.SignNull(new(enr.Record), randomID()), flags: flags}
+	}
+	peers := make(map[enode.ID]*Peer)
+	addPeer := func(c *conn) {
+		peers[c.node.ID()] = newPeer(log.Root(), c, nil)
+	}
+	addPeer(newConn(net.IP{95, 33, 21, 2}, inboundConn))
+	addPeer(newConn(net.IP{95, 33, 22, 2}, inboundConn))
+	addPeer(newConn(net.ParseIP("2001:db8::1"), inboundConn))
+	addPeer(newConn(net.IP{95, 33, 21, 5}, dynDialedConn))
+	addPeer(newConn(net.IP{95, 33, 21, 6}, inboundConn|trustedConn))
+
+	tests := []struct {
+		ip    net.IP
+		flags connFlag
+		want  error
+	}{
+		{net.IP{95, 33, 21, 2}, inboundConn, errTooManyFromIP},
+		{net.IP{95, 33, 21, 2}, inboundConn | trustedConn, nil},
+		{net.IP{95, 33, 21, 2}, dynDialedConn, nil},
+		{net.IP{95, 33, 21, 3}, inboundConn, nil},
+		{net.IP{95, 33, 22, 3}, inboundConn, nil},
+		{net.ParseIP("2001:db8::2"), inboundConn, nil},
+		{net.ParseIP("2001:db8:0:1::1"), inboundConn, nil},
+	}
+	for i, test := range tests {
+		if err := srv.postHandshakeChecks(peers, 3, newConn(test.ip, test.flags)); err != test.want {
+			t.Errorf("test %d: wrong error %v, want %v", i, err, test.want)
+		}
+	}
+
+	// Fill the /24 and check the subnet limit.
+	addPeer(newConn(net.IP{95, 33, 21, 3}, inboundConn))
+	if err := srv.postHandshakeChecks(peers, 4, newConn(net.IP{95, 33, 21, 4}, inboundConn)); err != errTooManyFromSubnet {
+		t.Errorf("wrong error for full subnet: %v", err)
+	}
+	addPeer(newConn(net.ParseIP("2001:db8::2"), inboundConn))
+	if err := srv.postHandshakeChecks(peers, 5, newConn(net.ParseIP("2001:db8::3"), inboundConn)); err != errTooManyFromSubnet {
+		t.Errorf("wrong error for full IPv6 subnet: %v", err)
+	}
+}
+
+func TestServerPersistentPeers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "p2p-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		dbpath  = filepath.Join(dir, "nodes")
+		static  = enode.NewV4(&newkey().PublicKey, net.IP{10, 0, 0, 1}, 30303, 30303)
+		trusted = enode.NewV4(&newkey().PublicKey, net.IP{10, 0, 0, 2}, 30303, 30303)
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:   newkey(),
+			MaxPeers:     10,
+			NoDial:       true,
+			NoDiscovery:  true,
+			NodeDatabase: dbpath,
+			Logger:       testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatal("can't start: ", err)
+	}
+	srv.AddPeer(static)
+	srv.AddTrustedPeer(trusted)
+	if err := srv.BanPeer("10.0.1.0/24", time.Hour); err != nil {
+		t.Fatal("can't ban: ", err)
+	}
+	srv.Peers() // wait for the run loop to process the additions
+	srv.Stop()
+
+	db, err := enode.OpenDB(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if nodes := db.StaticNodes(); len(nodes) != 1 || nodes[0].ID() != static.ID() {
+		t.Errorf("wrong static nodes: %v", nodes)
+	}
+	if nodes := db.TrustedNodes(); len(nodes) != 1 || nodes[0].ID() != trusted.ID() {
+		t.Errorf("wrong trusted nodes: %v", nodes)
+	}
+	if bans := newBanList(db).list(); len(bans) != 1 || bans[0].Target != "10.0.1.0/24" {
+		t.Errorf("wrong bans: %v", bans)
+	}
+}
+
+// This test checks that connections exceeding the inbound limits are disconnected
+// with DiscTooManyPeers.
+func TestServerInboundLimitsDisconnect(t *testing.T) {
+	var tp *testTransport
+	srv := &Server{
+		Config: Config{
+			PrivateKey:      newkey(),
+			MaxPeers:        10,
+			MaxInboundPerIP: 1,
+			NoDial:          true,
+			NoDiscovery:     true,
+			Logger:          testlog.Logger(t, log.LvlTrace),
+		},
+		newTransport: func(fd net.Conn) transport {
+			tp = newTestTransport(&newkey().PublicKey, fd).(*testTransport)
+			return tp
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("couldn't start server: %v", err)
+	}
+	defer srv.Stop()
+
+	var remotes []net.Conn
+	defer func() {
+		for _, c := range remotes {
+			c.Close()
+		}
+	}()
+	setup := func() error {
+		fd, remote := net.Pipe()
+		remotes = append(remotes, remote)
+		addr := &net.TCPAddr{IP: net.IP{95, 33, 21, 2}, Port: 30303}
+		return srv.SetupConn(&fakeAddrConn{fd, addr}, inboundConn, nil)
+	}
+	if err := setup(); err != nil {
+		t.Fatalf("first connection rejected: %v", err)
+	}
+	if err := setup(); err != DiscTooManyPeers {
+		t.Fatalf("wrong error for second connection: %v", err)
+	}
+	if tp.closeErr != DiscTooManyPeers {
+		t.Fatalf("wrong disconnect reason: %v", tp.closeErr)
+	}
+}
+
 func listenFakeAddr(network, laddr string, remoteAddr net.Addr) (net.Listener, error) {
 	l, err := net.Listen(network, laddr)
 	if err == nil {
@@ -724,3 +905,47 @@ func (l *fakeAddrListener) Accept() (net.Conn, error) {
 func (c *fakeAddrConn) RemoteAddr() net.Addr {
 	return c.remoteAddr
 }
+
+// This test checks that all discovery protocols can run on the shared UDP socket.
+func TestServerDiscoverySharedSocket(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			Name:           "test",
+			MaxPeers:       10,
+			ListenAddr:     "127.0.0.1:0",
+			PrivateKey:     newkey(),
+			DiscoveryV5:    true,
+			DiscoveryV5ENR: true,
+			NoDial:         true,
+			Logger:         testlog.Logger(t, log.LvlTrace),
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start server: %v", err)
+	}
+	defer srv.Stop()
+
+	if srv.ntab == nil || srv.ntabV5 == nil || srv.DiscV5 == nil {
+		t.Fatal("discovery not running")
+	}
+	// Ping the server using discovery v5. The packet is read by the v4
+	// listener and passed on to the v5 listener.
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IP{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _ := enode.OpenDB("")
+	key := newkey()
+	ln := enode.NewLocalNode(db, key)
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(socket.LocalAddr().(*net.UDPAddr).Port)
+	client, err := discover.ListenV5(socket, ln, discover.Config{PrivateKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if err := client.Ping(srv.Self()); err != nil {
+		t.Fatalf("v5 ping failed: %v", err)
+	}
+}
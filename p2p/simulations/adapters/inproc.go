@@ -17,10 +17,12 @@
 package adapters
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math"
 	"net"
+	"sort"
 	"sync"
 
 	"github.com/ethereum/go-ethereum/event"
@@ -40,6 +42,28 @@ type SimAdapter struct {
 	mtx      sync.RWMutex
 	nodes    map[enode.ID]*SimNode
 	services map[string]ServiceFunc
+
+	linkMu      sync.Mutex
+	links       map[linkKey]*pipes.Link // nil unless link conditions are used
+	customLinks map[linkKey]bool        // links configured by SetLink
+	defaultLink pipes.LinkConfig
+}
+
+// NodeLink describes the conditions of the link between two nodes.
+type NodeLink struct {
+	One    enode.ID         `json:"one"`
+	Other  enode.ID         `json:"other"`
+	Config pipes.LinkConfig `json:"config"`
+}
+
+// linkKey identifies the link between two nodes, regardless of direction.
+type linkKey [2]enode.ID
+
+func newLinkKey(a, b enode.ID) linkKey {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+	return linkKey{a, b}
 }
 
 // NewSimAdapter creates a SimAdapter which is capable of running in-memory
@@ -62,6 +86,16 @@ func NewTCPAdapter(services map[string]ServiceFunc) *SimAdapter {
 	}
 }
 
+// Clone returns a new adapter running the same services over the same kind of
+// connections as s, without any of the nodes or link conditions of s.
+func (s *SimAdapter) Clone() *SimAdapter {
+	return &SimAdapter{
+		pipe:     s.pipe,
+		nodes:    make(map[enode.ID]*SimNode),
+		services: s.services,
+	}
+}
+
 // Name returns the name of the adapter for logging purposes
 func (s *SimAdapter) Name() string {
 	return "sim-adapter"
@@ -103,7 +137,7 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 			PrivateKey:      config.PrivateKey,
 			MaxPeers:        math.MaxInt32,
 			NoDiscovery:     true,
-			Dialer:          s,
+			Dialer:          &simDialer{s, id},
 			EnableMsgEvents: config.EnableMsgEvents,
 		},
 		NoUSB:  true,
@@ -124,9 +158,126 @@ func (s *SimAdapter) NewNode(config *NodeConfig) (Node, error) {
 	return simNode, nil
 }
 
+// SetDefaultLink sets the conditions of all links which are not configured
+// individually, including links of open connections.
+//
+// Link conditions only apply to connections created after the first call to
+// SetDefaultLink or SetLink.
+func (s *SimAdapter) SetDefaultLink(cfg pipes.LinkConfig) {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	s.initLinks()
+	s.defaultLink = cfg
+	for key, l := range s.links {
+		if !s.customLinks[key] {
+			l.SetConfig(cfg)
+		}
+	}
+}
+
+// DefaultLink returns the default link conditions.
+func (s *SimAdapter) DefaultLink() pipes.LinkConfig {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	return s.defaultLink
+}
+
+// SetLink sets the conditions of the link between nodes a and b. The change
+// also applies to open connections between the nodes.
+func (s *SimAdapter) SetLink(a, b enode.ID, cfg pipes.LinkConfig) {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	s.initLinks()
+	key := newLinkKey(a, b)
+	s.customLinks[key] = true
+	if l := s.links[key]; l != nil {
+		l.SetConfig(cfg)
+	} else {
+		s.links[key] = pipes.NewLink(cfg)
+	}
+}
+
+// ResetLink reverts the link between nodes a and b to the default conditions.
+func (s *SimAdapter) ResetLink(a, b enode.ID) {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	key := newLinkKey(a, b)
+	if !s.customLinks[key] {
+		return
+	}
+	delete(s.customLinks, key)
+	s.links[key].SetConfig(s.defaultLink)
+}
+
+// Link returns the conditions of the link between nodes a and b.
+func (s *SimAdapter) Link(a, b enode.ID) pipes.LinkConfig {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	if l := s.links[newLinkKey(a, b)]; l != nil {
+		return l.Config()
+	}
+	return s.defaultLink
+}
+
+// Links returns all individually configured links.
+func (s *SimAdapter) Links() []NodeLink {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	links := make([]NodeLink, 0, len(s.customLinks))
+	for key := range s.customLinks {
+		links = append(links, NodeLink{One: key[0], Other: key[1], Config: s.links[key].Config()})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].One != links[j].One {
+			return bytes.Compare(links[i].One[:], links[j].One[:]) < 0
+		}
+		return bytes.Compare(links[i].Other[:], links[j].Other[:]) < 0
+	})
+	return links
+}
+
+func (s *SimAdapter) initLinks() {
+	if s.links == nil {
+		s.links = make(map[linkKey]*pipes.Link)
+		s.customLinks = make(map[linkKey]bool)
+	}
+}
+
+// link returns the link between nodes a and b, creating it if necessary. It
+// returns nil if link conditions are not used.
+func (s *SimAdapter) link(a, b enode.ID) *pipes.Link {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	if s.links == nil {
+		return nil
+	}
+	key := newLinkKey(a, b)
+	l := s.links[key]
+	if l == nil {
+		l = pipes.NewLink(s.defaultLink)
+		s.links[key] = l
+	}
+	return l
+}
+
+// simDialer dials on behalf of a single node, applying the conditions of
+// the link between the dialing node and the destination.
+type simDialer struct {
+	adapter *SimAdapter
+	src     enode.ID
+}
+
+func (d *simDialer) Dial(dest *enode.Node) (net.Conn, error) {
+	return d.adapter.dial(d.adapter.link(d.src, dest.ID()), dest)
+}
+
 // Dial implements the p2p.NodeDialer interface by connecting to the node using
 // an in-memory net.Pipe
 func (s *SimAdapter) Dial(dest *enode.Node) (conn net.Conn, err error) {
+	return s.dial(nil, dest)
+}
+
+func (s *SimAdapter) dial(link *pipes.Link, dest *enode.Node) (conn net.Conn, err error) {
 	node, ok := s.GetNode(dest.ID())
 	if !ok {
 		return nil, fmt.Errorf("unknown node: %s", dest.ID())
@@ -136,7 +287,12 @@ func (s *SimAdapter) Dial(dest *enode.Node) (conn net.Conn, err error) {
 		return nil, fmt.Errorf("node not running: %s", dest.ID())
 	}
 	// SimAdapter.pipe is net.Pipe (NewSimAdapter)
-	pipe1, pipe2, err := s.pipe()
+	var pipe1, pipe2 net.Conn
+	if link != nil {
+		pipe1, pipe2, err = link.Pipe(s.pipe)
+	} else {
+		pipe1, pipe2, err = s.pipe()
+	}
 	if err != nil {
 		return nil, err
 	}
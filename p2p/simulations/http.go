@@ -85,6 +85,42 @@ func (c *Client) LoadSnapshot(snap *Snapshot) error {
 	return c.Post("/snapshot", snap, nil)
 }
 
+// RunScenario runs a scenario in a separate simulation network and returns
+// the result
+func (c *Client) RunScenario(scenario *Scenario) (*ScenarioResult, error) {
+	result := &ScenarioResult{}
+	return result, c.Post("/scenario", scenario, result)
+}
+
+// GetLinks returns the link conditions of the network
+func (c *Client) GetLinks() (*NetworkLinks, error) {
+	links := &NetworkLinks{}
+	return links, c.Get("/links", links)
+}
+
+// SetDefaultLink sets the conditions of all links which are not configured
+// individually
+func (c *Client) SetDefaultLink(conditions LinkConditions) error {
+	return c.Post("/links", conditions, nil)
+}
+
+// GetLink returns the conditions of the link between a node and a peer node
+func (c *Client) GetLink(nodeID, peerID string) (*LinkConditions, error) {
+	conditions := &LinkConditions{}
+	return conditions, c.Get(fmt.Sprintf("/nodes/%s/link/%s", nodeID, peerID), conditions)
+}
+
+// SetLink sets the conditions of the link between a node and a peer node
+func (c *Client) SetLink(nodeID, peerID string, conditions LinkConditions) error {
+	return c.Post(fmt.Sprintf("/nodes/%s/link/%s", nodeID, peerID), conditions, nil)
+}
+
+// ResetLink reverts the link between a node and a peer node to the default
+// conditions
+func (c *Client) ResetLink(nodeID, peerID string) error {
+	return c.Delete(fmt.Sprintf("/nodes/%s/link/%s", nodeID, peerID))
+}
+
 // SubscribeOpts is a collection of options to use when subscribing to network
 // events
 type SubscribeOpts struct {
@@ -288,6 +324,9 @@ func NewServer(network *Network) *Server {
 	s.GET("/events", s.StreamNetworkEvents)
 	s.GET("/snapshot", s.CreateSnapshot)
 	s.POST("/snapshot", s.LoadSnapshot)
+	s.POST("/scenario", s.RunScenario)
+	s.GET("/links", s.GetLinks)
+	s.POST("/links", s.SetDefaultLink)
 	s.POST("/nodes", s.CreateNode)
 	s.GET("/nodes", s.GetNodes)
 	s.GET("/nodes/:nodeid", s.GetNode)
@@ -296,6 +335,9 @@ func NewServer(network *Network) *Server {
 	s.POST("/nodes/:nodeid/conn/:peerid", s.ConnectNode)
 	s.DELETE("/nodes/:nodeid/conn/:peerid", s.DisconnectNode)
 	s.GET("/nodes/:nodeid/rpc", s.NodeRPC)
+	s.GET("/nodes/:nodeid/link/:peerid", s.GetLink)
+	s.POST("/nodes/:nodeid/link/:peerid", s.SetLink)
+	s.DELETE("/nodes/:nodeid/link/:peerid", s.ResetLink)
 
 	return s
 }
@@ -554,6 +596,112 @@ func (s *Server) LoadSnapshot(w http.ResponseWriter, req *http.Request) {
 	s.JSON(w, http.StatusOK, s.network)
 }
 
+// RunScenario runs a scenario in a separate network using the adapter of the
+// simulation network and returns the result. In-process adapters are cloned, so
+// the nodes and link conditions of the scenario don't leak into the simulation
+// network.
+func (s *Server) RunScenario(w http.ResponseWriter, req *http.Request) {
+	scenario := &Scenario{}
+	if err := json.NewDecoder(req.Body).Decode(scenario); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adapter := s.network.nodeAdapter
+	if sim, ok := adapter.(*adapters.SimAdapter); ok {
+		adapter = sim.Clone()
+	}
+	network := NewNetwork(adapter, s.network.Config())
+	defer network.Shutdown()
+	result, err := RunScenario(req.Context(), network, scenario)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, result)
+}
+
+// GetLinks returns the link conditions of the network
+func (s *Server) GetLinks(w http.ResponseWriter, req *http.Request) {
+	links, err := s.network.Links()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, links)
+}
+
+// SetDefaultLink sets the default link conditions of the network
+func (s *Server) SetDefaultLink(w http.ResponseWriter, req *http.Request) {
+	var c LinkConditions
+	if err := json.NewDecoder(req.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.network.SetDefaultLink(c); err == errNoLinkAdapter {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, c)
+}
+
+// GetLink returns the conditions of the link between a node and a peer node
+func (s *Server) GetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	c, err := s.network.Link(node.ID(), peer.ID())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, c)
+}
+
+// SetLink sets the conditions of the link between a node and a peer node
+func (s *Server) SetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	var c LinkConditions
+	if err := json.NewDecoder(req.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.network.SetLink(node.ID(), peer.ID(), c); err == errNoLinkAdapter {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.JSON(w, http.StatusOK, c)
+}
+
+// ResetLink reverts the link between a node and a peer node to the default
+// conditions
+func (s *Server) ResetLink(w http.ResponseWriter, req *http.Request) {
+	node := req.Context().Value("node").(*Node)
+	peer := req.Context().Value("peer").(*Node)
+
+	if err := s.network.ResetLink(node.ID(), peer.ID()); err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // CreateNode creates a node in the network using the given configuration
 func (s *Server) CreateNode(w http.ResponseWriter, req *http.Request) {
 	config := &adapters.NodeConfig{}
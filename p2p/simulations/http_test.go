@@ -868,3 +868,142 @@ func TestMsgFilterFailBadParams(t *testing.T) {
 		t.Fatalf("expected event subscription to fail but succeeded!")
 	}
 }
+
+// TestHTTPScenario tests running a scenario using the HTTP API
+func TestHTTPScenario(t *testing.T) {
+	network, s := testHTTPServer(t)
+	defer s.Close()
+	defer network.Shutdown()
+
+	client := NewClient(s.URL)
+	result, err := client.RunScenario(&Scenario{
+		Name:       "star",
+		NodeCount:  3,
+		Services:   []string{"test"},
+		Topology:   TopologyStar,
+		Assertions: []ScenarioAssertion{{Kind: AssertConnected, Within: Duration(5 * time.Second)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed || len(result.Assertions) != 1 {
+		t.Fatalf("wrong result: %+v", result)
+	}
+	if len(network.GetNodes()) != 0 {
+		t.Fatal("scenario nodes added to the simulation network")
+	}
+
+	if _, err := client.RunScenario(&Scenario{Name: "empty"}); err == nil {
+		t.Fatal("expected error for scenario without nodes")
+	}
+}
+
+// TestHTTPScenarioLinks tests that the link conditions of a scenario run using
+// the HTTP API don't change the links of the simulation network
+func TestHTTPScenarioLinks(t *testing.T) {
+	network, s := testHTTPServer(t)
+	defer s.Close()
+	defer network.Shutdown()
+
+	client := NewClient(s.URL)
+	def := LinkConditions{Latency: Duration(10 * time.Millisecond)}
+	if err := client.SetDefaultLink(def); err != nil {
+		t.Fatalf("error setting default link: %s", err)
+	}
+	before, err := client.GetLinks()
+	if err != nil {
+		t.Fatalf("error getting links: %s", err)
+	}
+	result, err := client.RunScenario(&Scenario{
+		Name:       "links",
+		NodeCount:  2,
+		Services:   []string{"test"},
+		Topology:   TopologyStar,
+		Link:       &ScenarioLink{LinkConditions: LinkConditions{Latency: Duration(time.Millisecond)}},
+		Links:      []ScenarioLink{{Nodes: [2]string{"node1", "node2"}, LinkConditions: LinkConditions{Bandwidth: 1 << 20}}},
+		Assertions: []ScenarioAssertion{{Kind: AssertConnected, Within: Duration(5 * time.Second)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Fatalf("wrong result: %+v", result)
+	}
+	after, err := client.GetLinks()
+	if err != nil {
+		t.Fatalf("error getting links: %s", err)
+	}
+	if after.Default != before.Default || len(after.Links) != len(before.Links) {
+		t.Fatalf("scenario changed the network links: before %+v, after %+v", before, after)
+	}
+}
+
+// TestHTTPLinks tests changing link conditions using the HTTP API
+func TestHTTPLinks(t *testing.T) {
+	adapter := adapters.NewSimAdapter(adapters.Services{
+		"noop": func(ctx *adapters.ServiceContext) (node.Service, error) {
+			return NewNoopService(nil), nil
+		},
+	})
+	network := NewNetwork(adapter, &NetworkConfig{DefaultService: "noop"})
+	s := httptest.NewServer(NewServer(network))
+	defer s.Close()
+	defer network.Shutdown()
+
+	client := NewClient(s.URL)
+	def := LinkConditions{Latency: Duration(10 * time.Millisecond)}
+	if err := client.SetDefaultLink(def); err != nil {
+		t.Fatalf("error setting default link: %s", err)
+	}
+	nodeIDs := startTestNetwork(t, client)
+	var one, other enode.ID
+	one.UnmarshalText([]byte(nodeIDs[0]))
+	other.UnmarshalText([]byte(nodeIDs[1]))
+	waitConn := func(up bool) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if conn := network.GetConn(one, other); conn != nil && conn.Up == up {
+				return
+			}
+		}
+		t.Fatalf("timeout waiting for connection up=%t", up)
+	}
+	waitConn(true)
+
+	// Configure the link and check it's reported.
+	cond := LinkConditions{Latency: Duration(50 * time.Millisecond), Bandwidth: 1 << 20}
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], cond); err != nil {
+		t.Fatalf("error setting link: %s", err)
+	}
+	got, err := client.GetLink(nodeIDs[1], nodeIDs[0])
+	if err != nil {
+		t.Fatalf("error getting link: %s", err)
+	}
+	if *got != cond {
+		t.Fatalf("wrong link conditions: got %+v, want %+v", got, cond)
+	}
+	links, err := client.GetLinks()
+	if err != nil {
+		t.Fatalf("error getting links: %s", err)
+	}
+	if links.Default != def || len(links.Links) != 1 || links.Links[0].LinkConditions != cond {
+		t.Fatalf("wrong links: %+v", links)
+	}
+
+	// Taking the link down drops the connection.
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], LinkConditions{Down: true}); err != nil {
+		t.Fatalf("error setting link: %s", err)
+	}
+	waitConn(false)
+
+	// Resetting reverts the link to the defaults.
+	if err := client.ResetLink(nodeIDs[0], nodeIDs[1]); err != nil {
+		t.Fatalf("error resetting link: %s", err)
+	}
+	if got, _ := client.GetLink(nodeIDs[0], nodeIDs[1]); *got != def {
+		t.Fatalf("link not reset: %+v", got)
+	}
+	if err := client.SetLink(nodeIDs[0], nodeIDs[1], LinkConditions{Loss: 2}); err == nil {
+		t.Fatal("expected error for invalid loss")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/p2p/simulations/pipes"
+)
+
+var errNoLinkAdapter = errors.New("link conditions require an in-process adapter")
+
+// LinkConditions describes the conditions of a simulated link. It is the JSON
+// representation of pipes.LinkConfig used by scenarios and the HTTP API.
+type LinkConditions struct {
+	Latency   Duration `json:"latency,omitempty"`
+	Jitter    Duration `json:"jitter,omitempty"`
+	Bandwidth int64    `json:"bandwidth,omitempty"` // bytes per second
+	Loss      float64  `json:"loss,omitempty"`      // probability of a write being lost
+	Drop      float64  `json:"drop,omitempty"`      // probability of a write dropping the connection
+	Down      bool     `json:"down,omitempty"`
+}
+
+func newLinkConditions(cfg pipes.LinkConfig) LinkConditions {
+	return LinkConditions{
+		Latency:   Duration(cfg.Latency),
+		Jitter:    Duration(cfg.Jitter),
+		Bandwidth: cfg.Bandwidth,
+		Loss:      cfg.Loss,
+		Drop:      cfg.Drop,
+		Down:      cfg.Down,
+	}
+}
+
+func (c *LinkConditions) config() pipes.LinkConfig {
+	return pipes.LinkConfig{
+		Latency:   time.Duration(c.Latency),
+		Jitter:    time.Duration(c.Jitter),
+		Bandwidth: c.Bandwidth,
+		Loss:      c.Loss,
+		Drop:      c.Drop,
+		Down:      c.Down,
+	}
+}
+
+func (c *LinkConditions) validate() error {
+	switch {
+	case c.Latency < 0 || c.Jitter < 0:
+		return errors.New("negative latency or jitter")
+	case c.Bandwidth < 0:
+		return errors.New("negative bandwidth")
+	case c.Loss < 0 || c.Loss > 1 || c.Drop < 0 || c.Drop > 1:
+		return errors.New("loss and drop must be between 0 and 1")
+	}
+	return nil
+}
+
+// NodeLinkConditions are the conditions of the link between two nodes.
+type NodeLinkConditions struct {
+	One   enode.ID `json:"one"`
+	Other enode.ID `json:"other"`
+	LinkConditions
+}
+
+// NetworkLinks lists the default link conditions of a network and the
+// individually configured links.
+type NetworkLinks struct {
+	Default LinkConditions       `json:"default"`
+	Links   []NodeLinkConditions `json:"links"`
+}
+
+// simAdapter returns the network's adapter if it supports link conditions. The
+// link conditions are kept by the adapter, networks sharing an adapter share
+// their links too.
+func (net *Network) simAdapter() (*adapters.SimAdapter, error) {
+	sim, ok := net.nodeAdapter.(*adapters.SimAdapter)
+	if !ok {
+		return nil, errNoLinkAdapter
+	}
+	return sim, nil
+}
+
+// Links returns the link conditions of the network.
+func (net *Network) Links() (*NetworkLinks, error) {
+	sim, err := net.simAdapter()
+	if err != nil {
+		return nil, err
+	}
+	links := &NetworkLinks{Default: newLinkConditions(sim.DefaultLink())}
+	for _, l := range sim.Links() {
+		links.Links = append(links.Links, NodeLinkConditions{
+			One:            l.One,
+			Other:          l.Other,
+			LinkConditions: newLinkConditions(l.Config),
+		})
+	}
+	return links, nil
+}
+
+// SetDefaultLink sets the conditions of all links which are not configured
+// individually.
+func (net *Network) SetDefaultLink(c LinkConditions) error {
+	sim, err := net.simAdapter()
+	if err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	sim.SetDefaultLink(c.config())
+	return nil
+}
+
+// Link returns the conditions of the link between two nodes.
+func (net *Network) Link(oneID, otherID enode.ID) (*LinkConditions, error) {
+	sim, err := net.simAdapter()
+	if err != nil {
+		return nil, err
+	}
+	c := newLinkConditions(sim.Link(oneID, otherID))
+	return &c, nil
+}
+
+// SetLink sets the conditions of the link between two nodes. The change
+// applies to open connections immediately.
+func (net *Network) SetLink(oneID, otherID enode.ID, c LinkConditions) error {
+	sim, err := net.simAdapter()
+	if err != nil {
+		return err
+	}
+	if err := c.validate(); err != nil {
+		return err
+	}
+	sim.SetLink(oneID, otherID, c.config())
+	return nil
+}
+
+// ResetLink reverts the link between two nodes to the default conditions.
+func (net *Network) ResetLink(oneID, otherID enode.ID) error {
+	sim, err := net.simAdapter()
+	if err != nil {
+		return err
+	}
+	sim.ResetLink(oneID, otherID)
+	return nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pipes
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// Writes are queued for delivery, up to linkQueueSize writes per direction.
+	// Writers block when the queue is full.
+	linkQueueSize = 64
+
+	// Lost writes are 'retransmitted' after the minimum retransmission timeout
+	// plus one round trip. Streams can't really drop data, so loss shows up as
+	// delay for the lost write and all writes queued behind it.
+	lossRetransmitTimeout = 200 * time.Millisecond
+)
+
+var (
+	errLinkClosed  = errors.New("link connection closed")
+	errLinkDown    = errors.New("link down")
+	errLinkDropped = errors.New("link connection dropped")
+)
+
+// LinkConfig describes the conditions of a simulated network link.
+type LinkConfig struct {
+	Latency   time.Duration `json:"latency"`   // one-way delay of every write
+	Jitter    time.Duration `json:"jitter"`    // maximum random deviation from Latency
+	Bandwidth int64         `json:"bandwidth"` // bytes per second and direction, zero is unlimited
+	Loss      float64       `json:"loss"`      // probability of a write being lost, 0..1
+	Drop      float64       `json:"drop"`      // probability of a write resetting the connection, 0..1
+	Down      bool          `json:"down"`      // drops all connections and refuses new ones
+}
+
+// Link applies network conditions to connections created through it. The
+// conditions may be changed while connections are open.
+type Link struct {
+	mu    sync.Mutex
+	cfg   LinkConfig
+	rand  *rand.Rand
+	conns map[*linkConn]struct{}
+}
+
+// NewLink creates a link with the given conditions.
+func NewLink(cfg LinkConfig) *Link {
+	return &Link{
+		cfg:   cfg,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		conns: make(map[*linkConn]struct{}),
+	}
+}
+
+// Config returns the current link conditions.
+func (l *Link) Config() LinkConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// SetConfig changes the link conditions. The new conditions apply to all
+// subsequent writes on connections of the link. If the link goes down, all
+// open connections are closed.
+func (l *Link) SetConfig(cfg LinkConfig) {
+	l.mu.Lock()
+	l.cfg = cfg
+	var drop []*linkConn
+	if cfg.Down {
+		for c := range l.conns {
+			drop = append(drop, c)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, c := range drop {
+		c.Close()
+	}
+}
+
+// Pipe creates a pipe using the given pipe function and wraps both ends so
+// they are subject to the link conditions. It fails if the link is down.
+func (l *Link) Pipe(pipe func() (net.Conn, net.Conn, error)) (net.Conn, net.Conn, error) {
+	c1, c2, err := pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cfg.Down {
+		c1.Close()
+		c2.Close()
+		return nil, nil, errLinkDown
+	}
+	lc1, lc2 := newLinkConn(l, c1), newLinkConn(l, c2)
+	l.conns[lc1], l.conns[lc2] = struct{}{}, struct{}{}
+	return lc1, lc2, nil
+}
+
+// Conns returns the number of open connection ends of the link.
+func (l *Link) Conns() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+func (l *Link) removeConn(c *linkConn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+}
+
+// schedule computes the delay of a single write after its transmission. It
+// also reports whether the write resets the connection.
+func (l *Link) schedule() (delay time.Duration, drop bool, cfg LinkConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cfg = l.cfg
+	delay = cfg.Latency
+	if cfg.Jitter > 0 {
+		delay += time.Duration(l.rand.Int63n(int64(2*cfg.Jitter)+1)) - cfg.Jitter
+		if delay < 0 {
+			delay = 0
+		}
+	}
+	if cfg.Loss > 0 && l.rand.Float64() < cfg.Loss {
+		delay += lossRetransmitTimeout + 2*cfg.Latency
+	}
+	drop = cfg.Drop > 0 && l.rand.Float64() < cfg.Drop
+	return delay, drop, cfg
+}
+
+type linkWrite struct {
+	data    []byte
+	deliver time.Time
+}
+
+// linkConn delays writes to the wrapped connection according to the
+// conditions of its link. Writes are delivered in order.
+type linkConn struct {
+	net.Conn
+	link  *Link
+	queue chan linkWrite
+	quit  chan struct{}
+
+	mu      sync.Mutex
+	busy    time.Time // end of transmission of the most recent write
+	last    time.Time // delivery time of the most recent write
+	err     error     // delivery error
+	closing sync.Once
+}
+
+func newLinkConn(link *Link, conn net.Conn) *linkConn {
+	c := &linkConn{
+		Conn:  conn,
+		link:  link,
+		queue: make(chan linkWrite, linkQueueSize),
+		quit:  make(chan struct{}),
+	}
+	go c.deliver()
+	return c
+}
+
+// Write queues b for delivery.
+func (c *linkConn) Write(b []byte) (int, error) {
+	select {
+	case <-c.quit:
+		return 0, errLinkClosed
+	default:
+	}
+	delay, drop, cfg := c.link.schedule()
+	if drop {
+		c.Close()
+		return 0, errLinkDropped
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return 0, c.err
+	}
+	// Writes are transmitted one after another at the link bandwidth and
+	// arrive after the link delay, but never before earlier writes.
+	sent := time.Now()
+	if cfg.Bandwidth > 0 {
+		if sent.Before(c.busy) {
+			sent = c.busy
+		}
+		sent = sent.Add(time.Duration(int64(len(b)) * int64(time.Second) / cfg.Bandwidth))
+		c.busy = sent
+	}
+	deliver := sent.Add(delay)
+	if deliver.Before(c.last) {
+		deliver = c.last
+	}
+	c.last = deliver
+	c.mu.Unlock()
+
+	w := linkWrite{data: make([]byte, len(b)), deliver: deliver}
+	copy(w.data, b)
+	select {
+	case c.queue <- w:
+		return len(b), nil
+	case <-c.quit:
+		return 0, errLinkClosed
+	}
+}
+
+func (c *linkConn) deliver() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for {
+		var w linkWrite
+		select {
+		case w = <-c.queue:
+		case <-c.quit:
+			return
+		}
+		if d := time.Until(w.deliver); d > 0 {
+			timer.Reset(d)
+			select {
+			case <-timer.C:
+			case <-c.quit:
+				return
+			}
+		}
+		if _, err := c.Conn.Write(w.data); err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			c.Close()
+			return
+		}
+	}
+}
+
+// Close closes the connection. Writes which haven't been delivered are
+// discarded.
+func (c *linkConn) Close() error {
+	var err error
+	c.closing.Do(func() {
+		close(c.quit)
+		err = c.Conn.Close()
+		c.link.removeConn(c)
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pipes
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// transfer writes data to c1 and returns the time until it was read from c2.
+func transfer(t *testing.T, c1, c2 io.ReadWriter, data []byte) time.Duration {
+	t.Helper()
+	start := time.Now()
+	go c1.Write(data)
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(c2, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("wrong data: got %x, want %x", buf, data)
+	}
+	return time.Since(start)
+}
+
+func TestLinkLatency(t *testing.T) {
+	link := NewLink(LinkConfig{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	c1, c2, err := link.Pipe(NetPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	if d := transfer(t, c1, c2, []byte{1, 2, 3}); d < 40*time.Millisecond {
+		t.Fatalf("write delivered too early: %v", d)
+	}
+	if d := transfer(t, c2, c1, []byte{4, 5, 6}); d < 40*time.Millisecond {
+		t.Fatalf("write delivered too early: %v", d)
+	}
+
+	// Changes apply to open connections.
+	link.SetConfig(LinkConfig{})
+	if d := transfer(t, c1, c2, []byte{7}); d > 40*time.Millisecond {
+		t.Fatalf("write delivered too late: %v", d)
+	}
+}
+
+func TestLinkOrder(t *testing.T) {
+	link := NewLink(LinkConfig{Latency: time.Millisecond, Jitter: time.Millisecond, Loss: 0.2})
+	c1, c2, err := link.Pipe(NetPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		for i := 0; i < 50; i++ {
+			c1.Write([]byte{byte(i)})
+		}
+	}()
+	buf := make([]byte, 50)
+	if _, err := io.ReadFull(c2, buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := range buf {
+		if buf[i] != byte(i) {
+			t.Fatalf("write %d delivered out of order", i)
+		}
+	}
+}
+
+func TestLinkBandwidth(t *testing.T) {
+	link := NewLink(LinkConfig{Bandwidth: 1000})
+	c1, c2, err := link.Pipe(NetPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	defer c2.Close()
+
+	// 100 bytes at 1000 bytes/s take 100ms.
+	if d := transfer(t, c1, c2, make([]byte, 100)); d < 90*time.Millisecond {
+		t.Fatalf("write delivered too early: %v", d)
+	}
+}
+
+func TestLinkDown(t *testing.T) {
+	link := NewLink(LinkConfig{})
+	c1, c2, err := link.Pipe(NetPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := link.Conns(); n != 2 {
+		t.Fatalf("wrong number of connections: %d", n)
+	}
+
+	link.SetConfig(LinkConfig{Down: true})
+	if _, err := c1.Write([]byte{1}); err == nil {
+		t.Fatal("write succeeded on closed connection")
+	}
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read succeeded on closed connection")
+	}
+	if n := link.Conns(); n != 0 {
+		t.Fatalf("connections not removed: %d", n)
+	}
+	if _, _, err := link.Pipe(NetPipe); err != errLinkDown {
+		t.Fatalf("wrong error for pipe on down link: %v", err)
+	}
+}
+
+func TestLinkDrop(t *testing.T) {
+	link := NewLink(LinkConfig{Drop: 1})
+	c1, c2, err := link.Pipe(NetPipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	if _, err := c1.Write([]byte{1}); err != errLinkDropped {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if _, err := c2.Read(make([]byte, 1)); err == nil {
+		t.Fatal("read succeeded on dropped connection")
+	}
+}
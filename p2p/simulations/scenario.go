@@ -0,0 +1,707 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+)
+
+// scenarioSampleInterval is the interval at which the network state is
+// sampled and assertions are evaluated.
+const scenarioSampleInterval = 100 * time.Millisecond
+
+// Scenario topologies.
+const (
+	TopologyFull  = "full"
+	TopologyChain = "chain"
+	TopologyRing  = "ring"
+	TopologyStar  = "star" // the first node is the center
+)
+
+// Scenario actions.
+const (
+	ActionStart      = "start"      // start node
+	ActionStop       = "stop"       // stop node
+	ActionConnect    = "connect"    // connect node to peer
+	ActionDisconnect = "disconnect" // disconnect node from peer
+	ActionInject     = "inject"     // make node send a message to peer
+	ActionLink       = "link"       // change the link between node and peer
+)
+
+// Scenario assertion kinds.
+const (
+	AssertPeers     = "peers"     // every node has at least min peers
+	AssertConnected = "connected" // the nodes form a connected graph
+	AssertMessages  = "messages"  // every node received at least min messages
+)
+
+// Duration is a time.Duration which is encoded as a string like "1.5s" in
+// JSON.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(input []byte) error {
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// String returns the duration formatted like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Scenario is a declarative description of a simulation run: the nodes and
+// their topology, the conditions of the links between them, a timeline of
+// actions and the assertions which must hold.
+type Scenario struct {
+	Name string `json:"name"`
+
+	// Nodes lists the nodes of the network. If it is empty, NodeCount nodes
+	// named node1, node2, ... are created instead.
+	Nodes     []ScenarioNode `json:"nodes,omitempty"`
+	NodeCount int            `json:"nodeCount,omitempty"`
+	Services  []string       `json:"services,omitempty"` // default services of all nodes
+
+	// Topology connects the nodes when the scenario starts. Conns lists
+	// additional initial connections.
+	Topology string      `json:"topology,omitempty"`
+	Conns    [][2]string `json:"conns,omitempty"`
+
+	// Link sets the conditions of all links, Links overrides them for
+	// particular pairs of nodes.
+	Link  *ScenarioLink  `json:"link,omitempty"`
+	Links []ScenarioLink `json:"links,omitempty"`
+
+	Timeline   []ScenarioAction    `json:"timeline,omitempty"`
+	Assertions []ScenarioAssertion `json:"assertions,omitempty"`
+
+	// Duration is the length of the run. If zero, the run ends once all
+	// actions are performed and all assertions are decided, which requires
+	// every assertion to either be an Always assertion or have a Within.
+	Duration Duration `json:"duration,omitempty"`
+}
+
+// ScenarioNode is a node of a scenario.
+type ScenarioNode struct {
+	Name     string   `json:"name"`
+	Services []string `json:"services,omitempty"`
+}
+
+// ScenarioLink describes the conditions of the link between two nodes.
+type ScenarioLink struct {
+	Nodes [2]string `json:"nodes,omitempty"`
+	LinkConditions
+}
+
+// ScenarioAction is an action performed at a point of the timeline.
+type ScenarioAction struct {
+	At     Duration `json:"at"`
+	Action string   `json:"action"`
+	Node   string   `json:"node"`
+	Peer   string   `json:"peer,omitempty"`
+
+	// Message injection.
+	Service string        `json:"service,omitempty"`
+	Code    uint64        `json:"code,omitempty"`
+	Payload hexutil.Bytes `json:"payload,omitempty"`
+
+	// Link changes.
+	LinkConditions
+}
+
+func (a *ScenarioAction) String() string {
+	s := a.Action + " " + a.Node
+	if a.Peer != "" {
+		s += " " + a.Peer
+	}
+	return s
+}
+
+// ScenarioAssertion is a condition on the network state.
+//
+// By default the condition must hold at some point between After and Within
+// (or the end of the run if Within is zero). If Always is set, it must hold
+// at all times from After until the end of the run.
+type ScenarioAssertion struct {
+	Name  string   `json:"name,omitempty"`
+	Kind  string   `json:"kind"`
+	Nodes []string `json:"nodes,omitempty"` // default all nodes
+	Min   int      `json:"min,omitempty"`   // default 1 for peers and messages
+
+	// Message filter of the messages assertion.
+	Protocol string  `json:"protocol,omitempty"`
+	Code     *uint64 `json:"code,omitempty"`
+
+	After  Duration `json:"after,omitempty"`
+	Within Duration `json:"within,omitempty"`
+	Always bool     `json:"always,omitempty"`
+}
+
+func (a *ScenarioAssertion) String() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	s := a.Kind
+	if len(a.Nodes) > 0 {
+		s += " " + strings.Join(a.Nodes, ",")
+	}
+	if a.Min > 0 {
+		s += fmt.Sprintf(" min=%d", a.Min)
+	}
+	if a.Always {
+		s += " always"
+	} else if a.Within > 0 {
+		s += " within " + a.Within.String()
+	}
+	return s
+}
+
+// ScenarioResult is the report of a scenario run.
+type ScenarioResult struct {
+	Name       string            `json:"name"`
+	Passed     bool              `json:"passed"`
+	Duration   Duration          `json:"duration"`
+	Actions    []ActionResult    `json:"actions"`
+	Assertions []AssertionResult `json:"assertions"`
+	Samples    []ScenarioSample  `json:"samples"`
+}
+
+// ActionResult is the outcome of a timeline action.
+type ActionResult struct {
+	At     Duration `json:"at"` // actual time of execution
+	Action string   `json:"action"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// AssertionResult is the outcome of an assertion. At is the time at which the
+// assertion was decided.
+type AssertionResult struct {
+	Assertion string   `json:"assertion"`
+	Passed    bool     `json:"passed"`
+	At        Duration `json:"at"`
+}
+
+// ScenarioSample is a sample of the network state.
+type ScenarioSample struct {
+	T       Duration `json:"t"`
+	NodesUp int      `json:"nodesUp"`
+	Conns   int      `json:"conns"`
+	Msgs    int      `json:"msgs"` // messages received since the start
+}
+
+// Report writes a human-readable report of the result.
+func (r *ScenarioResult) Report(w io.Writer) {
+	status := "PASSED"
+	if !r.Passed {
+		status = "FAILED"
+	}
+	fmt.Fprintf(w, "scenario %q %s after %v\n", r.Name, status, r.Duration)
+	if len(r.Actions) > 0 {
+		fmt.Fprintln(w, "actions:")
+		for _, a := range r.Actions {
+			fmt.Fprintf(w, "  %-10v %s", a.At, a.Action)
+			if a.Error != "" {
+				fmt.Fprintf(w, ": %s", a.Error)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	if len(r.Assertions) > 0 {
+		fmt.Fprintln(w, "assertions:")
+		for _, a := range r.Assertions {
+			status := "PASS"
+			if !a.Passed {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "  %s %-10v %s\n", status, a.At, a.Assertion)
+		}
+	}
+	if n := len(r.Samples); n > 0 {
+		last := r.Samples[n-1]
+		fmt.Fprintf(w, "final state: %d nodes up, %d connections, %d messages\n", last.NodesUp, last.Conns, last.Msgs)
+	}
+}
+
+// MessageInjector is implemented by services which support message injection
+// in scenarios.
+type MessageInjector interface {
+	InjectMsg(peer enode.ID, code uint64, payload []byte) error
+}
+
+// RunScenario runs the scenario in the given network. The scenario nodes are
+// added to the network, which must use an in-process adapter if the scenario
+// configures link conditions. The caller is responsible for shutting down the
+// network afterwards.
+func RunScenario(ctx context.Context, net *Network, s *Scenario) (*ScenarioResult, error) {
+	r, err := newScenarioRun(net, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setup(); err != nil {
+		return nil, err
+	}
+	return r.run(ctx), nil
+}
+
+type scenarioRun struct {
+	net      *Network
+	links    bool // whether the scenario uses link conditions
+	scenario *Scenario
+	ids      map[string]enode.ID
+	order    []enode.ID
+	configs  []*adapters.NodeConfig
+
+	actions    []ScenarioAction // sorted by time
+	assertions []*assertionState
+	result     *ScenarioResult
+
+	mu   sync.Mutex
+	msgs int
+}
+
+type assertionState struct {
+	*ScenarioAssertion
+	nodes   []enode.ID
+	msgs    map[enode.ID]int // matching messages received per node
+	decided bool
+}
+
+func newScenarioRun(net *Network, s *Scenario) (*scenarioRun, error) {
+	r := &scenarioRun{
+		net:      net,
+		scenario: s,
+		ids:      make(map[string]enode.ID),
+		result:   &ScenarioResult{Name: s.Name},
+	}
+	if s.Link != nil || len(s.Links) > 0 || r.hasAction(ActionLink) {
+		if _, err := net.simAdapter(); err != nil {
+			return nil, err
+		}
+		r.links = true
+	}
+
+	nodes := s.Nodes
+	if len(nodes) == 0 {
+		for i := 1; i <= s.NodeCount; i++ {
+			nodes = append(nodes, ScenarioNode{Name: fmt.Sprintf("node%d", i)})
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("scenario has no nodes")
+	}
+	for _, n := range nodes {
+		services := n.Services
+		if len(services) == 0 {
+			services = s.Services
+		}
+		conf := adapters.RandomNodeConfig()
+		conf.Name = n.Name
+		conf.Services = services
+		conf.EnableMsgEvents = true
+		if _, exists := r.ids[n.Name]; exists {
+			return nil, fmt.Errorf("duplicate node %q", n.Name)
+		}
+		r.ids[n.Name] = conf.ID
+		r.order = append(r.order, conf.ID)
+		r.configs = append(r.configs, conf)
+	}
+
+	// Check timeline and assertions before creating anything.
+	r.actions = append(r.actions, s.Timeline...)
+	sort.SliceStable(r.actions, func(i, j int) bool { return r.actions[i].At < r.actions[j].At })
+	for _, a := range r.actions {
+		if err := r.checkAction(&a); err != nil {
+			return nil, err
+		}
+	}
+	for i := range s.Assertions {
+		a := &s.Assertions[i]
+		st := &assertionState{ScenarioAssertion: a, msgs: make(map[enode.ID]int)}
+		switch a.Kind {
+		case AssertPeers, AssertConnected, AssertMessages:
+		default:
+			return nil, fmt.Errorf("assertion %d: unknown kind %q", i, a.Kind)
+		}
+		if s.Duration == 0 && !a.Always && a.Within == 0 {
+			return nil, fmt.Errorf("assertion %d: missing within in scenario without duration", i)
+		}
+		if len(a.Nodes) == 0 {
+			st.nodes = r.order
+		}
+		for _, name := range a.Nodes {
+			id, ok := r.ids[name]
+			if !ok {
+				return nil, fmt.Errorf("assertion %d: unknown node %q", i, name)
+			}
+			st.nodes = append(st.nodes, id)
+		}
+		r.assertions = append(r.assertions, st)
+	}
+	return r, nil
+}
+
+func (r *scenarioRun) hasAction(action string) bool {
+	for _, a := range r.scenario.Timeline {
+		if a.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *scenarioRun) checkAction(a *ScenarioAction) error {
+	if _, ok := r.ids[a.Node]; !ok {
+		return fmt.Errorf("action %q: unknown node %q", a, a.Node)
+	}
+	switch a.Action {
+	case ActionStart, ActionStop:
+		return nil
+	case ActionConnect, ActionDisconnect, ActionInject, ActionLink:
+		if _, ok := r.ids[a.Peer]; !ok {
+			return fmt.Errorf("action %q: unknown peer %q", a, a.Peer)
+		}
+		if a.Action == ActionInject && a.Service == "" {
+			return fmt.Errorf("action %q: missing service", a)
+		}
+		return nil
+	default:
+		return fmt.Errorf("action %q: unknown action", a)
+	}
+}
+
+// setup creates and starts the nodes, configures links and connects the
+// initial topology.
+func (r *scenarioRun) setup() error {
+	s := r.scenario
+	if r.links {
+		var def LinkConditions
+		if s.Link != nil {
+			def = s.Link.LinkConditions
+		}
+		if err := r.net.SetDefaultLink(def); err != nil {
+			return err
+		}
+		for _, l := range s.Links {
+			one, ok1 := r.ids[l.Nodes[0]]
+			other, ok2 := r.ids[l.Nodes[1]]
+			if !ok1 || !ok2 {
+				return fmt.Errorf("link %v: unknown node", l.Nodes)
+			}
+			if err := r.net.SetLink(one, other, l.LinkConditions); err != nil {
+				return fmt.Errorf("link %v: %v", l.Nodes, err)
+			}
+		}
+	}
+
+	for _, conf := range r.configs {
+		if _, err := r.net.NewNodeWithConfig(conf); err != nil {
+			return fmt.Errorf("can't create node %q: %v", conf.Name, err)
+		}
+	}
+	for _, id := range r.order {
+		if err := r.net.Start(id); err != nil {
+			return fmt.Errorf("can't start node %v: %v", id.TerminalString(), err)
+		}
+	}
+
+	var err error
+	switch s.Topology {
+	case "":
+	case TopologyFull:
+		err = r.net.ConnectNodesFull(r.order)
+	case TopologyChain:
+		err = r.net.ConnectNodesChain(r.order)
+	case TopologyRing:
+		err = r.net.ConnectNodesRing(r.order)
+	case TopologyStar:
+		err = r.net.ConnectNodesStar(r.order[1:], r.order[0])
+	default:
+		err = fmt.Errorf("unknown topology %q", s.Topology)
+	}
+	if err != nil {
+		return err
+	}
+	for _, c := range s.Conns {
+		one, ok1 := r.ids[c[0]]
+		other, ok2 := r.ids[c[1]]
+		if !ok1 || !ok2 {
+			return fmt.Errorf("conn %v: unknown node", c)
+		}
+		if err := r.net.connectNotConnected(one, other); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run executes the timeline and evaluates assertions until the scenario ends.
+func (r *scenarioRun) run(ctx context.Context) *ScenarioResult {
+	events := make(chan *Event, 128)
+	sub := r.net.Events().Subscribe(events)
+	defer sub.Unsubscribe()
+	go r.countMessages(events, sub.Err())
+
+	var (
+		start  = time.Now()
+		end    = time.Duration(r.scenario.Duration)
+		ticker = time.NewTicker(scenarioSampleInterval)
+	)
+	defer ticker.Stop()
+
+	for {
+		t := time.Since(start)
+		for len(r.actions) > 0 && time.Duration(r.actions[0].At) <= t {
+			a := r.actions[0]
+			r.actions = r.actions[1:]
+			res := ActionResult{At: Duration(time.Since(start)), Action: a.String()}
+			if err := r.perform(&a); err != nil {
+				res.Error = err.Error()
+			}
+			r.result.Actions = append(r.result.Actions, res)
+		}
+		r.sample(t)
+
+		if end > 0 && t >= end || end == 0 && r.done() {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			r.finish(time.Since(start))
+			return r.result
+		}
+	}
+	r.finish(time.Since(start))
+	return r.result
+}
+
+// done reports whether all actions are performed and all assertions decided.
+func (r *scenarioRun) done() bool {
+	if len(r.actions) > 0 {
+		return false
+	}
+	for _, a := range r.assertions {
+		if !a.decided && !a.Always {
+			return false
+		}
+	}
+	return true
+}
+
+// finish decides the remaining assertions at the end of the run.
+func (r *scenarioRun) finish(t time.Duration) {
+	for _, a := range r.assertions {
+		if !a.decided {
+			r.decide(a, a.Always, t)
+		}
+	}
+	r.result.Passed = true
+	for _, a := range r.result.Assertions {
+		r.result.Passed = r.result.Passed && a.Passed
+	}
+	for _, a := range r.result.Actions {
+		r.result.Passed = r.result.Passed && a.Error == ""
+	}
+	sort.SliceStable(r.result.Assertions, func(i, j int) bool {
+		return r.result.Assertions[i].At < r.result.Assertions[j].At
+	})
+	r.result.Duration = Duration(t)
+}
+
+func (r *scenarioRun) decide(a *assertionState, passed bool, t time.Duration) {
+	a.decided = true
+	r.result.Assertions = append(r.result.Assertions, AssertionResult{
+		Assertion: a.String(),
+		Passed:    passed,
+		At:        Duration(t),
+	})
+}
+
+func (r *scenarioRun) countMessages(events chan *Event, errc <-chan error) {
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type != EventTypeMsg || !ev.Msg.Received {
+				continue
+			}
+			r.mu.Lock()
+			r.msgs++
+			for _, a := range r.assertions {
+				if a.Kind != AssertMessages {
+					continue
+				}
+				if a.Protocol != "" && a.Protocol != ev.Msg.Protocol || a.Code != nil && *a.Code != ev.Msg.Code {
+					continue
+				}
+				a.msgs[ev.Msg.Other]++
+			}
+			r.mu.Unlock()
+		case <-errc:
+			return
+		}
+	}
+}
+
+func (r *scenarioRun) perform(a *ScenarioAction) error {
+	id, peer := r.ids[a.Node], r.ids[a.Peer]
+	switch a.Action {
+	case ActionStart:
+		return r.net.Start(id)
+	case ActionStop:
+		return r.net.Stop(id)
+	case ActionConnect:
+		return r.net.Connect(id, peer)
+	case ActionDisconnect:
+		return r.net.Disconnect(id, peer)
+	case ActionLink:
+		return r.net.SetLink(id, peer, a.LinkConditions)
+	case ActionInject:
+		n := r.net.GetNode(id)
+		sn, ok := n.Node.(interface{ Service(string) node.Service })
+		if !ok {
+			return errors.New("node does not support message injection")
+		}
+		inj, ok := sn.Service(a.Service).(MessageInjector)
+		if !ok {
+			return fmt.Errorf("service %q does not support message injection", a.Service)
+		}
+		return inj.InjectMsg(peer, a.Code, a.Payload)
+	}
+	return nil
+}
+
+// sample records the network state and evaluates the assertions.
+func (r *scenarioRun) sample(t time.Duration) {
+	r.net.lock.RLock()
+	up := make(map[enode.ID]bool)
+	for _, n := range r.net.Nodes {
+		if n.Up() {
+			up[n.ID()] = true
+		}
+	}
+	peers := make(map[enode.ID][]enode.ID)
+	for _, c := range r.net.Conns {
+		if c.Up && up[c.One] && up[c.Other] {
+			peers[c.One] = append(peers[c.One], c.Other)
+			peers[c.Other] = append(peers[c.Other], c.One)
+		}
+	}
+	r.net.lock.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var conns int
+	for _, p := range peers {
+		conns += len(p)
+	}
+	r.result.Samples = append(r.result.Samples, ScenarioSample{
+		T:       Duration(t),
+		NodesUp: len(up),
+		Conns:   conns / 2,
+		Msgs:    r.msgs,
+	})
+
+	for _, a := range r.assertions {
+		if a.decided || t < time.Duration(a.After) {
+			continue
+		}
+		holds := a.holds(up, peers)
+		switch {
+		case a.Always && !holds:
+			r.decide(a, false, t)
+		case !a.Always && holds:
+			r.decide(a, true, t)
+		case !a.Always && a.Within > 0 && t >= time.Duration(a.Within):
+			r.decide(a, false, t)
+		}
+	}
+}
+
+// holds reports whether the assertion holds for the given network state.
+// The run's lock must be held.
+func (a *assertionState) holds(up map[enode.ID]bool, peers map[enode.ID][]enode.ID) bool {
+	min := a.Min
+	if min == 0 {
+		min = 1
+	}
+	switch a.Kind {
+	case AssertPeers:
+		for _, id := range a.nodes {
+			if !up[id] || len(peers[id]) < min {
+				return false
+			}
+		}
+		return true
+	case AssertMessages:
+		for _, id := range a.nodes {
+			if a.msgs[id] < min {
+				return false
+			}
+		}
+		return true
+	case AssertConnected:
+		// Check that all nodes are reachable from the first one.
+		if len(a.nodes) == 0 || !up[a.nodes[0]] {
+			return false
+		}
+		seen := map[enode.ID]bool{a.nodes[0]: true}
+		queue := []enode.ID{a.nodes[0]}
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			for _, p := range peers[id] {
+				if !seen[p] {
+					seen[p] = true
+					queue = append(queue, p)
+				}
+			}
+		}
+		for _, id := range a.nodes {
+			if !seen[id] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
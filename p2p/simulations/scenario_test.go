@@ -0,0 +1,194 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package simulations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// injectService is a service whose protocol discards all messages. It
+// supports message injection.
+type injectService struct {
+	mu    sync.Mutex
+	peers map[enode.ID]p2p.MsgReadWriter
+}
+
+func (s *injectService) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{{
+		Name:    "inject",
+		Version: 1,
+		Length:  2,
+		Run: func(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
+			s.mu.Lock()
+			s.peers[peer.ID()] = rw
+			s.mu.Unlock()
+			defer func() {
+				s.mu.Lock()
+				delete(s.peers, peer.ID())
+				s.mu.Unlock()
+			}()
+			for {
+				msg, err := rw.ReadMsg()
+				if err != nil {
+					return err
+				}
+				msg.Discard()
+			}
+		},
+	}}
+}
+
+func (s *injectService) InjectMsg(peer enode.ID, code uint64, payload []byte) error {
+	s.mu.Lock()
+	rw := s.peers[peer]
+	s.mu.Unlock()
+	if rw == nil {
+		return errors.New("not connected")
+	}
+	return rw.WriteMsg(p2p.Msg{Code: code, Size: uint32(len(payload)), Payload: bytes.NewReader(payload)})
+}
+
+func (s *injectService) APIs() []rpc.API         { return nil }
+func (s *injectService) Start(*p2p.Server) error { return nil }
+func (s *injectService) Stop() error             { return nil }
+
+func newScenarioNetwork() *Network {
+	adapter := adapters.NewSimAdapter(adapters.Services{
+		"inject": func(ctx *adapters.ServiceContext) (node.Service, error) {
+			return &injectService{peers: make(map[enode.ID]p2p.MsgReadWriter)}, nil
+		},
+	})
+	return NewNetwork(adapter, &NetworkConfig{DefaultService: "inject"})
+}
+
+const testScenario = `{
+	"name": "ring",
+	"nodeCount": 4,
+	"services": ["inject"],
+	"topology": "ring",
+	"link": {"latency": "20ms"},
+	"timeline": [
+		{"at": "500ms", "action": "inject", "node": "node1", "peer": "node2", "service": "inject", "code": 1, "payload": "0xc0"},
+		{"at": "600ms", "action": "stop", "node": "node4"}
+	],
+	"assertions": [
+		{"kind": "connected", "within": "5s"},
+		{"kind": "peers", "min": 2, "within": "5s"},
+		{"kind": "messages", "nodes": ["node2"], "protocol": "inject", "code": 1, "within": "5s"},
+		{"kind": "peers", "nodes": ["node2"], "min": 1, "after": "1s", "always": true}
+	],
+	"duration": "1500ms"
+}`
+
+func TestScenario(t *testing.T) {
+	net := newScenarioNetwork()
+	defer net.Shutdown()
+
+	var s Scenario
+	if err := json.Unmarshal([]byte(testScenario), &s); err != nil {
+		t.Fatal(err)
+	}
+	result, err := RunScenario(context.Background(), net, &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report bytes.Buffer
+	result.Report(&report)
+	if !result.Passed {
+		t.Fatalf("scenario failed:\n%s", report.String())
+	}
+	if len(result.Actions) != 2 || len(result.Assertions) != 4 {
+		t.Fatalf("wrong number of results:\n%s", report.String())
+	}
+	last := result.Samples[len(result.Samples)-1]
+	if last.NodesUp != 3 || last.Conns != 2 {
+		t.Fatalf("wrong final state: %+v", last)
+	}
+	if time.Duration(result.Duration) < 1500*time.Millisecond {
+		t.Fatalf("scenario ended early: %v", result.Duration)
+	}
+}
+
+func TestScenarioFailure(t *testing.T) {
+	net := newScenarioNetwork()
+	defer net.Shutdown()
+
+	s := &Scenario{
+		Name:      "chain",
+		NodeCount: 3,
+		Services:  []string{"inject"},
+		Topology:  TopologyChain,
+		Assertions: []ScenarioAssertion{
+			{Name: "too many peers", Kind: AssertPeers, Min: 2, Within: Duration(300 * time.Millisecond)},
+			{Name: "connected", Kind: AssertConnected, Within: Duration(5 * time.Second)},
+			{Name: "never enough peers", Kind: AssertPeers, Min: 3},
+		},
+		Duration: Duration(time.Second),
+	}
+	result, err := RunScenario(context.Background(), net, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Passed {
+		t.Fatal("scenario passed")
+	}
+	for _, a := range result.Assertions {
+		if a.Passed != (a.Assertion == "connected") {
+			t.Errorf("wrong result for %q: passed %t", a.Assertion, a.Passed)
+		}
+	}
+}
+
+func TestScenarioInvalid(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		err      string
+	}{
+		{Scenario{}, "scenario has no nodes"},
+		{
+			Scenario{NodeCount: 1, Timeline: []ScenarioAction{{Action: ActionStop, Node: "node2"}}},
+			`unknown node "node2"`,
+		},
+		{
+			Scenario{NodeCount: 1, Assertions: []ScenarioAssertion{{Kind: "foo"}}},
+			`unknown kind "foo"`,
+		},
+		{
+			Scenario{NodeCount: 1, Assertions: []ScenarioAssertion{{Kind: AssertPeers}}},
+			"missing within",
+		},
+	}
+	for _, test := range tests {
+		_, err := RunScenario(context.Background(), newScenarioNetwork(), &test.scenario)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("wrong error: got %v, want %q", err, test.err)
+		}
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"io/ioutil"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
@@ -158,15 +159,30 @@ type mockNode struct {
 
 	trigger  chan *Trigger
 	expect   chan []Expect
+	raw      chan rawOp // raw message operations, used by Replay
 	err      chan error
 	stop     chan struct{}
 	stopOnce sync.Once
+
+	// Operations which timed out are kept running. The next operation in
+	// the same direction waits for them. Only accessed by Run.
+	pendingRead  chan rawMsg
+	pendingWrite chan rawMsg
+}
+
+// rawOp is a raw message operation requested by Replay. Operations which
+// don't complete within timeout fail with errTimedOut.
+type rawOp struct {
+	send    *p2p.Msg // message to send, nil to receive the next message
+	timeout time.Duration
+	result  chan rawMsg
 }
 
 func newMockNode() *mockNode {
 	mock := &mockNode{
 		trigger: make(chan *Trigger),
 		expect:  make(chan []Expect),
+		raw:     make(chan rawOp),
 		err:     make(chan error),
 		stop:    make(chan struct{}),
 	}
@@ -181,9 +197,16 @@ func (m *mockNode) Run(peer *p2p.Peer, rw p2p.MsgReadWriter) error {
 		select {
 		case trig := <-m.trigger:
 			wmsg := Wrap(trig.Msg)
-			m.err <- p2p.Send(rw, trig.Code, wmsg)
+			m.err <- m.write(func() error { return p2p.Send(rw, trig.Code, wmsg) }, 0)
 		case exps := <-m.expect:
-			m.err <- expectMsgs(rw, exps)
+			m.err <- expectMsgs(&mockReader{m, rw}, exps)
+		case op := <-m.raw:
+			if op.send != nil {
+				msg := *op.send
+				op.result <- rawMsg{err: m.write(func() error { return rw.WriteMsg(msg) }, op.timeout)}
+			} else {
+				op.result <- m.read(rw, op.timeout)
+			}
 		case <-m.stop:
 			return nil
 		}
@@ -200,12 +223,102 @@ func (m *mockNode) Expect(exp ...Expect) error {
 	return <-m.err
 }
 
+// sendRaw sends a message to the peer without wrapping it.
+func (m *mockNode) sendRaw(msg p2p.Msg, timeout time.Duration) error {
+	op := rawOp{send: &msg, timeout: timeout, result: make(chan rawMsg, 1)}
+	m.raw <- op
+	return (<-op.result).err
+}
+
+// receiveRaw reads the next message sent by the peer.
+func (m *mockNode) receiveRaw(timeout time.Duration) rawMsg {
+	op := rawOp{timeout: timeout, result: make(chan rawMsg, 1)}
+	m.raw <- op
+	return <-op.result
+}
+
 func (m *mockNode) Stop() error {
 	m.stopOnce.Do(func() { close(m.stop) })
 	return nil
 }
 
-func expectMsgs(rw p2p.MsgReadWriter, exps []Expect) error {
+// read reads the next message from rw. If an earlier read timed out, its
+// message is returned instead, so no message is lost.
+func (m *mockNode) read(rw p2p.MsgReadWriter, timeout time.Duration) rawMsg {
+	if ch := m.pendingRead; ch != nil {
+		m.pendingRead = nil
+		return m.wait(ch, &m.pendingRead, timeout)
+	}
+	return m.await(func() rawMsg { return readRawMsg(rw) }, &m.pendingRead, timeout)
+}
+
+// write runs fn once an earlier write which timed out has completed.
+func (m *mockNode) write(fn func() error, timeout time.Duration) error {
+	if ch := m.pendingWrite; ch != nil {
+		m.pendingWrite = nil
+		if m.wait(ch, &m.pendingWrite, timeout); m.pendingWrite != nil {
+			return errTimedOut
+		}
+	}
+	return m.await(func() rawMsg { return rawMsg{err: fn()} }, &m.pendingWrite, timeout).err
+}
+
+// await runs op and waits for its result. A zero timeout waits forever. If op
+// doesn't complete in time, it is left running and stored in pending.
+func (m *mockNode) await(op func() rawMsg, pending *chan rawMsg, timeout time.Duration) rawMsg {
+	ch := make(chan rawMsg, 1)
+	go func() { ch <- op() }()
+	return m.wait(ch, pending, timeout)
+}
+
+func (m *mockNode) wait(ch chan rawMsg, pending *chan rawMsg, timeout time.Duration) rawMsg {
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	select {
+	case msg := <-ch:
+		return msg
+	case <-timer:
+		*pending = ch
+		return rawMsg{err: errTimedOut}
+	}
+}
+
+// mockReader reads messages through the mock node, taking timed out reads
+// into account.
+type mockReader struct {
+	m  *mockNode
+	rw p2p.MsgReadWriter
+}
+
+func (r *mockReader) ReadMsg() (p2p.Msg, error) {
+	msg := r.m.read(r.rw, 0)
+	if msg.err != nil {
+		return p2p.Msg{}, msg.err
+	}
+	return p2p.Msg{Code: msg.code, Size: uint32(len(msg.payload)), Payload: bytes.NewReader(msg.payload)}, nil
+}
+
+// rawMsg is a message received by a mock node.
+type rawMsg struct {
+	code    uint64
+	payload []byte
+	err     error
+}
+
+func readRawMsg(rw p2p.MsgReadWriter) rawMsg {
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		return rawMsg{err: err}
+	}
+	payload, err := ioutil.ReadAll(msg.Payload)
+	return rawMsg{code: msg.Code, payload: payload, err: err}
+}
+
+func expectMsgs(rw p2p.MsgReader, exps []Expect) error {
 	matched := make([]bool, len(exps))
 	for {
 		msg, err := rw.ReadMsg()
@@ -0,0 +1,71 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package testing
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// replayTimeout is the time allowed for sending or receiving a single
+// replayed message.
+var replayTimeout = 2 * time.Second
+
+// Replay feeds a session recorded with p2p capture mode into the protocol
+// handler of the pivot node. The records are processed one after another:
+// inbound records, i.e. messages received by the capturing node, are sent by
+// the given mock peer. Outbound records must be answered by the pivot node with
+// a message of the same code and payload before replay continues.
+//
+// Records usually need to be filtered by peer and protocol before replaying them.
+func (s *ProtocolSession) Replay(peer enode.ID, records []p2p.CaptureRecord) error {
+	simNode, ok := s.adapter.GetNode(peer)
+	if !ok {
+		return fmt.Errorf("replay: peer %v does not exist", peer)
+	}
+	mock, ok := simNode.Services()[0].(*mockNode)
+	if !ok {
+		return fmt.Errorf("replay: peer %v is not a mock", peer)
+	}
+	for i, rec := range records {
+		var err error
+		switch rec.Direction {
+		case p2p.CaptureInbound:
+			err = mock.sendRaw(rec.Msg(), replayTimeout)
+		case p2p.CaptureOutbound:
+			msg := mock.receiveRaw(replayTimeout)
+			switch {
+			case msg.err != nil:
+				err = msg.err
+			case msg.code != rec.Code:
+				err = fmt.Errorf("got message code %d, want %d", msg.code, rec.Code)
+			case !bytes.Equal(msg.payload, rec.Payload):
+				err = fmt.Errorf("payload mismatch:\ngot:  %x\nwant: %x", msg.payload, []byte(rec.Payload))
+			}
+		default:
+			err = fmt.Errorf("invalid direction %q", rec.Direction)
+		}
+		if err != nil {
+			return fmt.Errorf("replay: record %d (%s, code %d): %v", i, rec.Direction, rec.Code, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package testing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// counterProtocol announces 0 on connect and answers every number with its
+// successor.
+func counterProtocol(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	if err := p2p.Send(rw, 0, uint(0)); err != nil {
+		return err
+	}
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		var n uint
+		if err := msg.Decode(&n); err != nil {
+			return err
+		}
+		if err := p2p.Send(rw, 1, n+1); err != nil {
+			return err
+		}
+	}
+}
+
+func captureRecord(dir string, code uint64, n uint) p2p.CaptureRecord {
+	payload, _ := rlp.EncodeToBytes(n)
+	return p2p.CaptureRecord{Direction: dir, Code: code, Size: uint32(len(payload)), Payload: payload}
+}
+
+func TestReplay(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tester := NewProtocolTester(key, 1, counterProtocol)
+	defer tester.Stop()
+
+	records := []p2p.CaptureRecord{
+		captureRecord(p2p.CaptureOutbound, 0, 0),
+		captureRecord(p2p.CaptureInbound, 1, 5),
+		captureRecord(p2p.CaptureOutbound, 1, 6),
+		captureRecord(p2p.CaptureInbound, 1, 9),
+		captureRecord(p2p.CaptureOutbound, 1, 10),
+	}
+	if err := tester.Replay(tester.Nodes[0].ID(), records); err != nil {
+		t.Fatal(err)
+	}
+
+	// Divergence from the recording is reported.
+	records = []p2p.CaptureRecord{
+		captureRecord(p2p.CaptureInbound, 1, 1),
+		captureRecord(p2p.CaptureOutbound, 1, 3),
+	}
+	err := tester.Replay(tester.Nodes[0].ID(), records)
+	if err == nil || !strings.Contains(err.Error(), "record 1") {
+		t.Fatalf("expected payload mismatch in record 1, got %v", err)
+	}
+}
+
+// This test checks that a replay step which timed out doesn't swallow messages
+// meant for later steps.
+func TestReplayTimeout(t *testing.T) {
+	defer func(d time.Duration) { replayTimeout = d }(replayTimeout)
+	replayTimeout = 200 * time.Millisecond
+
+	key, _ := crypto.GenerateKey()
+	tester := NewProtocolTester(key, 1, counterProtocol)
+	defer tester.Stop()
+	peer := tester.Nodes[0].ID()
+
+	if err := tester.Replay(peer, []p2p.CaptureRecord{captureRecord(p2p.CaptureOutbound, 0, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	// The pivot node doesn't send anything unprompted.
+	err := tester.Replay(peer, []p2p.CaptureRecord{captureRecord(p2p.CaptureOutbound, 1, 1)})
+	if err == nil || !strings.Contains(err.Error(), errTimedOut.Error()) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	records := []p2p.CaptureRecord{
+		captureRecord(p2p.CaptureInbound, 1, 5),
+		captureRecord(p2p.CaptureOutbound, 1, 6),
+	}
+	if err := tester.Replay(peer, records); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -50,10 +50,14 @@ func (h expHeap) contains(item string) bool {
 	return false
 }
 
-// expire removes items with expiry time before 'now'.
-func (h *expHeap) expire(now time.Time) {
+// expire removes items with expiry time before 'now'. If onExp is non-nil,
+// it is called for every removed item.
+func (h *expHeap) expire(now time.Time, onExp func(string)) {
 	for h.Len() > 0 && h.nextExpiry().Before(now) {
-		heap.Pop(h)
+		item := heap.Pop(h).(expItem)
+		if onExp != nil {
+			onExp(item.item)
+		}
 	}
 }
 
@@ -41,7 +41,11 @@ func TestExpHeap(t *testing.T) {
 		t.Fatal("heap doesn't contain all live items")
 	}
 
-	h.expire(exptimeA.Add(1))
+	var expired []string
+	h.expire(exptimeA.Add(1), func(item string) { expired = append(expired, item) })
+	if len(expired) != 1 || expired[0] != "a" {
+		t.Fatalf("wrong expired items %v", expired)
+	}
 	if !h.nextExpiry().Equal(exptimeB) {
 		t.Fatal("wrong nextExpiry")
 	}
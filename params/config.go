@@ -213,16 +213,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, nil, nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}, nil, nil, nil}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, new(EthashConfig), nil, nil, nil, nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -297,6 +297,13 @@ type ChainConfig struct {
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
+	IBFT   *IBFTConfig   `json:"ibft,omitempty"`
+
+	// Scheduled consensus engine switches, in ascending block order
+	Transitions []*EngineTransition `json:"transitions,omitempty"`
+
+	// Additional precompiled contracts activated at fork blocks
+	Precompiles []*PrecompileConfig `json:"precompiles,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -311,6 +318,8 @@ func (c *EthashConfig) String() string {
 type CliqueConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	SignerContract *common.Address `json:"signerContract,omitempty"` // Contract governing the signers at checkpoints (nil = votes only)
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -318,6 +327,61 @@ func (c *CliqueConfig) String() string {
 	return "clique"
 }
 
+// IBFTConfig is the consensus engine configs for byzantine fault tolerant sealing.
+type IBFTConfig struct {
+	Period         uint64 `json:"period"`         // Number of seconds between blocks to enforce
+	Epoch          uint64 `json:"epoch"`          // Epoch length to reset votes and checkpoint
+	RequestTimeout uint64 `json:"requestTimeout"` // Milliseconds to wait for a proposal before changing rounds
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (c *IBFTConfig) String() string {
+	return "ibft"
+}
+
+// EngineTransition schedules a switch of the consensus engine at a fork block.
+// If no engine config is set, the chain switches to proof-of-work.
+type EngineTransition struct {
+	Block   *big.Int         `json:"block"`             // Number of the first block sealed by the new engine
+	Clique  *CliqueConfig    `json:"clique,omitempty"`  // Proof-of-authority engine to switch to
+	IBFT    *IBFTConfig      `json:"ibft,omitempty"`    // Byzantine fault tolerant engine to switch to
+	Signers []common.Address `json:"signers,omitempty"` // Initial signers or validators of the proof-of-authority engine
+}
+
+// String implements the stringer interface, returning the consensus engine details.
+func (t *EngineTransition) String() string {
+	switch {
+	case t.Clique != nil:
+		return fmt.Sprintf("%v@%v", t.Clique, t.Block)
+	case t.IBFT != nil:
+		return fmt.Sprintf("%v@%v", t.IBFT, t.Block)
+	}
+	return fmt.Sprintf("ethash@%v", t.Block)
+}
+
+// PrecompileConfig activates a precompiled contract at a fork block, in addition
+// to the default precompiles of the Ethereum forks.
+type PrecompileConfig struct {
+	Block   *big.Int         `json:"block"`            // Activation block (0 = already activated)
+	Address common.Address   `json:"address"`          // Address to install the precompiled contract at
+	Name    string           `json:"name"`             // Name of the precompiled contract implementation
+	Admins  []common.Address `json:"admins,omitempty"` // Initial admins of the allow list precompile
+}
+
+// sameContract returns whether two precompile configs install the same contract,
+// regardless of their activation block.
+func (pc *PrecompileConfig) sameContract(other *PrecompileConfig) bool {
+	if pc.Name != other.Name || pc.Address != other.Address || len(pc.Admins) != len(other.Admins) {
+		return false
+	}
+	for i, admin := range pc.Admins {
+		if admin != other.Admins[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -326,9 +390,17 @@ func (c *ChainConfig) String() string {
 		engine = c.Ethash
 	case c.Clique != nil:
 		engine = c.Clique
+	case c.IBFT != nil:
+		engine = c.IBFT
 	default:
 		engine = "unknown"
 	}
+	if len(c.Transitions) > 0 {
+		engine = fmt.Sprintf("%v %v", engine, c.Transitions)
+	}
+	if len(c.Precompiles) > 0 {
+		engine = fmt.Sprintf("%v Precompiles: %d", engine, len(c.Precompiles))
+	}
 	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
@@ -345,6 +417,21 @@ func (c *ChainConfig) String() string {
 	)
 }
 
+// HasSignerContract returns whether any clique engine of the chain reads its signers
+// from a governance contract, whose checkpoints can only be verified against the
+// chain state.
+func (c *ChainConfig) HasSignerContract() bool {
+	if c.Clique != nil && c.Clique.SignerContract != nil {
+		return true
+	}
+	for _, t := range c.Transitions {
+		if t.Clique != nil && t.Clique.SignerContract != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // IsHomestead returns whether num is either equal to the homestead block or greater.
 func (c *ChainConfig) IsHomestead(num *big.Int) bool {
 	return isForked(c.HomesteadBlock, num)
@@ -392,6 +479,23 @@ func (c *ChainConfig) IsIstanbul(num *big.Int) bool {
 	return isForked(c.IstanbulBlock, num)
 }
 
+// HasPrecompiles returns whether any additional precompiled contract is active at
+// the given block number.
+func (c *ChainConfig) HasPrecompiles(num *big.Int) bool {
+	for _, pc := range c.Precompiles {
+		if c.IsPrecompileActive(pc, num) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPrecompileActive returns whether an additional precompiled contract is active
+// at the given block number.
+func (c *ChainConfig) IsPrecompileActive(pc *PrecompileConfig, num *big.Int) bool {
+	return isForked(pc.Block, num)
+}
+
 // IsEWASM returns whether num represents a block number after the EWASM fork
 func (c *ChainConfig) IsEWASM(num *big.Int) bool {
 	return isForked(c.EWASMBlock, num)
@@ -448,6 +552,34 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		}
 		lastFork = cur
 	}
+	// Consensus engine transitions must be scheduled in ascending order after genesis
+	var last *big.Int
+	for _, t := range c.Transitions {
+		if t.Block == nil || t.Block.Sign() <= 0 {
+			return fmt.Errorf("unsupported engine transition: %v not scheduled after genesis", t)
+		}
+		if last != nil && last.Cmp(t.Block) >= 0 {
+			return fmt.Errorf("unsupported engine transition ordering: %v scheduled at or before block %v", t, last)
+		}
+		if t.Clique != nil && t.IBFT != nil {
+			return fmt.Errorf("unsupported engine transition: both clique and ibft scheduled at block %v", t.Block)
+		}
+		if (t.Clique != nil || t.IBFT != nil) && len(t.Signers) == 0 {
+			return fmt.Errorf("unsupported engine transition: %v without initial signers", t)
+		}
+		last = t.Block
+	}
+	// Additional precompiles must be scheduled and must not clash with each other
+	installed := make(map[common.Address]bool)
+	for _, pc := range c.Precompiles {
+		if pc.Block == nil {
+			return fmt.Errorf("unsupported precompile %q at %x: activation block missing", pc.Name, pc.Address)
+		}
+		if installed[pc.Address] {
+			return fmt.Errorf("unsupported precompile %q at %x: address already used", pc.Name, pc.Address)
+		}
+		installed[pc.Address] = true
+	}
 	return nil
 }
 
@@ -488,6 +620,36 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	for i := 0; i < len(c.Transitions) || i < len(newcfg.Transitions); i++ {
+		var s1, s2 *big.Int
+		if i < len(c.Transitions) {
+			s1 = c.Transitions[i].Block
+		}
+		if i < len(newcfg.Transitions) {
+			s2 = newcfg.Transitions[i].Block
+		}
+		if isForkIncompatible(s1, s2, head) {
+			return newCompatError("consensus engine transition block", s1, s2)
+		}
+	}
+	for i := 0; i < len(c.Precompiles) || i < len(newcfg.Precompiles); i++ {
+		var (
+			p1, p2 *PrecompileConfig
+			s1, s2 *big.Int
+		)
+		if i < len(c.Precompiles) {
+			p1, s1 = c.Precompiles[i], c.Precompiles[i].Block
+		}
+		if i < len(newcfg.Precompiles) {
+			p2, s2 = newcfg.Precompiles[i], newcfg.Precompiles[i].Block
+		}
+		if isForkIncompatible(s1, s2, head) {
+			return newCompatError("precompile activation block", s1, s2)
+		}
+		if p1 != nil && p2 != nil && isForked(s1, head) && !p1.sameContract(p2) {
+			return newCompatError("precompile contract", s1, s2)
+		}
+	}
 	return nil
 }
 
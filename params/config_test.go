@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -70,6 +72,62 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     9,
 			},
 		},
+		{
+			stored:  &ChainConfig{Transitions: []*EngineTransition{{Block: big.NewInt(10)}}},
+			new:     &ChainConfig{Transitions: []*EngineTransition{{Block: big.NewInt(20)}}},
+			head:    9,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Transitions: []*EngineTransition{{Block: big.NewInt(10)}}},
+			new:    &ChainConfig{},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "consensus engine transition block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    nil,
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10)}}},
+			new:    &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(20)}}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "precompile activation block",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Name: "sha256"}}},
+			new:    &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Name: "blake2f"}}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "precompile contract",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored: &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Address: common.Address{1}}}},
+			new:    &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Address: common.Address{2}}}},
+			head:   15,
+			wantErr: &ConfigCompatError{
+				What:         "precompile contract",
+				StoredConfig: big.NewInt(10),
+				NewConfig:    big.NewInt(10),
+				RewindTo:     9,
+			},
+		},
+		{
+			stored:  &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Name: "sha256"}}},
+			new:     &ChainConfig{Precompiles: []*PrecompileConfig{{Block: big.NewInt(10), Name: "blake2f"}}},
+			head:    5,
+			wantErr: nil,
+		},
 	}
 
 	for _, test := range tests {
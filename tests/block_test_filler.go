@@ -0,0 +1,240 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BlockScenario describes a blockchain test to fill: the accounts of the genesis
+// block, the blocks built on top of it and the expected post state.
+type BlockScenario struct {
+	Name   string
+	Alloc  core.GenesisAlloc
+	Blocks []ScenarioBlock
+	Expect map[common.Address]ExpectedAccount
+}
+
+// ScenarioBlock describes a block of a scenario.
+type ScenarioBlock struct {
+	Coinbase common.Address
+	Extra    []byte
+	Txs      []TxTemplate
+}
+
+// TxTemplate describes a transaction of a scenario block. The nonce is filled in
+// from the state of the chain and the transaction is signed with the signer of
+// the fork the scenario is filled for.
+type TxTemplate struct {
+	Key      *ecdsa.PrivateKey
+	To       *common.Address // nil for contract creations
+	Value    *big.Int
+	Gas      uint64
+	GasPrice *big.Int
+	Data     []byte
+}
+
+// ExpectedAccount is an expectation on an account of the post state. As fees and
+// rewards differ between forks, only the fields set are checked.
+type ExpectedAccount struct {
+	Balance *big.Int
+	Nonce   *uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+// Fill generates the blocks of the scenario with the rules of the given fork and
+// returns them as a blockchain test.
+func (s *BlockScenario) Fill(fork string) (test *BlockTest, err error) {
+	config, ok := Forks[fork]
+	if !ok {
+		return nil, UnsupportedForkError{fork}
+	}
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		engine  = ethash.NewFaker()
+		genesis = &core.Genesis{
+			Config:     config,
+			GasLimit:   10000000,
+			Difficulty: params.MinimumDifficulty,
+			Alloc:      s.Alloc,
+		}
+		gblock = genesis.MustCommit(db)
+	)
+	// Generate the blocks, converting the panics of invalid transactions to errors
+	defer func() {
+		if r := recover(); r != nil {
+			test, err = nil, fmt.Errorf("%s/%s: %v", s.Name, fork, r)
+		}
+	}()
+	blocks, _ := core.GenerateChain(config, gblock, engine, db, len(s.Blocks), func(i int, b *core.BlockGen) {
+		spec := s.Blocks[i]
+		b.SetCoinbase(spec.Coinbase)
+		if len(spec.Extra) > 0 {
+			b.SetExtra(spec.Extra)
+		}
+		signer := types.MakeSigner(config, b.Number())
+		for j, tmpl := range spec.Txs {
+			var (
+				from  = crypto.PubkeyToAddress(tmpl.Key.PublicKey)
+				nonce = b.TxNonce(from)
+				value = tmpl.Value
+				price = tmpl.GasPrice
+				tx    *types.Transaction
+			)
+			if value == nil {
+				value = new(big.Int)
+			}
+			if price == nil {
+				price = big.NewInt(1)
+			}
+			if tmpl.To == nil {
+				tx = types.NewContractCreation(nonce, value, tmpl.Gas, price, tmpl.Data)
+			} else {
+				tx = types.NewTransaction(nonce, *tmpl.To, value, tmpl.Gas, price, tmpl.Data)
+			}
+			signed, err := types.SignTx(tx, signer, tmpl.Key)
+			if err != nil {
+				panic(fmt.Sprintf("block %d, tx %d: %v", i+1, j, err))
+			}
+			b.AddTx(signed)
+		}
+	})
+	// Import the blocks into a fresh chain to retrieve the post state
+	chaindb := rawdb.NewMemoryDatabase()
+	genesis.MustCommit(chaindb)
+
+	chain, err := core.NewBlockChain(chaindb, nil, config, engine, vm.Config{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		return nil, fmt.Errorf("%s/%s: block #%d import failed: %v", s.Name, fork, blocks[n].NumberU64(), err)
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkExpected(statedb); err != nil {
+		return nil, fmt.Errorf("%s/%s: %v", s.Name, fork, err)
+	}
+	// Assemble the test from the generated chain
+	test = &BlockTest{json: btJSON{
+		Genesis:    *newBtHeader(gblock.Header()),
+		Pre:        s.Alloc,
+		Post:       DumpAlloc(statedb),
+		BestBlock:  common.UnprefixedHash(chain.CurrentBlock().Hash()),
+		Network:    fork,
+		SealEngine: "NoProof",
+	}}
+	for _, block := range blocks {
+		enc, err := rlp.EncodeToBytes(block)
+		if err != nil {
+			return nil, err
+		}
+		uncles := make([]*btHeader, 0, len(block.Uncles()))
+		for _, uncle := range block.Uncles() {
+			uncles = append(uncles, newBtHeader(uncle))
+		}
+		test.json.Blocks = append(test.json.Blocks, btBlock{
+			BlockHeader:  newBtHeader(block.Header()),
+			Rlp:          hexutil.Encode(enc),
+			UncleHeaders: uncles,
+		})
+	}
+	return test, nil
+}
+
+// FillAll fills the scenario for every supported fork, returning the tests keyed
+// by scenario and fork name.
+func (s *BlockScenario) FillAll() (map[string]*BlockTest, error) {
+	tests := make(map[string]*BlockTest)
+	for _, fork := range AvailableForks() {
+		test, err := s.Fill(fork)
+		if err != nil {
+			return nil, err
+		}
+		tests[s.Name+"_"+fork] = test
+	}
+	return tests, nil
+}
+
+// checkExpected verifies the post state against the expectations of the scenario.
+func (s *BlockScenario) checkExpected(statedb *state.StateDB) error {
+	for addr, want := range s.Expect {
+		if want.Balance != nil {
+			if have := statedb.GetBalance(addr); have.Cmp(want.Balance) != 0 {
+				return fmt.Errorf("account %x balance mismatch: have %v, want %v", addr, have, want.Balance)
+			}
+		}
+		if want.Nonce != nil {
+			if have := statedb.GetNonce(addr); have != *want.Nonce {
+				return fmt.Errorf("account %x nonce mismatch: have %d, want %d", addr, have, *want.Nonce)
+			}
+		}
+		if want.Code != nil {
+			if have := statedb.GetCode(addr); !bytes.Equal(have, want.Code) {
+				return fmt.Errorf("account %x code mismatch: have %x, want %x", addr, have, want.Code)
+			}
+		}
+		for key, val := range want.Storage {
+			if have := statedb.GetState(addr, key); have != val {
+				return fmt.Errorf("account %x storage %x mismatch: have %x, want %x", addr, key, have, val)
+			}
+		}
+	}
+	return nil
+}
+
+// newBtHeader converts a block header into its test representation.
+func newBtHeader(h *types.Header) *btHeader {
+	return &btHeader{
+		Bloom:            h.Bloom,
+		Coinbase:         h.Coinbase,
+		MixHash:          h.MixDigest,
+		Nonce:            h.Nonce,
+		Number:           new(big.Int).Set(h.Number),
+		Hash:             h.Hash(),
+		ParentHash:       h.ParentHash,
+		ReceiptTrie:      h.ReceiptHash,
+		StateRoot:        h.Root,
+		TransactionsTrie: h.TxHash,
+		UncleHash:        h.UncleHash,
+		ExtraData:        common.CopyBytes(h.Extra),
+		Difficulty:       new(big.Int).Set(h.Difficulty),
+		GasLimit:         h.GasLimit,
+		GasUsed:          h.GasUsed,
+		Timestamp:        h.Time,
+	}
+}
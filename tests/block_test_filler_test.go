@@ -0,0 +1,69 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tests that the filled blockchain tests of all scenarios pass when read back
+// from their JSON encoding, for every supported fork.
+func TestBlockScenarioFill(t *testing.T) {
+	for _, scenario := range BlockScenarios {
+		filled, err := scenario.FillAll()
+		if err != nil {
+			t.Fatalf("failed to fill scenario %s: %v", scenario.Name, err)
+		}
+		if len(filled) != len(Forks) {
+			t.Errorf("%s: filled test count mismatch: have %d, want %d", scenario.Name, len(filled), len(Forks))
+		}
+		blob, err := json.Marshal(filled)
+		if err != nil {
+			t.Fatalf("failed to encode scenario %s: %v", scenario.Name, err)
+		}
+		var tests map[string]*BlockTest
+		if err := json.Unmarshal(blob, &tests); err != nil {
+			t.Fatalf("failed to decode scenario %s: %v", scenario.Name, err)
+		}
+		for name, test := range tests {
+			if len(test.json.Blocks) != len(scenario.Blocks) {
+				t.Errorf("%s: block count mismatch: have %d, want %d", name, len(test.json.Blocks), len(scenario.Blocks))
+			}
+			if err := test.Run(); err != nil {
+				t.Errorf("%s: filled test failed: %v", name, err)
+			}
+		}
+	}
+}
+
+// Tests that filling fails if the post state doesn't meet the expectations.
+func TestBlockScenarioExpectations(t *testing.T) {
+	scenario := *BlockScenarios[0]
+	scenario.Expect = map[common.Address]ExpectedAccount{
+		scenarioPayee: {Balance: big.NewInt(1)},
+	}
+	if _, err := scenario.Fill("Istanbul"); err == nil {
+		t.Fatal("mismatching post state accepted")
+	}
+	if _, err := scenario.Fill("Unknown"); err == nil {
+		t.Fatal("unknown fork accepted")
+	}
+}
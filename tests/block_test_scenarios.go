@@ -0,0 +1,81 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tests
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	scenarioKey, _  = crypto.HexToECDSA("45a915e4d060149eb4365960e6a7a45f334393093061116b197e3240065ff2d8")
+	scenarioAddr    = crypto.PubkeyToAddress(scenarioKey.PublicKey)
+	scenarioFunds   = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+	scenarioMiner   = common.HexToAddress("0x2adc25665018aa1fe0e6bc666dac8fc2697ff9ba")
+	scenarioPayee   = common.HexToAddress("0x095e7baea6a6c7c4c2dfeb977efac326af552d87")
+	scenarioCreated = crypto.CreateAddress(scenarioAddr, 1)
+
+	scenarioNonce = uint64(2)
+)
+
+// BlockScenarios are the scenarios the blockchain tests of the test suite are
+// filled from.
+var BlockScenarios = []*BlockScenario{
+	{
+		Name:  "valueTransfer",
+		Alloc: core.GenesisAlloc{scenarioAddr: {Balance: scenarioFunds}},
+		Blocks: []ScenarioBlock{
+			{
+				Coinbase: scenarioMiner,
+				Txs: []TxTemplate{
+					{Key: scenarioKey, To: &scenarioPayee, Value: big.NewInt(1000), Gas: params.TxGas},
+					{Key: scenarioKey, To: &scenarioPayee, Value: big.NewInt(2000), Gas: params.TxGas},
+				},
+			},
+			{Coinbase: scenarioMiner},
+		},
+		Expect: map[common.Address]ExpectedAccount{
+			scenarioPayee: {Balance: big.NewInt(3000)},
+			scenarioAddr:  {Nonce: &scenarioNonce},
+		},
+	},
+	{
+		Name:  "contractStorage",
+		Alloc: core.GenesisAlloc{scenarioAddr: {Balance: scenarioFunds}},
+		Blocks: []ScenarioBlock{
+			{
+				Coinbase: scenarioMiner,
+				Extra:    []byte("contractStorage"),
+				Txs: []TxTemplate{
+					{Key: scenarioKey, To: &scenarioPayee, Value: big.NewInt(1), Gas: params.TxGas},
+					// sstore(0, 42), leaving an empty contract behind
+					{Key: scenarioKey, Gas: 100000, Data: common.FromHex("602a60005500")},
+				},
+			},
+		},
+		Expect: map[common.Address]ExpectedAccount{
+			scenarioCreated: {
+				Code:    []byte{},
+				Storage: map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(42))},
+			},
+		},
+	},
+}
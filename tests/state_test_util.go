@@ -110,11 +110,11 @@ type stTransactionMarshaling struct {
 	PrivateKey hexutil.Bytes
 }
 
-// getVMConfig takes a fork definition and returns a chain config.
+// GetChainConfig takes a fork definition and returns a chain config.
 // The fork definition can be
 // - a plain forkname, e.g. `Byzantium`,
 // - a fork basename, and a list of EIPs to enable; e.g. `Byzantium+1884+1283`.
-func getVMConfig(forkString string) (baseConfig *params.ChainConfig, eips []int, err error) {
+func GetChainConfig(forkString string) (baseConfig *params.ChainConfig, eips []int, err error) {
 	var (
 		splitForks            = strings.Split(forkString, "+")
 		ok                    bool
@@ -164,7 +164,7 @@ func (t *StateTest) Run(subtest StateSubtest, vmconfig vm.Config) (*state.StateD
 
 // RunNoVerify runs a specific subtest and returns the statedb and post-state root
 func (t *StateTest) RunNoVerify(subtest StateSubtest, vmconfig vm.Config) (*state.StateDB, common.Hash, error) {
-	config, eips, err := getVMConfig(subtest.Fork)
+	config, eips, err := GetChainConfig(subtest.Fork)
 	if err != nil {
 		return nil, common.Hash{}, UnsupportedForkError{subtest.Fork}
 	}
@@ -221,6 +221,28 @@ func MakePreState(db ethdb.Database, accounts core.GenesisAlloc) *state.StateDB
 	return statedb
 }
 
+// DumpAlloc converts the accounts of a state into the genesis allocation format,
+// the inverse of MakePreState.
+func DumpAlloc(statedb *state.StateDB) core.GenesisAlloc {
+	alloc := make(core.GenesisAlloc)
+	for addr, account := range statedb.RawDump(false, false, true).Accounts {
+		balance, _ := new(big.Int).SetString(account.Balance, 10)
+		genesisAccount := core.GenesisAccount{
+			Code:    common.FromHex(account.Code),
+			Balance: balance,
+			Nonce:   account.Nonce,
+		}
+		if len(account.Storage) > 0 {
+			genesisAccount.Storage = make(map[common.Hash]common.Hash)
+			for key, value := range account.Storage {
+				genesisAccount.Storage[key] = common.HexToHash(value)
+			}
+		}
+		alloc[addr] = genesisAccount
+	}
+	return alloc
+}
+
 func (t *StateTest) genesis(config *params.ChainConfig) *core.Genesis {
 	return &core.Genesis{
 		Config:     config,